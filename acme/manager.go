@@ -0,0 +1,482 @@
+// Package acme gets TLS certificates from a certificate authority that
+// speaks ACME (RFC 8555), like Let's Encrypt or a local pebble instance. It
+// proves control of names with the tls-alpn-01 challenge, answered on the
+// TLS listener the certificates are for, so no other port is needed. The
+// protocol itself is spoken by golang.org/x/crypto/acme.
+package acme
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	atomicfile "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/facebookgo/atomicfile"
+	xacme "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/crypto/acme"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	logging "github.com/ipfs/go-ipfs/vendor/go-log-v1.0.0"
+)
+
+var log = logging.Logger("acme")
+
+// ALPNProto is the protocol ACME servers negotiate to validate tls-alpn-01
+// challenges.
+const ALPNProto = xacme.ALPNProto
+
+// DefaultRenewBefore is how long before they expire certificates are
+// renewed, unless a Manager says otherwise.
+const DefaultRenewBefore = 30 * 24 * time.Hour
+
+// DefaultRetryAfter is how long a name waits after getting a certificate
+// for it failed, unless a Manager says otherwise.
+const DefaultRetryAfter = time.Hour
+
+// obtainTimeout bounds getting a certificate while a handshake waits.
+const obtainTimeout = 2 * time.Minute
+
+const accountKeyFile = "account.key"
+
+// Manager serves certificates it gets from an ACME server, by the name
+// clients ask for with SNI. Its GetCertificate goes in a tls.Config, and
+// answers the server's challenges on the same listener.
+type Manager struct {
+	Client *xacme.Client
+
+	// Email is the contact for the account, and may be empty.
+	Email string
+
+	// CacheDir keeps the account key and the certificates across restarts.
+	// If empty, certificates only live in memory.
+	CacheDir string
+
+	// HostPolicy returns an error for names the manager must not get
+	// certificates for. A nil HostPolicy refuses every name.
+	HostPolicy func(ctx context.Context, host string) error
+
+	// RenewBefore is how long before they expire certificates are renewed,
+	// DefaultRenewBefore if zero.
+	RenewBefore time.Duration
+
+	// RetryAfter is how long after getting a certificate for a name failed
+	// it is tried again, DefaultRetryAfter if zero. Handshakes for the name
+	// meanwhile get no certificate, so clients can't make the manager hit
+	// the server's rate limits.
+	RetryAfter time.Duration
+
+	regLk      sync.Mutex
+	registered bool
+
+	lk         sync.Mutex
+	certs      map[string]*tls.Certificate
+	pending    map[string]*obtainCall
+	renewing   map[string]bool
+	failed     map[string]time.Time
+	challenges map[string]*tls.Certificate
+}
+
+type obtainCall struct {
+	done chan struct{}
+	cert *tls.Certificate
+	err  error
+}
+
+// NewManager returns a manager for the ACME server whose directory is at
+// directoryURL, keeping its account key and certificates in cacheDir. The
+// account key is created on first use.
+func NewManager(directoryURL, cacheDir string) (*Manager, error) {
+	m := &Manager{CacheDir: cacheDir}
+
+	var key *ecdsa.PrivateKey
+	if cacheDir != "" {
+		if err := os.MkdirAll(cacheDir, 0700); err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(filepath.Join(cacheDir, accountKeyFile))
+		switch {
+		case err == nil:
+			if key, err = parseKey(data); err != nil {
+				return nil, fmt.Errorf("acme: reading the account key: %s", err)
+			}
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+	}
+	if key == nil {
+		var err error
+		if key, err = generateKey(); err != nil {
+			return nil, err
+		}
+		if cacheDir != "" {
+			if err := m.writeFile(accountKeyFile, encodeKey(key)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	m.Client = &xacme.Client{DirectoryURL: directoryURL, Key: key}
+	return m, nil
+}
+
+// TLSConfig returns a tls.Config that gets its certificates from m.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"http/1.1", ALPNProto},
+	}
+}
+
+// GetCertificate returns the certificate for the name in hello, getting
+// one from the ACME server if needed. It returns no certificate, and no
+// error, for names HostPolicy refuses, so a tls.Config can fall back to its
+// Certificates.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		return nil, nil
+	}
+	if !validName(name) {
+		return nil, fmt.Errorf("acme: invalid server name %q", hello.ServerName)
+	}
+
+	if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == ALPNProto {
+		m.lk.Lock()
+		cert, ok := m.challenges[name]
+		m.lk.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("acme: no challenge for %s", name)
+		}
+		return cert, nil
+	}
+
+	if cert, ok := m.cached(name); ok {
+		return cert, nil
+	}
+
+	if m.failedRecently(name) {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), obtainTimeout)
+	defer cancel()
+	if m.HostPolicy == nil || m.HostPolicy(ctx, name) != nil {
+		return nil, nil
+	}
+	return m.obtain(ctx, name)
+}
+
+// cached returns the certificate for name from memory or the cache
+// directory, starting its renewal if it expires soon.
+func (m *Manager) cached(name string) (*tls.Certificate, bool) {
+	m.lk.Lock()
+	cert, ok := m.certs[name]
+	m.lk.Unlock()
+
+	if !ok && m.CacheDir != "" {
+		data, err := ioutil.ReadFile(filepath.Join(m.CacheDir, name+".pem"))
+		if err != nil {
+			return nil, false
+		}
+		if cert, err = parseCert(data); err != nil {
+			log.Errorf("acme: ignoring the cached certificate for %s: %s", name, err)
+			return nil, false
+		}
+		m.lk.Lock()
+		if m.certs == nil {
+			m.certs = make(map[string]*tls.Certificate)
+		}
+		m.certs[name] = cert
+		m.lk.Unlock()
+	}
+	if cert == nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	if now.After(cert.Leaf.NotAfter) {
+		return nil, false
+	}
+	renewBefore := m.RenewBefore
+	if renewBefore == 0 {
+		renewBefore = DefaultRenewBefore
+	}
+	if now.Add(renewBefore).After(cert.Leaf.NotAfter) {
+		m.renew(name)
+	}
+	return cert, true
+}
+
+// failedRecently returns whether getting a certificate for name failed
+// less than RetryAfter ago.
+func (m *Manager) failedRecently(name string) bool {
+	retryAfter := m.RetryAfter
+	if retryAfter == 0 {
+		retryAfter = DefaultRetryAfter
+	}
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	t, ok := m.failed[name]
+	return ok && time.Since(t) < retryAfter
+}
+
+// renew gets a new certificate for name in the background.
+func (m *Manager) renew(name string) {
+	if m.failedRecently(name) {
+		return
+	}
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if m.renewing[name] {
+		return
+	}
+	if m.renewing == nil {
+		m.renewing = make(map[string]bool)
+	}
+	m.renewing[name] = true
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), obtainTimeout)
+		defer cancel()
+		if _, err := m.obtain(ctx, name); err != nil {
+			log.Errorf("acme: renewing the certificate for %s: %s", name, err)
+		}
+
+		m.lk.Lock()
+		delete(m.renewing, name)
+		m.lk.Unlock()
+	}()
+}
+
+// obtain gets a certificate for name from the ACME server, once at a time.
+func (m *Manager) obtain(ctx context.Context, name string) (*tls.Certificate, error) {
+	m.lk.Lock()
+	if call, ok := m.pending[name]; ok {
+		m.lk.Unlock()
+		select {
+		case <-call.done:
+			return call.cert, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if m.pending == nil {
+		m.pending = make(map[string]*obtainCall)
+	}
+	call := &obtainCall{done: make(chan struct{})}
+	m.pending[name] = call
+	m.lk.Unlock()
+
+	call.cert, call.err = m.request(ctx, name)
+
+	m.lk.Lock()
+	delete(m.pending, name)
+	if call.err == nil {
+		if m.certs == nil {
+			m.certs = make(map[string]*tls.Certificate)
+		}
+		m.certs[name] = call.cert
+		delete(m.failed, name)
+	} else {
+		if m.failed == nil {
+			m.failed = make(map[string]time.Time)
+		}
+		m.failed[name] = time.Now()
+	}
+	m.lk.Unlock()
+	close(call.done)
+	return call.cert, call.err
+}
+
+func (m *Manager) request(ctx context.Context, name string) (*tls.Certificate, error) {
+	if err := m.register(ctx); err != nil {
+		return nil, err
+	}
+
+	o, err := m.Client.AuthorizeOrder(ctx, xacme.DomainIDs(name))
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range o.AuthzURLs {
+		if err := m.authorize(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: name},
+		DNSNames: []string{name},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	chain, _, err := m.Client.CreateOrderCert(ctx, o.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write(encodeKey(key))
+	for _, der := range chain {
+		pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	cert, err := parseCert(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if m.CacheDir != "" {
+		if err := m.writeFile(name+".pem", buf.Bytes()); err != nil {
+			log.Errorf("acme: caching the certificate for %s: %s", name, err)
+		}
+	}
+	return cert, nil
+}
+
+// authorize answers the tls-alpn-01 challenge of the authorization at url,
+// unless it is already valid, and waits for the result.
+func (m *Manager) authorize(ctx context.Context, url string) error {
+	authz, err := m.Client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	}
+	if authz.Status == xacme.StatusValid {
+		return nil
+	}
+
+	name := authz.Identifier.Value
+	var chal *xacme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "tls-alpn-01" {
+			chal = c
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("acme: the server offers no tls-alpn-01 challenge for %s", name)
+	}
+
+	cert, err := m.Client.TLSALPN01ChallengeCert(chal.Token, name)
+	if err != nil {
+		return err
+	}
+	m.present(name, &cert)
+	defer m.cleanUp(name)
+
+	if _, err := m.Client.Accept(ctx, chal); err != nil {
+		return err
+	}
+	_, err = m.Client.WaitAuthorization(ctx, url)
+	return err
+}
+
+func (m *Manager) register(ctx context.Context) error {
+	m.regLk.Lock()
+	defer m.regLk.Unlock()
+	if m.registered {
+		return nil
+	}
+
+	acct := &xacme.Account{}
+	if m.Email != "" {
+		acct.Contact = []string{"mailto:" + m.Email}
+	}
+	_, err := m.Client.Register(ctx, acct, xacme.AcceptTOS)
+	if err != nil && err != xacme.ErrAccountAlreadyExists {
+		return err
+	}
+	m.registered = true
+	return nil
+}
+
+// present serves cert to the ACME server's tls-alpn-01 handshakes for name.
+func (m *Manager) present(name string, cert *tls.Certificate) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if m.challenges == nil {
+		m.challenges = make(map[string]*tls.Certificate)
+	}
+	m.challenges[name] = cert
+}
+
+// cleanUp stops serving the challenge certificate for name.
+func (m *Manager) cleanUp(name string) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	delete(m.challenges, name)
+}
+
+func (m *Manager) writeFile(name string, data []byte) error {
+	f, err := atomicfile.New(filepath.Join(m.CacheDir, name), 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Close()
+}
+
+// validName returns whether name can be a DNS name, and so a file name in
+// the cache.
+func validName(name string) bool {
+	if len(name) > 253 || strings.HasPrefix(name, ".") || strings.Contains(name, "..") {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// generateKey returns a new key for an account or a certificate.
+func generateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func encodeKey(key *ecdsa.PrivateKey) []byte {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		// only fails for keys on unknown curves
+		panic(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func parseKey(data []byte) (*ecdsa.PrivateKey, error) {
+	b, _ := pem.Decode(data)
+	if b == nil || b.Type != "EC PRIVATE KEY" {
+		return nil, errors.New("expected an EC PRIVATE KEY")
+	}
+	return x509.ParseECPrivateKey(b.Bytes)
+}
+
+// parseCert parses a PEM key and certificate chain.
+func parseCert(data []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
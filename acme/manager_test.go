@@ -0,0 +1,469 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	xacme "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/crypto/acme"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// fakeCA is an ACME server that validates tls-alpn-01 challenges by dialing
+// target, and checks the signatures of the requests it gets.
+type fakeCA struct {
+	t      *testing.T
+	srv    *httptest.Server
+	target string
+
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+
+	lk       sync.Mutex
+	nonce    int
+	nonces   map[string]bool
+	accounts map[string]*ecdsa.PublicKey
+	orders   map[string]*fakeOrder
+	authzs   map[string]*fakeAuthz
+	badNonce bool // refuse the next request for its nonce
+}
+
+type fakeOrder struct {
+	names  []string
+	status string
+	authzs []string
+	cert   []byte
+}
+
+type fakeAuthz struct {
+	name   string
+	token  string
+	status string
+	jwk    *ecdsa.PublicKey
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	key, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := &fakeCA{
+		t:        t,
+		key:      key,
+		cert:     cert,
+		nonces:   make(map[string]bool),
+		accounts: make(map[string]*ecdsa.PublicKey),
+		orders:   make(map[string]*fakeOrder),
+		authzs:   make(map[string]*fakeAuthz),
+	}
+	ca.srv = httptest.NewTLSServer(http.HandlerFunc(ca.serve))
+	return ca
+}
+
+func (ca *fakeCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func (ca *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	ca.lk.Lock()
+	defer ca.lk.Unlock()
+
+	ca.nonce++
+	n := fmt.Sprint("nonce", ca.nonce)
+	ca.nonces[n] = true
+	w.Header().Set("Replay-Nonce", n)
+
+	u := ca.srv.URL
+	switch {
+	case r.URL.Path == "/dir":
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   u + "/nonce",
+			"newAccount": u + "/account",
+			"newOrder":   u + "/order",
+		})
+		return
+	case r.URL.Path == "/nonce":
+		return
+	}
+
+	payload, kid, jwk, err := ca.verify(r)
+	if err != nil {
+		ca.problem(w, "malformed", err.Error())
+		return
+	}
+	if ca.badNonce {
+		ca.badNonce = false
+		ca.problem(w, "badNonce", "try again")
+		return
+	}
+
+	id := filepath.Base(r.URL.Path)
+	switch {
+	case r.URL.Path == "/account":
+		if jwk == nil {
+			ca.problem(w, "malformed", "expected a jwk")
+			return
+		}
+		kid := fmt.Sprintf("%s/acct/%d", u, len(ca.accounts))
+		ca.accounts[kid] = jwk
+		w.Header().Set("Location", kid)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+
+	case r.URL.Path == "/order":
+		var req struct {
+			Identifiers []struct{ Value string }
+		}
+		json.Unmarshal(payload, &req)
+		oid := fmt.Sprint(len(ca.orders))
+		o := &fakeOrder{status: "pending"}
+		for _, ident := range req.Identifiers {
+			aid := fmt.Sprint(len(ca.authzs))
+			ca.authzs[aid] = &fakeAuthz{
+				name:   ident.Value,
+				token:  "token" + aid,
+				status: "pending",
+				jwk:    ca.accounts[kid],
+			}
+			o.names = append(o.names, ident.Value)
+			o.authzs = append(o.authzs, u+"/authz/"+aid)
+		}
+		ca.orders[oid] = o
+		w.Header().Set("Location", u+"/order/"+oid)
+		w.WriteHeader(http.StatusCreated)
+		ca.writeOrder(w, oid)
+
+	case strings.HasPrefix(r.URL.Path, "/order/"):
+		ca.writeOrder(w, id)
+
+	case strings.HasPrefix(r.URL.Path, "/authz/"):
+		a := ca.authzs[id]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     a.status,
+			"identifier": map[string]string{"type": "dns", "value": a.name},
+			"challenges": []map[string]string{
+				{"type": "http-01", "url": u + "/chal/x", "token": "unused", "status": "pending"},
+				{"type": "tls-alpn-01", "url": u + "/chal/" + id, "token": a.token, "status": a.status},
+			},
+		})
+
+	case strings.HasPrefix(r.URL.Path, "/chal/"):
+		a := ca.authzs[id]
+		a.status = "valid"
+		if err := ca.validate(a); err != nil {
+			ca.t.Logf("challenge for %s failed: %s", a.name, err)
+			a.status = "invalid"
+		}
+		w.Write([]byte("{}"))
+
+	case strings.HasPrefix(r.URL.Path, "/finalize/"):
+		o := ca.orders[id]
+		for _, aurl := range o.authzs {
+			if ca.authzs[filepath.Base(aurl)].status != "valid" {
+				ca.problem(w, "orderNotReady", "not authorized")
+				return
+			}
+		}
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || strings.Join(csr.DNSNames, ",") != strings.Join(o.names, ",") {
+			ca.problem(w, "badCSR", fmt.Sprint("bad csr ", err))
+			return
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(ca.nonce)),
+			Subject:      pkix.Name{CommonName: o.names[0]},
+			DNSNames:     o.names,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if o.cert, err = x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key); err != nil {
+			ca.t.Fatal(err)
+		}
+		o.status = "valid"
+		ca.writeOrder(w, id)
+
+	case strings.HasPrefix(r.URL.Path, "/cert/"):
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.orders[id].cert})
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (ca *fakeCA) writeOrder(w http.ResponseWriter, id string) {
+	o := ca.orders[id]
+	res := map[string]interface{}{
+		"status":         o.status,
+		"authorizations": o.authzs,
+		"finalize":       ca.srv.URL + "/finalize/" + id,
+	}
+	if o.cert != nil {
+		res["certificate"] = ca.srv.URL + "/cert/" + id
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func (ca *fakeCA) problem(w http.ResponseWriter, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"type":   "urn:ietf:params:acme:error:" + typ,
+		"detail": detail,
+	})
+}
+
+// verify checks the JWS of r, and returns its payload and signer.
+func (ca *fakeCA) verify(r *http.Request) (payload []byte, kid string, jwk *ecdsa.PublicKey, err error) {
+	var jws struct{ Protected, Payload, Signature string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, "", nil, err
+	}
+	ph, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var hdr struct {
+		Alg, Nonce, URL, Kid string
+		JWK                  *struct{ Crv, Kty, X, Y string }
+	}
+	if err := json.Unmarshal(ph, &hdr); err != nil {
+		return nil, "", nil, err
+	}
+	if hdr.Alg != "ES256" || hdr.URL != ca.srv.URL+r.URL.Path {
+		return nil, "", nil, fmt.Errorf("bad header %s", ph)
+	}
+	if !ca.nonces[hdr.Nonce] {
+		return nil, "", nil, fmt.Errorf("unknown nonce %q", hdr.Nonce)
+	}
+	delete(ca.nonces, hdr.Nonce)
+
+	key := ca.accounts[hdr.Kid]
+	if hdr.JWK != nil {
+		x, _ := base64.RawURLEncoding.DecodeString(hdr.JWK.X)
+		y, _ := base64.RawURLEncoding.DecodeString(hdr.JWK.Y)
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		jwk = key
+	}
+	if key == nil {
+		return nil, "", nil, errors.New("unknown account")
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	sum := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if len(sig) != 64 || !ecdsa.Verify(key, sum[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, "", nil, errors.New("bad signature")
+	}
+	payload, _ = base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload, hdr.Kid, jwk, nil
+}
+
+// idPeAcmeIdentifier is the extension tls-alpn-01 certificates carry the key
+// authorization digest in.
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// validate does the tls-alpn-01 handshake for a.
+func (ca *fakeCA) validate(a *fakeAuthz) error {
+	conn, err := tls.Dial("tcp", ca.target, &tls.Config{
+		ServerName:         a.name,
+		NextProtos:         []string{ALPNProto},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != ALPNProto {
+		return fmt.Errorf("negotiated %q", state.NegotiatedProtocol)
+	}
+	leaf := state.PeerCertificates[0]
+	if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != a.name {
+		return fmt.Errorf("certificate is for %v", leaf.DNSNames)
+	}
+
+	thumb, _ := xacme.JWKThumbprint(a.jwk)
+	sum := sha256.Sum256([]byte(a.token + "." + thumb))
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(idPeAcmeIdentifier) {
+			continue
+		}
+		var got []byte
+		if _, err := asn1.Unmarshal(ext.Value, &got); err != nil || !bytes.Equal(got, sum[:]) || !ext.Critical {
+			return errors.New("wrong key authorization")
+		}
+		return nil
+	}
+	return errors.New("no acmeIdentifier extension")
+}
+
+func TestManager(t *testing.T) {
+	ca := newFakeCA(t)
+	defer ca.srv.Close()
+	ca.badNonce = true
+
+	dir, err := ioutil.TempDir("", "acme-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newManager := func() *Manager {
+		m, err := NewManager(ca.srv.URL+"/dir", dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Client.HTTPClient = ca.srv.Client()
+		m.HostPolicy = func(ctx context.Context, host string) error {
+			if host != "example.test" {
+				return errors.New("not allowed")
+			}
+			return nil
+		}
+		return m
+	}
+	m := newManager()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", m.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	ca.target = ln.Addr().String()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: ca.pool(), ServerName: "example.test"},
+	}}
+	res, err := client.Get("https://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "hello" {
+		t.Fatalf("got %q", body)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "example.test.pem")); err != nil {
+		t.Fatal("the certificate was not cached: ", err)
+	}
+
+	// names the policy refuses get no certificate
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.test"})
+	if cert != nil || err != nil {
+		t.Fatalf("got %v, %v for a refused name", cert, err)
+	}
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "../x"}); err == nil {
+		t.Fatal("expected an error for an invalid name")
+	}
+
+	// a new manager finds the account key and certificate in the cache
+	m2 := newManager()
+	if m2.Client.Key.(*ecdsa.PrivateKey).X.Cmp(m.Client.Key.(*ecdsa.PrivateKey).X) != 0 {
+		t.Fatal("the account key was not reused")
+	}
+	cert, err = m2.GetCertificate(&tls.ClientHelloInfo{ServerName: "Example.Test."})
+	if err != nil || cert == nil {
+		t.Fatalf("no cached certificate: %v", err)
+	}
+	if len(ca.orders) != 1 {
+		t.Fatalf("expected 1 order, got %d", len(ca.orders))
+	}
+}
+
+func TestManagerRetryAfter(t *testing.T) {
+	var lk sync.Mutex
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lk.Lock()
+		requests++
+		lk.Unlock()
+		http.Error(w, "no", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	m, err := NewManager(srv.URL+"/dir", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.HostPolicy = func(ctx context.Context, host string) error { return nil }
+
+	hello := &tls.ClientHelloInfo{ServerName: "example.test"}
+	if _, err := m.GetCertificate(hello); err == nil {
+		t.Fatal("expected an error from a failing server")
+	}
+	lk.Lock()
+	n := requests
+	lk.Unlock()
+	if n == 0 {
+		t.Fatal("the server got no requests")
+	}
+
+	// a failed name is not tried again until RetryAfter passes
+	cert, err := m.GetCertificate(hello)
+	if cert != nil || err != nil {
+		t.Fatalf("got %v, %v for a name that failed", cert, err)
+	}
+	lk.Lock()
+	if requests != n {
+		t.Fatalf("the server got %d more requests", requests-n)
+	}
+	lk.Unlock()
+
+	m.RetryAfter = time.Nanosecond
+	if _, err := m.GetCertificate(hello); err == nil {
+		t.Fatal("expected an error from a failing server")
+	}
+	lk.Lock()
+	if requests == n {
+		t.Fatal("the name was not tried again after RetryAfter")
+	}
+	lk.Unlock()
+}
@@ -0,0 +1,237 @@
+// Package apitoken stores the tokens that authenticate HTTP API clients,
+// along with the commands each of them may call.
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	query "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+)
+
+// ErrInvalidToken is returned when looking up a token that was never
+// created or has been revoked.
+var ErrInvalidToken = errors.New("invalid api token")
+
+// ErrNoSuchToken is returned when revoking a token that does not exist.
+var ErrNoSuchToken = errors.New("no token by the given name was found")
+
+// ErrTokenExists is returned when creating a token with a name in use.
+var ErrTokenExists = errors.New("token by that name already exists")
+
+// tokenPrefix is where tokens are kept in the datastore, by the hash of
+// their secret.
+var tokenPrefix = ds.NewKey("/local/apitokens")
+
+// Token describes what the holder of an api token may do.
+type Token struct {
+	Name string
+
+	// ReadOnly limits the token to the commands of the read-only api.
+	ReadOnly bool
+
+	// Allow lists the commands the token may call, by path, like
+	// "name/resolve". A command allows all of its subcommands, and an empty
+	// list allows every command.
+	Allow []string `json:",omitempty"`
+}
+
+// Allows returns whether the token may call the command at path. Only
+// unrestricted tokens may manage tokens, so no token can create one with
+// more rights than its own.
+func (t *Token) Allows(path []string) bool {
+	if managesTokens(path) {
+		return t.Unrestricted()
+	}
+	if len(t.Allow) == 0 {
+		return true
+	}
+
+	for _, a := range t.Allow {
+		parts := splitPath(a)
+		if len(parts) == 0 || len(parts) > len(path) {
+			continue
+		}
+		match := true
+		for i, p := range parts {
+			if path[i] != p {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Unrestricted returns whether the token may call every command.
+func (t *Token) Unrestricted() bool {
+	return !t.ReadOnly && len(t.Allow) == 0
+}
+
+// managesTokens returns whether path is a command that manages tokens, or
+// one of their parents.
+func managesTokens(path []string) bool {
+	tokenCmd := []string{"api", "token"}
+	for i := range path {
+		if i >= len(tokenCmd) {
+			return true
+		}
+		if path[i] != tokenCmd[i] {
+			return false
+		}
+	}
+	return len(path) > 0
+}
+
+// splitPath splits a command path given as "name/resolve" or "name resolve".
+func splitPath(p string) []string {
+	return strings.Fields(strings.Replace(p, "/", " ", -1))
+}
+
+// Store keeps tokens in a datastore. Only hashes of the secrets are stored,
+// so a secret is known only to whoever created the token.
+type Store struct {
+	lk sync.Mutex
+	ds ds.Datastore
+}
+
+// NewStore returns a token store kept in d.
+func NewStore(d ds.Datastore) *Store {
+	return &Store{ds: d}
+}
+
+// Create stores t and returns the secret that authenticates as it.
+func (s *Store) Create(t Token) (string, error) {
+	if t.Name == "" {
+		return "", errors.New("token name must not be empty")
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	tokens, err := s.list()
+	if err != nil {
+		return "", err
+	}
+	for _, e := range tokens {
+		if e.tok.Name == t.Name {
+			return "", ErrTokenExists
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(buf)
+
+	data, err := json.Marshal(&t)
+	if err != nil {
+		return "", err
+	}
+	if err := s.ds.Put(secretKey(secret), data); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Revoke deletes the token named name.
+func (s *Store) Revoke(name string) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	tokens, err := s.list()
+	if err != nil {
+		return err
+	}
+	for _, e := range tokens {
+		if e.tok.Name == name {
+			return s.ds.Delete(e.key)
+		}
+	}
+	return ErrNoSuchToken
+}
+
+// List returns every token, without their secrets.
+func (s *Store) List() ([]Token, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	tokens, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Token, len(tokens))
+	for i, e := range tokens {
+		out[i] = e.tok
+	}
+	return out, nil
+}
+
+// Lookup returns the token secret authenticates as.
+func (s *Store) Lookup(secret string) (*Token, error) {
+	if secret == "" {
+		return nil, ErrInvalidToken
+	}
+
+	v, err := s.ds.Get(secretKey(secret))
+	if err == ds.ErrNotFound {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeToken(v)
+}
+
+type storedToken struct {
+	key ds.Key
+	tok Token
+}
+
+func (s *Store) list() ([]storedToken, error) {
+	res, err := s.ds.Query(query.Query{Prefix: tokenPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []storedToken
+	for _, e := range entries {
+		t, err := decodeToken(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, storedToken{ds.NewKey(e.Key), *t})
+	}
+	return out, nil
+}
+
+func decodeToken(v interface{}) (*Token, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, errors.New("api token stored as a non []byte value")
+	}
+	t := new(Token)
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func secretKey(secret string) ds.Key {
+	h := sha256.Sum256([]byte(secret))
+	return tokenPrefix.ChildString(hex.EncodeToString(h[:]))
+}
@@ -0,0 +1,91 @@
+package apitoken
+
+import (
+	"testing"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+
+	secret, err := s.Create(Token{Name: "ci", Allow: []string{"cat", "name/resolve"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(Token{Name: "ci"}); err != ErrTokenExists {
+		t.Fatalf("expected ErrTokenExists, got %v", err)
+	}
+	if _, err := s.Create(Token{Name: "ro", ReadOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := s.Lookup(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Name != "ci" {
+		t.Fatalf("looked up token %q", tok.Name)
+	}
+	if _, err := s.Lookup(secret + "0"); err != ErrInvalidToken {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("listed %d tokens, expected 2", len(list))
+	}
+
+	if err := s.Revoke("ci"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke("ci"); err != ErrNoSuchToken {
+		t.Fatalf("expected ErrNoSuchToken, got %v", err)
+	}
+	if _, err := s.Lookup(secret); err != ErrInvalidToken {
+		t.Fatalf("revoked token still valid: %v", err)
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tok := &Token{Allow: []string{"cat", "name/resolve", "object stat"}}
+	for _, c := range []struct {
+		path []string
+		ok   bool
+	}{
+		{[]string{"cat"}, true},
+		{[]string{"name", "resolve"}, true},
+		{[]string{"name", "publish"}, false},
+		{[]string{"name"}, false},
+		{[]string{"object", "stat"}, true},
+		{[]string{"add"}, false},
+	} {
+		if tok.Allows(c.path) != c.ok {
+			t.Errorf("Allows(%v) should be %t", c.path, c.ok)
+		}
+	}
+
+	if !(&Token{}).Allows([]string{"add"}) {
+		t.Error("empty allowlist should allow every command")
+	}
+
+	// only unrestricted tokens manage tokens, even if allowed by a prefix
+	for _, tok := range []*Token{
+		{Allow: []string{"api"}},
+		{Allow: []string{"api/token/create"}},
+		{ReadOnly: true},
+	} {
+		for _, path := range [][]string{{"api"}, {"api", "token", "create"}, {"api", "token", "list"}} {
+			if tok.Allows(path) {
+				t.Errorf("restricted token %+v should not be allowed %v", tok, path)
+			}
+		}
+	}
+	if !(&Token{}).Allows([]string{"api", "token", "create"}) {
+		t.Error("unrestricted token should manage tokens")
+	}
+}
@@ -15,6 +15,7 @@ type Filter interface {
 	Find([]byte) bool
 	Merge(Filter) (Filter, error)
 	HammingDistance(Filter) (int, error)
+	Bytes() []byte
 }
 
 func NewFilter(size int) Filter {
@@ -31,6 +32,13 @@ type filter struct {
 	k      int
 }
 
+// FromBytes returns the filter whose Bytes are b.
+func FromBytes(b []byte) Filter {
+	f := NewFilter(len(b)).(*filter)
+	copy(f.filter, b)
+	return f
+}
+
 func BasicFilter() Filter {
 	return NewFilter(2048)
 }
@@ -77,6 +85,11 @@ func (f *filter) getBit(i uint32) bool {
 	return f.filter[i/8]&(1<<byte(i%8)) != 0
 }
 
+// Bytes returns the bits of the filter.
+func (f *filter) Bytes() []byte {
+	return f.filter
+}
+
 func (f *filter) Merge(o Filter) (Filter, error) {
 	casfil, ok := o.(*filter)
 	if !ok {
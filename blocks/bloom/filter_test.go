@@ -92,3 +92,16 @@ func TestHamming(t *testing.T) {
 		t.Fatal("Should have 6 bit difference")
 	}
 }
+
+func TestFromBytes(t *testing.T) {
+	f := NewFilter(128)
+	f.Add([]byte("hello"))
+
+	g := FromBytes(f.Bytes())
+	if !g.Find([]byte("hello")) {
+		t.Fatal("filter lost a key")
+	}
+	if d, err := f.HammingDistance(g); err != nil || d != 0 {
+		t.Fatalf("filters differ: %d, %v", d, err)
+	}
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"crypto/tls"
 	_ "expvar"
 	"fmt"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -22,6 +24,7 @@ import (
 	"github.com/ipfs/go-ipfs/core/corerouting"
 	conn "github.com/ipfs/go-ipfs/p2p/net/conn"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	util "github.com/ipfs/go-ipfs/util"
 )
@@ -30,6 +33,8 @@ const (
 	initOptionKwd             = "init"
 	routingOptionKwd          = "routing"
 	routingOptionSupernodeKwd = "supernode"
+	routingOptionDHTClientKwd = "dhtclient"
+	routingOptionDHTKwd       = "dht"
 	mountKwd                  = "mount"
 	writableKwd               = "writable"
 	ipfsMountKwd              = "mount-ipfs"
@@ -85,6 +90,12 @@ Note that the value of the keys is an _array_ of strings. This is because
 headers can have more than one value, and it is convenient to pass through
 to other libraries.
 
+Encrypted Identity Key
+
+If the identity key in the config is encrypted (see 'ipfs config
+passphrase'), the daemon reads its passphrase from $IPFS_PASSPHRASE, or
+prompts for it when run from a terminal.
+
 CORS Headers (for API)
 
 You can setup CORS headers the same way:
@@ -107,7 +118,7 @@ future version, along with this notice. Please move to setting the HTTP Headers.
 
 	Options: []cmds.Option{
 		cmds.BoolOption(initOptionKwd, "Initialize IPFS with default settings if not already initialized"),
-		cmds.StringOption(routingOptionKwd, "Overrides the routing option (dht, supernode)"),
+		cmds.StringOption(routingOptionKwd, "Overrides the routing option (dht, dhtclient, supernode)"),
 		cmds.BoolOption(mountKwd, "Mounts IPFS to the filesystem"),
 		cmds.BoolOption(writableKwd, "Enable writing objects (with POST, PUT and DELETE)"),
 		cmds.StringOption(ipfsMountKwd, "Path to the mountpoint for IPFS (if using --mount)"),
@@ -192,10 +203,18 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		return
 	}
 
+	passphrase, err := identityPassphrase(cfg.Identity)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		repo.Close() // because ownership hasn't been transferred to the node
+		return
+	}
+
 	// Start assembling node config
 	ncfg := &core.BuildCfg{
-		Online: true,
-		Repo:   repo,
+		Online:     true,
+		Repo:       repo,
+		Passphrase: passphrase,
 	}
 
 	routingOption, _, err := req.Option(routingOptionKwd).String()
@@ -203,7 +222,11 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		res.SetError(err, cmds.ErrNormal)
 		return
 	}
-	if routingOption == routingOptionSupernodeKwd {
+	if routingOption == "" {
+		routingOption = cfg.Routing.Type
+	}
+	switch routingOption {
+	case routingOptionSupernodeKwd:
 		servers, err := cfg.SupernodeRouting.ServerIPFSAddrs()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -219,6 +242,14 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		}
 
 		ncfg.Routing = corerouting.SupernodeClient(infos...)
+	case routingOptionDHTClientKwd:
+		ncfg.Routing = core.DHTClientOption
+	case routingOptionDHTKwd, "":
+		ncfg.Routing = core.DHTOption
+	default:
+		res.SetError(fmt.Errorf("unrecognized routing option: %s", routingOption), cmds.ErrClient)
+		repo.Close() // because ownership hasn't been transferred to the node
+		return
 	}
 
 	node, err := core.NewNode(req.Context(), ncfg)
@@ -313,7 +344,11 @@ func serveHTTPApi(req cmds.Request) (error, <-chan error) {
 	}
 	// we might have listened to /tcp/0 - lets see what we are listing on
 	apiMaddr = apiLis.Multiaddr()
-	fmt.Printf("API server listening on %s\n", apiMaddr)
+	if cfg.API.TLS.Enabled() {
+		fmt.Printf("API server (https) listening on %s\n", apiMaddr)
+	} else {
+		fmt.Printf("API server listening on %s\n", apiMaddr)
+	}
 
 	unrestricted, _, err := req.Option(unrestrictedApiAccessKwd).Bool()
 	if err != nil {
@@ -338,6 +373,7 @@ func serveHTTPApi(req cmds.Request) (error, <-chan error) {
 		},
 	})
 	var opts = []corehttp.ServeOption{
+		corehttp.TokenAuthOption(),
 		corehttp.CommandsOption(*req.InvocContext()),
 		corehttp.WebUIOption,
 		apiGw.ServeOption(),
@@ -361,9 +397,21 @@ func serveHTTPApi(req cmds.Request) (error, <-chan error) {
 		return fmt.Errorf("serveHTTPApi: SetAPIAddr() failed: %s", err), nil
 	}
 
+	var tlsConfig *tls.Config
+	if cfg.API.TLS.Enabled() {
+		tlsConfig, err = corehttp.TLSConfig(node, req.InvocContext().ConfigRoot, cfg.API.TLS)
+		if err != nil {
+			return fmt.Errorf("serveHTTPApi: %s", err), nil
+		}
+	}
+
 	errc := make(chan error)
 	go func() {
-		errc <- corehttp.Serve(node, apiLis.NetListener(), opts...)
+		if tlsConfig != nil {
+			errc <- corehttp.ServeTLS(node, apiLis.NetListener(), tlsConfig, opts...)
+		} else {
+			errc <- corehttp.Serve(node, apiLis.NetListener(), opts...)
+		}
 		close(errc)
 	}()
 	return nil, errc
@@ -409,18 +457,47 @@ func serveHTTPGateway(req cmds.Request) (error, <-chan error) {
 	// we might have listened to /tcp/0 - lets see what we are listing on
 	gatewayMaddr = gwLis.Multiaddr()
 
+	mode := "readonly"
 	if writable {
-		fmt.Printf("Gateway (writable) server listening on %s\n", gatewayMaddr)
-	} else {
-		fmt.Printf("Gateway (readonly) server listening on %s\n", gatewayMaddr)
+		mode = "writable"
 	}
+	if cfg.Gateway.TLS.Enabled() {
+		mode += ", https"
+	}
+	fmt.Printf("Gateway (%s) server listening on %s\n", mode, gatewayMaddr)
 
-	var opts = []corehttp.ServeOption{
+	var opts []corehttp.ServeOption
+
+	// the access log goes first, to see every request
+	var accessLog *os.File
+	if len(cfg.Gateway.AccessLog) > 0 {
+		file := cfg.Gateway.AccessLog
+		if !filepath.IsAbs(file) {
+			file, err = config.Path(req.InvocContext().ConfigRoot, file)
+			if err != nil {
+				return fmt.Errorf("serveHTTPGateway: %s", err), nil
+			}
+		}
+		accessLog, err = os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("serveHTTPGateway: opening the access log failed: %s", err), nil
+		}
+		opts = append(opts, corehttp.AccessLogOption(accessLog, cfg.Gateway.AccessLogFormat))
+	}
+
+	opts = append(opts,
 		corehttp.CommandsROOption(*req.InvocContext()),
 		corehttp.VersionOption(),
+	)
+
+	if len(cfg.Gateway.SubdomainHost) > 0 {
+		opts = append(opts, corehttp.SubdomainOption(cfg.Gateway.SubdomainHost))
+	}
+
+	opts = append(opts,
 		corehttp.IPNSHostnameOption(),
 		corehttp.GatewayOption(writable),
-	}
+	)
 
 	if len(cfg.Gateway.RootRedirect) > 0 {
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
@@ -428,12 +505,33 @@ func serveHTTPGateway(req cmds.Request) (error, <-chan error) {
 
 	node, err := req.InvocContext().ConstructNode()
 	if err != nil {
+		if accessLog != nil {
+			accessLog.Close()
+		}
 		return fmt.Errorf("serveHTTPGateway: ConstructNode() failed: %s", err), nil
 	}
 
+	var tlsConfig *tls.Config
+	if cfg.Gateway.TLS.Enabled() {
+		tlsConfig, err = corehttp.TLSConfig(node, req.InvocContext().ConfigRoot, cfg.Gateway.TLS)
+		if err != nil {
+			if accessLog != nil {
+				accessLog.Close()
+			}
+			return fmt.Errorf("serveHTTPGateway: %s", err), nil
+		}
+	}
+
 	errc := make(chan error)
 	go func() {
-		errc <- corehttp.Serve(node, gwLis.NetListener(), opts...)
+		if tlsConfig != nil {
+			errc <- corehttp.ServeTLS(node, gwLis.NetListener(), tlsConfig, opts...)
+		} else {
+			errc <- corehttp.Serve(node, gwLis.NetListener(), opts...)
+		}
+		if accessLog != nil {
+			accessLog.Close()
+		}
 		close(errc)
 	}()
 	return nil, errc
@@ -476,6 +574,18 @@ func mountFuse(req cmds.Request) error {
 	return nil
 }
 
+// identityPassphrase returns the passphrase of the identity key, if it is
+// encrypted. It is read from the environment, or prompted for.
+func identityPassphrase(ident config.Identity) (string, error) {
+	if !ident.Encrypted() {
+		return "", nil
+	}
+	if p := os.Getenv(util.PassphraseEnv); p != "" {
+		return p, nil
+	}
+	return util.ReadPassphrase("Enter the passphrase of the identity key: ")
+}
+
 // merge does fan-in of multiple read-only error channels
 // taken from http://blog.golang.org/pipelines
 func merge(cs ...<-chan error) <-chan error {
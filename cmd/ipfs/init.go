@@ -12,8 +12,10 @@ import (
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
 	namesys "github.com/ipfs/go-ipfs/namesys"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	util "github.com/ipfs/go-ipfs/util"
 )
 
 const nBitsForKeypairDefault = 2048
@@ -26,8 +28,10 @@ var initCmd = &cmds.Command{
 
 	Options: []cmds.Option{
 		cmds.IntOption("bits", "b", fmt.Sprintf("Number of bits to use in the generated RSA private key (defaults to %d)", nBitsForKeypairDefault)),
+		cmds.StringOption("key-type", "t", "Type of the identity key to generate: rsa or ed25519 (defaults to rsa)"),
 		cmds.BoolOption("force", "f", "Overwrite existing config (if it exists)"),
 		cmds.BoolOption("empty-repo", "e", "Don't add and pin help files to the local storage"),
+		cmds.BoolOption("encrypt-key", "Encrypt the identity key with a passphrase, read from $IPFS_PASSPHRASE or prompted for"),
 
 		// TODO need to decide whether to expose the override as a file or a
 		// directory. That is: should we allow the user to also specify the
@@ -76,7 +80,36 @@ var initCmd = &cmds.Command{
 			nBitsForKeypair = nBitsForKeypairDefault
 		}
 
-		if err := doInit(os.Stdout, req.InvocContext().ConfigRoot, force, empty, nBitsForKeypair); err != nil {
+		keyType := ci.RSA
+		typ, found, err := req.Option("key-type").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if found {
+			t, ok := ci.KeyTypes[typ]
+			if !ok {
+				res.SetError(fmt.Errorf("unrecognized key type: %s", typ), cmds.ErrClient)
+				return
+			}
+			keyType = t
+		}
+
+		var passphrase string
+		encrypt, _, err := req.Option("encrypt-key").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if encrypt {
+			passphrase, err = newPassphrase()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		if err := doInit(os.Stdout, req.InvocContext().ConfigRoot, force, empty, keyType, nBitsForKeypair, passphrase); err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
@@ -89,10 +122,20 @@ Reinitializing would overwrite your keys.
 `)
 
 func initWithDefaults(out io.Writer, repoRoot string) error {
-	return doInit(out, repoRoot, false, false, nBitsForKeypairDefault)
+	return doInit(out, repoRoot, false, false, ci.RSA, nBitsForKeypairDefault, "")
 }
 
-func doInit(out io.Writer, repoRoot string, force bool, empty bool, nBitsForKeypair int) error {
+// newPassphrase returns the passphrase to encrypt a new identity key with.
+// It is read from the environment, or prompted for twice.
+func newPassphrase() (string, error) {
+	if p := os.Getenv(util.PassphraseEnv); p != "" {
+		return p, nil
+	}
+
+	return util.ReadNewPassphrase("Enter a passphrase for the identity key: ")
+}
+
+func doInit(out io.Writer, repoRoot string, force bool, empty bool, keyType int, nBitsForKeypair int, passphrase string) error {
 	if _, err := fmt.Fprintf(out, "initializing ipfs node at %s\n", repoRoot); err != nil {
 		return err
 	}
@@ -105,11 +148,21 @@ func doInit(out io.Writer, repoRoot string, force bool, empty bool, nBitsForKeyp
 		return errRepoExists
 	}
 
-	conf, err := config.Init(out, nBitsForKeypair)
+	conf, err := config.InitWithKeyType(out, keyType, nBitsForKeypair)
 	if err != nil {
 		return err
 	}
 
+	if passphrase != "" {
+		sk, err := conf.Identity.DecodePrivateKey("")
+		if err != nil {
+			return err
+		}
+		if err := conf.Identity.SetPrivateKey(sk, passphrase); err != nil {
+			return err
+		}
+	}
+
 	if fsrepo.IsInitialized(repoRoot) {
 		if err := fsrepo.Remove(repoRoot); err != nil {
 			return err
@@ -126,7 +179,7 @@ func doInit(out io.Writer, repoRoot string, force bool, empty bool, nBitsForKeyp
 		}
 	}
 
-	return initializeIpnsKeyspace(repoRoot)
+	return initializeIpnsKeyspace(repoRoot, passphrase)
 }
 
 func checkWriteable(dir string) error {
@@ -186,7 +239,7 @@ func addDefaultAssets(out io.Writer, repoRoot string) error {
 	return err
 }
 
-func initializeIpnsKeyspace(repoRoot string) error {
+func initializeIpnsKeyspace(repoRoot string, passphrase string) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -195,7 +248,7 @@ func initializeIpnsKeyspace(repoRoot string) error {
 		return err
 	}
 
-	nd, err := core.NewNode(ctx, &core.BuildCfg{Repo: r})
+	nd, err := core.NewNode(ctx, &core.BuildCfg{Repo: r, Passphrase: passphrase})
 	if err != nil {
 		return err
 	}
@@ -109,4 +109,7 @@ var cmdDetailsMap = map[*cmds.Command]cmdDetails{
 	commands.UpdateCheckCmd:    {preemptsAutoUpdate: true},
 	commands.UpdateLogCmd:      {preemptsAutoUpdate: true},
 	commands.LogCmd:            {cannotRunOnClient: true},
+
+	// prompts for passphrases on the terminal of the client
+	commands.ConfigPassphraseCmd: {cannotRunOnDaemon: true},
 }
@@ -2,12 +2,17 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"strings"
@@ -44,6 +49,9 @@ const (
 	cpuProfile         = "ipfs.cpuprof"
 	heapProfile        = "ipfs.memprof"
 	errorFormat        = "ERROR: %v\n\n"
+
+	// apiTokenEnv holds the token to authenticate to the api with
+	apiTokenEnv = "IPFS_API_TOKEN"
 )
 
 type cmdInvocation struct {
@@ -209,8 +217,9 @@ func (i *cmdInvocation) constructNodeFunc(ctx context.Context) func() (*core.Ipf
 		// ok everything is good. set it on the invocation (for ownership)
 		// and return it.
 		n, err := core.NewNode(ctx, &core.BuildCfg{
-			Online: cmdctx.Online,
-			Repo:   r,
+			Online:     cmdctx.Online,
+			Repo:       r,
+			Passphrase: os.Getenv(u.PassphraseEnv),
 		})
 		if err != nil {
 			return nil, err
@@ -587,19 +596,28 @@ func profileIfEnabled() (func(), error) {
 // otherwise, it returns errApiNotRunning, or another error.
 func getApiClient(repoPath, apiAddrStr string) (cmdsHttp.Client, error) {
 
-	if apiAddrStr == "" {
+	// the repo's TLS config is for the API of the repo's daemon
+	var tlsConfig *tls.Config
+	fromOption := apiAddrStr != ""
+	if !fromOption {
 		var err error
 		if apiAddrStr, err = fsrepo.APIAddr(repoPath); err != nil {
 			return nil, err
 		}
+		if tlsConfig, err = apiTLSConfig(repoPath); err != nil {
+			return nil, err
+		}
 	}
 
 	addr, err := ma.NewMultiaddr(apiAddrStr)
 	if err != nil {
 		return nil, err
 	}
+	if fromOption {
+		addr, tlsConfig = apiAddrTLSConfig(repoPath, addr)
+	}
 
-	client, err := apiClientForAddr(addr)
+	client, err := apiClientForAddr(addr, tlsConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -650,6 +668,10 @@ func doVersionRequest(client cmdsHttp.Client) (*coreCmds.VersionOutput, error) {
 		}
 		return nil, err
 	}
+	if e := res.Error(); e != nil {
+		// such as a missing api token
+		return nil, e
+	}
 
 	ver, ok := res.Output().(*coreCmds.VersionOutput)
 	if !ok {
@@ -658,13 +680,83 @@ func doVersionRequest(client cmdsHttp.Client) (*coreCmds.VersionOutput, error) {
 	return ver, nil
 }
 
-func apiClientForAddr(addr ma.Multiaddr) (cmdsHttp.Client, error) {
+func apiClientForAddr(addr ma.Multiaddr, tlsConfig *tls.Config) (cmdsHttp.Client, error) {
 	_, host, err := manet.DialArgs(addr)
 	if err != nil {
 		return nil, err
 	}
 
-	return cmdsHttp.NewClient(host), nil
+	if tlsConfig != nil {
+		return cmdsHttp.NewClientWithTLS(host, os.Getenv(apiTokenEnv), tlsConfig), nil
+	}
+	return cmdsHttp.NewClientWithToken(host, os.Getenv(apiTokenEnv)), nil
+}
+
+// apiAddrTLSConfig returns the address to dial for an API address given
+// with --api, and how to check its certificate, or nil for plain HTTP. An
+// address ending in /https or /http says which, otherwise the API is
+// taken to be served like the API of the repo's daemon, if there is a repo.
+func apiAddrTLSConfig(repoPath string, addr ma.Multiaddr) (ma.Multiaddr, *tls.Config) {
+	protos := addr.Protocols()
+	switch protos[len(protos)-1].Code {
+	case ma.P_HTTP:
+		return addr.Decapsulate(ma.StringCast("/http")), nil
+	case ma.P_HTTPS:
+		conf, err := apiTLSConfig(repoPath)
+		if err != nil || conf == nil {
+			// no repo to tell, check the certificate against the
+			// system's roots
+			conf = &tls.Config{}
+		}
+		return addr.Decapsulate(ma.StringCast("/https")), conf
+	}
+
+	conf, err := apiTLSConfig(repoPath)
+	if err != nil {
+		log.Debugf("no TLS config for the API at %s: %s", addr, err)
+		return addr, nil
+	}
+	return addr, conf
+}
+
+// apiTLSConfig returns how to check the certificate of the API of the
+// daemon at repoPath, or nil if it does not serve HTTPS. The API is dialed
+// by its address, so the name to check is taken from the configured
+// certificate, or else the first ACME domain.
+func apiTLSConfig(repoPath string) (*tls.Config, error) {
+	cfg, err := fsrepo.ConfigAt(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	tc := cfg.API.TLS
+	if !tc.Enabled() {
+		return nil, nil
+	}
+
+	conf := &tls.Config{}
+	if tc.CertFile != "" {
+		file := tc.CertFile
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(repoPath, file)
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in %s", tc.CertFile)
+		}
+
+		b, _ := pem.Decode(data)
+		if leaf, err := x509.ParseCertificate(b.Bytes); err == nil && len(leaf.DNSNames) > 0 {
+			conf.ServerName = leaf.DNSNames[0]
+		}
+	}
+	if conf.ServerName == "" && len(tc.ACME.Domains) > 0 {
+		conf.ServerName = tc.ACME.Domains[0]
+	}
+	return conf, nil
 }
 
 func isConnRefused(err error) bool {
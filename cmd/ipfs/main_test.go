@@ -3,6 +3,7 @@ package main
 import (
 	"testing"
 
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
 	"github.com/ipfs/go-ipfs/commands"
 )
 
@@ -15,3 +16,23 @@ func TestIsCientErr(t *testing.T) {
 		t.Errorf("misidentified pointer")
 	}
 }
+
+func TestApiAddrTLSConfig(t *testing.T) {
+	repo := "/nonexistent-ipfs-repo"
+	for _, c := range []struct {
+		addr string
+		tls  bool
+	}{
+		{"/ip4/127.0.0.1/tcp/5001/https", true},
+		{"/ip4/127.0.0.1/tcp/5001/http", false},
+		{"/ip4/127.0.0.1/tcp/5001", false},
+	} {
+		addr, conf := apiAddrTLSConfig(repo, ma.StringCast(c.addr))
+		if addr.String() != "/ip4/127.0.0.1/tcp/5001" {
+			t.Errorf("%s: dialing %s", c.addr, addr)
+		}
+		if (conf != nil) != c.tls {
+			t.Errorf("%s: expected tls %t", c.addr, c.tls)
+		}
+	}
+}
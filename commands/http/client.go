@@ -1,6 +1,7 @@
 package http
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	config "github.com/ipfs/go-ipfs/repo/config"
@@ -19,8 +21,9 @@ import (
 )
 
 const (
-	ApiUrlFormat = "http://%s%s/%s?%s"
-	ApiPath      = "/api/v0" // TODO: make configurable
+	ApiUrlFormat    = "http://%s%s/%s?%s"
+	ApiTLSUrlFormat = "https://%s%s/%s?%s"
+	ApiPath         = "/api/v0" // TODO: make configurable
 )
 
 // Client is the commands HTTP client interface.
@@ -31,9 +34,17 @@ type Client interface {
 type client struct {
 	serverAddress string
 	httpClient    http.Client
+	token         string
+	urlFormat     string
 }
 
 func NewClient(address string) Client {
+	return NewClientWithToken(address, "")
+}
+
+// NewClientWithToken returns a client that authenticates to the API with
+// token, if it is not empty.
+func NewClientWithToken(address, token string) Client {
 	// We cannot use the default transport because of a bug in go's connection reuse
 	// code. It causes random failures in the connection including io.EOF and connection
 	// refused on 'client.Do'
@@ -44,6 +55,24 @@ func NewClient(address string) Client {
 				DisableKeepAlives: true,
 			},
 		},
+		token:     token,
+		urlFormat: ApiUrlFormat,
+	}
+}
+
+// NewClientWithTLS returns a client that talks to the API over HTTPS,
+// checking its certificate with conf.
+func NewClientWithTLS(address, token string, conf *tls.Config) Client {
+	return &client{
+		serverAddress: address,
+		httpClient: http.Client{
+			Transport: &http.Transport{
+				DisableKeepAlives: true,
+				TLSClientConfig:   conf,
+			},
+		},
+		token:     token,
+		urlFormat: ApiTLSUrlFormat,
 	}
 }
 
@@ -86,7 +115,7 @@ func (c *client) Send(req cmds.Request) (cmds.Response, error) {
 	}
 
 	path := strings.Join(req.Path(), "/")
-	url := fmt.Sprintf(ApiUrlFormat, c.serverAddress, ApiPath, path, query)
+	url := fmt.Sprintf(c.urlFormat, c.serverAddress, ApiPath, path, query)
 
 	httpReq, err := http.NewRequest("POST", url, reader)
 	if err != nil {
@@ -102,6 +131,9 @@ func (c *client) Send(req cmds.Request) (cmds.Response, error) {
 	}
 	version := config.CurrentVersionNumber
 	httpReq.Header.Set(uaHeader, fmt.Sprintf("/go-ipfs/%s/", version))
+	if c.token != "" {
+		httpReq.Header.Set(authorizationHeader, bearerPrefix+c.token)
+	}
 
 	ec := make(chan error, 1)
 	rc := make(chan cmds.Response, 1)
@@ -183,7 +215,10 @@ func getResponse(httpRes *http.Response, req cmds.Request) (cmds.Response, error
 	contentType := httpRes.Header.Get(contentTypeHeader)
 	contentType = strings.Split(contentType, ";")[0]
 
-	lengthHeader := httpRes.Header.Get(contentLengthHeader)
+	lengthHeader := httpRes.Header.Get(streamLengthHeader)
+	if len(lengthHeader) == 0 {
+		lengthHeader = httpRes.Header.Get(contentLengthHeader)
+	}
 	if len(lengthHeader) > 0 {
 		length, err := strconv.ParseUint(lengthHeader, 10, 64)
 		if err != nil {
@@ -192,7 +227,7 @@ func getResponse(httpRes *http.Response, req cmds.Request) (cmds.Response, error
 		res.SetLength(length)
 	}
 
-	rr := &httpResponseReader{httpRes}
+	rr := &httpResponseReader{resp: httpRes}
 	res.SetCloser(rr)
 
 	if contentType != applicationJson {
@@ -298,9 +333,12 @@ func decodeTypedVal(t reflect.Type, dec *json.Decoder) (interface{}, error) {
 
 // httpResponseReader reads from the response body, and checks for an error
 // in the http trailer upon EOF, this error if present is returned instead
-// of the EOF.
+// of the EOF. The progress reported in the trailer is returned by Progress.
 type httpResponseReader struct {
 	resp *http.Response
+
+	lk       sync.Mutex
+	progress []string
 }
 
 func (r *httpResponseReader) Read(b []byte) (int, error) {
@@ -312,6 +350,9 @@ func (r *httpResponseReader) Read(b []byte) (int, error) {
 	}
 	if err == io.EOF {
 		_ = r.resp.Body.Close()
+		r.lk.Lock()
+		r.progress = append(r.progress, r.resp.Trailer[StreamProgressHeader]...)
+		r.lk.Unlock()
 		trailerErr := r.checkError()
 		if trailerErr != nil {
 			return n, trailerErr
@@ -327,6 +368,16 @@ func (r *httpResponseReader) checkError() error {
 	return nil
 }
 
+// Progress implements cmds.ProgressReader. The reports are only known once
+// the body was read to the end.
+func (r *httpResponseReader) Progress() []string {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	ps := r.progress
+	r.progress = nil
+	return ps
+}
+
 func (r *httpResponseReader) Close() error {
 	return r.resp.Body.Close()
 }
@@ -0,0 +1,125 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	coremock "github.com/ipfs/go-ipfs/core/mock"
+)
+
+// progressReader is an output stream with progress reports.
+type progressReader struct {
+	io.Reader
+	progress []string
+}
+
+func (r *progressReader) Progress() []string {
+	ps := r.progress
+	r.progress = nil
+	return ps
+}
+
+// send calls cmd through a handler and a client.
+func send(t *testing.T, cmd *cmds.Command) (cmds.Response, func()) {
+	cmdsCtx, err := coremock.MockCmdsCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"test": cmd,
+		},
+	}
+	server := httptest.NewServer(NewHandler(cmdsCtx, root, originCfg(defaultOrigins)))
+
+	optDefs, err := root.GetOptions([]string{"test"})
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	req, err := cmds.NewRequest([]string{"test"}, nil, nil, nil, cmd, optDefs)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	if err := req.SetRootContext(context.Background()); err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	res, err := NewClient(strings.TrimPrefix(server.URL, "http://")).Send(req)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return res, server.Close
+}
+
+func TestStreamProgress(t *testing.T) {
+	res, done := send(t, &cmds.Command{
+		Run: func(req cmds.Request, res cmds.Response) {
+			res.SetOutput(&progressReader{
+				Reader:   strings.NewReader("hello world"),
+				progress: []string{"wanted block", "received block"},
+			})
+		},
+	})
+	defer done()
+
+	pr, ok := res.Output().(cmds.ProgressReader)
+	if !ok {
+		t.Fatalf("expected a progress reader, got %T", res.Output())
+	}
+	data, err := ioutil.ReadAll(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world" {
+		t.Fatalf("expected the output as it is, got %q", data)
+	}
+	ps := pr.Progress()
+	if len(ps) != 2 || ps[0] != "wanted block" || ps[1] != "received block" {
+		t.Fatalf("unexpected progress %q", ps)
+	}
+}
+
+// errReader returns err once its data has been read.
+type errReader struct {
+	io.Reader
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		err = r.err
+	}
+	return n, err
+}
+
+func TestStreamErrorAfterData(t *testing.T) {
+	res, done := send(t, &cmds.Command{
+		Run: func(req cmds.Request, res cmds.Response) {
+			res.SetLength(uint64(len("hello world")))
+			res.SetOutput(&errReader{strings.NewReader("hello"), errors.New("fetch failed")})
+		},
+	})
+	defer done()
+
+	if res.Length() != uint64(len("hello world")) {
+		t.Fatalf("expected the length of the stream, got %d", res.Length())
+	}
+	data, err := ioutil.ReadAll(res.Output().(io.Reader))
+	if string(data) != "hello" {
+		t.Fatalf("expected the data sent before the error, got %q", data)
+	}
+	if err == nil || err.Error() != "fetch failed" {
+		t.Fatalf("expected the stream error, got %v", err)
+	}
+}
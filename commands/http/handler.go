@@ -2,6 +2,7 @@ package http
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -39,17 +40,21 @@ var ErrNotFound = errors.New("404 page not found")
 
 const (
 	StreamErrHeader        = "X-Stream-Error"
+	StreamProgressHeader   = "X-Stream-Progress"
 	streamHeader           = "X-Stream-Output"
 	channelHeader          = "X-Chunked-Output"
 	uaHeader               = "User-Agent"
 	contentTypeHeader      = "Content-Type"
 	contentLengthHeader    = "Content-Length"
+	streamLengthHeader     = "X-Content-Length"
 	contentDispHeader      = "Content-Disposition"
 	transferEncodingHeader = "Transfer-Encoding"
 	applicationJson        = "application/json"
 	applicationOctetStream = "application/octet-stream"
 	plainText              = "text/plain"
 	originHeader           = "origin"
+	authorizationHeader    = "Authorization"
+	bearerPrefix           = "Bearer "
 )
 
 const (
@@ -70,6 +75,38 @@ type ServerConfig struct {
 
 	// CORSOpts is a set of options for CORS headers.
 	CORSOpts *cors.Options
+
+	// Authenticate, if set, is called for every request. Requests it
+	// returns an error for are refused.
+	Authenticate AuthFunc
+
+	// Refuse, if set, is called with every parsed request before it is
+	// run. If it returns an error, the request is refused with the HTTP
+	// status it returns.
+	Refuse func(req cmds.Request) (int, error)
+}
+
+// Access describes the commands an authenticated request may call.
+type Access struct {
+	// Root is the tree of commands the request may call. If nil, it is the
+	// root the handler serves.
+	Root *cmds.Command
+
+	// Allows returns whether the command at path may be called. If nil,
+	// every command under Root may.
+	Allows func(path []string) bool
+}
+
+// AuthFunc authenticates an API request, returning what it may call.
+type AuthFunc func(r *http.Request) (*Access, error)
+
+// BearerToken returns the token in the Authorization header of r, if any.
+func BearerToken(r *http.Request) string {
+	h := r.Header.Get(authorizationHeader)
+	if len(h) < len(bearerPrefix) || !strings.EqualFold(h[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(h[len(bearerPrefix):])
 }
 
 func skipAPIHeader(h string) bool {
@@ -122,7 +159,23 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req, err := Parse(r, i.root)
+	root := i.root
+	var allows func([]string) bool
+	if i.cfg.Authenticate != nil {
+		access, err := i.cfg.Authenticate(r)
+		if err != nil {
+			log.Warningf("API refused unauthenticated request to %s: %s", r.URL, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs"`)
+			writeClientError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if access.Root != nil {
+			root = access.Root
+		}
+		allows = access.Allows
+	}
+
+	req, err := Parse(r, root)
 	if err != nil {
 		if err == ErrNotFound {
 			w.WriteHeader(http.StatusNotFound)
@@ -133,6 +186,12 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if allows != nil && !allows(req.Path()) {
+		log.Warningf("API refused request to %s, not allowed by its token", r.URL)
+		writeClientError(w, http.StatusForbidden, fmt.Errorf("not allowed to call '%s'", strings.Join(req.Path(), " ")))
+		return
+	}
+
 	// get the node's context to pass into the commands.
 	node, err := i.ctx.GetNode()
 	if err != nil {
@@ -153,8 +212,16 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if i.cfg.Refuse != nil {
+		if status, err := i.cfg.Refuse(req); err != nil {
+			log.Warningf("API refused request to %s: %s", r.URL, err)
+			writeClientError(w, status, err)
+			return
+		}
+	}
+
 	// call the command
-	res := i.root.Call(req)
+	res := root.Call(req)
 
 	// set user's headers first.
 	for k, v := range i.cfg.Headers {
@@ -167,6 +234,14 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, r, res, req)
 }
 
+// writeClientError responds with err marshalled like a command error, so
+// clients report it as one.
+func writeClientError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set(contentTypeHeader, applicationJson)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(cmds.Error{Message: err.Error(), Code: cmds.ErrClient})
+}
+
 func guessMimeType(res cmds.Response) (string, error) {
 	// Try to guess mimeType from the encoding option
 	enc, found, err := res.Request().Option(cmds.EncShort).String()
@@ -206,7 +281,9 @@ func sendResponse(w http.ResponseWriter, r *http.Request, res cmds.Response, req
 
 	h := w.Header()
 	if res.Length() > 0 {
-		h.Set(contentLengthHeader, strconv.FormatUint(res.Length(), 10))
+		// a Content-Length would keep the trailers that report stream
+		// errors from being sent, so the length is sent apart
+		h.Set(streamLengthHeader, strconv.FormatUint(res.Length(), 10))
 	}
 
 	if _, ok := res.Output().(io.Reader); ok {
@@ -236,13 +313,20 @@ func sendResponse(w http.ResponseWriter, r *http.Request, res cmds.Response, req
 	if mime != "" {
 		h.Set(contentTypeHeader, mime)
 	}
-	h.Set(transferEncodingHeader, "chunked")
 
 	if r.Method == "HEAD" { // after all the headers.
 		return
 	}
 
-	if err := writeResponse(status, w, out); err != nil {
+	// Requests with a body, like add, may still be uploading while the
+	// output streams back, which net/http does not allow. Those get the
+	// connection hijacked; the rest keep it alive for the next request.
+	var write func(int, http.ResponseWriter, io.Reader) error = streamResponse
+	if r.ContentLength != 0 {
+		h.Set(transferEncodingHeader, "chunked")
+		write = writeResponse
+	}
+	if err := write(status, w, out); err != nil {
 		if strings.Contains(err.Error(), "broken pipe") {
 			log.Info("client disconnect while writing stream ", err)
 			return
@@ -267,6 +351,9 @@ func writeResponse(status int, w http.ResponseWriter, out io.Reader) error {
 	}
 	defer conn.Close()
 
+	// the connection is closed after the response
+	w.Header().Set("Connection", "close")
+
 	// write status
 	writer.WriteString(fmt.Sprintf("HTTP/1.1 %d %s\r\n", status, http.StatusText(status)))
 
@@ -287,11 +374,65 @@ func writeResponse(status int, w http.ResponseWriter, out io.Reader) error {
 	if streamErr != nil {
 		writer.WriteString(StreamErrHeader + ": " + sanitizedErrStr(streamErr) + "\r\n")
 	}
+	for _, p := range progress(out) {
+		writer.WriteString(StreamProgressHeader + ": " + p + "\r\n")
+	}
 	writer.WriteString("\r\n") // close response
 	writer.Flush()
 	return streamErr
 }
 
+// streamResponse copies out to w through net/http, flushing as it goes, and
+// reports errors in the X-Stream-Error trailer, and progress in the
+// X-Stream-Progress one.
+func streamResponse(status int, w http.ResponseWriter, out io.Reader) error {
+	w.Header().Set("Trailer", StreamErrHeader)
+	if _, ok := out.(cmds.ProgressReader); ok {
+		w.Header().Add("Trailer", StreamProgressHeader)
+		defer func() {
+			for _, p := range progress(out) {
+				w.Header().Add(StreamProgressHeader, p)
+			}
+		}()
+	}
+	w.WriteHeader(status)
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := out.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			w.Header().Set(StreamErrHeader, sanitizedErrStr(err))
+			return err
+		}
+	}
+}
+
+// progress returns the reports of out if it is a cmds.ProgressReader, made
+// fit for a header.
+func progress(out io.Reader) []string {
+	pr, ok := out.(cmds.ProgressReader)
+	if !ok {
+		return nil
+	}
+	ps := pr.Progress()
+	for i, p := range ps {
+		ps[i] = sanitizedHeaderStr(p)
+	}
+	return ps
+}
+
 func writeChunks(r io.Reader, w *bufio.ReadWriter) error {
 	buf := make([]byte, 32*1024)
 	for {
@@ -321,7 +462,10 @@ func writeChunks(r io.Reader, w *bufio.ReadWriter) error {
 }
 
 func sanitizedErrStr(err error) string {
-	s := err.Error()
+	return sanitizedHeaderStr(err.Error())
+}
+
+func sanitizedHeaderStr(s string) string {
 	s = strings.Split(s, "\n")[0]
 	s = strings.Split(s, "\r")[0]
 	return s
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -350,3 +351,57 @@ func TestAllowedMethod(t *testing.T) {
 		tc.test(t)
 	}
 }
+
+func TestAuthenticate(t *testing.T) {
+	cmdsCtx, err := coremock.MockCmdsCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmdRoot := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"version": ipfscmd.VersionCmd,
+			"id":      ipfscmd.IDCmd,
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.Authenticate = func(r *http.Request) (*Access, error) {
+		if BearerToken(r) != "secret" {
+			return nil, errors.New("bad token")
+		}
+		return &Access{
+			Allows: func(path []string) bool { return path[0] == "version" },
+		}, nil
+	}
+	server := httptest.NewServer(NewHandler(cmdsCtx, cmdRoot, cfg))
+	defer server.Close()
+
+	for _, c := range []struct {
+		path  string
+		token string
+		code  int
+	}{
+		{"/api/v0/version", "", http.StatusUnauthorized},
+		{"/api/v0/version", "wrong", http.StatusUnauthorized},
+		{"/api/v0/version", "secret", http.StatusOK},
+		{"/api/v0/id", "secret", http.StatusForbidden},
+	} {
+		req, err := http.NewRequest("GET", server.URL+c.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Errorf("%s with token %q: expected status %d, got %d", c.path, c.token, c.code, res.StatusCode)
+		}
+	}
+}
@@ -118,6 +118,16 @@ type Response interface {
 	Stderr() io.Writer
 }
 
+// ProgressReader is an output stream that reports on its progress apart
+// from its data. Over HTTP, the reports are sent once the stream ends.
+type ProgressReader interface {
+	io.Reader
+
+	// Progress returns the reports made since it was last called, one
+	// line each.
+	Progress() []string
+}
+
 type response struct {
 	req    Request
 	err    *Error
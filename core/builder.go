@@ -13,6 +13,7 @@ import (
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	bserv "github.com/ipfs/go-ipfs/blockservice"
 	offline "github.com/ipfs/go-ipfs/exchange/offline"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	ci "github.com/ipfs/go-ipfs/p2p/crypto"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
@@ -32,6 +33,9 @@ type BuildCfg struct {
 	Routing RoutingOption
 	Host    HostOption
 	Repo    repo.Repo
+
+	// Passphrase decrypts the private key in the config, if it is encrypted
+	Passphrase string
 }
 
 func (cfg *BuildCfg) fillDefaults() error {
@@ -88,6 +92,7 @@ func defaultRepo(dstore ds.ThreadSafeDatastore) (repo.Repo, error) {
 	return &repo.Mock{
 		D: dstore,
 		C: c,
+		K: keystore.NewMemKeystore(),
 	}, nil
 }
 
@@ -106,6 +111,8 @@ func NewNode(ctx context.Context, cfg *BuildCfg) (*IpfsNode, error) {
 		Repo:      cfg.Repo,
 		ctx:       ctx,
 		Peerstore: peer.NewPeerstore(),
+
+		passphrase: cfg.Passphrase,
 	}
 	if cfg.Online {
 		n.mode = onlineMode
@@ -15,9 +15,8 @@ import (
 	cmds "github.com/ipfs/go-ipfs/commands"
 	files "github.com/ipfs/go-ipfs/commands/files"
 	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	offline "github.com/ipfs/go-ipfs/exchange/offline"
-	importer "github.com/ipfs/go-ipfs/importer"
-	"github.com/ipfs/go-ipfs/importer/chunk"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	dagutils "github.com/ipfs/go-ipfs/merkledag/utils"
 	pin "github.com/ipfs/go-ipfs/pin"
@@ -307,32 +306,11 @@ type adder struct {
 }
 
 // Perform the actual add & pin locally, outputting results to reader
-func add(n *core.IpfsNode, reader io.Reader, useTrickle bool, chunker string) (*dag.Node, error) {
-	chnk, err := chunk.FromString(reader, chunker)
-	if err != nil {
-		return nil, err
-	}
-
-	var node *dag.Node
-	if useTrickle {
-		node, err = importer.BuildTrickleDagFromReader(
-			n.DAG,
-			chnk,
-			importer.PinIndirectCB(n.Pinning.GetManual()),
-		)
-	} else {
-		node, err = importer.BuildDagFromReader(
-			n.DAG,
-			chnk,
-			importer.PinIndirectCB(n.Pinning.GetManual()),
-		)
-	}
-
-	if err != nil {
-		return nil, err
-	}
-
-	return node, nil
+func add(ctx cxt.Context, n *core.IpfsNode, reader io.Reader, useTrickle bool, chunker string) (*dag.Node, error) {
+	return coreapi.NewCoreAPI(n).Unixfs().Add(ctx, reader, &coreapi.AddOptions{
+		Chunker: chunker,
+		Trickle: useTrickle,
+	})
 }
 
 func (params *adder) RootNode() (*dag.Node, error) {
@@ -405,7 +383,7 @@ func (params *adder) addFile(file files.File) (*dag.Node, error) {
 		reader = &progressReader{file: file, out: params.out}
 	}
 
-	dagnode, err := add(params.node, reader, params.trickle, params.chunker)
+	dagnode, err := add(params.ctx, params.node, reader, params.trickle, params.chunker)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,228 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	apitoken "github.com/ipfs/go-ipfs/apitoken"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+var ApiCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage access to the HTTP API",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"token": apiTokenCmd,
+	},
+}
+
+var apiTokenCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the tokens that authenticate to the API",
+		Synopsis: `
+ipfs api token create <name>  - Create a new token
+ipfs api token list           - List all tokens
+ipfs api token revoke <name>  - Revoke a token
+`,
+		ShortDescription: `
+When API.RequireToken is set in the config, the daemon refuses API
+requests that do not carry a valid token in their Authorization header:
+
+    Authorization: Bearer <token>
+
+The ipfs command line sends the token in the IPFS_API_TOKEN environment
+variable.
+
+The rest of the API port, like the WebUI, the gateway and the debug
+endpoints, is only open to tokens that may call every command.
+So are these token commands, so no token can create one with more rights
+than its own.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"create": apiTokenCreateCmd,
+		"list":   apiTokenListCmd,
+		"revoke": apiTokenRevokeCmd,
+	},
+}
+
+// ApiTokenOutput is a newly created token, with the secret that
+// authenticates as it.
+type ApiTokenOutput struct {
+	apitoken.Token
+	Secret string
+}
+
+type ApiTokenList struct {
+	Tokens []apitoken.Token
+}
+
+var apiTokenCreateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create a new API token",
+		ShortDescription: `
+Prints the token's secret. It is not stored, and cannot be shown again.
+`,
+		LongDescription: `
+Prints the token's secret. It is not stored, and cannot be shown again.
+
+By default a token may call every command. --read-only limits it to the
+commands the read-only API serves, and --allow to the commands listed,
+including their subcommands:
+
+    ipfs api token create --allow=cat,name/resolve,object/stat viewer
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the token to create"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("read-only", "r", "Only allow the commands of the read-only API"),
+		cmds.StringOption("allow", "a", "Comma separated list of the commands the token may call, like 'cat,name/resolve'"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		t := apitoken.Token{Name: req.Arguments()[0]}
+
+		t.ReadOnly, _, err = req.Option("read-only").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		allow, _, err := req.Option("allow").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		for _, a := range strings.Split(allow, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				t.Allow = append(t.Allow, a)
+			}
+		}
+
+		secret, err := apitoken.NewStore(n.Repo.Datastore()).Create(t)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&ApiTokenOutput{Token: t, Secret: secret})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*ApiTokenOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return bytes.NewBufferString(out.Secret + "\n"), nil
+		},
+	},
+	Type: ApiTokenOutput{},
+}
+
+var apiTokenListCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List all API tokens",
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		tokens, err := apitoken.NewStore(n.Repo.Datastore()).List()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		sort.Sort(tokensByName(tokens))
+		res.SetOutput(&ApiTokenList{tokens})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*ApiTokenList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+			for _, t := range list.Tokens {
+				access := "all"
+				if len(t.Allow) > 0 {
+					access = strings.Join(t.Allow, ",")
+				}
+				if t.ReadOnly {
+					access += " (read-only)"
+				}
+				fmt.Fprintf(w, "%s\t%s\n", t.Name, access)
+			}
+			w.Flush()
+			return buf, nil
+		},
+	},
+	Type: ApiTokenList{},
+}
+
+var apiTokenRevokeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Revoke API tokens",
+		ShortDescription: `
+Requests with a revoked token are refused from then on.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, true, "Names of the tokens to revoke").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		store := apitoken.NewStore(n.Repo.Datastore())
+		var revoked []apitoken.Token
+		for _, name := range req.Arguments() {
+			if err := store.Revoke(name); err != nil {
+				res.SetError(fmt.Errorf("%s: %s", name, err), cmds.ErrNormal)
+				return
+			}
+			revoked = append(revoked, apitoken.Token{Name: name})
+		}
+		res.SetOutput(&ApiTokenList{revoked})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*ApiTokenList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, t := range list.Tokens {
+				fmt.Fprintf(buf, "revoked %s\n", t.Name)
+			}
+			return buf, nil
+		},
+	},
+	Type: ApiTokenList{},
+}
+
+type tokensByName []apitoken.Token
+
+func (ts tokensByName) Len() int           { return len(ts) }
+func (ts tokensByName) Swap(i, j int)      { ts[i], ts[j] = ts[j], ts[i] }
+func (ts tokensByName) Less(i, j int) bool { return ts[i].Name < ts[j].Name }
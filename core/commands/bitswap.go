@@ -4,23 +4,37 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
+	"time"
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
 	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
+	reprovide "github.com/ipfs/go-ipfs/exchange/reprovide"
+	notif "github.com/ipfs/go-ipfs/notifications"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	u "github.com/ipfs/go-ipfs/util"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
+// fetchStallTimeout is how long a fetch may go without progress before the
+// outstanding keys are reported as stalled.
+const fetchStallTimeout = time.Second * 10
+
 var BitswapCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "A set of commands to manipulate the bitswap agent",
 		ShortDescription: ``,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"wantlist": showWantlistCmd,
-		"stat":     bitswapStatCmd,
-		"unwant":   unwantCmd,
+		"wantlist":  showWantlistCmd,
+		"stat":      bitswapStatCmd,
+		"unwant":    unwantCmd,
+		"inspect":   inspectCmd,
+		"reprovide": reprovideCmd,
 	},
 }
 
@@ -168,3 +182,324 @@ var bitswapStatCmd = &cmds.Command{
 		},
 	},
 }
+
+var inspectCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the fetch status of a wanted block",
+		ShortDescription: `
+Shows when a block was first wanted, how many provider lookups were made for
+it, which providers were found, and which peers were sent a want for it.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, false, "key of the block to inspect").EnableStdin(),
+	},
+	Type: bitswap.KeyStatus{},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		bs, ok := nd.Exchange.(*bitswap.Bitswap)
+		if !ok {
+			res.SetError(u.ErrCast(), cmds.ErrNormal)
+			return
+		}
+
+		k := key.B58KeyDecode(req.Arguments()[0])
+		if k == "" {
+			res.SetError(fmt.Errorf("incorrectly formatted key: %s", req.Arguments()[0]), cmds.ErrNormal)
+			return
+		}
+
+		st, ok := bs.Inspect(k)
+		if !ok {
+			has, err := nd.Blockstore.Has(k)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if has {
+				res.SetError(fmt.Errorf("block %s is stored locally", k.B58String()), cmds.ErrNormal)
+				return
+			}
+			res.SetError(fmt.Errorf("block %s is not on the wantlist", k.B58String()), cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(st)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			st, ok := res.Output().(*bitswap.KeyStatus)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			writeKeyStatus(buf, st)
+			return buf, nil
+		},
+	},
+}
+
+var reprovideCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Trigger a reprovide run and show its status",
+		ShortDescription: `
+Starts announcing the keys selected by the Reprovider.Strategy config setting
+to the routing system, unless a run is already in progress. The status of the
+current or last run is printed.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("status", "s", "Only show the status of the current or last run"),
+	},
+	Type: reprovide.Status{},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() || nd.Reprovider == nil {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		statusOnly, _, _ := req.Option("status").Bool()
+		if !statusOnly {
+			err := nd.Reprovider.Trigger(req.Context())
+			if err != nil && err != reprovide.ErrAlreadyRunning {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		st := nd.Reprovider.Status()
+		res.SetOutput(&st)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			st, ok := res.Output().(*reprovide.Status)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			fmt.Fprintln(buf, "reprovider status")
+			fmt.Fprintf(buf, "\trunning: %t\n", st.Running)
+			if !st.LastStart.IsZero() {
+				fmt.Fprintf(buf, "\tstarted: %s\n", st.LastStart.Format(time.RFC3339))
+			}
+			if !st.LastEnd.IsZero() && !st.Running {
+				fmt.Fprintf(buf, "\tfinished: %s\n", st.LastEnd.Format(time.RFC3339))
+			}
+			fmt.Fprintf(buf, "\tresumed: %t\n", st.Resumed)
+			fmt.Fprintf(buf, "\tkeys provided: %d\n", st.Provided)
+			if st.Failed > 0 {
+				fmt.Fprintf(buf, "\tkeys failed: %d\n", st.Failed)
+			}
+			if st.LastError != "" {
+				fmt.Fprintf(buf, "\terror: %s\n", st.LastError)
+			}
+			return buf, nil
+		},
+	},
+}
+
+func writeKeyStatus(w io.Writer, st *bitswap.KeyStatus) {
+	fmt.Fprintf(w, "%s\n", st.Key.B58String())
+	fmt.Fprintf(w, "\twanted for: %s\n", time.Since(st.WantedSince)/time.Second*time.Second)
+	fmt.Fprintf(w, "\trequesters: %d\n", st.Requesters)
+	fmt.Fprintf(w, "\tprovider searches: %d\n", st.ProviderSearches)
+	fmt.Fprintf(w, "\tproviders [%d]\n", len(st.Providers))
+	for _, p := range st.Providers {
+		fmt.Fprintf(w, "\t\t%s\n", p)
+	}
+	fmt.Fprintf(w, "\tpeers contacted [%d]\n", len(st.PeersContacted))
+	for _, p := range st.PeersContacted {
+		fmt.Fprintf(w, "\t\t%s\n", p)
+	}
+}
+
+// fetchProgressLines bounds the progress reports kept for a client that
+// only gets them once the output ends; older ones are dropped.
+const fetchProgressLines = 1024
+
+// fetchPrintInterval is how often the progress of a fetch is printed while
+// its output is read.
+const fetchPrintInterval = time.Millisecond * 200
+
+// fetchProgress is the output of cat and get with --progress: the fetched
+// data, with reports on the blocks fetched for it kept apart, so the data is
+// sent as it is. It implements cmds.ProgressReader.
+type fetchProgress struct {
+	io.Reader
+	stop func()
+
+	lk      sync.Mutex
+	reports []string
+	dropped int
+}
+
+func (fp *fetchProgress) Read(p []byte) (int, error) {
+	n, err := fp.Reader.Read(p)
+	if err != nil {
+		fp.stop()
+	}
+	return n, err
+}
+
+func (fp *fetchProgress) report(s string) {
+	fp.lk.Lock()
+	defer fp.lk.Unlock()
+	for _, l := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		if len(fp.reports) == fetchProgressLines {
+			fp.reports = fp.reports[1:]
+			fp.dropped++
+		}
+		fp.reports = append(fp.reports, l)
+	}
+}
+
+// Progress implements cmds.ProgressReader.
+func (fp *fetchProgress) Progress() []string {
+	fp.lk.Lock()
+	defer fp.lk.Unlock()
+	ps := fp.reports
+	if fp.dropped > 0 {
+		ps = append([]string{fmt.Sprintf("%d earlier progress reports dropped", fp.dropped)}, ps...)
+	}
+	fp.reports = nil
+	fp.dropped = 0
+	return ps
+}
+
+// reportFetchProgress registers for block fetch events on ctx and passes
+// them to report. If no progress is made for fetchStallTimeout, the status
+// of every block still outstanding is reported as well. Reporting stops when
+// ctx is done or the returned stop function is called, which waits for the
+// last report.
+func reportFetchProgress(ctx context.Context, nd *core.IpfsNode, report func(string)) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	events := make(chan *notif.FetchEvent, 16)
+	ctx = notif.RegisterForFetchEvents(ctx, events)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bs, _ := nd.Exchange.(*bitswap.Bitswap)
+		stall := time.NewTimer(fetchStallTimeout)
+		defer stall.Stop()
+
+		for {
+			select {
+			case ev := <-events:
+				report(ev.String())
+				stall.Reset(fetchStallTimeout)
+			case <-stall.C:
+				// events may have been dropped, so ask bitswap what is
+				// still outstanding
+				if bs != nil {
+					if sts := bs.InspectFetch(ctx); len(sts) > 0 {
+						buf := new(bytes.Buffer)
+						fmt.Fprintf(buf, "no progress for %s, waiting on %d blocks\n", fetchStallTimeout, len(sts))
+						for _, st := range sts {
+							writeKeyStatus(buf, st)
+						}
+						report(buf.String())
+					}
+				}
+				stall.Reset(fetchStallTimeout)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+}
+
+// fetchWithProgress sets the output of res to the reader fetch returns,
+// along with the progress of the blocks fetched for it. Keeping the progress
+// in the output lets clients of a daemon show it, unlike writing to the
+// daemon's stderr.
+func fetchWithProgress(req cmds.Request, res cmds.Response, nd *core.IpfsNode, fetch func(context.Context) (io.Reader, error)) {
+	fp := new(fetchProgress)
+	ctx, stop := reportFetchProgress(req.Context(), nd, fp.report)
+	r, err := fetch(ctx)
+	if err != nil {
+		stop()
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	fp.Reader = r
+	fp.stop = stop
+	res.SetOutput(fp)
+}
+
+// printProgress prints the progress reports of the output of res to its
+// stderr while the output is read, if it has any.
+func printProgress(res cmds.Response) {
+	pr, ok := res.Output().(cmds.ProgressReader)
+	if !ok {
+		return
+	}
+	pp := &progressPrinter{ProgressReader: pr, out: res.Stderr(), done: make(chan struct{})}
+	go pp.run(res.Request().Context())
+	res.SetOutput(pp)
+}
+
+type progressPrinter struct {
+	cmds.ProgressReader
+	out io.Writer
+
+	lk   sync.Mutex
+	once sync.Once
+	done chan struct{}
+}
+
+func (pp *progressPrinter) Read(p []byte) (int, error) {
+	n, err := pp.ProgressReader.Read(p)
+	if err != nil {
+		pp.once.Do(func() { close(pp.done) })
+		pp.print()
+	}
+	return n, err
+}
+
+func (pp *progressPrinter) run(ctx context.Context) {
+	t := time.NewTicker(fetchPrintInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			pp.print()
+		case <-pp.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (pp *progressPrinter) print() {
+	pp.lk.Lock()
+	defer pp.lk.Unlock()
+	for _, p := range pp.Progress() {
+		fmt.Fprintln(pp.out, p)
+	}
+}
@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+)
+
+// stderrResponse is a response whose stderr can be inspected.
+type stderrResponse struct {
+	cmds.Response
+	stderr bytes.Buffer
+}
+
+func (r *stderrResponse) Stderr() io.Writer {
+	return &r.stderr
+}
+
+func TestPrintProgress(t *testing.T) {
+	req, err := cmds.NewEmptyRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := &stderrResponse{Response: cmds.NewResponse(req)}
+
+	stopped := false
+	fp := &fetchProgress{
+		Reader: strings.NewReader("hello world"),
+		stop:   func() { stopped = true },
+	}
+	fp.report("wanted block")
+	fp.report("no progress\n\tpeers contacted [0]\n")
+	res.SetOutput(fp)
+
+	printProgress(res)
+	data, err := ioutil.ReadAll(res.Output().(io.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world" {
+		t.Fatalf("expected the data as it is, got %q", data)
+	}
+	if !stopped {
+		t.Fatal("reporting was not stopped at the end of the output")
+	}
+	if res.stderr.String() != "wanted block\nno progress\n\tpeers contacted [0]\n" {
+		t.Fatalf("unexpected progress output %q", res.stderr.String())
+	}
+}
+
+func TestFetchProgressDropsOldReports(t *testing.T) {
+	fp := new(fetchProgress)
+	for i := 0; i < fetchProgressLines+2; i++ {
+		fp.report("event")
+	}
+	ps := fp.Progress()
+	if len(ps) != fetchProgressLines+1 || ps[0] != "2 earlier progress reports dropped" {
+		t.Fatalf("expected %d reports after a drop notice, got %d starting with %q", fetchProgressLines, len(ps)-1, ps[0])
+	}
+	if ps := fp.Progress(); len(ps) != 0 {
+		t.Fatalf("reports were returned twice: %v", ps)
+	}
+}
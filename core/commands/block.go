@@ -114,7 +114,7 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 		cmds.FileArg("data", true, false, "The data to be stored as an IPFS block").EnableStdin(),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -138,15 +138,14 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 			return
 		}
 
-		b := blocks.NewBlock(data)
-		log.Debugf("BlockPut key: '%q'", b.Key())
-
-		k, err := n.Blocks.AddBlock(b)
+		k, err := api.Block().Put(req.Context(), data)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
+		log.Debugf("BlockPut key: '%q'", k)
+
 		res.SetOutput(&BlockStat{
 			Key:  k.String(),
 			Size: len(data),
@@ -162,7 +161,7 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 }
 
 func getBlockForKey(req cmds.Request, skey string) (*blocks.Block, error) {
-	n, err := req.InvocContext().GetNode()
+	api, err := coreAPI(req)
 	if err != nil {
 		return nil, err
 	}
@@ -177,7 +176,7 @@ func getBlockForKey(req cmds.Request, skey string) (*blocks.Block, error) {
 	}
 
 	k := key.Key(h)
-	b, err := n.Blocks.GetBlock(req.Context(), k)
+	b, err := api.Block().Get(req.Context(), k)
 	if err != nil {
 		return nil, err
 	}
@@ -5,9 +5,8 @@ import (
 	"io"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
-	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	path "github.com/ipfs/go-ipfs/path"
-	uio "github.com/ipfs/go-ipfs/unixfs/io"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/cheggaaa/pb"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
@@ -26,12 +25,18 @@ var CatCmd = &cmds.Command{
 		ShortDescription: `
 Retrieves the object named by <ipfs-or-ipns-path> and outputs the data
 it contains.
+
+Use '--progress' to print every block fetched from the network, the peers
+involved, and the status of any blocks the fetch is stalled on.
 `,
 	},
 
 	Arguments: []cmds.Argument{
 		cmds.StringArg("ipfs-path", true, true, "The path to the IPFS object(s) to be outputted").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption("progress", "Report block fetch progress and stalls on stderr"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		node, err := req.InvocContext().GetNode()
 		if err != nil {
@@ -39,7 +44,19 @@ it contains.
 			return
 		}
 
-		readers, length, err := cat(req.Context(), node, req.Arguments())
+		api := coreapi.NewCoreAPI(node)
+		if progress, _, _ := req.Option("progress").Bool(); progress {
+			fetchWithProgress(req, res, node, func(ctx context.Context) (io.Reader, error) {
+				readers, _, err := cat(ctx, api, req.Arguments())
+				if err != nil {
+					return nil, err
+				}
+				return io.MultiReader(readers...), nil
+			})
+			return
+		}
+
+		readers, length, err := cat(req.Context(), api, req.Arguments())
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -51,6 +68,11 @@ it contains.
 		res.SetOutput(reader)
 	},
 	PostRun: func(req cmds.Request, res cmds.Response) {
+		if res.Error() != nil {
+			return
+		}
+		printProgress(res)
+
 		if res.Length() < progressBarMinSize {
 			return
 		}
@@ -64,21 +86,16 @@ it contains.
 	},
 }
 
-func cat(ctx context.Context, node *core.IpfsNode, paths []string) ([]io.Reader, uint64, error) {
+func cat(ctx context.Context, api coreapi.CoreAPI, paths []string) ([]io.Reader, uint64, error) {
 	readers := make([]io.Reader, 0, len(paths))
 	length := uint64(0)
 	for _, fpath := range paths {
-		dagnode, err := core.Resolve(ctx, node, path.Path(fpath))
-		if err != nil {
-			return nil, 0, err
-		}
-
-		read, err := uio.NewDagReader(ctx, dagnode, node.DAG)
+		read, err := api.Unixfs().Cat(ctx, path.Path(fpath))
 		if err != nil {
 			return nil, 0, err
 		}
 		readers = append(readers, read)
-		length += uint64(read.Size())
+		length += read.Size()
 	}
 	return readers, length, nil
 }
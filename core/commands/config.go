@@ -31,6 +31,7 @@ ipfs config <key> <value>  - Set value of <key> to <value>
 ipfs config show           - Show config file
 ipfs config edit           - Edit config file in $EDITOR
 ipfs config replace <file> - Replaces the config file with <file>
+ipfs config passphrase     - Encrypt the identity key with a passphrase
 `,
 		ShortDescription: `
 ipfs config controls configuration variables. It works like 'git config'.
@@ -125,9 +126,10 @@ Set the value of the 'datastore.path' key:
 	},
 	Type: ConfigField{},
 	Subcommands: map[string]*cmds.Command{
-		"show":    configShowCmd,
-		"edit":    configEditCmd,
-		"replace": configReplaceCmd,
+		"show":       configShowCmd,
+		"edit":       configEditCmd,
+		"replace":    configReplaceCmd,
+		"passphrase": ConfigPassphraseCmd,
 	},
 }
 
@@ -135,8 +137,8 @@ var configShowCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Outputs the content of the config file",
 		ShortDescription: `
-WARNING: Your private key is stored in the config file, and it will be
-included in the output of this command.
+The private key of the node is left out of the output. 'ipfs config
+replace' keeps the current private key when given a config without one.
 `,
 	},
 
@@ -184,7 +186,8 @@ var configReplaceCmd = &cmds.Command{
 		Tagline: "Replaces the config with <file>",
 		ShortDescription: `
 Make sure to back up the config file first if neccessary, this operation
-can't be undone.
+can't be undone. If <file> has no private key, like the output of 'ipfs
+config show', the current one is kept.
 `,
 	},
 
@@ -214,11 +217,106 @@ can't be undone.
 	},
 }
 
+var ConfigPassphraseCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Encrypt the identity key with a passphrase",
+		ShortDescription: `
+Encrypts the private key in the config with a new passphrase, or with
+--remove, stores it unencrypted. The current passphrase is read from
+$IPFS_PASSPHRASE and the new one from $IPFS_NEW_PASSPHRASE, or they are
+prompted for. Restart the daemon for the change to take effect.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.BoolOption("remove", "Store the private key unencrypted"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		remove, _, err := req.Option("remove").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		r, err := fsrepo.Open(req.InvocContext().ConfigRoot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer r.Close()
+
+		cfg, err := r.Config()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var current string
+		if cfg.Identity.Encrypted() {
+			current = os.Getenv(u.PassphraseEnv)
+			if current == "" {
+				current, err = u.ReadPassphrase("Enter the current passphrase: ")
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+			}
+		}
+		sk, err := cfg.Identity.DecodePrivateKey(current)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var next string
+		if !remove {
+			next = os.Getenv(newPassphraseEnv)
+			if next == "" {
+				next, err = u.ReadNewPassphrase("Enter the new passphrase: ")
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+			}
+		}
+
+		newcfg := *cfg
+		if err := newcfg.Identity.SetPrivateKey(sk, next); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := r.SetConfig(&newcfg); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+// newPassphraseEnv is the environment variable 'ipfs config passphrase'
+// reads the new passphrase from.
+const newPassphraseEnv = "IPFS_NEW_PASSPHRASE"
+
+var errPrivKeyHidden = errors.New("the private key is not shown, see 'ipfs config passphrase'")
+
+// isPrivKeyField returns whether the config key holds the private key.
+func isPrivKeyField(key string) bool {
+	return key == "Identity.PrivKey" || key == "Identity.EncryptedPrivKey"
+}
+
 func getConfig(r repo.Repo, key string) (*ConfigField, error) {
+	if isPrivKeyField(key) {
+		return nil, errPrivKeyHidden
+	}
+
 	value, err := r.GetConfigKey(key)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get config value: %s", err)
 	}
+
+	if ident, ok := value.(map[string]interface{}); ok && key == "Identity" {
+		delete(ident, "PrivKey")
+		delete(ident, "EncryptedPrivKey")
+	}
 	return &ConfigField{
 		Key:   key,
 		Value: value,
@@ -230,18 +328,35 @@ func setConfig(r repo.Repo, key string, value interface{}) (*ConfigField, error)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to set config value: %s (maybe use --json?)", err)
 	}
+	if isPrivKeyField(key) {
+		return &ConfigField{Key: key}, nil
+	}
 	return getConfig(r, key)
 }
 
 func showConfig(filename string) (io.Reader, error) {
-	// TODO maybe we should omit privkey so we don't accidentally leak it?
-
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	return bytes.NewReader(data), nil
+	// go through a map rather than config.Config, so that fields this
+	// version does not know about are shown too
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	// never print the private key, encrypted or not
+	if ident, ok := cfg["Identity"].(map[string]interface{}); ok {
+		delete(ident, "PrivKey")
+		delete(ident, "EncryptedPrivKey")
+	}
+
+	out, err := config.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
 }
 
 func editConfig(filename string) error {
@@ -261,5 +376,18 @@ func replaceConfig(r repo.Repo, file io.Reader) error {
 		return errors.New("Failed to decode file as config")
 	}
 
+	// configs from 'ipfs config show' have no private key, keep ours
+	if cfg.Identity.PrivKey == "" && !cfg.Identity.Encrypted() {
+		cur, err := r.Config()
+		if err != nil {
+			return err
+		}
+		if cfg.Identity.PeerID != cur.Identity.PeerID {
+			return errors.New("cannot change the peer ID without a private key")
+		}
+		cfg.Identity.PrivKey = cur.Identity.PrivKey
+		cfg.Identity.EncryptedPrivKey = cur.Identity.EncryptedPrivKey
+	}
+
 	return r.SetConfig(&cfg)
 }
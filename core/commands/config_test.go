@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestShowConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{
+  "Identity": {"PeerID": "QmPeer", "PrivKey": "secret"},
+  "Unknown": {"Kept": true}
+}`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := showConfig(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	if strings.Contains(s, "secret") || strings.Contains(s, "PrivKey") {
+		t.Fatalf("the private key is shown:\n%s", s)
+	}
+	if !strings.Contains(s, "QmPeer") || !strings.Contains(s, `"Kept": true`) {
+		t.Fatalf("fields are missing:\n%s", s)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	notif "github.com/ipfs/go-ipfs/notifications"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	ipdht "github.com/ipfs/go-ipfs/routing/dht"
@@ -159,21 +160,25 @@ FindProviders will return a list of peers who are able to provide the value requ
 			return
 		}
 
-		dht, ok := n.Routing.(*ipdht.IpfsDHT)
-		if !ok {
+		if _, ok := n.Routing.(*ipdht.IpfsDHT); !ok {
 			res.SetError(ErrNotDHT, cmds.ErrNormal)
 			return
 		}
 
 		numProviders := 20
 
-		outChan := make(chan interface{})
-		res.SetOutput((<-chan interface{})(outChan))
-
 		events := make(chan *notif.QueryEvent)
 		ctx := notif.RegisterForQueryEvents(req.Context(), events)
 
-		pchan := dht.FindProvidersAsync(ctx, key.B58KeyDecode(req.Arguments()[0]), numProviders)
+		pchan, err := coreapi.NewCoreAPI(n).Dht().FindProviders(ctx, key.B58KeyDecode(req.Arguments()[0]), numProviders)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		outChan := make(chan interface{})
+		res.SetOutput((<-chan interface{})(outChan))
+
 		go func() {
 			defer close(outChan)
 			for e := range events {
@@ -273,11 +278,11 @@ var findPeerDhtCmd = &cmds.Command{
 			return
 		}
 
-		dht, ok := n.Routing.(*ipdht.IpfsDHT)
-		if !ok {
+		if _, ok := n.Routing.(*ipdht.IpfsDHT); !ok {
 			res.SetError(ErrNotDHT, cmds.ErrNormal)
 			return
 		}
+		api := coreapi.NewCoreAPI(n)
 
 		pid, err := peer.IDB58Decode(req.Arguments()[0])
 		if err != nil {
@@ -300,7 +305,7 @@ var findPeerDhtCmd = &cmds.Command{
 
 		go func() {
 			defer close(events)
-			pi, err := dht.FindPeer(ctx, pid)
+			pi, err := api.Dht().FindPeer(ctx, pid)
 			if err != nil {
 				notif.PublishQueryEvent(ctx, &notif.QueryEvent{
 					Type:  notif.QueryError,
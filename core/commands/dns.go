@@ -1,11 +1,13 @@
 package commands
 
 import (
+	"bytes"
+	"fmt"
 	"io"
-	"strings"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	namesys "github.com/ipfs/go-ipfs/namesys"
+	path "github.com/ipfs/go-ipfs/path"
 	util "github.com/ipfs/go-ipfs/util"
 )
 
@@ -42,7 +44,18 @@ The resolver will give:
   > ipfs dns ipfs.io
   /dns/ipfs.io
   > ipfs dns --recursive
+  /dns/ipfs.io
   /ipfs/QmRzTuh2Lpuz7Gr39stNr6mTFdqAghsZec1JoUnfySUzcy
+
+Every step of the resolution is printed, one per line, ending with the
+final value.
+
+The TXT records of _dnslink.<domain-name> are used if they hold a DNS
+link, else those of <domain-name> itself. Domains are looked up with the
+system resolver, unless DNS.Resolvers in the config names a nameserver
+or DNS-over-HTTPS url for them:
+
+  > ipfs config --json DNS.Resolvers '{"eth": "https://resolver.example/dns-query", ".": "8.8.8.8"}'
 `,
 	},
 
@@ -56,27 +69,50 @@ The resolver will give:
 
 		recursive, _, _ := req.Option("recursive").Bool()
 		name := req.Arguments()[0]
-		resolver := namesys.NewDNSResolver()
+
+		cfg, err := req.InvocContext().GetConfig()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		lookup, err := namesys.NewLookupTXT(cfg.DNS.Resolvers)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		resolver := namesys.NewDNSResolver(lookup)
 
 		depth := 1
 		if recursive {
 			depth = namesys.DefaultDepthLimit
 		}
-		output, err := resolver.ResolveN(req.Context(), name, depth)
-		if err != nil {
+		chain, err := resolver.ResolveChain(req.Context(), name, depth)
+		if err != nil && err != namesys.ErrResolveRecursion {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		res.SetOutput(&ResolvedPath{output})
+		res.SetOutput(&ResolvedChain{chain})
 	},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			output, ok := res.Output().(*ResolvedPath)
+			output, ok := res.Output().(*ResolvedChain)
 			if !ok {
 				return nil, util.ErrCast()
 			}
-			return strings.NewReader(output.Path.String()), nil
+
+			buf := new(bytes.Buffer)
+			for _, p := range output.Chain {
+				fmt.Fprintln(buf, p.String())
+			}
+			return buf, nil
 		},
 	},
-	Type: ResolvedPath{},
+	Type: ResolvedChain{},
+}
+
+// ResolvedChain lists the values a name resolved through, ending with the
+// value it resolved to.
+type ResolvedChain struct {
+	Chain []path.Path
 }
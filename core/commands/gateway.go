@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+var GatewayCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the HTTP gateway",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"denylist": gatewayDenylistCmd,
+	},
+}
+
+var gatewayDenylistCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the content the gateway refuses to serve",
+		Synopsis: `
+ipfs gateway denylist add <entry>...  - Deny content
+ipfs gateway denylist rm <entry>...   - Serve denied content again
+ipfs gateway denylist ls              - List denied content
+ipfs gateway denylist reload          - Read the denylist file again
+`,
+		ShortDescription: `
+The gateway answers requests for denied content with 410 Gone. Entries are
+hashes, which deny an object at any path it is reached by, or /ipfs/ and
+/ipns/ paths, which deny everything under them:
+
+    ipfs gateway denylist add QmHash /ipns/example.com/private
+
+The list is kept in the file Gateway.DenylistFile names in the config.
+Changes made with these commands apply to a running daemon at once. After
+editing the file by hand, run 'ipfs gateway denylist reload'.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add":    gatewayDenylistAddCmd,
+		"rm":     gatewayDenylistRmCmd,
+		"ls":     gatewayDenylistLsCmd,
+		"reload": gatewayDenylistReloadCmd,
+	},
+}
+
+type DenylistOutput struct {
+	Entries []string
+}
+
+var gatewayDenylistAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add hashes and paths to the denylist",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("entry", true, true, "Hashes or /ipfs/ and /ipns/ paths to deny").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		dl, err := n.Denylist()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := dl.Add(req.Arguments()...); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&DenylistOutput{req.Arguments()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: denylistMarshaler("denied "),
+	},
+	Type: DenylistOutput{},
+}
+
+var gatewayDenylistRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove hashes and paths from the denylist",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("entry", true, true, "Denylist entries to remove").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		dl, err := n.Denylist()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := dl.Remove(req.Arguments()...); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&DenylistOutput{req.Arguments()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: denylistMarshaler("allowed "),
+	},
+	Type: DenylistOutput{},
+}
+
+var gatewayDenylistLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the denylist",
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		dl, err := n.Denylist()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&DenylistOutput{dl.List()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: denylistMarshaler(""),
+	},
+	Type: DenylistOutput{},
+}
+
+var gatewayDenylistReloadCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Read the denylist file again",
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		dl, err := n.Denylist()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := dl.Reload(); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&DenylistOutput{dl.List()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*DenylistOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return bytes.NewBufferString(fmt.Sprintf("loaded %d entries\n", len(out.Entries))), nil
+		},
+	},
+	Type: DenylistOutput{},
+}
+
+func denylistMarshaler(prefix string) func(cmds.Response) (io.Reader, error) {
+	return func(res cmds.Response) (io.Reader, error) {
+		out, ok := res.Output().(*DenylistOutput)
+		if !ok {
+			return nil, u.ErrCast()
+		}
+
+		buf := new(bytes.Buffer)
+		for _, e := range out.Entries {
+			fmt.Fprintf(buf, "%s%s\n", prefix, e)
+		}
+		return buf, nil
+	}
+}
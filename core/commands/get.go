@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/cheggaaa/pb"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
@@ -33,6 +34,9 @@ To output a TAR archive instead of unpacked files, use '--archive' or '-a'.
 
 To compress the output with GZIP compression, use '--compress' or '-C'. You
 may also specify the level of compression by specifying '-l=<1-9>'.
+
+Use '--progress' to print every block fetched from the network, the peers
+involved, and the status of any blocks the fetch is stalled on.
 `,
 	},
 
@@ -44,6 +48,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		cmds.BoolOption("archive", "a", "Output a TAR archive"),
 		cmds.BoolOption("compress", "C", "Compress the output with GZIP compression"),
 		cmds.IntOption("compression-level", "l", "The level of compression (1-9)"),
+		cmds.BoolOption("progress", "Report block fetch progress and stalls on stderr"),
 	},
 	PreRun: func(req cmds.Request) error {
 		_, err := getCompressOptions(req)
@@ -62,15 +67,21 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			return
 		}
 		p := path.Path(req.Arguments()[0])
-		ctx := req.Context()
-		dn, err := core.Resolve(ctx, node, p)
-		if err != nil {
-			res.SetError(err, cmds.ErrNormal)
+		archive, _, _ := req.Option("archive").Bool()
+		fetch := func(ctx context.Context) (io.Reader, error) {
+			dn, err := core.Resolve(ctx, node, p)
+			if err != nil {
+				return nil, err
+			}
+			return uarchive.DagArchive(ctx, dn, p.String(), node.DAG, archive, cmplvl)
+		}
+
+		if progress, _, _ := req.Option("progress").Bool(); progress {
+			fetchWithProgress(req, res, node, fetch)
 			return
 		}
 
-		archive, _, _ := req.Option("archive").Bool()
-		reader, err := uarchive.DagArchive(ctx, dn, p.String(), node.DAG, archive, cmplvl)
+		reader, err := fetch(req.Context())
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -78,9 +89,10 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		res.SetOutput(reader)
 	},
 	PostRun: func(req cmds.Request, res cmds.Response) {
-		if res.Output() == nil {
+		if res.Output() == nil || res.Error() != nil {
 			return
 		}
+		printProgress(res)
 		outReader := res.Output().(io.Reader)
 		res.SetOutput(nil)
 
@@ -1,12 +1,11 @@
 package commands
 
 import (
-	"errors"
 	"io"
 	"strings"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
-	namesys "github.com/ipfs/go-ipfs/namesys"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -36,6 +35,11 @@ Resolve the value of another name:
   > ipfs name resolve QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
   QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
 
+Resolved names are cached for as long as their records allow, see
+'ipfs stats ipns'. Use --nocache to look the name up again regardless.
+Use --routing-only to look the name up in the routing system alone,
+without dns, proquints or the cache.
+
 `,
 	},
 
@@ -44,44 +48,29 @@ Resolve the value of another name:
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("recursive", "r", "Resolve until the result is not an IPNS name"),
+		cmds.BoolOption("nocache", "n", "Do not use cached entries"),
+		cmds.BoolOption("routing-only", "Only resolve through the routing system"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
-		if !n.OnlineMode() {
-			err := n.SetupOfflineRouting()
-			if err != nil {
-				res.SetError(err, cmds.ErrNormal)
-				return
-			}
-		}
-
 		var name string
-
-		if len(req.Arguments()) == 0 {
-			if n.Identity == "" {
-				res.SetError(errors.New("Identity not loaded!"), cmds.ErrNormal)
-				return
-			}
-			name = n.Identity.Pretty()
-
-		} else {
+		if len(req.Arguments()) > 0 {
 			name = req.Arguments()[0]
 		}
 
 		recursive, _, _ := req.Option("recursive").Bool()
-		depth := 1
-		if recursive {
-			depth = namesys.DefaultDepthLimit
-		}
-
-		resolver := namesys.NewRoutingResolver(n.Routing)
-		output, err := resolver.ResolveN(req.Context(), name, depth)
+		nocache, _, _ := req.Option("nocache").Bool()
+		routingOnly, _, _ := req.Option("routing-only").Bool()
+		output, err := api.Name().Resolve(req.Context(), name, &coreapi.ResolveOptions{
+			Recursive:   recursive,
+			NoCache:     nocache,
+			RoutingOnly: routingOnly,
+		})
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
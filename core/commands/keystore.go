@@ -0,0 +1,639 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	republisher "github.com/ipfs/go-ipfs/namesys/republisher"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	path "github.com/ipfs/go-ipfs/path"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+var KeyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create and manage the keys used to publish IPNS names",
+		Synopsis: `
+ipfs key gen <name>              - Generate a new named key
+ipfs key list                    - List all local keys
+ipfs key rm <name>               - Remove a key
+ipfs key rename <name> <newName> - Rename a key
+ipfs key rotate                  - Replace the node identity with a new key
+`,
+		ShortDescription: `
+Besides the node identity, known as 'self', names can be published with
+any number of keys kept in the repo's keystore. Pass the key name to
+'ipfs name publish --key'.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"gen":    keyGenCmd,
+		"list":   keyListCmd,
+		"rm":     keyRmCmd,
+		"rename": keyRenameCmd,
+		"rotate": keyRotateCmd,
+	},
+}
+
+// KeyOutput describes a named key by the ipns name it publishes to.
+type KeyOutput struct {
+	Name string
+	Id   string
+}
+
+type KeyOutputList struct {
+	Keys []KeyOutput
+}
+
+var keyGenCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Generate a new key and store it in the keystore",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the key to create"),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("type", "t", "Type of the key to create: rsa or ed25519 (default: rsa)"),
+		cmds.IntOption("size", "s", "Size of an rsa key to create (default: 2048)"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		name := req.Arguments()[0]
+		if name == core.SelfKeyName {
+			res.SetError(fmt.Errorf("cannot create key with name '%s'", name), cmds.ErrClient)
+			return
+		}
+
+		keyType, size, err := keyGenOptions(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		ks, err := n.Keystore()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		sk, _, err := ci.GenerateKeyPair(keyType, size)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if err := ks.Put(name, sk); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out, err := keyOutput(name, sk)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			k, ok := res.Output().(*KeyOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return bytes.NewBufferString(k.Id + "\n"), nil
+		},
+	},
+	Type: KeyOutput{},
+}
+
+var keyListCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List all local keys",
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("l", "Show extra information about keys"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		keys, err := n.IpnsKeys()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		list := make([]KeyOutput, 0, len(keys))
+		for _, nk := range keys {
+			out, err := keyOutput(nk.Name, nk.Key)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			list = append(list, *out)
+		}
+
+		// self first, the others by name
+		if len(list) > 0 && list[0].Name == core.SelfKeyName {
+			sort.Sort(keyOutputs(list[1:]))
+		} else {
+			sort.Sort(keyOutputs(list))
+		}
+		res.SetOutput(&KeyOutputList{list})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: keyOutputListMarshaler,
+	},
+	Type: KeyOutputList{},
+}
+
+var keyRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove a key from the keystore",
+		ShortDescription: `
+Removes the key and stops republishing the name it published to. The
+removed key cannot be recovered.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, true, "Names of the keys to remove").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		ks, err := n.Keystore()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		repub := n.IpnsRepub
+		if repub == nil {
+			repub = republisher.NewRepublisher(n.Namesys, n.Repo.Datastore(), nil)
+		}
+
+		var removed []KeyOutput
+		for _, name := range req.Arguments() {
+			if name == core.SelfKeyName {
+				res.SetError(errors.New("cannot remove key with name 'self'"), cmds.ErrClient)
+				return
+			}
+
+			sk, err := ks.Get(name)
+			if err != nil {
+				res.SetError(fmt.Errorf("%s: %s", name, err), cmds.ErrNormal)
+				return
+			}
+
+			out, err := keyOutput(name, sk)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
+			if err := ks.Delete(name); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
+			err = repub.Forget(key.B58KeyDecode(out.Id))
+			if err != nil && err != republisher.ErrUnknownName {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
+			removed = append(removed, *out)
+		}
+
+		res.SetOutput(&KeyOutputList{removed})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*KeyOutputList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, k := range list.Keys {
+				fmt.Fprintf(buf, "removed %s %s\n", k.Name, k.Id)
+			}
+			return buf, nil
+		},
+	},
+	Type: KeyOutputList{},
+}
+
+var keyRenameCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Rename a key",
+		ShortDescription: `
+Renaming a key keeps the ipns name it publishes to.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the key to rename"),
+		cmds.StringArg("newName", true, false, "New name of the key"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("force", "f", "Overwrite a key already named newName"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		name, newName := req.Arguments()[0], req.Arguments()[1]
+		if name == core.SelfKeyName || newName == core.SelfKeyName {
+			res.SetError(errors.New("cannot rename key to or from 'self'"), cmds.ErrClient)
+			return
+		}
+
+		force, _, err := req.Option("force").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		ks, err := n.Keystore()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		sk, err := ks.Get(name)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if name != newName {
+			exists, err := ks.Has(newName)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if exists {
+				if !force {
+					res.SetError(fmt.Errorf("key by name '%s' already exists, use --force to overwrite", newName), cmds.ErrClient)
+					return
+				}
+				if err := ks.Delete(newName); err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+			}
+
+			// store under the new name first, so a failure never loses the key
+			if err := ks.Put(newName, sk); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if err := ks.Delete(name); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		out, err := keyOutput(newName, sk)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			k, ok := res.Output().(*KeyOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return bytes.NewBufferString(fmt.Sprintf("Key %s renamed to %s\n", k.Id, k.Name)), nil
+		},
+	},
+	Type: KeyOutput{},
+}
+
+// KeyRotateOutput describes an identity key rotation: the retired key, now
+// kept in the keystore, and the ipns name of its successor. When only
+// preparing a rotation, Old is the current identity and Next names the
+// successor in the keystore.
+type KeyRotateOutput struct {
+	Old  KeyOutput
+	New  string
+	Next string `json:",omitempty"`
+}
+
+var keyRotateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Replace the node identity with a new key",
+		ShortDescription: `
+Publishes a succession record, signed by the current identity key, naming
+its successor. From then on the ipns name of the current key resolves
+through the name of the successor, so links to it keep working. Publish to
+the new name with 'ipfs name publish' after restarting.
+
+The current key is kept in the keystore, and the successor is written to
+the config. It becomes the node identity, and the node gets a new peer ID,
+when the daemon restarts.
+
+The successor is generated and committed to ahead of time, with
+'ipfs key rotate --prepare': the commitment names the hash of the
+successor without revealing it, and whoever steals the current key later
+cannot name another successor. Rotating prepares the successor of the new
+identity the same way. Rotating a key that has no prepared successor
+generates one on the spot, and only protects the name if the succession
+is published before the key leaks.
+
+Keys in the keystore are not encrypted, so rotating is refused when the
+identity key is encrypted with a passphrase.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("prepare", "p", "Only generate the successor of the current key and commit to it"),
+		cmds.StringOption("type", "t", "Type of generated keys: rsa or ed25519 (default: rsa)"),
+		cmds.IntOption("size", "s", "Size of generated rsa keys (default: 2048)"),
+		cmds.StringOption("oldkey", "o", "Name to keep the current key under (default: self-<peer id>)"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !n.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		// the old key and the successor are kept in the keystore, which
+		// would undo the encryption of the identity key
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if cfg.Identity.Encrypted() {
+			res.SetError(errors.New("the identity key is encrypted, and rotating it would keep private keys unencrypted in the keystore"), cmds.ErrClient)
+			return
+		}
+
+		keyType, size, err := keyGenOptions(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		prepare, _, err := req.Option("prepare").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		oldName, found, err := req.Option("oldkey").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !found {
+			oldName = core.SelfKeyName + "-" + n.Identity.Pretty()
+		}
+		if oldName == core.SelfKeyName {
+			res.SetError(fmt.Errorf("cannot keep the old key as '%s'", oldName), cmds.ErrClient)
+			return
+		}
+
+		ks, err := n.Keystore()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		old := n.PrivateKey
+		dstore := n.Repo.Datastore()
+		nextName := nextKeyName(n.Identity)
+
+		if prepare {
+			sk, err := prepareSuccessor(req.Context(), n, ks, nextName, old, keyType, size)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			selfOut, err := keyOutput(core.SelfKeyName, old)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			id, err := peer.IDFromPrivateKey(sk)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			res.SetOutput(&KeyRotateOutput{Old: *selfOut, New: id.Pretty(), Next: nextName})
+			return
+		}
+
+		// use the successor committed to, if there is one
+		prepared, err := ks.Has(nextName)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		var sk ci.PrivKey
+		if prepared {
+			sk, err = ks.Get(nextName)
+		} else {
+			sk, _, err = ci.GenerateKeyPair(keyType, size)
+		}
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		id, err := peer.IDFromPrivateKey(sk)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		// keep the old key before retiring it, so a failure never loses it
+		if err := ks.Put(oldName, old); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if err := namesys.PublishSuccession(req.Context(), n.Routing, dstore, old, sk.GetPublic()); err != nil {
+			ks.Delete(oldName)
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		// successors are only looked up once the old name has no current
+		// record, so point it at the new name right away
+		if err := n.Namesys.Publish(req.Context(), old, path.FromString("/ipns/"+id.Pretty())); err != nil {
+			log.Warningf("rotate: publishing the new name under the old key failed: %s", err)
+		}
+
+		if err := n.WriteIdentityKey(sk); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if prepared {
+			if err := ks.Delete(nextName); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		if _, err := prepareSuccessor(req.Context(), n, ks, nextKeyName(id), sk, keyType, size); err != nil {
+			res.SetError(fmt.Errorf("rotated to %s, but preparing its successor failed, run 'ipfs key rotate --prepare' after restarting: %s", id.Pretty(), err), cmds.ErrNormal)
+			return
+		}
+
+		oldOut, err := keyOutput(oldName, old)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&KeyRotateOutput{Old: *oldOut, New: id.Pretty()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*KeyRotateOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			if out.Next != "" {
+				fmt.Fprintf(buf, "%s committed to successor %s, kept as %s\n", out.Old.Id, out.New, out.Next)
+				return buf, nil
+			}
+			fmt.Fprintf(buf, "%s succeeded by %s\n", out.Old.Id, out.New)
+			fmt.Fprintf(buf, "old key kept as %s, restart the daemon to use the new identity\n", out.Old.Name)
+			return buf, nil
+		},
+	},
+	Type: KeyRotateOutput{},
+}
+
+// nextKeyName is the keystore name of the prepared successor of the
+// identity id.
+func nextKeyName(id peer.ID) string {
+	return core.SelfKeyName + "-next-" + id.Pretty()
+}
+
+// prepareSuccessor generates the successor of cur, keeps it in the keystore
+// as name and publishes the commitment of cur to it. A key commits to a
+// single successor, so an existing one is never replaced.
+func prepareSuccessor(ctx context.Context, n *core.IpfsNode, ks keystore.Keystore, name string, cur ci.PrivKey, keyType, size int) (ci.PrivKey, error) {
+	has, err := ks.Has(name)
+	if err != nil {
+		return nil, err
+	}
+	if has {
+		return nil, fmt.Errorf("a successor is already prepared as %s", name)
+	}
+
+	sk, pk, err := ci.GenerateKeyPair(keyType, size)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.Put(name, sk); err != nil {
+		return nil, err
+	}
+	if err := namesys.PublishCommitment(ctx, n.Routing, n.Repo.Datastore(), cur, pk); err != nil {
+		ks.Delete(name)
+		return nil, err
+	}
+	return sk, nil
+}
+
+// keyGenOptions returns the type and size of the key a command was asked to
+// generate with its type and size options.
+func keyGenOptions(req cmds.Request) (int, int, error) {
+	keyType := ci.RSA
+	typ, found, err := req.Option("type").String()
+	if err != nil {
+		return 0, 0, err
+	}
+	if found {
+		t, ok := ci.KeyTypes[typ]
+		if !ok {
+			return 0, 0, fmt.Errorf("unrecognized key type: %s", typ)
+		}
+		keyType = t
+	}
+
+	size := 2048
+	val, found, err := req.Option("size").Int()
+	if err != nil {
+		return 0, 0, err
+	}
+	if found {
+		size = val
+	}
+	if keyType == ci.RSA && size < 1024 {
+		return 0, 0, errors.New("key size must be at least 1024 bits")
+	}
+	return keyType, size, nil
+}
+
+func keyOutput(name string, sk ci.PrivKey) (*KeyOutput, error) {
+	h, err := sk.GetPublic().Hash()
+	if err != nil {
+		return nil, err
+	}
+	return &KeyOutput{Name: name, Id: key.Key(h).B58String()}, nil
+}
+
+func keyOutputListMarshaler(res cmds.Response) (io.Reader, error) {
+	list, ok := res.Output().(*KeyOutputList)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+
+	withID, _, _ := res.Request().Option("l").Bool()
+
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+	for _, k := range list.Keys {
+		if withID {
+			fmt.Fprintf(w, "%s\t%s\t\n", k.Id, k.Name)
+		} else {
+			fmt.Fprintf(w, "%s\n", k.Name)
+		}
+	}
+	w.Flush()
+	return buf, nil
+}
+
+type keyOutputs []KeyOutput
+
+func (ks keyOutputs) Len() int           { return len(ks) }
+func (ks keyOutputs) Less(i, j int) bool { return ks[i].Name < ks[j].Name }
+func (ks keyOutputs) Swap(i, j int)      { ks[i], ks[j] = ks[j], ks[i] }
@@ -13,6 +13,9 @@ var NameCmd = &cmds.Command{
 		Synopsis: `
 ipfs name publish [<name>] <ipfs-path> - Publish an object to IPNS
 ipfs name resolve [<name>]             - Gets the value currently published at an IPNS name
+ipfs name subscribe <name> [<peer>...] - Receive the updates of a name as they are published
+ipfs name unsubscribe <name>           - Stop receiving the updates of a name
+ipfs name subscriptions                - List the names subscribed to
 `,
 		ShortDescription: `
 IPNS is a PKI namespace, where names are the hashes of public keys, and
@@ -51,7 +54,10 @@ Resolve the value of another name:
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"publish": PublishCmd,
-		"resolve": IpnsCmd,
+		"publish":       PublishCmd,
+		"resolve":       IpnsCmd,
+		"subscribe":     ipnsSubscribeCmd,
+		"unsubscribe":   ipnsUnsubscribeCmd,
+		"subscriptions": ipnsSubscriptionsCmd,
 	},
 }
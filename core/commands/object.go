@@ -15,10 +15,9 @@ import (
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	dag "github.com/ipfs/go-ipfs/merkledag"
-	dagutils "github.com/ipfs/go-ipfs/merkledag/utils"
 	path "github.com/ipfs/go-ipfs/path"
-	ft "github.com/ipfs/go-ipfs/unixfs"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -92,14 +91,14 @@ output is the raw data of the object.
 		cmds.StringArg("key", true, false, "Key of the object to retrieve, in base58-encoded multihash format").EnableStdin(),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
 		fpath := path.Path(req.Arguments()[0])
-		node, err := core.Resolve(req.Context(), n, fpath)
+		node, err := api.Object().Get(req.Context(), fpath)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -122,14 +121,14 @@ multihash.
 		cmds.StringArg("key", true, false, "Key of the object to retrieve, in base58-encoded multihash format").EnableStdin(),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
 		fpath := path.Path(req.Arguments()[0])
-		node, err := core.Resolve(req.Context(), n, fpath)
+		node, err := api.Object().Get(req.Context(), fpath)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -181,7 +180,7 @@ This command outputs data in the following encodings:
 		cmds.StringArg("key", true, false, "Key of the object to retrieve (in base58-encoded multihash format)").EnableStdin(),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -189,7 +188,7 @@ This command outputs data in the following encodings:
 
 		fpath := path.Path(req.Arguments()[0])
 
-		object, err := core.Resolve(req.Context(), n, fpath)
+		object, err := api.Object().Get(req.Context(), fpath)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -247,7 +246,7 @@ var objectStatCmd = &cmds.Command{
 		cmds.StringArg("key", true, false, "Key of the object to retrieve (in base58-encoded multihash format)").EnableStdin(),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -255,7 +254,7 @@ var objectStatCmd = &cmds.Command{
 
 		fpath := path.Path(req.Arguments()[0])
 
-		object, err := core.Resolve(req.Context(), n, fpath)
+		object, err := api.Object().Get(req.Context(), fpath)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -396,24 +395,24 @@ Available templates:
 		cmds.StringArg("template", false, false, "optional template to use"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
-		node := new(dag.Node)
+		var template string
 		if len(req.Arguments()) == 1 {
-			template := req.Arguments()[0]
-			var err error
-			node, err = nodeFromTemplate(template)
-			if err != nil {
-				res.SetError(err, cmds.ErrNormal)
-				return
-			}
+			template = req.Arguments()[0]
+		}
+
+		node, err := api.Object().New(req.Context(), template)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
 		}
 
-		k, err := n.DAG.Add(node)
+		k, err := node.Key()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -462,7 +461,7 @@ resulting object hash.
 	},
 	Type: Object{},
 	Run: func(req cmds.Request, res cmds.Response) {
-		nd, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -478,38 +477,34 @@ resulting object hash.
 			return
 		}
 
-		rnode, err := nd.DAG.Get(req.Context(), rhash)
-		if err != nil {
-			res.SetError(err, cmds.ErrNormal)
-			return
-		}
+		rpath := path.FromKey(rhash)
 
 		action := req.Arguments()[1]
 
 		switch action {
 		case "add-link":
-			k, err := addLinkCaller(req, rnode)
+			k, err := addLinkCaller(req, api, rpath)
 			if err != nil {
 				res.SetError(err, cmds.ErrNormal)
 				return
 			}
 			res.SetOutput(&Object{Hash: k.B58String()})
 		case "rm-link":
-			k, err := rmLinkCaller(req, rnode)
+			k, err := rmLinkCaller(req, api, rpath)
 			if err != nil {
 				res.SetError(err, cmds.ErrNormal)
 				return
 			}
 			res.SetOutput(&Object{Hash: k.B58String()})
 		case "set-data":
-			k, err := setDataCaller(req, rnode)
+			k, err := setDataCaller(req, api, rpath)
 			if err != nil {
 				res.SetError(err, cmds.ErrNormal)
 				return
 			}
 			res.SetOutput(&Object{Hash: k.B58String()})
 		case "append-data":
-			k, err := appendDataCaller(req, rnode)
+			k, err := appendDataCaller(req, api, rpath)
 			if err != nil {
 				res.SetError(err, cmds.ErrNormal)
 				return
@@ -532,123 +527,66 @@ resulting object hash.
 	},
 }
 
-func appendDataCaller(req cmds.Request, root *dag.Node) (key.Key, error) {
+func appendDataCaller(req cmds.Request, api coreapi.CoreAPI, root path.Path) (key.Key, error) {
 	if len(req.Arguments()) < 3 {
 		return "", fmt.Errorf("not enough arguments for set-data")
 	}
 
-	nd, err := req.InvocContext().GetNode()
+	nnode, err := api.Object().AppendData(req.Context(), root, []byte(req.Arguments()[2]))
 	if err != nil {
 		return "", err
 	}
 
-	root.Data = append(root.Data, []byte(req.Arguments()[2])...)
-
-	newkey, err := nd.DAG.Add(root)
-	if err != nil {
-		return "", err
-	}
-
-	return newkey, nil
+	return nnode.Key()
 }
 
-func setDataCaller(req cmds.Request, root *dag.Node) (key.Key, error) {
+func setDataCaller(req cmds.Request, api coreapi.CoreAPI, root path.Path) (key.Key, error) {
 	if len(req.Arguments()) < 3 {
 		return "", fmt.Errorf("not enough arguments for set-data")
 	}
 
-	nd, err := req.InvocContext().GetNode()
-	if err != nil {
-		return "", err
-	}
-
-	root.Data = []byte(req.Arguments()[2])
-
-	newkey, err := nd.DAG.Add(root)
+	nnode, err := api.Object().SetData(req.Context(), root, []byte(req.Arguments()[2]))
 	if err != nil {
 		return "", err
 	}
 
-	return newkey, nil
+	return nnode.Key()
 }
 
-func rmLinkCaller(req cmds.Request, root *dag.Node) (key.Key, error) {
+func rmLinkCaller(req cmds.Request, api coreapi.CoreAPI, root path.Path) (key.Key, error) {
 	if len(req.Arguments()) < 3 {
 		return "", fmt.Errorf("not enough arguments for rm-link")
 	}
 
-	nd, err := req.InvocContext().GetNode()
-	if err != nil {
-		return "", err
-	}
-
-	path := req.Arguments()[2]
-
-	e := dagutils.NewDagEditor(nd.DAG, root)
-
-	err = e.RmLink(req.Context(), path)
+	nnode, err := api.Object().RmLink(req.Context(), root, req.Arguments()[2])
 	if err != nil {
 		return "", err
 	}
 
-	nnode := e.GetNode()
-
 	return nnode.Key()
 }
 
-func addLinkCaller(req cmds.Request, root *dag.Node) (key.Key, error) {
+func addLinkCaller(req cmds.Request, api coreapi.CoreAPI, root path.Path) (key.Key, error) {
 	if len(req.Arguments()) < 4 {
 		return "", fmt.Errorf("not enough arguments for add-link")
 	}
 
-	nd, err := req.InvocContext().GetNode()
-	if err != nil {
-		return "", err
-	}
-
-	path := req.Arguments()[2]
-	childk := key.B58KeyDecode(req.Arguments()[3])
+	name := req.Arguments()[2]
+	child := path.FromKey(key.B58KeyDecode(req.Arguments()[3]))
 
 	create, _, err := req.Option("create").Bool()
 	if err != nil {
 		return "", err
 	}
 
-	var createfunc func() *dag.Node
-	if create {
-		createfunc = func() *dag.Node {
-			return &dag.Node{Data: ft.FolderPBData()}
-		}
-	}
-
-	e := dagutils.NewDagEditor(nd.DAG, root)
-
-	childnd, err := nd.DAG.Get(req.Context(), childk)
+	nnode, err := api.Object().AddLink(req.Context(), root, name, child, create)
 	if err != nil {
 		return "", err
 	}
 
-	err = e.InsertNodeAtPath(req.Context(), path, childnd, createfunc)
-	if err != nil {
-		return "", err
-	}
-
-	nnode := e.GetNode()
-
 	return nnode.Key()
 }
 
-func nodeFromTemplate(template string) (*dag.Node, error) {
-	switch template {
-	case "unixfs-dir":
-		nd := new(dag.Node)
-		nd.Data = ft.FolderPBData()
-		return nd, nil
-	default:
-		return nil, fmt.Errorf("template '%s' not found", template)
-	}
-}
-
 // ErrEmptyNode is returned when the input to 'ipfs object put' contains no data
 var ErrEmptyNode = errors.New("no data or links in this node")
 
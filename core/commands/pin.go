@@ -7,7 +7,7 @@ import (
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
-	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -44,7 +44,7 @@ on disk.
 	},
 	Type: PinOutput{},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -60,7 +60,7 @@ on disk.
 			recursive = false
 		}
 
-		added, err := corerepo.Pin(n, req.Context(), req.Arguments(), recursive)
+		added, err := api.Pin().Add(req.Context(), recursive, toPaths(req.Arguments())...)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -109,7 +109,7 @@ collected if needed.
 	},
 	Type: PinOutput{},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -125,7 +125,7 @@ collected if needed.
 			recursive = false // default
 		}
 
-		removed, err := corerepo.Unpin(n, req.Context(), req.Arguments(), recursive)
+		removed, err := api.Pin().Rm(req.Context(), recursive, toPaths(req.Arguments())...)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -177,7 +177,7 @@ Defaults to "direct".
 		cmds.BoolOption("quiet", "q", "Write just hashes of objects"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		api, err := coreAPI(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -189,39 +189,20 @@ Defaults to "direct".
 			return
 		}
 		if !found {
-			typeStr = "direct"
+			typeStr = coreapi.PinDirect
 		}
 
-		switch typeStr {
-		case "all", "direct", "indirect", "recursive":
-		default:
-			err = fmt.Errorf("Invalid type '%s', must be one of {direct, indirect, recursive, all}", typeStr)
+		pins, err := api.Pin().Ls(req.Context(), typeStr)
+		if err != nil {
 			res.SetError(err, cmds.ErrClient)
+			return
 		}
 
-		keys := make(map[string]RefKeyObject)
-		if typeStr == "direct" || typeStr == "all" {
-			for _, k := range n.Pinning.DirectKeys() {
-				keys[k.B58String()] = RefKeyObject{
-					Type:  "direct",
-					Count: 1,
-				}
-			}
-		}
-		if typeStr == "indirect" || typeStr == "all" {
-			for k, v := range n.Pinning.IndirectKeys() {
-				keys[k.B58String()] = RefKeyObject{
-					Type:  "indirect",
-					Count: v,
-				}
-			}
-		}
-		if typeStr == "recursive" || typeStr == "all" {
-			for _, k := range n.Pinning.RecursiveKeys() {
-				keys[k.B58String()] = RefKeyObject{
-					Type:  "recursive",
-					Count: 1,
-				}
+		keys := make(map[string]RefKeyObject, len(pins))
+		for _, p := range pins {
+			keys[p.Key.B58String()] = RefKeyObject{
+				Type:  p.Type,
+				Count: p.Count,
 			}
 		}
 
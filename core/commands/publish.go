@@ -5,13 +5,11 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
-	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
-
-	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
-	core "github.com/ipfs/go-ipfs/core"
-	crypto "github.com/ipfs/go-ipfs/p2p/crypto"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	namesys "github.com/ipfs/go-ipfs/namesys"
 	path "github.com/ipfs/go-ipfs/path"
 )
 
@@ -37,18 +35,30 @@ Publish an <ipfs-path> to your identity name:
   > ipfs name publish /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
   Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
 
-Publish an <ipfs-path> to another public key (not implemented):
+Publish an <ipfs-path> to another key from the keystore (see 'ipfs key'):
 
-  > ipfs name publish /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
+  > ipfs key gen mysite
+  QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
+  > ipfs name publish --key=mysite /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
   Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
 
+Published names are remembered, and the daemon republishes them every
+Ipns.RepublishPeriod, so their records never expire while it runs.
+--lifetime sets how long each record is valid, and --ttl how long
+resolvers may cache it.
+
 `,
 	},
 
 	Arguments: []cmds.Argument{
-		cmds.StringArg("name", false, false, "The IPNS name to publish to. Defaults to your node's peerID"),
+		cmds.StringArg("name", false, false, "The IPNS name to publish to. Must match --key, defaults to its hash"),
 		cmds.StringArg("ipfs-path", true, false, "IPFS path of the obejct to be published at <name>").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.StringOption("key", "k", "Name of the key to publish with, see 'ipfs key list' (default: self)"),
+		cmds.StringOption("lifetime", "t", "Time duration the record will be valid for, e.g. '24h' (default: 24h)"),
+		cmds.StringOption("ttl", "Time duration resolvers may cache the record for, e.g. '1m'"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		log.Debug("Begin Publish")
 		n, err := req.InvocContext().GetNode()
@@ -57,45 +67,46 @@ Publish an <ipfs-path> to another public key (not implemented):
 			return
 		}
 
-		if !n.OnlineMode() {
-			err := n.SetupOfflineRouting()
-			if err != nil {
-				res.SetError(err, cmds.ErrNormal)
-				return
-			}
-		}
-
 		args := req.Arguments()
 
-		if n.Identity == "" {
-			res.SetError(errors.New("Identity not loaded!"), cmds.ErrNormal)
+		kname, _, err := req.Option("key").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
+		pstr := args[0]
 		var name string
-		var pstr string
-
-		switch len(args) {
-		case 2:
-			name = args[0]
-			pstr = args[1]
-			if name != n.Identity.Pretty() {
-				res.SetError(errors.New("keychains not yet implemented"), cmds.ErrNormal)
-				return
-			}
-		case 1:
-			// name = n.Identity.Pretty()
-			pstr = args[0]
+		if len(args) == 2 {
+			name, pstr = args[0], args[1]
 		}
 
-		// TODO n.Keychain.Get(name).PrivKey
-		// TODO(cryptix): is req.Context().Context a child of n.Context()?
-		output, err := publish(req.Context(), n, n.PrivateKey, path.Path(pstr))
+		lifetime, err := durationOption(req, "lifetime", namesys.DefaultRecordLifetime)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		ttl, err := durationOption(req, "ttl", 0)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		published, err := coreapi.NewCoreAPI(n).Name().Publish(req.Context(), path.Path(pstr), &coreapi.PublishOptions{
+			Key:      kname,
+			Name:     name,
+			Lifetime: lifetime,
+			TTL:      ttl,
+		})
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		res.SetOutput(output)
+		res.SetOutput(&IpnsEntry{
+			Name:  published,
+			Value: pstr,
+		})
 	},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
@@ -107,25 +118,23 @@ Publish an <ipfs-path> to another public key (not implemented):
 	Type: IpnsEntry{},
 }
 
-func publish(ctx context.Context, n *core.IpfsNode, k crypto.PrivKey, ref path.Path) (*IpnsEntry, error) {
-	// First, verify the path exists
-	_, err := core.Resolve(ctx, n, ref)
+// durationOption parses the named option as a time.Duration, returning def
+// if it was not given.
+func durationOption(req cmds.Request, name string, def time.Duration) (time.Duration, error) {
+	s, found, err := req.Option(name).String()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-
-	err = n.Namesys.Publish(ctx, k, ref)
-	if err != nil {
-		return nil, err
+	if !found || s == "" {
+		return def, nil
 	}
 
-	hash, err := k.GetPublic().Hash()
+	d, err := time.ParseDuration(s)
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("invalid duration for --%s: %s", name, err)
 	}
-
-	return &IpnsEntry{
-		Name:  key.Key(hash).String(),
-		Value: ref.String(),
-	}, nil
+	if d < 0 {
+		return 0, fmt.Errorf("--%s must not be negative", name)
+	}
+	return d, nil
 }
@@ -6,6 +6,8 @@ import (
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	unixfs "github.com/ipfs/go-ipfs/core/commands/unixfs"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	path "github.com/ipfs/go-ipfs/path"
 	logging "github.com/ipfs/go-ipfs/vendor/go-log-v1.0.0"
 )
 
@@ -48,7 +50,9 @@ ADVANCED COMMANDS
     mount         Mount an ipfs read-only mountpoint
     resolve       Resolve any type of name
     name          Publish or resolve IPNS names
+    key           Create and manage IPNS keys
     dns           Resolve DNS links
+    gateway       Manage the content the gateway refuses to serve
     pin           Pin objects to local storage
     repo gc       Garbage collect unpinned objects
 
@@ -64,6 +68,7 @@ NETWORK COMMANDS
 TOOL COMMANDS
 
     config        Manage configuration
+    api token     Manage the tokens that authenticate to the API
     version       Show ipfs version information
     update        Download and apply go-ipfs updates
     commands      List all available commands
@@ -96,6 +101,8 @@ var rootSubcommands = map[string]*cmds.Command{
 	"dns":       DNSCmd,
 	"get":       GetCmd,
 	"id":        IDCmd,
+	"key":       KeyCmd,
+	"api":       ApiCmd,
 	"log":       LogCmd,
 	"ls":        LsCmd,
 	"mount":     MountCmd,
@@ -111,6 +118,7 @@ var rootSubcommands = map[string]*cmds.Command{
 	"tar":       TarCmd,
 	"tour":      tourCmd,
 	"file":      unixfs.UnixFSCmd,
+	"gateway":   GatewayCmd,
 	"update":    UpdateCmd,
 	"version":   VersionCmd,
 	"bitswap":   BitswapCmd,
@@ -168,3 +176,21 @@ type MessageOutput struct {
 func MessageTextMarshaler(res cmds.Response) (io.Reader, error) {
 	return strings.NewReader(res.Output().(*MessageOutput).Message), nil
 }
+
+// coreAPI returns the API of the node req runs on.
+func coreAPI(req cmds.Request) (coreapi.CoreAPI, error) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	return coreapi.NewCoreAPI(n), nil
+}
+
+// toPaths converts command arguments to paths.
+func toPaths(args []string) []path.Path {
+	paths := make([]path.Path, len(args))
+	for i, a := range args {
+		paths[i] = path.Path(a)
+	}
+	return paths
+}
@@ -11,6 +11,7 @@ import (
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	metrics "github.com/ipfs/go-ipfs/metrics"
+	namesys "github.com/ipfs/go-ipfs/namesys"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
 	u "github.com/ipfs/go-ipfs/util"
@@ -23,7 +24,8 @@ var StatsCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"bw": statBwCmd,
+		"bw":   statBwCmd,
+		"ipns": statIpnsCmd,
 	},
 }
 
@@ -180,3 +182,52 @@ func printStats(out io.Writer, bs *metrics.Stats) {
 	fmt.Fprintf(out, "RateIn: %s/s\n", humanize.Bytes(uint64(bs.RateIn)))
 	fmt.Fprintf(out, "RateOut: %s/s\n", humanize.Bytes(uint64(bs.RateOut)))
 }
+
+var statIpnsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print ipns resolution cache statistics",
+		ShortDescription: `
+Prints how many names are cached, and how many resolutions were answered
+from the cache (hits) or looked up again (misses).
+`,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		// Must be online!
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		cr, ok := nd.Namesys.(namesys.CacheReporter)
+		if !ok {
+			res.SetError(errors.New("name system does not cache names"), cmds.ErrNormal)
+			return
+		}
+
+		stats := cr.CacheStats()
+		res.SetOutput(&stats)
+	},
+	Type: namesys.CacheStats{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			stats, ok := res.Output().(*namesys.CacheStats)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintln(buf, "IPNS cache:")
+			fmt.Fprintf(buf, "\tSize:   %d\n", stats.Size)
+			fmt.Fprintf(buf, "\tHits:   %d\n", stats.Hits)
+			fmt.Fprintf(buf, "\tMisses: %d\n", stats.Misses)
+			return buf, nil
+		},
+	},
+}
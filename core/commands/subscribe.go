@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+var errPushDisabled = errors.New("ipns push is disabled, set Ipns.Push in the config to enable it")
+
+var ipnsSubscribeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Receive the updates of an IPNS name as they are published",
+		ShortDescription: `
+Asks peers to push the records of <name> to this node as soon as they are
+published, instead of waiting for them to propagate through the DHT. By
+default the peer whose ID is <name> is asked, which is the node that
+publishes to its own identity. Pushed records are cached, so 'ipfs name
+resolve' sees them right away.
+
+Both nodes must have Ipns.Push enabled in their config.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The IPNS name to subscribe to"),
+		cmds.StringArg("peer", false, true, "IDs of the peers to subscribe at"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, ps, err := pushService(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		name, err := parseIpnsName(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		var peers []peer.ID
+		for _, s := range req.Arguments()[1:] {
+			p, err := peer.IDB58Decode(s)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			peers = append(peers, p)
+		}
+		if len(peers) == 0 {
+			peers = []peer.ID{peer.ID(name)}
+		}
+		for _, p := range peers {
+			if p == n.Identity {
+				res.SetError(errors.New("cannot subscribe at this node itself"), cmds.ErrClient)
+				return
+			}
+		}
+
+		if err := ps.Subscribe(name, peers...); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&stringList{[]string{name.B58String()}})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*stringList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, s := range list.Strings {
+				fmt.Fprintf(buf, "subscribed to %s\n", s)
+			}
+			return buf, nil
+		},
+	},
+	Type: stringList{},
+}
+
+var ipnsUnsubscribeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stop receiving the updates of an IPNS name",
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The IPNS name to unsubscribe from"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		_, ps, err := pushService(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		name, err := parseIpnsName(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		ps.Unsubscribe(name)
+		res.SetOutput(&stringList{[]string{name.B58String()}})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*stringList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, s := range list.Strings {
+				fmt.Fprintf(buf, "unsubscribed from %s\n", s)
+			}
+			return buf, nil
+		},
+	},
+	Type: stringList{},
+}
+
+var ipnsSubscriptionsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the IPNS names this node is subscribed to",
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		_, ps, err := pushService(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var names []string
+		for _, k := range ps.Subscriptions() {
+			names = append(names, k.B58String())
+		}
+		res.SetOutput(&stringList{names})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
+
+// parseIpnsName decodes an ipns name, the multihash of a public key.
+func parseIpnsName(s string) (key.Key, error) {
+	// names share the format of peer IDs
+	id, err := peer.IDB58Decode(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid ipns name %s: %s", s, err)
+	}
+	return key.Key(id), nil
+}
+
+// pushService returns the node of req and its ipns push service.
+func pushService(req cmds.Request) (*core.IpfsNode, *namesys.PushService, error) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !n.OnlineMode() {
+		return nil, nil, errNotOnline
+	}
+
+	if n.IpnsPush == nil {
+		return nil, nil, errPushDisabled
+	}
+	return n, n.IpnsPush, nil
+}
@@ -9,6 +9,7 @@ import (
 	"sort"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	swarm "github.com/ipfs/go-ipfs/p2p/net/swarm"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	iaddr "github.com/ipfs/go-ipfs/util/ipfsaddr"
@@ -71,12 +72,15 @@ ipfs swarm peers lists the set of peers this node is connected to.
 			return
 		}
 
-		conns := n.PeerHost.Network().Conns()
+		conns, err := coreapi.NewCoreAPI(n).Swarm().Peers(req.Context())
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
 		addrs := make([]string, len(conns))
 		for i, c := range conns {
-			pid := c.RemotePeer()
-			addr := c.RemoteMultiaddr()
-			addrs[i] = fmt.Sprintf("%s/ipfs/%s", addr, pid.Pretty())
+			addrs[i] = fmt.Sprintf("%s/ipfs/%s", c.Addr, c.Peer.Pretty())
 		}
 
 		sort.Sort(sort.StringSlice(addrs))
@@ -231,11 +235,12 @@ ipfs swarm connect /ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3
 			return
 		}
 
+		api := coreapi.NewCoreAPI(n)
 		output := make([]string, len(pis))
 		for i, pi := range pis {
 			output[i] = "connect " + pi.ID.Pretty()
 
-			err := n.PeerHost.Connect(ctx, pi)
+			err := api.Swarm().Connect(ctx, pi)
 			if err != nil {
 				output[i] += " failure: " + err.Error()
 			} else {
@@ -284,30 +289,16 @@ ipfs swarm disconnect /ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQA
 			return
 		}
 
+		api := coreapi.NewCoreAPI(n)
 		output := make([]string, len(iaddrs))
 		for i, addr := range iaddrs {
-			taddr := addr.Transport()
 			output[i] = "disconnect " + addr.ID().Pretty()
 
-			found := false
-			conns := n.PeerHost.Network().ConnsToPeer(addr.ID())
-			for _, conn := range conns {
-				if !conn.RemoteMultiaddr().Equal(taddr) {
-					log.Debug("it's not", conn.RemoteMultiaddr(), taddr)
-					continue
-				}
-
-				if err := conn.Close(); err != nil {
-					output[i] += " failure: " + err.Error()
-				} else {
-					output[i] += " success"
-				}
-				found = true
-				break
-			}
-
-			if !found {
-				output[i] += " failure: conn not found"
+			err := api.Swarm().Disconnect(req.Context(), addr.ID(), addr.Transport())
+			if err != nil {
+				output[i] += " failure: " + err.Error()
+			} else {
+				output[i] += " success"
 			}
 		}
 		res.SetOutput(&stringList{output})
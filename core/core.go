@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	b58 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-base58"
@@ -41,7 +42,9 @@ import (
 	offroute "github.com/ipfs/go-ipfs/routing/offline"
 
 	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	bserv "github.com/ipfs/go-ipfs/blockservice"
+	denylist "github.com/ipfs/go-ipfs/denylist"
 	exchange "github.com/ipfs/go-ipfs/exchange"
 	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
 	bsnet "github.com/ipfs/go-ipfs/exchange/bitswap/network"
@@ -51,6 +54,7 @@ import (
 	ipnsfs "github.com/ipfs/go-ipfs/ipnsfs"
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
 	namesys "github.com/ipfs/go-ipfs/namesys"
+	ipnsrp "github.com/ipfs/go-ipfs/namesys/republisher"
 	path "github.com/ipfs/go-ipfs/path"
 	pin "github.com/ipfs/go-ipfs/pin"
 	repo "github.com/ipfs/go-ipfs/repo"
@@ -58,6 +62,7 @@ import (
 )
 
 const IpnsValidatorTag = "ipns"
+const SuccessionValidatorTag = "succession"
 const kSizeBlockstoreWriteCache = 100
 const kReprovideFrequency = time.Hour * 12
 const discoveryConnTimeout = time.Second * 30
@@ -103,7 +108,9 @@ type IpfsNode struct {
 	Namesys      namesys.NameSystem  // the name system, resolves paths to hashes
 	Diagnostics  *diag.Diagnostics   // the diagnostics service
 	Ping         *ping.PingService
-	Reprovider   *rp.Reprovider // the value reprovider system
+	Reprovider   *rp.Reprovider       // the value reprovider system
+	IpnsRepub    *ipnsrp.Republisher  // the ipns record republisher
+	IpnsPush     *namesys.PushService // pushes ipns records to subscribers, if enabled
 
 	IpnsFs *ipnsfs.Filesystem
 
@@ -111,6 +118,12 @@ type IpfsNode struct {
 	ctx  context.Context
 
 	mode mode
+
+	// passphrase decrypts the private key in the config, if it is encrypted
+	passphrase string
+
+	denylistLk sync.Mutex
+	denylist   *denylist.Denylist
 }
 
 // Mounts defines what the node's mount state is. This should
@@ -158,13 +171,22 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 		return err
 	}
 
+	if d, ok := n.Routing.(*dht.IpfsDHT); ok {
+		d.SetQueryParams(cfg.Routing.Alpha, cfg.Routing.DisjointPaths)
+	}
+
 	// Ok, now we're ready to listen.
 	if err := startListening(ctx, n.PeerHost, cfg); err != nil {
 		return err
 	}
 
-	n.Reprovider = rp.NewReprovider(n.Routing, n.Blockstore)
-	go n.Reprovider.ProvideEvery(ctx, kReprovideFrequency)
+	if err := n.startReprovider(ctx, cfg.Reprovider); err != nil {
+		return err
+	}
+
+	if err := n.startIpnsRepublisher(ctx, cfg.Ipns); err != nil {
+		return err
+	}
 
 	// setup local discovery
 	if do != nil {
@@ -180,6 +202,81 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 	return n.Bootstrap(DefaultBootstrapConfig)
 }
 
+func (n *IpfsNode) startReprovider(ctx context.Context, cfg config.Reprovider) error {
+	interval := kReprovideFrequency
+	if cfg.Interval != "" {
+		dur, err := time.ParseDuration(cfg.Interval)
+		if err != nil {
+			return fmt.Errorf("incorrectly formatted reprovider interval in config: %s", cfg.Interval)
+		}
+		interval = dur
+	}
+
+	keyProvider, err := rp.NewStrategy(cfg.Strategy, n.Blockstore, n.Pinning)
+	if err != nil {
+		return err
+	}
+
+	n.Reprovider = rp.NewReprovider(n.Routing, keyProvider, n.Repo.Datastore())
+	n.Reprovider.SetRateLimit(cfg.RateLimit)
+	go n.Reprovider.ProvideEvery(ctx, interval)
+	return nil
+}
+
+func (n *IpfsNode) startIpnsRepublisher(ctx context.Context, cfg config.Ipns) error {
+	n.IpnsRepub = ipnsrp.NewRepublisher(n.Namesys, n.Repo.Datastore(), n.ipnsKey)
+	n.IpnsRepub.Routing = n.Routing
+
+	if cfg.RepublishPeriod != "" {
+		dur, err := time.ParseDuration(cfg.RepublishPeriod)
+		if err != nil {
+			return fmt.Errorf("incorrectly formatted ipns republish period in config: %s", cfg.RepublishPeriod)
+		}
+		n.IpnsRepub.Interval = dur
+	}
+
+	if cfg.RecordLifetime != "" {
+		dur, err := time.ParseDuration(cfg.RecordLifetime)
+		if err != nil {
+			return fmt.Errorf("incorrectly formatted ipns record lifetime in config: %s", cfg.RecordLifetime)
+		}
+		n.IpnsRepub.RecordLifetime = dur
+	}
+
+	// our own name is initialized with the repo, keep it alive too
+	n.IpnsRepub.AddName(key.Key(n.Identity))
+	go n.IpnsRepub.Run(ctx)
+	return nil
+}
+
+// resolveCacheSize returns the number of names the name system caches.
+func (n *IpfsNode) resolveCacheSize() int {
+	cfg, err := n.Repo.Config()
+	if err != nil || cfg.Ipns.ResolveCacheSize == 0 {
+		return namesys.DefaultResolverCacheSize
+	}
+	if cfg.Ipns.ResolveCacheSize < 0 {
+		return 0
+	}
+	return cfg.Ipns.ResolveCacheSize
+}
+
+// dnsLookup returns the function the name system looks up dns links with,
+// following the resolvers of the config.
+func (n *IpfsNode) dnsLookup() namesys.LookupTXTFunc {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil
+	}
+
+	lookup, err := namesys.NewLookupTXT(cfg.DNS.Resolvers)
+	if err != nil {
+		log.Errorf("invalid DNS.Resolvers in config, using the system resolver: %s", err)
+		return nil
+	}
+	return lookup
+}
+
 func setupDiscoveryOption(d config.Discovery) DiscoveryOption {
 	if d.MDNS.Enabled {
 		return func(h p2phost.Host) (discovery.Service, error) {
@@ -224,7 +321,15 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 	n.Exchange = bitswap.New(ctx, n.Identity, bitswapNetwork, n.Blockstore, alwaysSendToPeer)
 
 	// setup name system
-	n.Namesys = namesys.NewNameSystem(n.Routing)
+	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), n.dnsLookup(), n.resolveCacheSize())
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+	if cfg.Ipns.Push {
+		n.IpnsPush = namesys.NewPushService(ctx, n.PeerHost, n.Namesys)
+	}
 
 	return nil
 }
@@ -376,7 +481,7 @@ func (n *IpfsNode) LoadPrivateKey() error {
 		return err
 	}
 
-	sk, err := loadPrivateKey(&cfg.Identity, n.Identity)
+	sk, err := loadPrivateKey(&cfg.Identity, n.Identity, n.passphrase)
 	if err != nil {
 		return err
 	}
@@ -404,6 +509,11 @@ func (n *IpfsNode) loadBootstrapPeers() ([]peer.PeerInfo, error) {
 // uses it to instantiate a routing system in offline mode.
 // This is primarily used for offline ipns modifications.
 func (n *IpfsNode) SetupOfflineRouting() error {
+	// commands served by an offline daemon each call this
+	if n.Routing != nil {
+		return nil
+	}
+
 	err := n.LoadPrivateKey()
 	if err != nil {
 		return err
@@ -411,13 +521,13 @@ func (n *IpfsNode) SetupOfflineRouting() error {
 
 	n.Routing = offroute.NewOfflineRouter(n.Repo.Datastore(), n.PrivateKey)
 
-	n.Namesys = namesys.NewNameSystem(n.Routing)
+	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), n.dnsLookup(), n.resolveCacheSize())
 
 	return nil
 }
 
-func loadPrivateKey(cfg *config.Identity, id peer.ID) (ic.PrivKey, error) {
-	sk, err := cfg.DecodePrivateKey("passphrase todo!")
+func loadPrivateKey(cfg *config.Identity, id peer.ID, passphrase string) (ic.PrivKey, error) {
+	sk, err := cfg.DecodePrivateKey(passphrase)
 	if err != nil {
 		return nil, err
 	}
@@ -498,15 +608,27 @@ func startListening(ctx context.Context, host p2phost.Host, cfg *config.Config)
 	return nil
 }
 
-func constructDHTRouting(ctx context.Context, host p2phost.Host, dstore ds.ThreadSafeDatastore) (routing.IpfsRouting, error) {
-	dhtRouting := dht.NewDHT(ctx, host, dstore)
-	dhtRouting.Validator[IpnsValidatorTag] = namesys.IpnsRecordValidator
-	return dhtRouting, nil
+// constructDHTRouting returns a RoutingOption for a DHT that only issues
+// queries, and does not serve them, if client is set.
+func constructDHTRouting(client bool) RoutingOption {
+	return func(ctx context.Context, host p2phost.Host, dstore ds.ThreadSafeDatastore) (routing.IpfsRouting, error) {
+		newDHT := dht.NewDHT
+		if client {
+			newDHT = dht.NewDHTClient
+		}
+		dhtRouting := newDHT(ctx, host, dstore)
+		dhtRouting.Validator[IpnsValidatorTag] = namesys.IpnsRecordValidator
+		dhtRouting.Selector[IpnsValidatorTag] = namesys.IpnsSelectorFunc
+		dhtRouting.Validator[SuccessionValidatorTag] = namesys.SuccessionRecordValidator
+		dhtRouting.Selector[SuccessionValidatorTag] = namesys.SuccessionSelectorFunc
+		return dhtRouting, nil
+	}
 }
 
 type RoutingOption func(context.Context, p2phost.Host, ds.ThreadSafeDatastore) (routing.IpfsRouting, error)
 
 type DiscoveryOption func(p2phost.Host) (discovery.Service, error)
 
-var DHTOption RoutingOption = constructDHTRouting
+var DHTOption RoutingOption = constructDHTRouting(false)
+var DHTClientOption RoutingOption = constructDHTRouting(true)
 var NilRouterOption RoutingOption = nilrouting.ConstructNilRouting
@@ -0,0 +1,20 @@
+package coreapi
+
+import (
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+type blockAPI coreAPI
+
+func (api *blockAPI) Get(ctx context.Context, k key.Key) (*blocks.Block, error) {
+	return api.node.Blocks.GetBlock(ctx, k)
+}
+
+func (api *blockAPI) Put(ctx context.Context, data []byte) (key.Key, error) {
+	b := blocks.NewBlock(data)
+	log.Debugf("BlockPut key: '%q'", b.Key())
+	return api.node.Blocks.AddBlock(b)
+}
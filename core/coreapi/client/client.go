@@ -0,0 +1,184 @@
+// Package client is a Go client for the HTTP API of an ipfs daemon.
+//
+// Unlike commands/http, which sends cmds.Requests for the command line, it
+// has a typed method for each call. Outputs stream as the daemon produces
+// them, and connections are kept alive between calls.
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	cmdsHttp "github.com/ipfs/go-ipfs/commands/http"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// Client calls the API of one daemon. It is safe for concurrent use.
+type Client struct {
+	// URL is where the daemon's API is, like "http://127.0.0.1:5001".
+	URL string
+
+	// Token, if not empty, authenticates the client to the API.
+	Token string
+
+	// HTTPClient sends the requests. It is http.DefaultClient if nil, and
+	// needs a TLS configuration to call an API served over HTTPS.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the API at address, which is either a
+// "host:port" or a URL.
+func NewClient(address string) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return &Client{URL: strings.TrimSuffix(address, "/")}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// upload is a request body with its content type.
+type upload struct {
+	body        io.Reader
+	contentType string
+}
+
+// call sends the command at cmd, like "pin/add", and returns the response
+// if it succeeded. Its body is left for the caller to read and close.
+func (c *Client) call(ctx context.Context, cmd string, args []string, opts url.Values, up *upload) (*http.Response, error) {
+	query := url.Values{}
+	for k, v := range opts {
+		query[k] = v
+	}
+	query["arg"] = args
+	query.Set(cmds.EncShort, cmds.JSON)
+	query.Set(cmds.ChanOpt, "true")
+
+	u := c.URL + cmdsHttp.ApiPath + "/" + cmd + "?" + query.Encode()
+
+	var body io.Reader = strings.NewReader("")
+	if up != nil {
+		body = up.body
+	}
+	req, err := http.NewRequest("POST", u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Cancel = ctx.Done()
+	req.Header.Set("User-Agent", fmt.Sprintf("/go-ipfs/%s/", config.CurrentVersionNumber))
+	if up != nil {
+		req.Header.Set("Content-Type", up.contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		defer closeResponse(res)
+		return nil, responseError(res)
+	}
+	return res, nil
+}
+
+// responseError returns the error in a failed response.
+func responseError(res *http.Response) error {
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") {
+		var e cmds.Error
+		if err := json.NewDecoder(res.Body).Decode(&e); err == nil && e.Message != "" {
+			return e
+		}
+	}
+
+	e := cmds.Error{Code: cmds.ErrNormal}
+	if res.StatusCode < http.StatusInternalServerError {
+		e.Code = cmds.ErrClient
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	e.Message = strings.TrimSpace(string(msg))
+	if e.Message == "" {
+		e.Message = res.Status
+	}
+	return e
+}
+
+// streamError returns the error the daemon reported after the response
+// started, once its body has been read.
+func streamError(res *http.Response) error {
+	if msg := res.Trailer.Get(cmdsHttp.StreamErrHeader); msg != "" {
+		return cmds.Error{Message: msg, Code: cmds.ErrNormal}
+	}
+	return nil
+}
+
+// closeResponse reads what is left of res, so its connection can be used
+// again, and closes it.
+func closeResponse(res *http.Response) {
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+}
+
+// decode decodes the single value a command outputs into v.
+func decode(res *http.Response, v interface{}) error {
+	defer closeResponse(res)
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// decodeStream decodes each value a command outputs on a channel into a
+// value from newValue, and passes it to handle.
+func decodeStream(res *http.Response, newValue func() interface{}, handle func(interface{}) error) error {
+	defer closeResponse(res)
+	dec := json.NewDecoder(res.Body)
+	for {
+		v := newValue()
+		err := dec.Decode(v)
+		if err == io.EOF {
+			return streamError(res)
+		}
+		if err != nil {
+			if serr := streamError(res); serr != nil {
+				return serr
+			}
+			return err
+		}
+		if err := handle(v); err != nil {
+			return err
+		}
+	}
+}
+
+// streamReader is a response body that reports the daemon's stream error,
+// if any, instead of its end.
+type streamReader struct {
+	res *http.Response
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	n, err := r.res.Body.Read(p)
+	if err == io.EOF {
+		if serr := streamError(r.res); serr != nil {
+			err = serr
+		}
+	}
+	return n, err
+}
+
+func (r *streamReader) Close() error {
+	return r.res.Body.Close()
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	commands "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	repo "github.com/ipfs/go-ipfs/repo"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	testutil "github.com/ipfs/go-ipfs/util/testutil"
+)
+
+// countingListener counts the connections it accepts.
+type countingListener struct {
+	net.Listener
+	n int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.n, 1)
+	}
+	return c, err
+}
+
+func (l *countingListener) count() int {
+	return int(atomic.LoadInt32(&l.n))
+}
+
+// newTestClient serves the API of an offline node, with a key named
+// "test", and returns a client for it.
+func newTestClient(t *testing.T) (*Client, *countingListener) {
+	ident, err := testutil.RandIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := keystore.NewMemKeystore()
+	if err := ks.Put("test", sk); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := config.Config{
+		Identity: config.Identity{
+			PeerID: ident.ID().Pretty(),
+		},
+	}
+	if err := conf.Identity.SetPrivateKey(ident.PrivateKey(), ""); err != nil {
+		t.Fatal(err)
+	}
+	r := &repo.Mock{
+		C: conf,
+		D: testutil.ThreadSafeCloserMapDatastore(),
+		K: ks,
+	}
+	n, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cctx := commands.Context{
+		ConfigRoot: "/tmp/.mockipfsconfig",
+		LoadConfig: func(path string) (*config.Config, error) {
+			return &conf, nil
+		},
+		ConstructNode: func() (*core.IpfsNode, error) {
+			return n, nil
+		},
+	}
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := &countingListener{Listener: tcp}
+	go corehttp.Serve(n, lis, corehttp.CommandsOption(cctx))
+
+	return NewClient(tcp.Addr().String()), lis
+}
+
+func TestClient(t *testing.T) {
+	c, lis := newTestClient(t)
+	defer lis.Close()
+	ctx := context.Background()
+
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var progress int64
+	file, err := c.Add(ctx, bytes.NewReader(data), &AddOptions{
+		Progress: func(n int64) { progress = n },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != int64(len(data)) {
+		t.Fatalf("progress ended at %d, expected %d", progress, len(data))
+	}
+	// uploads close their connection, the calls after it share a new one
+	conns := lis.count() + 1
+
+	cat, err := c.Cat(ctx, "/ipfs/"+file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(cat)
+	cat.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("cat returned other data than was added")
+	}
+
+	pins, err := c.Pins(ctx, PinRecursive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pins[file] != PinRecursive {
+		t.Fatalf("added file is not pinned recursively: %v", pins)
+	}
+	if _, err := c.Unpin(ctx, true, file); err != nil {
+		t.Fatal(err)
+	}
+	if pinned, err := c.Pin(ctx, false, file); err != nil || len(pinned) != 1 || pinned[0] != file {
+		t.Fatalf("pin returned %v, %v", pinned, err)
+	}
+	if pins, err := c.Pins(ctx, PinDirect); err != nil || pins[file] != PinDirect {
+		t.Fatalf("file is not pinned directly: %v, %v", pins, err)
+	}
+
+	if n := lis.count(); n != conns {
+		t.Fatalf("calls after add opened %d connections, expected them to share one", n-conns+1)
+	}
+
+	dir, err := c.Add(ctx, strings.NewReader("hello"), &AddOptions{Name: "a.txt", Wrap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := c.ObjectPatch(ctx, dir, "add-link", false, "b.txt", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]int{"a.txt": 5, "b.txt": len(data)} {
+		cat, err := c.Cat(ctx, "/ipfs/"+patched+"/"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(cat)
+		cat.Close()
+		if err != nil || len(out) != expected {
+			t.Fatalf("%s in the patched directory: %d bytes, %v", name, len(out), err)
+		}
+	}
+
+	name, err := c.NamePublish(ctx, "/ipfs/"+patched, &NamePublishOptions{Key: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := c.NameResolve(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != "/ipfs/"+patched {
+		t.Fatalf("%s resolved to %s, expected /ipfs/%s", name, resolved, patched)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c, lis := newTestClient(t)
+	defer lis.Close()
+	ctx := context.Background()
+
+	_, err := c.Cat(ctx, "/ipfs/notahash")
+	if _, ok := err.(commands.Error); !ok {
+		t.Fatalf("expected a command error for a bad path, got %v", err)
+	}
+
+	_, err = c.NamePublish(ctx, "/ipfs/notahash", &NamePublishOptions{Key: "missing"})
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("expected an error about the missing key, got %v", err)
+	}
+
+	c.Token = "bad"
+	if _, err := c.Pins(ctx, PinAll); err != nil {
+		t.Fatalf("tokens are not required by default: %s", err)
+	}
+}
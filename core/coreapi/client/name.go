@@ -0,0 +1,70 @@
+package client
+
+import (
+	"net/url"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// NamePublishOptions are the options of NamePublish. The zero value
+// publishes with the node's own key and the default lifetime.
+type NamePublishOptions struct {
+	// Key is the name of the key to publish with, see 'ipfs key list'.
+	Key string
+
+	// Lifetime is how long the record is valid for.
+	Lifetime time.Duration
+
+	// TTL is how long resolvers may cache the record for.
+	TTL time.Duration
+}
+
+// NamePublish publishes p under the name of a key, and returns the name.
+func (c *Client) NamePublish(ctx context.Context, p string, opts *NamePublishOptions) (string, error) {
+	if opts == nil {
+		opts = &NamePublishOptions{}
+	}
+
+	q := url.Values{}
+	if opts.Key != "" {
+		q.Set("key", opts.Key)
+	}
+	if opts.Lifetime != 0 {
+		q.Set("lifetime", opts.Lifetime.String())
+	}
+	if opts.TTL != 0 {
+		q.Set("ttl", opts.TTL.String())
+	}
+	res, err := c.call(ctx, "name/publish", []string{p}, q, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		Name string
+	}
+	if err := decode(res, &out); err != nil {
+		return "", err
+	}
+	return out.Name, nil
+}
+
+// NameResolve returns the path the name points to, following names to
+// other names.
+func (c *Client) NameResolve(ctx context.Context, name string) (string, error) {
+	q := url.Values{}
+	q.Set("recursive", "true")
+	res, err := c.call(ctx, "name/resolve", []string{name}, q, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		Path string
+	}
+	if err := decode(res, &out); err != nil {
+		return "", err
+	}
+	return out.Path, nil
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// ObjectPatch applies op, one of "add-link", "rm-link", "set-data" and
+// "append-data", with args to the object root, and returns the hash of the
+// new object. With create, add-link creates missing directories.
+func (c *Client) ObjectPatch(ctx context.Context, root, op string, create bool, args ...string) (string, error) {
+	q := url.Values{}
+	q.Set("create", strconv.FormatBool(create))
+	res, err := c.call(ctx, "object/patch", append([]string{root, op}, args...), q, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		Hash string
+	}
+	if err := decode(res, &out); err != nil {
+		return "", err
+	}
+	return out.Hash, nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// Pin types, for Pins.
+const (
+	PinDirect    = "direct"
+	PinIndirect  = "indirect"
+	PinRecursive = "recursive"
+	PinAll       = "all"
+)
+
+// Pin pins the objects at paths, and with recursive everything they link
+// to. It returns the hashes pinned.
+func (c *Client) Pin(ctx context.Context, recursive bool, paths ...string) ([]string, error) {
+	return c.pin(ctx, "pin/add", recursive, paths)
+}
+
+// Unpin removes the pins of the objects at paths. It returns the hashes
+// unpinned.
+func (c *Client) Unpin(ctx context.Context, recursive bool, paths ...string) ([]string, error) {
+	return c.pin(ctx, "pin/rm", recursive, paths)
+}
+
+func (c *Client) pin(ctx context.Context, cmd string, recursive bool, paths []string) ([]string, error) {
+	q := url.Values{}
+	q.Set("recursive", strconv.FormatBool(recursive))
+	res, err := c.call(ctx, cmd, paths, q, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Pinned []string
+	}
+	if err := decode(res, &out); err != nil {
+		return nil, err
+	}
+	return out.Pinned, nil
+}
+
+// Pins returns the pinned hashes of type typ, one of the Pin types, with
+// the type each is pinned as.
+func (c *Client) Pins(ctx context.Context, typ string) (map[string]string, error) {
+	q := url.Values{}
+	q.Set("type", typ)
+	res, err := c.call(ctx, "pin/ls", nil, q, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Keys map[string]struct {
+			Type string
+		}
+	}
+	if err := decode(res, &out); err != nil {
+		return nil, err
+	}
+	pins := make(map[string]string, len(out.Keys))
+	for k, v := range out.Keys {
+		pins[k] = v.Type
+	}
+	return pins, nil
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	files "github.com/ipfs/go-ipfs/commands/files"
+	cmdsHttp "github.com/ipfs/go-ipfs/commands/http"
+)
+
+// AddOptions are the options of Add. The zero value adds a balanced dag
+// with the default chunker.
+type AddOptions struct {
+	// Name is the name of the file, kept when it is wrapped.
+	Name string
+
+	// Wrap adds a directory around the file, and returns its hash.
+	Wrap bool
+
+	// Trickle uses the trickle-dag format.
+	Trickle bool
+
+	// OnlyHash computes the hash without storing anything.
+	OnlyHash bool
+
+	// Chunker is the chunking algorithm, like "size-262144" or "rabin".
+	Chunker string
+
+	// Progress, if set, is called with the bytes of the file added so far.
+	Progress func(bytes int64)
+}
+
+// addedObject is an output of the add command.
+type addedObject struct {
+	Name  string
+	Hash  string
+	Bytes int64
+}
+
+// Add adds the data in r and returns the hash of its root, streaming r to
+// the daemon while it is read.
+func (c *Client) Add(ctx context.Context, r io.Reader, opts *AddOptions) (string, error) {
+	if opts == nil {
+		opts = &AddOptions{}
+	}
+
+	q := url.Values{}
+	q.Set("wrap-with-directory", strconv.FormatBool(opts.Wrap))
+	q.Set("trickle", strconv.FormatBool(opts.Trickle))
+	q.Set("only-hash", strconv.FormatBool(opts.OnlyHash))
+	q.Set("progress", strconv.FormatBool(opts.Progress != nil))
+	if opts.Chunker != "" {
+		q.Set("chunker", opts.Chunker)
+	}
+
+	file := files.NewReaderFile(opts.Name, opts.Name, ioutil.NopCloser(r), nil)
+	mfr := cmdsHttp.NewMultiFileReader(files.NewSliceFile("", "", []files.File{file}), true)
+	up := &upload{body: mfr, contentType: "multipart/form-data; boundary=" + mfr.Boundary()}
+
+	res, err := c.call(ctx, "add", nil, q, up)
+	if err != nil {
+		return "", err
+	}
+
+	// with a directory around it, the file is added first
+	var root string
+	err = decodeStream(res, func() interface{} { return new(addedObject) }, func(v interface{}) error {
+		out := v.(*addedObject)
+		switch {
+		case out.Hash != "":
+			root = out.Hash
+		case opts.Progress != nil:
+			opts.Progress(out.Bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if root == "" {
+		return "", io.ErrUnexpectedEOF
+	}
+	return root, nil
+}
+
+// Cat returns the contents of the file at p, as the daemon reads it. The
+// caller must close it.
+func (c *Client) Cat(ctx context.Context, p string) (io.ReadCloser, error) {
+	res, err := c.call(ctx, "cat", []string{p}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{res}, nil
+}
@@ -0,0 +1,33 @@
+package coreapi
+
+import (
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	core "github.com/ipfs/go-ipfs/core"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+	logging "github.com/ipfs/go-ipfs/vendor/go-log-v1.0.0"
+)
+
+var log = logging.Logger("coreapi")
+
+type coreAPI struct {
+	node *core.IpfsNode
+}
+
+// NewCoreAPI returns the API of n.
+func NewCoreAPI(n *core.IpfsNode) CoreAPI {
+	return &coreAPI{node: n}
+}
+
+func (api *coreAPI) Unixfs() Unixfs { return (*unixfsAPI)(api) }
+func (api *coreAPI) Pin() Pin       { return (*pinAPI)(api) }
+func (api *coreAPI) Name() Name     { return (*nameAPI)(api) }
+func (api *coreAPI) Object() Object { return (*objectAPI)(api) }
+func (api *coreAPI) Block() Block   { return (*blockAPI)(api) }
+func (api *coreAPI) Dht() Dht       { return (*dhtAPI)(api) }
+func (api *coreAPI) Swarm() Swarm   { return (*swarmAPI)(api) }
+
+func (api *coreAPI) ResolveNode(ctx context.Context, p path.Path) (*dag.Node, error) {
+	return core.Resolve(ctx, api.node, p)
+}
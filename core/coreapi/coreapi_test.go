@@ -0,0 +1,337 @@
+package coreapi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	core "github.com/ipfs/go-ipfs/core"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	path "github.com/ipfs/go-ipfs/path"
+	repo "github.com/ipfs/go-ipfs/repo"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	testutil "github.com/ipfs/go-ipfs/util/testutil"
+)
+
+// newTestAPI returns the API of an offline node, with a key named "test".
+func newTestAPI(t *testing.T) CoreAPI {
+	ident, err := testutil.RandIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := keystore.NewMemKeystore()
+	if err := ks.Put("test", sk); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := config.Config{
+		Identity: config.Identity{
+			PeerID: ident.ID().Pretty(),
+		},
+	}
+	if err := conf.Identity.SetPrivateKey(ident.PrivateKey(), ""); err != nil {
+		t.Fatal(err)
+	}
+	r := &repo.Mock{
+		C: conf,
+		D: testutil.ThreadSafeCloserMapDatastore(),
+		K: ks,
+	}
+	n, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCoreAPI(n)
+}
+
+func addString(t *testing.T, api CoreAPI, s string, pin bool) path.Path {
+	nd, err := api.Unixfs().Add(context.Background(), strings.NewReader(s), &AddOptions{Pin: pin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := nd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path.FromKey(k)
+}
+
+func TestUnixfs(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+
+	data := bytes.Repeat([]byte("ipfs"), 100000)
+	nd, err := api.Unixfs().Add(ctx, bytes.NewReader(data), &AddOptions{Chunker: "size-1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := nd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := path.FromKey(k)
+
+	r, err := api.Unixfs().Cat(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Size() != uint64(len(data)) {
+		t.Fatalf("size is %d, expected %d", r.Size(), len(data))
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("cat returned other data than was added")
+	}
+
+	links, err := api.Unixfs().Ls(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) == 0 {
+		t.Fatal("a file of many chunks has no links")
+	}
+
+	dir, err := api.Object().New(ctx, "unixfs-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirk, err := dir.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.Unixfs().Cat(ctx, path.FromKey(dirk)); err == nil {
+		t.Fatal("cat of a directory succeeded")
+	}
+}
+
+func TestPin(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+
+	p := addString(t, api, "pin me", false)
+	if pins, err := api.Pin().Ls(ctx, PinRecursive); err != nil || len(pins) != 0 {
+		t.Fatalf("unpinned add left recursive pins %v, %v", pins, err)
+	}
+
+	keys, err := api.Pin().Add(ctx, true, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || path.FromKey(keys[0]) != p {
+		t.Fatalf("pin returned %v, expected %s", keys, p)
+	}
+	pins, err := api.Pin().Ls(ctx, PinRecursive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Key != keys[0] || pins[0].Type != PinRecursive {
+		t.Fatalf("recursive pins are %v", pins)
+	}
+
+	if _, err := api.Pin().Rm(ctx, true, p); err != nil {
+		t.Fatal(err)
+	}
+	if pins, err := api.Pin().Ls(ctx, PinRecursive); err != nil || len(pins) != 0 {
+		t.Fatalf("pins after rm are %v, %v", pins, err)
+	}
+
+	if _, err := api.Pin().Ls(ctx, "sideways"); err == nil {
+		t.Fatal("listed pins of an unknown type")
+	}
+
+	addString(t, api, "pinned by add", true)
+	if pins, err := api.Pin().Ls(ctx, PinRecursive); err != nil || len(pins) != 1 {
+		t.Fatalf("pinned add left recursive pins %v, %v", pins, err)
+	}
+}
+
+func TestObject(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+
+	if _, err := api.Object().New(ctx, "nope"); err == nil {
+		t.Fatal("created an object from an unknown template")
+	}
+
+	dir, err := api.Object().New(ctx, "unixfs-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirk, err := dir.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := path.FromKey(dirk)
+	child := addString(t, api, "child", false)
+
+	nd, err := api.Object().AddLink(ctx, root, "a/b", child, false)
+	if err == nil {
+		t.Fatal("added a link below a missing directory without create")
+	}
+	nd, err = api.Object().AddLink(ctx, root, "a/b", child, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := nd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := api.Object().Get(ctx, path.Path(path.FromKey(k).String()+"/a/b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotk, _ := got.Key()
+	if path.FromKey(gotk) != child {
+		t.Fatalf("a/b is %s, expected %s", gotk, child)
+	}
+
+	// the root it was given is left as it was
+	if again, err := api.Object().Get(ctx, root); err != nil || len(again.Links) != 0 {
+		t.Fatalf("the original root has links after add-link: %v", err)
+	}
+
+	nd, err = api.Object().RmLink(ctx, path.FromKey(k), "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.Object().RmLink(ctx, path.FromKey(k), "c"); err != dag.ErrNotFound {
+		t.Fatalf("removing a missing link returned %v", err)
+	}
+	a, err := nd.GetNodeLink("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	an, err := api.Object().Get(ctx, path.FromKey(key.Key(a.Hash)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(an.Links) != 0 {
+		t.Fatal("a still has links after rm-link")
+	}
+
+	raw, err := api.Object().New(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawk, _ := raw.Key()
+	nd, err = api.Object().SetData(ctx, path.FromKey(rawk), []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, _ = nd.Key()
+	nd, err = api.Object().AppendData(ctx, path.FromKey(k), []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, _ = nd.Key()
+	got, err = api.Object().Get(ctx, path.FromKey(k))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Data) != "foobar" {
+		t.Fatalf("data is %q, expected foobar", got.Data)
+	}
+}
+
+func TestName(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+
+	p := addString(t, api, "named", false)
+	if _, err := api.Name().Publish(ctx, p, &PublishOptions{Key: "missing"}); err == nil {
+		t.Fatal("published with a missing key")
+	}
+
+	for _, kname := range []string{"", "test"} {
+		name, err := api.Name().Publish(ctx, p, &PublishOptions{Key: kname})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resolved, err := api.Name().Resolve(ctx, name, &ResolveOptions{Recursive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved != p {
+			t.Fatalf("%s resolved to %s, expected %s", name, resolved, p)
+		}
+	}
+
+	self, err := api.Name().Resolve(ctx, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self != p {
+		t.Fatalf("the node's own name resolved to %s, expected %s", self, p)
+	}
+
+	self, err = api.Name().Resolve(ctx, "", &ResolveOptions{RoutingOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self != p {
+		t.Fatalf("the node's own name resolved to %s through routing, expected %s", self, p)
+	}
+}
+
+func TestNamePublishOffline(t *testing.T) {
+	// a fresh offline node, its identity key is loaded by the publish
+	api := newTestAPI(t)
+	ctx := context.Background()
+	self := api.(*coreAPI).node.Identity.Pretty()
+
+	p := addString(t, api, "named offline", false)
+	name, err := api.Name().Publish(ctx, p, &PublishOptions{Name: self})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != self {
+		t.Fatalf("published to %s, expected %s", name, self)
+	}
+
+	if _, err := api.Name().Publish(ctx, p, &PublishOptions{Key: "test", Name: self}); err == nil {
+		t.Fatal("published to a name of another key")
+	}
+}
+
+func TestBlock(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+
+	k, err := api.Block().Put(ctx, []byte("a block"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := api.Block().Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b.Data) != "a block" {
+		t.Fatalf("got block %q", b.Data)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+
+	if _, err := api.Swarm().Peers(ctx); err != ErrOffline {
+		t.Fatalf("swarm peers of an offline node returned %v", err)
+	}
+	if _, err := api.Dht().FindProviders(ctx, "", 1); err != ErrOffline {
+		t.Fatalf("dht findprovs of an offline node returned %v", err)
+	}
+}
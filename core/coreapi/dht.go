@@ -0,0 +1,31 @@
+package coreapi
+
+import (
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+)
+
+type dhtAPI coreAPI
+
+func (api *dhtAPI) FindProviders(ctx context.Context, k key.Key, n int) (<-chan peer.PeerInfo, error) {
+	if api.node.Routing == nil {
+		return nil, ErrOffline
+	}
+	return api.node.Routing.FindProvidersAsync(ctx, k, n), nil
+}
+
+func (api *dhtAPI) FindPeer(ctx context.Context, p peer.ID) (peer.PeerInfo, error) {
+	if api.node.Routing == nil {
+		return peer.PeerInfo{}, ErrOffline
+	}
+	return api.node.Routing.FindPeer(ctx, p)
+}
+
+func (api *dhtAPI) Provide(ctx context.Context, k key.Key) error {
+	if api.node.Routing == nil {
+		return ErrOffline
+	}
+	return api.node.Routing.Provide(ctx, k)
+}
@@ -0,0 +1,221 @@
+// Package coreapi is the Go API of an ipfs node, for programs that embed
+// one. It does what the commands do, without going through them: the
+// commands and the gateway are written over it.
+//
+// Paths given to it may be /ipfs/ or /ipns/ paths, or plain hashes.
+package coreapi
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+// ErrOffline is returned by calls that need the node to be online.
+var ErrOffline = errors.New("this action must be run in online mode, try running 'ipfs daemon' first")
+
+// CoreAPI is the API of one node.
+type CoreAPI interface {
+	Unixfs() Unixfs
+	Pin() Pin
+	Name() Name
+	Object() Object
+	Block() Block
+	Dht() Dht
+	Swarm() Swarm
+
+	// ResolveNode returns the object at p.
+	ResolveNode(ctx context.Context, p path.Path) (*dag.Node, error)
+}
+
+// Reader reads a unixfs file.
+type Reader interface {
+	io.ReadSeeker
+	io.Closer
+
+	// Size is the size of the file.
+	Size() uint64
+}
+
+// AddOptions are the options of Unixfs.Add. The zero value adds a
+// balanced dag with the default chunker, pinned indirectly.
+type AddOptions struct {
+	// Chunker is the chunking algorithm, like "size-262144" or "rabin".
+	Chunker string
+
+	// Trickle uses the trickle-dag format.
+	Trickle bool
+
+	// Pin pins the root recursively, as 'ipfs add' does. Otherwise it is
+	// only pinned indirectly, like the objects under it, until something
+	// pins or links to it.
+	Pin bool
+}
+
+// Unixfs adds and reads files.
+type Unixfs interface {
+	// Add adds the data in r as a file, and returns its root.
+	Add(ctx context.Context, r io.Reader, opts *AddOptions) (*dag.Node, error)
+
+	// Cat returns a reader of the file at p. It returns uio.ErrIsDir for
+	// directories.
+	Cat(ctx context.Context, p path.Path) (Reader, error)
+
+	// Ls returns the links of the object at p.
+	Ls(ctx context.Context, p path.Path) ([]*dag.Link, error)
+}
+
+// Pin types, for Pin.Ls.
+const (
+	PinDirect    = "direct"
+	PinIndirect  = "indirect"
+	PinRecursive = "recursive"
+	PinAll       = "all"
+)
+
+// Pinned is a pinned object.
+type Pinned struct {
+	Key key.Key
+
+	// Type is PinDirect, PinIndirect or PinRecursive.
+	Type string
+
+	// Count is how many times an indirect pin is pinned, 1 for the others.
+	Count int
+}
+
+// Pin keeps objects from being garbage collected.
+type Pin interface {
+	// Add pins the objects at paths, and with recursive everything they
+	// link to. It returns their keys.
+	Add(ctx context.Context, recursive bool, paths ...path.Path) ([]key.Key, error)
+
+	// Rm removes the pins of the objects at paths, and returns their keys.
+	Rm(ctx context.Context, recursive bool, paths ...path.Path) ([]key.Key, error)
+
+	// Ls returns the pins of type typ, one of the Pin types.
+	Ls(ctx context.Context, typ string) ([]Pinned, error)
+}
+
+// PublishOptions are the options of Name.Publish. The zero value publishes
+// with the node's own key for the configured lifetime.
+type PublishOptions struct {
+	// Key is the name of the key to publish with, see 'ipfs key list'.
+	Key string
+
+	// Name, if set, is the ipns name to publish to. It must be the name of
+	// Key.
+	Name string
+
+	// Lifetime is how long the record is valid for, the configured
+	// Ipns.RecordLifetime if zero.
+	Lifetime time.Duration
+
+	// TTL is how long resolvers may cache the record for.
+	TTL time.Duration
+}
+
+// ResolveOptions are the options of Name.Resolve.
+type ResolveOptions struct {
+	// Recursive resolves until the result is not an ipns name.
+	Recursive bool
+
+	// NoCache looks the name up even if it is cached.
+	NoCache bool
+
+	// RoutingOnly looks the name up in the routing system alone, without
+	// dns, proquints or the cache.
+	RoutingOnly bool
+}
+
+// Name publishes and resolves ipns names.
+type Name interface {
+	// Publish publishes p under the name of a key, and returns the name.
+	Publish(ctx context.Context, p path.Path, opts *PublishOptions) (string, error)
+
+	// Resolve returns the path name points to. The empty name is the
+	// node's own.
+	Resolve(ctx context.Context, name string, opts *ResolveOptions) (path.Path, error)
+}
+
+// Object reads and builds merkledag objects.
+type Object interface {
+	// New adds a new object from template, "" or "unixfs-dir".
+	New(ctx context.Context, template string) (*dag.Node, error)
+
+	// Get returns the object at p.
+	Get(ctx context.Context, p path.Path) (*dag.Node, error)
+
+	// Put adds nd.
+	Put(ctx context.Context, nd *dag.Node) (key.Key, error)
+
+	// AddLink returns a copy of the object at root with a link at name,
+	// which may have slashes, to the object at child. With create, missing
+	// directories along name are created.
+	AddLink(ctx context.Context, root path.Path, name string, child path.Path, create bool) (*dag.Node, error)
+
+	// RmLink returns a copy of the object at root without the link at
+	// name. It returns merkledag.ErrNotFound if there is none.
+	RmLink(ctx context.Context, root path.Path, name string) (*dag.Node, error)
+
+	// SetData returns a copy of the object at root with data.
+	SetData(ctx context.Context, root path.Path, data []byte) (*dag.Node, error)
+
+	// AppendData returns a copy of the object at root with data after its
+	// own.
+	AppendData(ctx context.Context, root path.Path, data []byte) (*dag.Node, error)
+}
+
+// Block reads and writes raw blocks.
+type Block interface {
+	// Get returns the block k, fetching it if needed.
+	Get(ctx context.Context, k key.Key) (*blocks.Block, error)
+
+	// Put adds data as a block, and returns its key.
+	Put(ctx context.Context, data []byte) (key.Key, error)
+}
+
+// Dht queries the routing system. Callers can follow the queries with
+// notifications.RegisterForQueryEvents on ctx.
+type Dht interface {
+	// FindProviders returns up to n peers that provide k.
+	FindProviders(ctx context.Context, k key.Key, n int) (<-chan peer.PeerInfo, error)
+
+	// FindPeer returns the addresses of p.
+	FindPeer(ctx context.Context, p peer.ID) (peer.PeerInfo, error)
+
+	// Provide announces that the node provides k.
+	Provide(ctx context.Context, k key.Key) error
+}
+
+// Conn is a connection to a peer.
+type Conn struct {
+	Peer peer.ID
+	Addr ma.Multiaddr
+}
+
+// Swarm manages the node's connections.
+type Swarm interface {
+	// Peers returns the open connections.
+	Peers(ctx context.Context) ([]Conn, error)
+
+	// Connect opens a connection to pi.
+	Connect(ctx context.Context, pi peer.PeerInfo) error
+
+	// Disconnect closes the connection to p at addr. It returns
+	// ErrNotConnected if there is none.
+	Disconnect(ctx context.Context, p peer.ID, addr ma.Multiaddr) error
+}
+
+// ErrNotConnected is returned by Swarm.Disconnect for peers the node has
+// no connection to at the address.
+var ErrNotConnected = errors.New("conn not found")
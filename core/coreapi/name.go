@@ -0,0 +1,106 @@
+package coreapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	core "github.com/ipfs/go-ipfs/core"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	republisher "github.com/ipfs/go-ipfs/namesys/republisher"
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+var errNoIdentity = errors.New("Identity not loaded!")
+
+type nameAPI coreAPI
+
+// setupRouting gives an offline node the routing names need.
+func (api *nameAPI) setupRouting() error {
+	n := api.node
+	if !n.OnlineMode() {
+		if err := n.SetupOfflineRouting(); err != nil {
+			return err
+		}
+	}
+	if n.Identity == "" {
+		return errNoIdentity
+	}
+	return nil
+}
+
+func (api *nameAPI) Publish(ctx context.Context, p path.Path, opts *PublishOptions) (string, error) {
+	if opts == nil {
+		opts = &PublishOptions{}
+	}
+	n := api.node
+	if err := api.setupRouting(); err != nil {
+		return "", err
+	}
+
+	kname := opts.Key
+	if kname == "" {
+		kname = core.SelfKeyName
+	}
+	k, err := n.GetKey(kname)
+	if err != nil {
+		return "", fmt.Errorf("key '%s': %s", kname, err)
+	}
+
+	hash, err := k.GetPublic().Hash()
+	if err != nil {
+		return "", err
+	}
+	if opts.Name != "" && opts.Name != key.Key(hash).B58String() {
+		return "", fmt.Errorf("name %s does not match key '%s'", opts.Name, kname)
+	}
+
+	// First, verify the path exists
+	if _, err := core.Resolve(ctx, n, p); err != nil {
+		return "", err
+	}
+
+	repub := n.IpnsRepub
+	if repub == nil {
+		// offline, remember the name for the next daemon to republish
+		repub = republisher.NewRepublisher(n.Namesys, n.Repo.Datastore(), nil)
+	}
+	if err := repub.Publish(ctx, k, p, opts.Lifetime, opts.TTL); err != nil {
+		return "", err
+	}
+	return key.Key(hash).String(), nil
+}
+
+func (api *nameAPI) Resolve(ctx context.Context, name string, opts *ResolveOptions) (path.Path, error) {
+	if opts == nil {
+		opts = &ResolveOptions{}
+	}
+	n := api.node
+	if err := api.setupRouting(); err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		name = n.Identity.Pretty()
+	}
+
+	depth := 1
+	if opts.Recursive {
+		depth = namesys.DefaultDepthLimit
+	}
+	if opts.RoutingOnly {
+		resolver := namesys.NewRoutingResolver(n.Routing)
+		return resolver.ResolveN(ctx, strings.TrimPrefix(name, "/ipns/"), depth)
+	}
+
+	if !strings.HasPrefix(name, "/ipns/") {
+		name = "/ipns/" + name
+	}
+	if opts.NoCache {
+		ctx = namesys.ContextWithNoCache(ctx)
+	}
+	return n.Namesys.ResolveN(ctx, name, depth)
+}
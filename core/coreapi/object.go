@@ -0,0 +1,104 @@
+package coreapi
+
+import (
+	"fmt"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	dagutils "github.com/ipfs/go-ipfs/merkledag/utils"
+	path "github.com/ipfs/go-ipfs/path"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+)
+
+type objectAPI coreAPI
+
+func (api *objectAPI) New(ctx context.Context, template string) (*dag.Node, error) {
+	nd := new(dag.Node)
+	switch template {
+	case "":
+	case "unixfs-dir":
+		nd.Data = ft.FolderPBData()
+	default:
+		return nil, fmt.Errorf("template '%s' not found", template)
+	}
+
+	if _, err := api.node.DAG.Add(nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+func (api *objectAPI) Get(ctx context.Context, p path.Path) (*dag.Node, error) {
+	return (*coreAPI)(api).ResolveNode(ctx, p)
+}
+
+func (api *objectAPI) Put(ctx context.Context, nd *dag.Node) (key.Key, error) {
+	return api.node.DAG.Add(nd)
+}
+
+func (api *objectAPI) AddLink(ctx context.Context, root path.Path, name string, child path.Path, create bool) (*dag.Node, error) {
+	rootnd, err := api.Get(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	childnd, err := api.Get(ctx, child)
+	if err != nil {
+		return nil, err
+	}
+
+	var createfunc func() *dag.Node
+	if create {
+		createfunc = func() *dag.Node {
+			return &dag.Node{Data: ft.FolderPBData()}
+		}
+	}
+
+	// the editor changes the nodes it is given, which the resolver may share
+	e := dagutils.NewDagEditor(api.node.DAG, rootnd.Copy())
+	if err := e.InsertNodeAtPath(ctx, name, childnd, createfunc); err != nil {
+		return nil, err
+	}
+	return e.GetNode(), nil
+}
+
+func (api *objectAPI) RmLink(ctx context.Context, root path.Path, name string) (*dag.Node, error) {
+	rootnd, err := api.Get(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	e := dagutils.NewDagEditor(api.node.DAG, rootnd.Copy())
+	if err := e.RmLink(ctx, name); err != nil {
+		return nil, err
+	}
+	return e.GetNode(), nil
+}
+
+func (api *objectAPI) SetData(ctx context.Context, root path.Path, data []byte) (*dag.Node, error) {
+	return api.patchData(ctx, root, data, false)
+}
+
+func (api *objectAPI) AppendData(ctx context.Context, root path.Path, data []byte) (*dag.Node, error) {
+	return api.patchData(ctx, root, data, true)
+}
+
+func (api *objectAPI) patchData(ctx context.Context, root path.Path, data []byte, appendData bool) (*dag.Node, error) {
+	rootnd, err := api.Get(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	nd := rootnd.Copy()
+	if appendData {
+		nd.Data = append(nd.Data, data...)
+	} else {
+		nd.Data = data
+	}
+
+	if _, err := api.node.DAG.Add(nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
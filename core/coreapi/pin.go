@@ -0,0 +1,106 @@
+package coreapi
+
+import (
+	"fmt"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+type pinAPI coreAPI
+
+func (api *pinAPI) Add(ctx context.Context, recursive bool, paths ...path.Path) ([]key.Key, error) {
+	n := api.node
+	dagnodes, err := api.resolveAll(ctx, paths)
+	if err != nil {
+		return nil, fmt.Errorf("pin: %s", err)
+	}
+
+	var out []key.Key
+	for _, dagnode := range dagnodes {
+		k, err := dagnode.Key()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := n.Pinning.Pin(ctx, dagnode, recursive); err != nil {
+			return nil, fmt.Errorf("pin: %s", err)
+		}
+		out = append(out, k)
+	}
+
+	if err := n.Pinning.Flush(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (api *pinAPI) Rm(ctx context.Context, recursive bool, paths ...path.Path) ([]key.Key, error) {
+	n := api.node
+	dagnodes, err := api.resolveAll(ctx, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var unpinned []key.Key
+	for _, dagnode := range dagnodes {
+		k, err := dagnode.Key()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := n.Pinning.Unpin(ctx, k, recursive); err != nil {
+			return nil, err
+		}
+		unpinned = append(unpinned, k)
+	}
+
+	if err := n.Pinning.Flush(); err != nil {
+		return nil, err
+	}
+	return unpinned, nil
+}
+
+// resolveAll resolves every path before anything is pinned, so a bad path
+// changes nothing.
+func (api *pinAPI) resolveAll(ctx context.Context, paths []path.Path) ([]*dag.Node, error) {
+	dagnodes := make([]*dag.Node, 0, len(paths))
+	for _, p := range paths {
+		dagnode, err := (*coreAPI)(api).ResolveNode(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		dagnodes = append(dagnodes, dagnode)
+	}
+	return dagnodes, nil
+}
+
+func (api *pinAPI) Ls(ctx context.Context, typ string) ([]Pinned, error) {
+	switch typ {
+	case PinAll, PinDirect, PinIndirect, PinRecursive:
+	default:
+		return nil, fmt.Errorf("Invalid type '%s', must be one of {direct, indirect, recursive, all}", typ)
+	}
+
+	p := api.node.Pinning
+	var pins []Pinned
+	if typ == PinDirect || typ == PinAll {
+		for _, k := range p.DirectKeys() {
+			pins = append(pins, Pinned{Key: k, Type: PinDirect, Count: 1})
+		}
+	}
+	if typ == PinIndirect || typ == PinAll {
+		for k, c := range p.IndirectKeys() {
+			pins = append(pins, Pinned{Key: k, Type: PinIndirect, Count: c})
+		}
+	}
+	if typ == PinRecursive || typ == PinAll {
+		for _, k := range p.RecursiveKeys() {
+			pins = append(pins, Pinned{Key: k, Type: PinRecursive, Count: 1})
+		}
+	}
+	return pins, nil
+}
@@ -0,0 +1,45 @@
+package coreapi
+
+import (
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+)
+
+type swarmAPI coreAPI
+
+func (api *swarmAPI) Peers(ctx context.Context) ([]Conn, error) {
+	if api.node.PeerHost == nil {
+		return nil, ErrOffline
+	}
+
+	conns := api.node.PeerHost.Network().Conns()
+	out := make([]Conn, len(conns))
+	for i, c := range conns {
+		out[i] = Conn{Peer: c.RemotePeer(), Addr: c.RemoteMultiaddr()}
+	}
+	return out, nil
+}
+
+func (api *swarmAPI) Connect(ctx context.Context, pi peer.PeerInfo) error {
+	if api.node.PeerHost == nil {
+		return ErrOffline
+	}
+	return api.node.PeerHost.Connect(ctx, pi)
+}
+
+func (api *swarmAPI) Disconnect(ctx context.Context, p peer.ID, addr ma.Multiaddr) error {
+	if api.node.PeerHost == nil {
+		return ErrOffline
+	}
+
+	for _, conn := range api.node.PeerHost.Network().ConnsToPeer(p) {
+		if !conn.RemoteMultiaddr().Equal(addr) {
+			log.Debug("it's not", conn.RemoteMultiaddr(), addr)
+			continue
+		}
+		return conn.Close()
+	}
+	return ErrNotConnected
+}
@@ -0,0 +1,71 @@
+package coreapi
+
+import (
+	"io"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	importer "github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+	pin "github.com/ipfs/go-ipfs/pin"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+)
+
+type unixfsAPI coreAPI
+
+func (api *unixfsAPI) Add(ctx context.Context, r io.Reader, opts *AddOptions) (*dag.Node, error) {
+	if opts == nil {
+		opts = &AddOptions{}
+	}
+	n := api.node
+
+	chnk, err := chunk.FromString(r, opts.Chunker)
+	if err != nil {
+		return nil, err
+	}
+
+	mp := n.Pinning.GetManual()
+	build := importer.BuildDagFromReader
+	if opts.Trickle {
+		build = importer.BuildTrickleDagFromReader
+	}
+	nd, err := build(n.DAG, chnk, importer.PinIndirectCB(mp))
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Pin {
+		k, err := nd.Key()
+		if err != nil {
+			return nil, err
+		}
+		mp.RemovePinWithMode(k, pin.Indirect)
+		mp.PinWithMode(k, pin.Recursive)
+		if err := n.Pinning.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return nd, nil
+}
+
+func (api *unixfsAPI) Cat(ctx context.Context, p path.Path) (Reader, error) {
+	nd, err := (*coreAPI)(api).ResolveNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := uio.NewDagReader(ctx, nd, api.node.DAG)
+	if err != nil {
+		return nil, err
+	}
+	return dr, nil
+}
+
+func (api *unixfsAPI) Ls(ctx context.Context, p path.Path) ([]*dag.Link, error) {
+	nd, err := (*coreAPI)(api).ResolveNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return nd.Links, nil
+}
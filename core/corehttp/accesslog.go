@@ -0,0 +1,180 @@
+package corehttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+// Access log formats.
+const (
+	// AccessLogCommon is the Common Log Format most web servers write.
+	AccessLogCommon = "common"
+	// AccessLogJSON writes a JSON object per request.
+	AccessLogJSON = "json"
+)
+
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogOption writes a line to out for each request to the options after
+// it, in format, AccessLogCommon or AccessLogJSON. To log every request it
+// must be the first option.
+func AccessLogOption(out io.Writer, format string) ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		var write func(*bytes.Buffer, *accessLogEntry)
+		switch format {
+		case "", AccessLogCommon:
+			write = writeCommonLog
+		case AccessLogJSON:
+			write = writeJSONLog
+		default:
+			return nil, fmt.Errorf("unknown access log format %q, expected %q or %q", format, AccessLogCommon, AccessLogJSON)
+		}
+
+		var lk sync.Mutex
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			rec := newResponseRecorder(w)
+			childMux.ServeHTTP(rec, r)
+
+			buf := new(bytes.Buffer)
+			write(buf, &accessLogEntry{r: r, rec: rec, end: time.Now()})
+
+			lk.Lock()
+			defer lk.Unlock()
+			if _, err := out.Write(buf.Bytes()); err != nil {
+				log.Errorf("writing the access log: %s", err)
+			}
+		})
+		return childMux, nil
+	}
+}
+
+type accessLogEntry struct {
+	r   *http.Request
+	rec *responseRecorder
+	end time.Time
+}
+
+func (e *accessLogEntry) remoteHost() string {
+	host, _, err := net.SplitHostPort(e.r.RemoteAddr)
+	if err != nil {
+		return e.r.RemoteAddr
+	}
+	return host
+}
+
+func writeCommonLog(buf *bytes.Buffer, e *accessLogEntry) {
+	user := "-"
+	if e.r.URL.User != nil && e.r.URL.User.Username() != "" {
+		user = e.r.URL.User.Username()
+	}
+	size := "-"
+	if e.rec.bytes > 0 {
+		size = strconv.FormatInt(e.rec.bytes, 10)
+	}
+	fmt.Fprintf(buf, "%s - %s [%s] %s %d %s\n",
+		e.remoteHost(), user, e.rec.start.Format(clfTimeFormat),
+		strconv.Quote(e.r.Method+" "+e.r.RequestURI+" "+e.r.Proto),
+		e.rec.status, size)
+}
+
+func writeJSONLog(buf *bytes.Buffer, e *accessLogEntry) {
+	json.NewEncoder(buf).Encode(struct {
+		Time     string  `json:"time"`
+		Remote   string  `json:"remote"`
+		Host     string  `json:"host"`
+		Method   string  `json:"method"`
+		URI      string  `json:"uri"`
+		Proto    string  `json:"proto"`
+		Status   int     `json:"status"`
+		Bytes    int64   `json:"bytes"`
+		Duration float64 `json:"duration"`
+		Referer  string  `json:"referer,omitempty"`
+		Agent    string  `json:"agent,omitempty"`
+	}{
+		Time:     e.rec.start.Format(time.RFC3339Nano),
+		Remote:   e.remoteHost(),
+		Host:     e.r.Host,
+		Method:   e.r.Method,
+		URI:      e.r.RequestURI,
+		Proto:    e.r.Proto,
+		Status:   e.rec.status,
+		Bytes:    e.rec.bytes,
+		Duration: e.end.Sub(e.rec.start).Seconds(),
+		Referer:  e.r.Referer(),
+		Agent:    e.r.UserAgent(),
+	})
+}
+
+// responseRecorder is a http.ResponseWriter that records the status and
+// size of the response, and when it started.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	start     time.Time
+	firstByte time.Time // zero until the header is written
+	status    int
+	bytes     int64
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{
+		ResponseWriter: w,
+		start:          time.Now(),
+		status:         http.StatusOK,
+	}
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseRecorder) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+// Hijack lets the commands handler stream its own responses. What it writes
+// to the connection is not recorded.
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer cannot be hijacked")
+	}
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
+	return h.Hijack()
+}
@@ -7,12 +7,17 @@ import (
 	"strconv"
 	"strings"
 
+	lru "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/hashicorp/golang-lru"
 	cors "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/rs/cors"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	apitoken "github.com/ipfs/go-ipfs/apitoken"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	commands "github.com/ipfs/go-ipfs/commands"
 	cmdsHttp "github.com/ipfs/go-ipfs/commands/http"
 	core "github.com/ipfs/go-ipfs/core"
 	corecommands "github.com/ipfs/go-ipfs/core/commands"
+	path "github.com/ipfs/go-ipfs/path"
 	config "github.com/ipfs/go-ipfs/repo/config"
 )
 
@@ -99,6 +104,68 @@ func patchCORSVars(c *cmdsHttp.ServerConfig, addr net.Addr) {
 	}
 }
 
+// tokenAuth authenticates API requests by the tokens in store. Every token
+// may ask for the version, so clients can check it is valid.
+func tokenAuth(store *apitoken.Store) cmdsHttp.AuthFunc {
+	return func(r *http.Request) (*cmdsHttp.Access, error) {
+		t, err := store.Lookup(cmdsHttp.BearerToken(r))
+		if err != nil {
+			return nil, err
+		}
+
+		access := &cmdsHttp.Access{
+			Allows: func(path []string) bool {
+				return (len(path) == 1 && path[0] == "version") || t.Allows(path)
+			},
+		}
+		if t.ReadOnly {
+			access.Root = corecommands.RootRO
+		}
+		return access, nil
+	}
+}
+
+// TokenAuthOption refuses requests to the options after it that carry no
+// valid API token, when API.RequireToken is set in the config. Commands
+// check the token against its allowlist themselves, anything else served
+// with them needs a token that may call every command. To guard every
+// handler it must be the first option.
+func TokenAuthOption() ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		rcfg, err := n.Repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		if !rcfg.API.RequireToken {
+			return mux, nil
+		}
+
+		store := apitoken.NewStore(n.Repo.Datastore())
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, cmdsHttp.ApiPath+"/") {
+				childMux.ServeHTTP(w, r)
+				return
+			}
+
+			t, err := store.Lookup(cmdsHttp.BearerToken(r))
+			if err != nil {
+				log.Warningf("API refused unauthenticated request to %s: %s", r.URL, err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if t.ReadOnly || len(t.Allow) > 0 {
+				log.Warningf("API refused request to %s, not allowed by its token", r.URL)
+				http.Error(w, "token may not access "+r.URL.Path, http.StatusForbidden)
+				return
+			}
+			childMux.ServeHTTP(w, r)
+		})
+		return childMux, nil
+	}
+}
+
 func commandsOption(cctx commands.Context, command *commands.Command) ServeOption {
 	return func(n *core.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 
@@ -117,12 +184,118 @@ func commandsOption(cctx commands.Context, command *commands.Command) ServeOptio
 		addCORSDefaults(cfg)
 		patchCORSVars(cfg, l.Addr())
 
+		if rcfg.API.RequireToken {
+			cfg.Authenticate = tokenAuth(apitoken.NewStore(n.Repo.Datastore()))
+		}
+
+		if command == corecommands.RootRO {
+			dl, err := n.Denylist()
+			if err != nil && err != core.ErrNoDenylist {
+				return nil, err
+			}
+			if dl != nil {
+				cfg.Refuse, err = refuseDenied(n, &BlockList{Denylist: dl})
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
 		cmdHandler := cmdsHttp.NewHandler(cctx, command, cfg)
 		mux.Handle(cmdsHttp.ApiPath+"/", cmdHandler)
 		return mux, nil
 	}
 }
 
+// contentArgs names the arguments of the read-only commands that are paths
+// to content, or its keys.
+var contentArgs = map[string]bool{
+	"ipfs-path": true,
+	"key":       true,
+}
+
+// resolvedCacheSize is the number of /ipfs/ paths refuseDenied keeps the
+// objects along of.
+const resolvedCacheSize = 1024
+
+// refuseDenied refuses the requests with a content argument that names
+// content on bl's denylist, or a path through it, like the gateway the
+// read-only commands are served with. Arguments that do not resolve are
+// left to the command.
+func refuseDenied(n *core.IpfsNode, bl *BlockList) (func(commands.Request) (int, error), error) {
+	// the objects along an /ipfs/ path never change, only whether they are
+	// denied, so they are resolved once.
+	resolved, err := lru.New(resolvedCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(req commands.Request) (int, error) {
+		for _, arg := range contentArguments(req) {
+			p := arg
+			if !strings.HasPrefix(p, "/") {
+				p = ipfsPathPrefix + p
+			}
+			if bl.DeniesPath(p) {
+				return http.StatusGone, errDenied
+			}
+
+			keys, err := pathKeys(req.Context(), n, resolved, p)
+			if err == nil && bl.DeniesKeys(keys) {
+				return http.StatusGone, errDenied
+			}
+		}
+		return 0, nil
+	}, nil
+}
+
+// contentArguments returns the arguments of req that contentArgs names.
+func contentArguments(req commands.Request) []string {
+	defs := req.Command().Arguments
+	var args []string
+	for i, arg := range req.Arguments() {
+		if len(defs) == 0 {
+			break
+		}
+		def := defs[len(defs)-1] // the variadic one
+		if i < len(defs) {
+			def = defs[i]
+		}
+		if contentArgs[def.Name] {
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
+// pathKeys returns the keys of the objects along p, from resolved if p is
+// an /ipfs/ path resolved before. A bare /ipfs/ key is not resolved at all.
+func pathKeys(ctx context.Context, n *core.IpfsNode, resolved *lru.Cache, p string) ([]key.Key, error) {
+	segs := path.Path(p).Segments()
+	immutable := len(segs) > 0 && segs[0] == "ipfs"
+	if immutable && len(segs) == 2 {
+		return []key.Key{key.B58KeyDecode(segs[1])}, nil
+	}
+	if immutable {
+		if keys, ok := resolved.Get(p); ok {
+			return keys.([]key.Key), nil
+		}
+	}
+
+	nodes, err := core.ResolveComponents(ctx, n, path.Path(p))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := nodeKeys(nodes)
+	if err != nil {
+		return nil, err
+	}
+	if immutable {
+		resolved.Add(p, keys)
+	}
+	return keys, nil
+}
+
 func CommandsOption(cctx commands.Context) ServeOption {
 	return commandsOption(cctx, corecommands.Root)
 }
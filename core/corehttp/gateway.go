@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"sync"
 
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	core "github.com/ipfs/go-ipfs/core"
+	denylist "github.com/ipfs/go-ipfs/denylist"
 	id "github.com/ipfs/go-ipfs/p2p/protocol/identify"
 )
 
@@ -19,8 +21,20 @@ type GatewayConfig struct {
 	Headers   map[string][]string
 	BlockList *BlockList
 	Writable  bool
+
+	// CacheSize bounds, in bytes, the decoded nodes kept between requests.
+	// Zero uses DefaultCacheSize, a negative size disables the cache.
+	CacheSize int
+
+	// MimeTypes maps file extensions to the content type files with them
+	// are served as, unless their unixfs metadata has one.
+	MimeTypes map[string]string
 }
 
+// DefaultCacheSize is the size of the gateway's node cache, unless
+// configured.
+const DefaultCacheSize = 64 << 20
+
 func NewGateway(conf GatewayConfig) *Gateway {
 	return &Gateway{
 		Config: conf,
@@ -36,6 +50,23 @@ func (g *Gateway) ServeOption() ServeOption {
 		}
 
 		g.Config.Headers = cfg.Gateway.HTTPHeaders
+		if g.Config.CacheSize == 0 {
+			g.Config.CacheSize = cfg.Gateway.CacheSize
+		}
+		if g.Config.MimeTypes == nil {
+			g.Config.MimeTypes = cfg.Gateway.MimeTypes
+		}
+
+		if g.Config.BlockList == nil {
+			g.Config.BlockList = &BlockList{}
+		}
+		if g.Config.BlockList.Denylist == nil {
+			dl, err := n.Denylist()
+			if err != nil && err != core.ErrNoDenylist {
+				return nil, err
+			}
+			g.Config.BlockList.Denylist = dl
+		}
 
 		gateway, err := newGatewayHandler(n, g.Config)
 		if err != nil {
@@ -71,6 +102,10 @@ type Decider func(string) bool
 type BlockList struct {
 	mu      sync.RWMutex
 	Decider Decider
+
+	// Denylist, if set, lists content refused with 410 Gone, by path or by
+	// any object a path reaches. It is set before the list is used.
+	Denylist *denylist.Denylist
 }
 
 func (b *BlockList) ShouldAllow(s string) bool {
@@ -94,3 +129,23 @@ func (b *BlockList) SetDecider(d Decider) {
 func (b *BlockList) ShouldBlock(s string) bool {
 	return !b.ShouldAllow(s)
 }
+
+// DeniesPath returns whether the denylist refuses the request path p by
+// itself, before it is resolved.
+func (b *BlockList) DeniesPath(p string) bool {
+	return b.Denylist != nil && b.Denylist.Blocks(p)
+}
+
+// DeniesKeys returns whether the denylist refuses any of keys, the objects
+// along a resolved path.
+func (b *BlockList) DeniesKeys(keys []key.Key) bool {
+	if b.Denylist == nil {
+		return false
+	}
+	for _, k := range keys {
+		if b.Denylist.BlocksKey(k) {
+			return true
+		}
+	}
+	return false
+}
@@ -14,12 +14,13 @@ import (
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	core "github.com/ipfs/go-ipfs/core"
-	"github.com/ipfs/go-ipfs/importer"
-	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
 	"github.com/ipfs/go-ipfs/routing"
+	ft "github.com/ipfs/go-ipfs/unixfs"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	ftpb "github.com/ipfs/go-ipfs/unixfs/pb"
 )
 
 const (
@@ -31,29 +32,48 @@ const (
 // (it serves requests like GET /ipfs/QmVRzPKPzNtSrEzBFm2UZfxmPAgnaLke4DMcerbsGGSaFe/link)
 type gatewayHandler struct {
 	node   *core.IpfsNode
+	api    coreapi.CoreAPI
 	config GatewayConfig
+
+	// files are read through dag, which caches nodes between requests
+	dag dag.DAGService
+
+	// mimeTypes is config.MimeTypes, keyed by lowercase ".ext"
+	mimeTypes map[string]string
 }
 
 func newGatewayHandler(node *core.IpfsNode, conf GatewayConfig) (*gatewayHandler, error) {
 	i := &gatewayHandler{
 		node:   node,
+		api:    coreapi.NewCoreAPI(node),
 		config: conf,
+		dag:    node.DAG,
+	}
+
+	size := conf.CacheSize
+	if size == 0 {
+		size = DefaultCacheSize
+	}
+	if size > 0 {
+		i.dag = uio.NewNodeCache(node.DAG, size)
 	}
-	return i, nil
-}
 
-// TODO(cryptix):  find these helpers somewhere else
-func (i *gatewayHandler) newDagFromReader(r io.Reader) (*dag.Node, error) {
-	// TODO(cryptix): change and remove this helper once PR1136 is merged
-	// return ufs.AddFromReader(i.node, r.Body)
-	return importer.BuildDagFromReader(
-		i.node.DAG,
-		chunk.DefaultSplitter(r),
-		importer.BasicPinnerCB(i.node.Pinning.GetManual()))
+	i.mimeTypes = make(map[string]string, len(conf.MimeTypes))
+	for ext, t := range conf.MimeTypes {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		i.mimeTypes[strings.ToLower(ext)] = t
+	}
+	return i, nil
 }
 
 // TODO(btc): break this apart into separate handlers using a more expressive muxer
 func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := newResponseRecorder(w)
+	defer observeRequest(r, rec)
+	w = rec
+
 	if i.config.Writable {
 		switch r.Method {
 		case "POST":
@@ -69,7 +89,7 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == "GET" || r.Method == "HEAD" {
-		i.getOrHeadHandler(w, r)
+		i.getOrHeadHandler(w, r, false)
 		return
 	}
 
@@ -85,7 +105,9 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Error(errmsg) // TODO(cryptix): log errors until we have a better way to expose these (counter metrics maybe)
 }
 
-func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request) {
+// getOrHeadHandler serves r. rewritten is set when r was rewritten by a
+// _redirects rule, which is then not applied again.
+func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request, rewritten bool) {
 	ctx, cancel := context.WithCancel(i.node.Context())
 	defer cancel()
 
@@ -98,7 +120,7 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	// the redirects and links would end up as http://example.net/ipns/example.net
 	originalUrlPath := urlPath
 	ipnsHostname := false
-	hdr := r.Header["X-IPNS-Original-Path"]
+	hdr := r.Header[originalPathHeader]
 	if len(hdr) > 0 {
 		originalUrlPath = hdr[0]
 		ipnsHostname = true
@@ -110,13 +132,29 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	nd, err := core.Resolve(ctx, i.node, path.Path(urlPath))
+	start := time.Now()
+	nd, err := i.resolve(ctx, urlPath)
+	observeResolve(urlPath, start, err)
+	if err == errDenied {
+		webErrorWithCode(w, urlPath, errDenied, http.StatusGone)
+		return
+	}
 	if err != nil {
+		if _, ok := err.(path.ErrNoLink); ok && i.serveNotFound(ctx, w, r, ipnsHostname, rewritten) {
+			return
+		}
 		webError(w, "Path Resolve error", err, http.StatusBadRequest)
 		return
 	}
 
-	etag := gopath.Base(urlPath)
+	k, err := nd.Key()
+	if err != nil {
+		internalWebError(w, err)
+		return
+	}
+
+	// the etag is quoted, so If-Range requests can match it
+	etag := `"` + k.String() + `"`
 	if r.Header.Get("If-None-Match") == etag {
 		w.WriteHeader(http.StatusNotModified)
 		return
@@ -138,7 +176,7 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		w.Header().Set("Suborigin", pathRoot)
 	}
 
-	dr, err := uio.NewDagReader(ctx, nd, i.node.DAG)
+	dr, err := uio.NewDagReader(ctx, nd, i.dag)
 	if err != nil && err != uio.ErrIsDir {
 		// not a directory and still an error
 		internalWebError(w, err)
@@ -161,6 +199,9 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	if err == nil {
 		defer dr.Close()
 		_, name := gopath.Split(urlPath)
+		if ctype := i.contentType(nd, name); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
 		http.ServeContent(w, r, name, modtime, dr)
 		return
 	}
@@ -182,18 +223,26 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 			}
 
 			// return index page instead.
-			nd, err := core.Resolve(ctx, i.node, path.Path(urlPath+"/index.html"))
+			nd, err := i.resolve(ctx, urlPath+"/index.html")
+			if err == errDenied {
+				webErrorWithCode(w, urlPath, errDenied, http.StatusGone)
+				return
+			}
 			if err != nil {
 				internalWebError(w, err)
 				return
 			}
-			dr, err := uio.NewDagReader(ctx, nd, i.node.DAG)
+			dr, err := uio.NewDagReader(ctx, nd, i.dag)
 			if err != nil {
 				internalWebError(w, err)
 				return
 			}
 			defer dr.Close()
 
+			if ctype := i.contentType(nd, link.Name); ctype != "" {
+				w.Header().Set("Content-Type", ctype)
+			}
+
 			// write to request
 			if r.Method != "HEAD" {
 				io.Copy(w, dr)
@@ -256,13 +305,13 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (i *gatewayHandler) postHandler(w http.ResponseWriter, r *http.Request) {
-	nd, err := i.newDagFromReader(r.Body)
+	nd, err := i.api.Unixfs().Add(i.node.Context(), r.Body, &coreapi.AddOptions{Pin: true})
 	if err != nil {
 		internalWebError(w, err)
 		return
 	}
 
-	k, err := i.node.DAG.Add(nd)
+	k, err := nd.Key()
 	if err != nil {
 		internalWebError(w, err)
 		return
@@ -273,187 +322,226 @@ func (i *gatewayHandler) postHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, ipfsPathPrefix+k.String(), http.StatusCreated)
 }
 
-func (i *gatewayHandler) putEmptyDirHandler(w http.ResponseWriter, r *http.Request) {
-	newnode := uio.NewEmptyDirectory()
-
-	key, err := i.node.DAG.Add(newnode)
+// editPath splits a request path like /ipfs/<root>/a/b into the path of the
+// root object and the components below it.
+func editPath(urlPath string) (path.Path, []string, error) {
+	p, err := path.ParsePath(urlPath)
 	if err != nil {
-		webError(w, "Could not recursively add new node", err, http.StatusInternalServerError)
-		return
+		return "", nil, err
+	}
+	segs := p.Segments()
+	if len(segs) < 2 || segs[1] == "" {
+		return "", nil, path.ErrNoComponents
 	}
 
-	i.addUserHeaders(w) // ok, _now_ write user's headers.
-	w.Header().Set("IPFS-Hash", key.String())
-	http.Redirect(w, r, ipfsPathPrefix+key.String()+"/", http.StatusCreated)
+	root, err := path.FromSegments("/", segs[0], segs[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return root, segs[2:], nil
 }
 
-func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO(cryptix): either ask mildred about the flow of this or rewrite it
-	webErrorWithCode(w, "Sorry, PUT is bugged right now, closing request", errors.New("handler disabled"), http.StatusInternalServerError)
-	return
-	urlPath := r.URL.Path
-	pathext := urlPath[5:]
-	var err error
-	if urlPath == ipfsPathPrefix+"QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/" {
-		i.putEmptyDirHandler(w, r)
-		return
+// checkDirectories returns an error unless nd and every node it has along
+// components, up to the first missing one, is a unixfs directory.
+func (i *gatewayHandler) checkDirectories(ctx context.Context, nd *dag.Node, components []string) error {
+	nodes, err := i.node.Resolver.ResolveLinks(ctx, nd, components)
+	if _, ok := err.(path.ErrNoLink); err != nil && !ok {
+		return err
 	}
 
-	var newnode *dag.Node
-	if pathext[len(pathext)-1] == '/' {
-		newnode = uio.NewEmptyDirectory()
-	} else {
-		newnode, err = i.newDagFromReader(r.Body)
+	for _, n := range nodes {
+		pbn, err := ft.FromBytes(n.Data)
 		if err != nil {
-			webError(w, "Could not create DAG from request", err, http.StatusInternalServerError)
-			return
+			return err
+		}
+		if pbn.GetType() != ftpb.Data_Directory {
+			return errNotDirectory
 		}
 	}
+	return nil
+}
 
-	ctx, cancel := context.WithCancel(i.node.Context())
+var errNotDirectory = errors.New("not a directory")
+
+// putHandler adds the request body as a file at the request path, or an
+// empty directory if the path ends with a slash. Missing directories along
+// the path are created. A PUT of just a root with a trailing slash creates
+// a new empty directory.
+func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(i.node.Context(), time.Minute)
 	defer cancel()
 
-	ipfsNode, err := core.Resolve(ctx, i.node, path.Path(urlPath))
+	rootPath, components, err := editPath(r.URL.Path)
 	if err != nil {
-		// FIXME HTTP error code
-		webError(w, "Could not resolve name", err, http.StatusInternalServerError)
+		webError(w, "Invalid path", err, http.StatusBadRequest)
 		return
 	}
-
-	k, err := ipfsNode.Key()
-	if err != nil {
-		webError(w, "Could not get key from resolved node", err, http.StatusInternalServerError)
+	if len(components) == 0 {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			i.writeEdit(ctx, w, r, uio.NewEmptyDirectory(), nil)
+			return
+		}
+		webErrorWithCode(w, "Cannot override existing object", errors.New("path must name a link below the root"), http.StatusBadRequest)
 		return
 	}
 
-	h, components, err := path.SplitAbsPath(path.FromKey(k))
+	rootnd, err := i.api.ResolveNode(ctx, rootPath)
 	if err != nil {
-		webError(w, "Could not split path", err, http.StatusInternalServerError)
+		webError(w, "Could not resolve root object", err, http.StatusBadRequest)
 		return
 	}
 
-	if len(components) < 1 {
-		err = fmt.Errorf("Cannot override existing object")
-		webError(w, "http gateway", err, http.StatusBadRequest)
+	// the new node is linked from the last directory, which must not be a
+	// file, and neither may any directory above it.
+	if err := i.checkDirectories(ctx, rootnd, components[:len(components)-1]); err != nil {
+		webError(w, "Could not resolve parent directory", err, http.StatusBadRequest)
 		return
 	}
 
-	tctx, cancel := context.WithTimeout(ctx, time.Minute)
-	defer cancel()
-	// TODO(cryptix): could this be core.Resolve() too?
-	rootnd, err := i.node.Resolver.DAG.Get(tctx, key.Key(h))
+	var newnode *dag.Node
+	if strings.HasSuffix(r.URL.Path, "/") {
+		newnode, err = i.api.Object().New(ctx, "unixfs-dir")
+	} else {
+		newnode, err = i.api.Unixfs().Add(ctx, r.Body, &coreapi.AddOptions{Pin: true})
+	}
 	if err != nil {
-		webError(w, "Could not resolve root object", err, http.StatusBadRequest)
+		webError(w, "Could not create DAG from request", err, http.StatusInternalServerError)
 		return
 	}
 
-	// resolving path components into merkledag nodes. if a component does not
-	// resolve, create empty directories (which will be linked and populated below.)
-	pathNodes, err := i.node.Resolver.ResolveLinks(tctx, rootnd, components[:len(components)-1])
-	if _, ok := err.(path.ErrNoLink); ok {
-		// Create empty directories, links will be made further down the code
-		for len(pathNodes) < len(components) {
-			pathNodes = append(pathNodes, uio.NewDirectory(i.node.DAG).GetNode())
-		}
-	} else if err != nil {
-		webError(w, "Could not resolve parent object", err, http.StatusBadRequest)
+	rootk, err := rootnd.Key()
+	if err != nil {
+		internalWebError(w, err)
 		return
 	}
-
-	for i := len(pathNodes) - 1; i >= 0; i-- {
-		newnode, err = pathNodes[i].UpdateNodeLink(components[i], newnode)
-		if err != nil {
-			webError(w, "Could not update node links", err, http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err := i.node.DAG.AddRecursive(newnode); err != nil {
-		webError(w, "Could not add recursively new node", err, http.StatusInternalServerError)
+	newk, err := newnode.Key()
+	if err != nil {
+		internalWebError(w, err)
 		return
 	}
 
-	// Redirect to new path
-	key, err := newnode.Key()
+	nd, err := i.api.Object().AddLink(ctx, path.FromKey(rootk), strings.Join(components, "/"), path.FromKey(newk), true)
 	if err != nil {
-		webError(w, "Could not get key of new node", err, http.StatusInternalServerError)
+		webError(w, "Could not insert node", err, http.StatusInternalServerError)
 		return
 	}
 
-	i.addUserHeaders(w) // ok, _now_ write user's headers.
-	w.Header().Set("IPFS-Hash", key.String())
-	http.Redirect(w, r, ipfsPathPrefix+key.String()+"/"+strings.Join(components, "/"), http.StatusCreated)
+	i.writeEdit(ctx, w, r, nd, components)
 }
 
+// deleteHandler removes the link at the request path.
 func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
-	urlPath := r.URL.Path
-	ctx, cancel := context.WithCancel(i.node.Context())
+	ctx, cancel := context.WithTimeout(i.node.Context(), time.Minute)
 	defer cancel()
 
-	ipfsNode, err := core.Resolve(ctx, i.node, path.Path(urlPath))
+	rootPath, components, err := editPath(r.URL.Path)
 	if err != nil {
-		// FIXME HTTP error code
-		webError(w, "Could not resolve name", err, http.StatusInternalServerError)
+		webError(w, "Invalid path", err, http.StatusBadRequest)
 		return
 	}
-
-	k, err := ipfsNode.Key()
-	if err != nil {
-		webError(w, "Could not get key from resolved node", err, http.StatusInternalServerError)
+	if len(components) == 0 {
+		webErrorWithCode(w, "Cannot delete root object", errors.New("path must name a link below the root"), http.StatusBadRequest)
 		return
 	}
 
-	h, components, err := path.SplitAbsPath(path.FromKey(k))
+	rootnd, err := i.api.ResolveNode(ctx, rootPath)
 	if err != nil {
-		webError(w, "Could not split path", err, http.StatusInternalServerError)
+		webError(w, "Could not resolve root object", err, http.StatusBadRequest)
 		return
 	}
 
-	tctx, cancel := context.WithTimeout(ctx, time.Minute)
-	defer cancel()
-	rootnd, err := i.node.Resolver.DAG.Get(tctx, key.Key(h))
+	rootk, err := rootnd.Key()
 	if err != nil {
-		webError(w, "Could not resolve root object", err, http.StatusBadRequest)
+		internalWebError(w, err)
 		return
 	}
 
-	pathNodes, err := i.node.Resolver.ResolveLinks(tctx, rootnd, components[:len(components)-1])
-	if err != nil {
-		webError(w, "Could not resolve parent object", err, http.StatusBadRequest)
+	nd, err := i.api.Object().RmLink(ctx, path.FromKey(rootk), strings.Join(components, "/"))
+	if err == dag.ErrNotFound {
+		webErrorWithCode(w, "Could not delete link", err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		webError(w, "Could not delete link", err, http.StatusInternalServerError)
 		return
 	}
 
-	// TODO(cyrptix): assumes len(pathNodes) > 1 - not found is an error above?
-	err = pathNodes[len(pathNodes)-1].RemoveNodeLink(components[len(components)-1])
+	i.writeEdit(ctx, w, r, nd, components[:len(components)-1])
+}
+
+// writeEdit responds to a successful edit with the new root, and redirects
+// to the directory at components under it. The new root is pinned
+// recursively, so what the client was given the hash of stays on the node.
+func (i *gatewayHandler) writeEdit(ctx context.Context, w http.ResponseWriter, r *http.Request, root *dag.Node, components []string) {
+	k, err := i.node.DAG.Add(root)
 	if err != nil {
-		webError(w, "Could not delete link", err, http.StatusBadRequest)
+		webError(w, "Could not add new root", err, http.StatusInternalServerError)
+		return
+	}
+	if _, err := i.api.Pin().Add(ctx, true, path.FromKey(k)); err != nil {
+		webError(w, "Could not pin new root", err, http.StatusInternalServerError)
 		return
 	}
 
-	newnode := pathNodes[len(pathNodes)-1]
-	for i := len(pathNodes) - 2; i >= 0; i-- {
-		newnode, err = pathNodes[i].UpdateNodeLink(components[i], newnode)
-		if err != nil {
-			webError(w, "Could not update node links", err, http.StatusInternalServerError)
-			return
-		}
+	location := ipfsPathPrefix + k.String() + "/"
+	if len(components) > 0 {
+		location += strings.Join(components, "/")
 	}
 
-	if err := i.node.DAG.AddRecursive(newnode); err != nil {
-		webError(w, "Could not add recursively new node", err, http.StatusInternalServerError)
-		return
+	i.addUserHeaders(w) // ok, _now_ write user's headers.
+	w.Header().Set("IPFS-Hash", k.String())
+	http.Redirect(w, r, location, http.StatusCreated)
+}
+
+// contentType returns the type to serve the file nd, named name, as: the
+// MimeType in its unixfs metadata, or else the configured type of its
+// extension. If it returns "", http.ServeContent goes by the system's type
+// for the extension, and failing that sniffs the content.
+func (i *gatewayHandler) contentType(nd *dag.Node, name string) string {
+	if md, err := ft.MetadataFromBytes(nd.Data); err == nil && md.MimeType != "" {
+		return md.MimeType
+	}
+
+	return i.mimeTypes[strings.ToLower(gopath.Ext(name))]
+}
+
+var errDenied = errors.New("content is on the gateway's denylist")
+
+// resolve resolves urlPath, returning errDenied if the denylist refuses
+// the path or any object along it.
+func (i *gatewayHandler) resolve(ctx context.Context, urlPath string) (*dag.Node, error) {
+	bl := i.config.BlockList
+	if bl == nil || bl.Denylist == nil {
+		return i.api.ResolveNode(ctx, path.Path(urlPath))
 	}
 
-	// Redirect to new path
-	key, err := newnode.Key()
+	if bl.DeniesPath(urlPath) {
+		return nil, errDenied
+	}
+	nodes, err := core.ResolveComponents(ctx, i.node, path.Path(urlPath))
 	if err != nil {
-		webError(w, "Could not get key of new node", err, http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	keys, err := nodeKeys(nodes)
+	if err != nil {
+		return nil, err
 	}
+	if bl.DeniesKeys(keys) {
+		return nil, errDenied
+	}
+	return nodes[len(nodes)-1], nil
+}
 
-	i.addUserHeaders(w) // ok, _now_ write user's headers.
-	w.Header().Set("IPFS-Hash", key.String())
-	http.Redirect(w, r, ipfsPathPrefix+key.String()+"/"+strings.Join(components[:len(components)-1], "/"), http.StatusCreated)
+// nodeKeys returns the keys of nodes.
+func nodeKeys(nodes []*dag.Node) ([]key.Key, error) {
+	keys := make([]key.Key, len(nodes))
+	for i, nd := range nodes {
+		k, err := nd.Key()
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = k
+	}
+	return keys, nil
 }
 
 func (i *gatewayHandler) addUserHeaders(w http.ResponseWriter) {
@@ -1,21 +1,43 @@
 package corehttp
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	apitoken "github.com/ipfs/go-ipfs/apitoken"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	commands "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
+	corecommands "github.com/ipfs/go-ipfs/core/commands"
 	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
+	denylist "github.com/ipfs/go-ipfs/denylist"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	dagutils "github.com/ipfs/go-ipfs/merkledag/utils"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	ci "github.com/ipfs/go-ipfs/p2p/crypto"
 	path "github.com/ipfs/go-ipfs/path"
 	repo "github.com/ipfs/go-ipfs/repo"
 	config "github.com/ipfs/go-ipfs/repo/config"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
 	testutil "github.com/ipfs/go-ipfs/util/testutil"
 )
 
@@ -37,6 +59,10 @@ func (m mockNamesys) Publish(ctx context.Context, name ci.PrivKey, value path.Pa
 	return errors.New("not implemented for mockNamesys")
 }
 
+func (m mockNamesys) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.Path, eol time.Time, ttl time.Duration) error {
+	return errors.New("not implemented for mockNamesys")
+}
+
 func newNodeWithMockNamesys(ns mockNamesys) (*core.IpfsNode, error) {
 	c := config.Config{
 		Identity: config.Identity{
@@ -78,6 +104,14 @@ func doWithoutRedirect(req *http.Request) (*http.Response, error) {
 }
 
 func newTestServerAndNode(t *testing.T, ns mockNamesys) (*httptest.Server, *core.IpfsNode) {
+	return newTestServerAndNodeWritable(t, ns, false)
+}
+
+func newTestServerAndNodeWritable(t *testing.T, ns mockNamesys, writable bool) (*httptest.Server, *core.IpfsNode) {
+	return newTestServerAndNodeWithOptions(t, ns, IPNSHostnameOption(), GatewayOption(writable))
+}
+
+func newTestServerAndNodeWithOptions(t *testing.T, ns mockNamesys, opts ...ServeOption) (*httptest.Server, *core.IpfsNode) {
 	n, err := newNodeWithMockNamesys(ns)
 	if err != nil {
 		t.Fatal(err)
@@ -88,11 +122,7 @@ func newTestServerAndNode(t *testing.T, ns mockNamesys) (*httptest.Server, *core
 	dh := &delegatedHandler{}
 	ts := httptest.NewServer(dh)
 
-	dh.Handler, err = makeHandler(n,
-		ts.Listener,
-		IPNSHostnameOption(),
-		GatewayOption(false),
-	)
+	dh.Handler, err = makeHandler(n, ts.Listener, opts...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -154,6 +184,396 @@ func TestGatewayGet(t *testing.T) {
 	}
 }
 
+func TestGatewaySubdomain(t *testing.T) {
+	ns := mockNamesys{}
+	ts, n := newTestServerAndNodeWithOptions(t, ns,
+		SubdomainOption("example.org"),
+		IPNSHostnameOption(),
+		GatewayOption(false),
+	)
+	defer ts.Close()
+
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.com"] = path.FromString("/ipfs/" + k)
+
+	h, err := mh.FromB58String(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := strings.ToLower(b32.EncodeToString(h))
+
+	for _, test := range []struct {
+		host     string
+		path     string
+		status   int
+		text     string
+		location string
+	}{
+		{sub + ".ipfs.example.org", "/", http.StatusOK, "fnord", ""},
+		{k + ".ipfs.example.org", "/", http.StatusOK, "fnord", ""},
+		{"example.com.ipns.example.org", "/", http.StatusOK, "fnord", ""},
+		{"nothash.ipfs.example.org", "/", http.StatusNotFound, "", ""},
+		{"ipfs.example.org", "/", http.StatusNotFound, "", ""},
+		{"example.org", "/ipfs/" + k, http.StatusMovedPermanently, "", "http://" + sub + ".ipfs.example.org/"},
+		{"example.org:8080", "/ipfs/" + k + "/a/b?c=d", http.StatusMovedPermanently, "", "http://" + sub + ".ipfs.example.org:8080/a/b?c=d"},
+		{"example.org", "/ipns/Example.com/", http.StatusMovedPermanently, "", "http://example.com.ipns.example.org/"},
+		{"localhost", "/ipfs/" + k, http.StatusOK, "fnord", ""},
+	} {
+		req, err := http.NewRequest("GET", ts.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = test.host
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		urlstr := "http://" + test.host + test.path
+		if res.StatusCode != test.status {
+			t.Errorf("got %d, expected %d from %s", res.StatusCode, test.status, urlstr)
+			continue
+		}
+		if loc := res.Header.Get("Location"); loc != test.location {
+			t.Errorf("%s redirected to %q, expected %q", urlstr, loc, test.location)
+		}
+		if test.text == "" {
+			continue
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != test.text {
+			t.Errorf("unexpected response body from %s: expected %q; got %q", urlstr, test.text, body)
+		}
+	}
+}
+
+func TestGatewayDenylist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dl, err := denylist.Load(filepath.Join(dir, "denylist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ns := mockNamesys{}
+	ts, n := newTestServerAndNodeWithOptions(t, ns,
+		IPNSHostnameOption(),
+		NewGateway(GatewayConfig{BlockList: &BlockList{Denylist: dl}}).ServeOption(),
+	)
+	defer ts.Close()
+
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dirnd, err := coreunix.AddWrapped(n, strings.NewReader("fnord"), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dk, err := dirnd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.com"] = path.FromKey(dk)
+
+	get := func(p string) int {
+		res, err := http.Get(ts.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if code := get("/ipfs/" + k); code != http.StatusOK {
+		t.Fatalf("got %d before denying", code)
+	}
+
+	// a denied hash is gone at any path that reaches it
+	if err := dl.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/ipfs/" + k, "/ipfs/" + dk.String() + "/file", "/ipns/example.com/file"} {
+		if code := get(p); code != http.StatusGone {
+			t.Errorf("got %d from %s, expected %d", code, p, http.StatusGone)
+		}
+	}
+	if code := get("/ipfs/" + dk.String()); code != http.StatusOK {
+		t.Errorf("got %d from the directory of a denied file", code)
+	}
+
+	// a denied path only under it
+	if err := dl.Remove(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := dl.Add("/ipns/example.com/file"); err != nil {
+		t.Fatal(err)
+	}
+	if code := get("/ipns/example.com/file"); code != http.StatusGone {
+		t.Errorf("got %d from a denied path", code)
+	}
+	if code := get("/ipfs/" + k); code != http.StatusOK {
+		t.Errorf("got %d from the hash of a denied path", code)
+	}
+
+	// a denied directory is gone under any other root that links to it
+	if err := dl.Remove("/ipns/example.com/file"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dl.Add(dk.String()); err != nil {
+		t.Fatal(err)
+	}
+	outer := &dag.Node{Data: ft.FolderPBData()}
+	if err := outer.AddNodeLink("dir", dirnd); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := n.DAG.Add(outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := get("/ipfs/" + ok.String() + "/dir/file"); code != http.StatusGone {
+		t.Errorf("got %d from a path through a denied directory", code)
+	}
+}
+
+func TestCommandsDenylist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Repo.(*repo.Mock).C.Gateway.DenylistFile = filepath.Join(dir, "denylist")
+	dl, err := n.Denylist()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cctx := commands.Context{
+		Online:        true,
+		ConstructNode: func() (*core.IpfsNode, error) { return n, nil },
+	}
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, CommandsROOption(cctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dirnd, err := coreunix.AddWrapped(n, strings.NewReader("fnord"), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dk, err := dirnd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dl.Add(k); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		path string
+		code int
+	}{
+		{"/api/v0/cat?arg=" + k, http.StatusGone},
+		{"/api/v0/cat?arg=/ipfs/" + dk.String() + "/file", http.StatusGone},
+		{"/api/v0/object/get?arg=" + k, http.StatusGone},
+		{"/api/v0/block/get?arg=" + k, http.StatusGone},
+		{"/api/v0/object/get?arg=" + dk.String(), http.StatusOK},
+	} {
+		res, err := http.Get(ts.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Errorf("%s: expected status %d, got %d", c.path, c.code, res.StatusCode)
+		}
+	}
+
+	// resolved paths are remembered, but not whether they were denied
+	if err := dl.Remove(k); err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Get(ts.URL + "/api/v0/cat?arg=/ipfs/" + dk.String() + "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("got %d after the file was allowed again", res.StatusCode)
+	}
+}
+
+func TestContentArguments(t *testing.T) {
+	for _, c := range []struct {
+		cmd      *commands.Command
+		args     []string
+		expected []string
+	}{
+		{corecommands.CatCmd, []string{"QmA", "/ipfs/QmB/c"}, []string{"QmA", "/ipfs/QmB/c"}},
+		{corecommands.IpnsCmd, []string{"example.com"}, nil},
+		{corecommands.RootRO, []string{"QmA"}, nil},
+	} {
+		req, err := commands.NewRequest(nil, nil, c.args, nil, c.cmd, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if args := contentArguments(req); !reflect.DeepEqual(args, c.expected) {
+			t.Errorf("got content arguments %q from %q, expected %q", args, c.args, c.expected)
+		}
+	}
+}
+
+func TestGatewayRanges(t *testing.T) {
+	ts, n := newTestServerAndNode(t, mockNamesys{})
+	defer ts.Close()
+
+	data := make([]byte, 1024*1024)
+	rand.Read(data)
+	k, err := coreunix.Add(n, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(hdrs map[string]string) *http.Response {
+		req, err := http.NewRequest("GET", ts.URL+"/ipfs/"+k, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for h, v := range hdrs {
+			req.Header.Set(h, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := get(nil)
+	res.Body.Close()
+	if res.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatal("gateway does not accept ranges")
+	}
+	etag := res.Header.Get("Etag")
+	if etag != `"`+k+`"` {
+		t.Fatalf("unexpected etag %s", etag)
+	}
+
+	// ranges in different blocks of the file
+	ranges := [][2]int{{0, 9}, {300000, 300099}, {len(data) - 10, len(data) - 1}}
+	res = get(map[string]string{"Range": "bytes=0-9,300000-300099,-10", "If-Range": etag})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("got %d, expected %d", res.StatusCode, http.StatusPartialContent)
+	}
+	mt, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || mt != "multipart/byteranges" {
+		t.Fatalf("unexpected content type %q", res.Header.Get("Content-Type"))
+	}
+
+	mr := multipart.NewReader(res.Body, params["boundary"])
+	for _, r := range ranges {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr := fmt.Sprintf("bytes %d-%d/%d", r[0], r[1], len(data))
+		if part.Header.Get("Content-Range") != cr {
+			t.Fatalf("part has range %q, expected %q", part.Header.Get("Content-Range"), cr)
+		}
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(body, data[r[0]:r[1]+1]) {
+			t.Fatalf("wrong data in range %s", cr)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatalf("expected %d parts", len(ranges))
+	}
+
+	// a stale If-Range gets the whole file
+	res = get(map[string]string{"Range": "bytes=0-9", "If-Range": `"QmStale"`})
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got %d for a stale If-Range, expected %d", res.StatusCode, http.StatusOK)
+	}
+}
+
+func TestGatewayContentType(t *testing.T) {
+	gw := NewGateway(GatewayConfig{
+		BlockList: &BlockList{},
+		MimeTypes: map[string]string{
+			".md":  "text/markdown; charset=utf-8",
+			"WASM": "application/wasm",
+		},
+	})
+	ts, n := newTestServerAndNodeWithOptions(t, mockNamesys{}, gw.ServeOption())
+	defer ts.Close()
+
+	html, err := coreunix.Add(n, strings.NewReader("<html><body>hi</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged, err := coreunix.AddMetadataTo(n, html, &ft.Metadata{MimeType: "text/plain; charset=utf-8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readme, _, err := coreunix.AddWrapped(n, strings.NewReader("# title"), "README.MD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wasm, _, err := coreunix.AddWrapped(n, strings.NewReader("\x00asm"), "a.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path  string
+		ctype string
+	}{
+		{"/ipfs/" + html, "text/html; charset=utf-8"},       // sniffed
+		{"/ipfs/" + tagged, "text/plain; charset=utf-8"},    // metadata
+		{"/ipfs/" + readme, "text/markdown; charset=utf-8"}, // config
+		{"/ipfs/" + wasm, "application/wasm"},
+	} {
+		res, err := http.Get(ts.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got status %d", test.path, res.StatusCode)
+		}
+		if ctype := res.Header.Get("Content-Type"); ctype != test.ctype {
+			t.Errorf("%s: got content type %q, expected %q", test.path, ctype, test.ctype)
+		}
+	}
+}
+
 func TestIPNSHostnameRedirect(t *testing.T) {
 	ns := mockNamesys{}
 	ts, n := newTestServerAndNode(t, ns)
@@ -337,3 +757,403 @@ func TestIPNSHostnameBacklinks(t *testing.T) {
 		t.Fatalf("expected file in directory listing")
 	}
 }
+
+// edit sends a PUT or DELETE request to the gateway, and returns the new
+// root and the Location it redirects to.
+func edit(t *testing.T, ts *httptest.Server, method, urlPath string, body io.Reader, status int) (string, string) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := doWithoutRedirect(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != status {
+		msg, _ := ioutil.ReadAll(res.Body)
+		t.Fatalf("%s %s: got %d, expected %d: %s", method, urlPath, res.StatusCode, status, msg)
+	}
+	return res.Header.Get("IPFS-Hash"), res.Header.Get("Location")
+}
+
+func TestGatewayPutDelete(t *testing.T) {
+	ns := mockNamesys{}
+	ts, n := newTestServerAndNodeWritable(t, ns, true)
+	defer ts.Close()
+
+	// an empty directory to start from
+	root, loc := edit(t, ts, "PUT", "/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/", nil, http.StatusCreated)
+	if root != "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn" || loc != "/ipfs/"+root+"/" {
+		t.Fatalf("PUT of an empty directory gave %s, redirected to %q", root, loc)
+	}
+
+	// intermediate directories are created
+	root, loc = edit(t, ts, "PUT", "/ipfs/"+root+"/a/b/c", strings.NewReader("fnord"), http.StatusCreated)
+	if loc != "/ipfs/"+root+"/a/b/c" {
+		t.Fatalf("PUT redirected to %q", loc)
+	}
+	assertCat(t, n, "/ipfs/"+root+"/a/b/c", "fnord")
+
+	// a trailing slash puts an empty directory, next to the file
+	root, _ = edit(t, ts, "PUT", "/ipfs/"+root+"/a/d/", nil, http.StatusCreated)
+	assertCat(t, n, "/ipfs/"+root+"/a/b/c", "fnord")
+	nd, err := core.Resolve(n.Context(), n, path.Path("/ipfs/"+root+"/a/d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nd.Links) != 0 {
+		t.Fatal("expected an empty directory")
+	}
+
+	// existing files are replaced
+	root, _ = edit(t, ts, "PUT", "/ipfs/"+root+"/a/b/c", strings.NewReader("bar"), http.StatusCreated)
+	assertCat(t, n, "/ipfs/"+root+"/a/b/c", "bar")
+
+	// but never linked from
+	edit(t, ts, "PUT", "/ipfs/"+root+"/a/b/c/e", strings.NewReader("baz"), http.StatusBadRequest)
+	edit(t, ts, "PUT", "/ipfs/"+root, strings.NewReader("baz"), http.StatusBadRequest)
+
+	// ipns names are resolved to their root
+	ns["/ipns/example.com"] = path.FromString("/ipfs/" + root)
+	root, _ = edit(t, ts, "PUT", "/ipns/example.com/f", strings.NewReader("qux"), http.StatusCreated)
+	assertCat(t, n, "/ipfs/"+root+"/f", "qux")
+
+	root, loc = edit(t, ts, "DELETE", "/ipfs/"+root+"/a/b/c", nil, http.StatusCreated)
+	if loc != "/ipfs/"+root+"/a/b" {
+		t.Fatalf("DELETE redirected to %q", loc)
+	}
+	if _, err := core.Resolve(n.Context(), n, path.Path("/ipfs/"+root+"/a/b/c")); err == nil {
+		t.Fatal("deleted link still resolves")
+	}
+	assertCat(t, n, "/ipfs/"+root+"/f", "qux")
+
+	// the new roots are pinned, so they survive a GC
+	if !n.Pinning.IsPinned(key.B58KeyDecode(root)) {
+		t.Fatal("the new root is not pinned")
+	}
+
+	edit(t, ts, "DELETE", "/ipfs/"+root+"/a/nope", nil, http.StatusNotFound)
+	edit(t, ts, "DELETE", "/ipfs/"+root, nil, http.StatusBadRequest)
+}
+
+func TestGatewayReadOnly(t *testing.T) {
+	ts, _ := newTestServerAndNode(t, mockNamesys{})
+	defer ts.Close()
+
+	for _, method := range []string{"PUT", "DELETE"} {
+		edit(t, ts, method, "/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/a", nil, http.StatusMethodNotAllowed)
+	}
+}
+
+func assertCat(t *testing.T, n *core.IpfsNode, p string, expected string) {
+	nd, err := core.Resolve(n.Context(), n, path.Path(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := uio.NewDagReader(n.Context(), nd, n.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatalf("%s contains %q, expected %q", p, data, expected)
+	}
+}
+
+// addSite adds a directory with files, by their paths in it, and returns
+// its key.
+func addSite(t *testing.T, n *core.IpfsNode, files map[string]string) string {
+	e := dagutils.NewDagEditor(n.DAG, uio.NewEmptyDirectory())
+	for p, data := range files {
+		k, err := coreunix.Add(n, strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd, err := n.DAG.Get(n.Context(), key.B58KeyDecode(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.InsertNodeAtPath(n.Context(), p, nd, uio.NewEmptyDirectory); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k, err := n.DAG.Add(e.GetNode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k.B58String()
+}
+
+func TestGatewayRedirectsAndNotFound(t *testing.T) {
+	ns := mockNamesys{}
+	ts, n := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	site := addSite(t, n, map[string]string{
+		"_redirects": `
+# single page app
+/app/*        /app/index.html  200
+/old/:page    /new/:page       302
+/gone         /missing.html    404
+/away         https://example.org/
+`,
+		"app/index.html":  "app",
+		"new/a":           "new a",
+		"404.html":        "not here",
+		"docs/404.html":   "not in docs",
+		"docs/intro.html": "intro",
+	})
+	ns["/ipns/example.net"] = path.FromString("/ipfs/" + site)
+
+	for _, test := range []struct {
+		host     string
+		path     string
+		status   int
+		location string
+		text     string
+	}{
+		{"", "/ipns/example.net/app/deep/link", http.StatusOK, "", "app"},
+		{"example.net", "/app/deep/link", http.StatusOK, "", "app"},
+		{"", "/ipns/example.net/old/a", http.StatusFound, "/ipns/example.net/new/a", ""},
+		{"example.net", "/old/a", http.StatusFound, "/new/a", ""},
+		{"example.net", "/away", http.StatusMovedPermanently, "https://example.org/", ""},
+		// the rule's page is missing, so the nearest 404.html is served
+		{"example.net", "/gone", http.StatusNotFound, "", "not here"},
+		{"example.net", "/docs/nothing", http.StatusNotFound, "", "not in docs"},
+		{"example.net", "/docs/a/b/c", http.StatusNotFound, "", "not in docs"},
+		{"example.net", "/nothing", http.StatusNotFound, "", "not here"},
+		// existing files are not redirected
+		{"example.net", "/new/a", http.StatusOK, "", "new a"},
+		// _redirects only applies under /ipns/
+		{"", "/ipfs/" + site + "/app/deep/link", http.StatusNotFound, "", "not here"},
+	} {
+		req, err := http.NewRequest("GET", ts.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.host != "" {
+			req.Host = test.host
+		}
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		urlstr := "http://" + test.host + test.path
+		if res.StatusCode != test.status {
+			t.Errorf("%s: got status %d, expected %d", urlstr, res.StatusCode, test.status)
+			continue
+		}
+		if loc := res.Header.Get("Location"); loc != test.location {
+			t.Errorf("%s: redirected to %q, expected %q", urlstr, loc, test.location)
+		}
+		if test.text == "" {
+			continue
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != test.text {
+			t.Errorf("%s: got body %q, expected %q", urlstr, body, test.text)
+		}
+	}
+}
+
+func TestGatewayAccessLogAndMetrics(t *testing.T) {
+	for _, format := range []string{AccessLogCommon, AccessLogJSON} {
+		logbuf := new(bytes.Buffer)
+		ns := mockNamesys{}
+		ts, n := newTestServerAndNodeWithOptions(t, ns,
+			AccessLogOption(logbuf, format),
+			PrometheusOption("/debug/metrics/prometheus"),
+			IPNSHostnameOption(),
+			GatewayOption(false),
+		)
+
+		k, err := coreunix.Add(n, strings.NewReader("fnord"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{"/ipfs/" + k + "?x=1", "/ipns/unknown.example"} {
+			res, err := http.Get(ts.URL + p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+
+		lines := strings.Split(strings.TrimSpace(logbuf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("%s: expected 2 log lines, got %q", format, logbuf.String())
+		}
+		switch format {
+		case AccessLogCommon:
+			if !strings.HasPrefix(lines[0], "127.0.0.1 - - [") ||
+				!strings.HasSuffix(lines[0], `] "GET /ipfs/`+k+`?x=1 HTTP/1.1" 200 5`) {
+				t.Errorf("unexpected log line %q", lines[0])
+			}
+		case AccessLogJSON:
+			var entry struct {
+				URI    string
+				Status int
+				Bytes  int64
+			}
+			if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.URI != "/ipfs/"+k+"?x=1" || entry.Status != 200 || entry.Bytes != 5 {
+				t.Errorf("unexpected log line %q", lines[0])
+			}
+		}
+
+		res, err := http.Get(ts.URL + "/debug/metrics/prometheus")
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range []string{
+			`ipfs_http_gateway_request_duration_seconds_count{code="200",method="GET"}`,
+			`ipfs_http_gateway_first_byte_duration_seconds_count{code="200",method="GET"}`,
+			`ipfs_http_gateway_response_size_bytes_sum{code="200",method="GET"}`,
+			`ipfs_http_gateway_resolve_duration_seconds_count{namespace="ipfs"}`,
+			`ipfs_http_gateway_ipns_resolve_failures_total{reason="not_found"}`,
+		} {
+			if !bytes.Contains(metrics, []byte(m)) {
+				t.Errorf("metrics are missing %s", m)
+			}
+		}
+		ts.Close()
+	}
+}
+
+func TestTokenAuthOption(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Repo.(*repo.Mock).C.API.RequireToken = true
+
+	store := apitoken.NewStore(n.Repo.Datastore())
+	full, err := store.Create(apitoken.Token{Name: "full"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, err := store.Create(apitoken.Token{Name: "limited", Allow: []string{"cat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, TokenAuthOption(), GatewayOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		method, token string
+		status        int
+	}{
+		{"GET", "", http.StatusUnauthorized},
+		{"GET", "wrong", http.StatusUnauthorized},
+		{"GET", limited, http.StatusForbidden},
+		{"POST", "", http.StatusUnauthorized},
+		{"GET", full, http.StatusOK},
+	} {
+		req, err := http.NewRequest(c.method, ts.URL+"/ipfs/"+k, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.status {
+			t.Errorf("%s with token %q: expected status %d, got %d", c.method, c.token, c.status, res.StatusCode)
+		}
+	}
+}
+
+func TestTokenCreateNeedsUnrestrictedToken(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Repo.(*repo.Mock).C.API.RequireToken = true
+
+	store := apitoken.NewStore(n.Repo.Datastore())
+	full, err := store.Create(apitoken.Token{Name: "full"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, err := store.Create(apitoken.Token{Name: "limited", Allow: []string{"api", "cat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cctx := commands.Context{
+		Online:        true,
+		ConstructNode: func() (*core.IpfsNode, error) { return n, nil },
+	}
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, TokenAuthOption(), CommandsOption(cctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		token, name string
+		status      int
+	}{
+		{limited, "broader", http.StatusForbidden},
+		{full, "other", http.StatusOK},
+	} {
+		req, err := http.NewRequest("POST", ts.URL+"/api/v0/api/token/create?arg="+c.name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.status {
+			t.Errorf("creating %s: expected status %d, got %d", c.name, c.status, res.StatusCode)
+		}
+	}
+
+	tokens, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range tokens {
+		if tok.Name == "broader" {
+			t.Fatal("a restricted token created a token")
+		}
+	}
+}
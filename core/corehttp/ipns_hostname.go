@@ -10,6 +10,12 @@ import (
 	"github.com/ipfs/go-ipfs/core"
 )
 
+// originalPathHeader carries the path of a request whose Host was rewritten
+// into its path, so the gateway can build links relative to the host. It is
+// set in the map under its non-canonical key, which headers sent by clients
+// never have.
+const originalPathHeader = "X-IPNS-Original-Path"
+
 // IPNSHostnameOption rewrites an incoming request if its Host: header contains
 // an IPNS name.
 // The rewritten request points at the resolved name on the gateway handler.
@@ -20,11 +26,14 @@ func IPNSHostnameOption() ServeOption {
 			ctx, cancel := context.WithCancel(n.Context())
 			defer cancel()
 
+			// SubdomainOption may already have rewritten the request
+			rewritten := len(r.Header[originalPathHeader]) > 0
+
 			host := strings.SplitN(r.Host, ":", 2)[0]
-			if len(host) > 0 && isd.IsDomain(host) {
+			if !rewritten && len(host) > 0 && isd.IsDomain(host) {
 				name := "/ipns/" + host
 				if _, err := n.Namesys.Resolve(ctx, name); err == nil {
-					r.Header["X-IPNS-Original-Path"] = []string{r.URL.Path}
+					r.Header[originalPathHeader] = []string{r.URL.Path}
 					r.URL.Path = name + r.URL.Path
 				}
 			}
@@ -0,0 +1,100 @@
+package corehttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	prom "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/prometheus/client_golang/prometheus"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	path "github.com/ipfs/go-ipfs/path"
+	"github.com/ipfs/go-ipfs/routing"
+)
+
+// The gateway's metrics, served by PrometheusOption with the rest of the
+// default registry.
+var (
+	gatewayRequestDuration = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: "ipfs",
+		Subsystem: "http_gateway",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to answer gateway requests, by method and status.",
+	}, []string{"method", "code"})
+
+	gatewayFirstByteDuration = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: "ipfs",
+		Subsystem: "http_gateway",
+		Name:      "first_byte_duration_seconds",
+		Help:      "Time until gateway responses start, by method and status.",
+	}, []string{"method", "code"})
+
+	gatewayResponseSize = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: "ipfs",
+		Subsystem: "http_gateway",
+		Name:      "response_size_bytes",
+		Help:      "Bytes served in gateway response bodies, by method and status.",
+		Buckets:   prom.ExponentialBuckets(256, 4, 10),
+	}, []string{"method", "code"})
+
+	gatewayResolveDuration = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: "ipfs",
+		Subsystem: "http_gateway",
+		Name:      "resolve_duration_seconds",
+		Help:      "Time taken to resolve the paths of gateway requests, by namespace.",
+	}, []string{"namespace"})
+
+	gatewayIpnsFailures = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: "ipfs",
+		Subsystem: "http_gateway",
+		Name:      "ipns_resolve_failures_total",
+		Help:      "Names the gateway failed to resolve, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prom.MustRegister(gatewayRequestDuration)
+	prom.MustRegister(gatewayFirstByteDuration)
+	prom.MustRegister(gatewayResponseSize)
+	prom.MustRegister(gatewayResolveDuration)
+	prom.MustRegister(gatewayIpnsFailures)
+}
+
+// observeRequest records the metrics of a gateway response.
+func observeRequest(r *http.Request, rec *responseRecorder) {
+	method, code := r.Method, strconv.Itoa(rec.status)
+	gatewayRequestDuration.WithLabelValues(method, code).Observe(time.Since(rec.start).Seconds())
+	if !rec.firstByte.IsZero() {
+		gatewayFirstByteDuration.WithLabelValues(method, code).Observe(rec.firstByte.Sub(rec.start).Seconds())
+	}
+	gatewayResponseSize.WithLabelValues(method, code).Observe(float64(rec.bytes))
+}
+
+// observeResolve records how long resolving urlPath took, and why resolving
+// a name failed, if it did.
+func observeResolve(urlPath string, start time.Time, err error) {
+	ns := "ipfs"
+	if strings.HasPrefix(urlPath, ipnsPathPrefix) {
+		ns = "ipns"
+	}
+	gatewayResolveDuration.WithLabelValues(ns).Observe(time.Since(start).Seconds())
+
+	if err == nil || ns != "ipns" {
+		return
+	}
+	switch err {
+	case namesys.ErrResolveFailed, routing.ErrNotFound:
+		gatewayIpnsFailures.WithLabelValues("not_found").Inc()
+	case namesys.ErrResolveRecursion:
+		gatewayIpnsFailures.WithLabelValues("recursion").Inc()
+	case context.DeadlineExceeded, context.Canceled:
+		gatewayIpnsFailures.WithLabelValues("timeout").Inc()
+	default:
+		// links missing under a resolved name are not name failures
+		if _, ok := err.(path.ErrNoLink); !ok {
+			gatewayIpnsFailures.WithLabelValues("error").Inc()
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package corehttp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	gopath "path"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	path "github.com/ipfs/go-ipfs/path"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+)
+
+// redirectsFile is the file at the root of a site, published under /ipns/,
+// with the rules for paths that do not exist in it.
+const redirectsFile = "_redirects"
+
+// notFoundFile is the page served, with a 404 status, for paths that do not
+// exist under the directory it is in.
+const notFoundFile = "404.html"
+
+// maxRedirectsSize bounds the _redirects file the gateway reads.
+const maxRedirectsSize = 64 << 10
+
+// redirectRule is a line of a _redirects file:
+//
+//	/from /to [status]
+//
+// From is a path under the site root. Its segments may be placeholders,
+// like ":id", which match any one segment, and its last may be "*", which
+// matches the rest of the path. To is a path under the site root, or an
+// absolute URL, and may use the placeholders, with ":splat" for what "*"
+// matched. Status is 301 by default. 200 serves to in place of from,
+// other 3xx codes redirect to it, and 404 serves it as the not found page.
+type redirectRule struct {
+	from   []string
+	to     string
+	status int
+}
+
+// parseRedirects parses a _redirects file. Blank lines and lines starting
+// with '#' are ignored.
+func parseRedirects(r io.Reader) ([]redirectRule, error) {
+	var rules []redirectRule
+	s := bufio.NewScanner(io.LimitReader(r, maxRedirectsSize))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected 'from to [status]'", redirectsFile, n)
+		}
+		if !strings.HasPrefix(fields[0], "/") {
+			return nil, fmt.Errorf("%s:%d: %q is not a path", redirectsFile, n, fields[0])
+		}
+
+		rule := redirectRule{
+			from:   strings.Split(strings.Trim(fields[0], "/"), "/"),
+			to:     fields[1],
+			status: http.StatusMovedPermanently,
+		}
+		for i, seg := range rule.from {
+			if seg == "*" && i != len(rule.from)-1 {
+				return nil, fmt.Errorf("%s:%d: '*' must end the path", redirectsFile, n)
+			}
+		}
+		if len(fields) == 3 {
+			code, err := strconv.Atoi(fields[2])
+			if err != nil || !validRedirectStatus(code) {
+				return nil, fmt.Errorf("%s:%d: unsupported status %q", redirectsFile, n, fields[2])
+			}
+			rule.status = code
+		}
+		if rule.status == http.StatusOK || rule.status == http.StatusNotFound {
+			if !strings.HasPrefix(rule.to, "/") {
+				return nil, fmt.Errorf("%s:%d: status %d needs a path on the site", redirectsFile, n, rule.status)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func validRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusOK, http.StatusNotFound,
+		http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, 308:
+		return true
+	}
+	return false
+}
+
+// match returns where the rule sends p, a path under the site root, if it
+// applies to it.
+func (rule redirectRule) match(p string) (string, bool) {
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+
+	var pairs []string
+	for i, from := range rule.from {
+		if from == "*" {
+			pairs = append(pairs, ":splat", strings.Join(segs[i:], "/"))
+			return expandRedirect(rule.to, pairs), true
+		}
+		if i >= len(segs) {
+			return "", false
+		}
+		switch {
+		case strings.HasPrefix(from, ":"):
+			pairs = append(pairs, from, segs[i])
+		case from != segs[i]:
+			return "", false
+		}
+	}
+	if len(segs) != len(rule.from) {
+		return "", false
+	}
+	return expandRedirect(rule.to, pairs), true
+}
+
+func expandRedirect(to string, pairs []string) string {
+	if len(pairs) == 0 {
+		return to
+	}
+	// longer placeholders first, so ":id" does not replace part of ":idx"
+	for i := 0; i < len(pairs); i += 2 {
+		for j := i + 2; j < len(pairs); j += 2 {
+			if len(pairs[j]) > len(pairs[i]) {
+				pairs[i], pairs[j] = pairs[j], pairs[i]
+				pairs[i+1], pairs[j+1] = pairs[j+1], pairs[i+1]
+			}
+		}
+	}
+	return strings.NewReplacer(pairs...).Replace(to)
+}
+
+// serveNotFound answers r, for a path that does not exist, by the rules in
+// the _redirects file of the site it is under, or else with the 404.html
+// nearest to it. It returns false if neither applies.
+func (i *gatewayHandler) serveNotFound(ctx context.Context, w http.ResponseWriter, r *http.Request, ipnsHostname, rewritten bool) bool {
+	urlPath := gopath.Clean(r.URL.Path)
+
+	// only sites published under a name have a root to keep rules at
+	parts := strings.SplitN(urlPath, "/", 4)
+	if !rewritten && len(parts) >= 3 && parts[1] == "ipns" {
+		root := "/ipns/" + parts[2]
+		rel := "/"
+		if len(parts) == 4 {
+			rel += parts[3]
+		}
+
+		rules, err := i.redirectRules(ctx, root)
+		if err != nil {
+			internalWebError(w, err)
+			return true
+		}
+		for _, rule := range rules {
+			to, ok := rule.match(rel)
+			if !ok {
+				continue
+			}
+
+			// rewrites stay on the site
+			target := gopath.Join(root, to)
+			onSite := target == root || strings.HasPrefix(target, root+"/")
+
+			switch rule.status {
+			case http.StatusOK:
+				if !onSite {
+					break
+				}
+				rr := new(http.Request)
+				*rr = *r
+				u := *r.URL
+				u.Path = target
+				rr.URL = &u
+				i.getOrHeadHandler(w, rr, true)
+				return true
+			case http.StatusNotFound:
+				if onSite && i.serveFile(ctx, w, r, target, http.StatusNotFound) {
+					return true
+				}
+			default:
+				if strings.HasPrefix(to, "/") && !ipnsHostname {
+					to = root + to
+				}
+				http.Redirect(w, r, to, rule.status)
+				return true
+			}
+			break
+		}
+	}
+
+	for dir := gopath.Dir(urlPath); strings.Count(dir, "/") >= 2; dir = gopath.Dir(dir) {
+		if i.serveFile(ctx, w, r, dir+"/"+notFoundFile, http.StatusNotFound) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectRules returns the rules in the _redirects file at root, if it has
+// one.
+func (i *gatewayHandler) redirectRules(ctx context.Context, root string) ([]redirectRule, error) {
+	nd, err := i.api.ResolveNode(ctx, path.Path(root+"/"+redirectsFile))
+	if err != nil {
+		return nil, nil
+	}
+	dr, err := uio.NewDagReader(ctx, nd, i.dag)
+	if err != nil {
+		return nil, nil
+	}
+	defer dr.Close()
+	return parseRedirects(dr)
+}
+
+// serveFile writes the file at p, with status, if it exists and is not
+// denied.
+func (i *gatewayHandler) serveFile(ctx context.Context, w http.ResponseWriter, r *http.Request, p string, status int) bool {
+	nd, err := i.resolve(ctx, p)
+	if err != nil {
+		return false
+	}
+	dr, err := uio.NewDagReader(ctx, nd, i.dag)
+	if err != nil {
+		return false
+	}
+	defer dr.Close()
+
+	i.addUserHeaders(w)
+	ctype := i.contentType(nd, gopath.Base(p))
+	if ctype == "" {
+		ctype = "text/html; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		io.Copy(w, dr)
+	}
+	return true
+}
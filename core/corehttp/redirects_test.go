@@ -0,0 +1,58 @@
+package corehttp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedirectRules(t *testing.T) {
+	rules, err := parseRedirects(strings.NewReader(`
+# comment
+/a/*            /b/:splat
+/users/:id/:idx /u/:idx/:id    302
+/spa/*          /index.html    200
+/               /home          307
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path   string
+		to     string
+		status int
+	}{
+		{"/a/x/y", "/b/x/y", 301},
+		{"/a", "/b/", 301},
+		{"/users/1/2", "/u/2/1", 302},
+		{"/spa/deep/link", "/index.html", 200},
+		{"/", "/home", 307},
+		{"/users/1", "", 0},
+		{"/users/1/2/3", "", 0},
+		{"/other", "", 0},
+	} {
+		to, status := "", 0
+		for _, rule := range rules {
+			if t, ok := rule.match(test.path); ok {
+				to, status = t, rule.status
+				break
+			}
+		}
+		if to != test.to || status != test.status {
+			t.Errorf("%s: got %q %d, expected %q %d", test.path, to, status, test.to, test.status)
+		}
+	}
+
+	for _, bad := range []string{
+		"/a",
+		"a /b",
+		"/a /b 500",
+		"/a/*/b /c",
+		"/a https://example.org/ 200",
+		"/a /b 301 extra",
+	} {
+		if _, err := parseRedirects(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected a parse error", bad)
+		}
+	}
+}
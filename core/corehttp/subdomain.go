@@ -0,0 +1,141 @@
+package corehttp
+
+import (
+	"encoding/base32"
+	"net"
+	"net/http"
+	"strings"
+
+	b58 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-base58"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+// b32 encodes hashes in subdomains. Browsers lowercase hostnames, which
+// base58 does not survive.
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// SubdomainOption serves content from its own origin under domain, as
+// <hash>.ipfs.<domain> and <name>.ipns.<domain>, so sites on the gateway
+// cannot read each other's cookies and storage. Hashes in subdomains are
+// lowercase base32. Path style requests to domain itself redirect to the
+// subdomain.
+func SubdomainOption(domain string) ServeOption {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			host := strings.SplitN(r.Host, ":", 2)[0]
+			lhost := strings.ToLower(host)
+			switch {
+			case lhost == domain:
+				if u, ok := subdomainURL(r, domain); ok {
+					http.Redirect(w, r, u, http.StatusMovedPermanently)
+					return
+				}
+
+			case strings.HasSuffix(lhost, "."+domain):
+				ns, name, ok := parseSubdomain(host[:len(host)-len(domain)-1])
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				r.Header[originalPathHeader] = []string{r.URL.Path}
+				r.URL.Path = "/" + ns + "/" + name + r.URL.Path
+			}
+			childMux.ServeHTTP(w, r)
+		})
+		return childMux, nil
+	}
+}
+
+// parseSubdomain parses the part of a host before the gateway domain, like
+// "<hash>.ipfs", into a namespace and the name under it.
+func parseSubdomain(sub string) (ns, name string, ok bool) {
+	i := strings.LastIndex(sub, ".")
+	if i <= 0 {
+		return "", "", false
+	}
+	ns, name = strings.ToLower(sub[i+1:]), sub[:i]
+
+	switch ns {
+	case "ipfs":
+		h, ok := decodeSubdomainHash(name)
+		if !ok {
+			return "", "", false
+		}
+		return ns, h.B58String(), true
+	case "ipns":
+		// a peer id, or a domain name with a dnslink
+		if h, ok := decodeSubdomainHash(name); ok {
+			return ns, h.B58String(), true
+		}
+		return ns, strings.ToLower(name), true
+	}
+	return "", "", false
+}
+
+func decodeSubdomainHash(s string) (mh.Multihash, bool) {
+	if strings.Contains(s, ".") {
+		return nil, false
+	}
+
+	if buf, err := b32.DecodeString(strings.ToUpper(s)); err == nil {
+		if h, err := mh.Cast(buf); err == nil {
+			return h, true
+		}
+	}
+
+	// clients that keep the case may still use base58
+	if h, err := mh.Cast(b58.Decode(s)); err == nil {
+		return h, true
+	}
+	return nil, false
+}
+
+// subdomainURL returns where a path style request for /ipfs/<hash>/... or
+// /ipns/<name>/... is served from in subdomain mode.
+func subdomainURL(r *http.Request, domain string) (string, bool) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return "", false
+	}
+
+	parts := strings.SplitN(r.URL.Path, "/", 4)
+	if len(parts) < 3 || parts[0] != "" || parts[2] == "" {
+		return "", false
+	}
+	ns, name := parts[1], parts[2]
+	if ns != "ipfs" && ns != "ipns" {
+		return "", false
+	}
+
+	h, err := mh.FromB58String(name)
+	switch {
+	case err == nil:
+		name = strings.ToLower(b32.EncodeToString(h))
+	case ns == "ipns":
+		name = strings.ToLower(name)
+	default:
+		return "", false
+	}
+
+	host := name + "." + ns + "." + domain
+	if i := strings.Index(r.Host, ":"); i >= 0 {
+		host += r.Host[i:]
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	u := scheme + "://" + host + "/"
+	if len(parts) == 4 {
+		u += parts[3]
+	}
+	if r.URL.RawQuery != "" {
+		u += "?" + r.URL.RawQuery
+	}
+	return u, true
+}
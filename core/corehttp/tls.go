@@ -0,0 +1,130 @@
+package corehttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	isd "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-is-domain"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	acme "github.com/ipfs/go-ipfs/acme"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	core "github.com/ipfs/go-ipfs/core"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// defaultACMECacheDir is where certificates from ACME are kept in the repo,
+// unless configured.
+const defaultACMECacheDir = "acme"
+
+// ServeTLS is Serve over TLS, with the certificates in conf.
+func ServeTLS(node *core.IpfsNode, lis net.Listener, conf *tls.Config, options ...ServeOption) error {
+	return Serve(node, tls.NewListener(lis, conf), options...)
+}
+
+// TLSConfig returns the tls.Config cfg describes. Relative paths in it are
+// relative to the repo at root. Certificates from ACME are served by SNI,
+// the certificate in cfg.CertFile to clients asking for other names.
+func TLSConfig(n *core.IpfsNode, root string, cfg config.TLS) (*tls.Config, error) {
+	conf := &tls.Config{NextProtos: []string{"http/1.1"}}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(repoPath(root, cfg.CertFile), repoPath(root, cfg.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("loading the TLS certificate: %s", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.ACME.DirectoryURL != "" {
+		dir := cfg.ACME.CacheDir
+		if dir == "" {
+			dir = defaultACMECacheDir
+		}
+		m, err := acme.NewManager(cfg.ACME.DirectoryURL, repoPath(root, dir))
+		if err != nil {
+			return nil, err
+		}
+		m.Email = cfg.ACME.Email
+		m.HostPolicy = acmeHostPolicy(n, cfg.ACME)
+
+		if cfg.ACME.CACertFile != "" {
+			pem, err := ioutil.ReadFile(repoPath(root, cfg.ACME.CACertFile))
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", cfg.ACME.CACertFile)
+			}
+			m.Client.HTTPClient = &http.Client{
+				Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+			}
+		}
+
+		conf.GetCertificate = m.GetCertificate
+		conf.NextProtos = append(conf.NextProtos, acme.ALPNProto)
+	}
+
+	if len(conf.Certificates) == 0 && conf.GetCertificate == nil {
+		return nil, fmt.Errorf("TLS needs a CertFile or an ACME.DirectoryURL")
+	}
+	return conf, nil
+}
+
+// acmeHostPolicy allows certificates for the configured domains and for
+// the names under DNSLinkDomains whose DNSLink points at content this node
+// has, which IPNSHostnameOption serves.
+func acmeHostPolicy(n *core.IpfsNode, cfg config.ACME) func(context.Context, string) error {
+	return func(ctx context.Context, host string) error {
+		for _, d := range cfg.Domains {
+			if strings.EqualFold(strings.TrimSuffix(d, "."), host) {
+				return nil
+			}
+		}
+		if !underDomains(host, cfg.DNSLinkDomains) || !isd.IsDomain(host) || n.Namesys == nil {
+			return fmt.Errorf("no certificate allowed for %s", host)
+		}
+		p, err := n.Namesys.Resolve(ctx, "/ipns/"+host)
+		if err != nil {
+			return fmt.Errorf("no DNSLink for %s: %s", host, err)
+		}
+		segs := p.Segments()
+		if len(segs) < 2 || segs[0] != "ipfs" {
+			return fmt.Errorf("the DNSLink for %s is not an /ipfs/ path", host)
+		}
+		has, err := n.Blockstore.Has(key.B58KeyDecode(segs[1]))
+		if err != nil {
+			return err
+		}
+		if !has {
+			return fmt.Errorf("the content of %s is not on this node", host)
+		}
+		return nil
+	}
+}
+
+// underDomains returns whether host is one of domains or a subdomain of one.
+func underDomains(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSuffix(d, "."))
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
+
+func repoPath(root, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(root, p)
+}
@@ -0,0 +1,151 @@
+package corehttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
+	path "github.com/ipfs/go-ipfs/path"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// writeCert writes a self-signed certificate for name to cert.pem and
+// key.pem in dir.
+func writeCert(t *testing.T, dir, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder})
+	if err := ioutil.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func TestGatewayTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "corehttp-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert := writeCert(t, dir, "gateway.test")
+
+	ns := mockNamesys{}
+	n, err := newNodeWithMockNamesys(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := TLSConfig(n, dir, config.TLS{}); err == nil {
+		t.Fatal("expected an error without a certificate or ACME")
+	}
+
+	// relative paths are in the repo
+	conf, err := TLSConfig(n, dir, config.TLS{CertFile: "cert.pem", KeyFile: "key.pem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := makeHandler(n, nil, IPNSHostnameOption(), GatewayOption(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(h)
+	ts.TLS = conf
+	ts.StartTLS()
+	defer ts.Close()
+
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "gateway.test"},
+	}}
+	res, err := client.Get(ts.URL + "/ipfs/" + k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "fnord" {
+		t.Fatalf("got %q over TLS", body)
+	}
+}
+
+func TestACMEHostPolicy(t *testing.T) {
+	ns := mockNamesys{}
+	n, err := newNodeWithMockNamesys(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/site.example.com"] = path.FromString("/ipfs/" + k)
+	ns["/ipns/www.site.example.com"] = path.FromString("/ipfs/" + k)
+	ns["/ipns/elsewhere.example.com"] = path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	ns["/ipns/site.example.org"] = path.FromString("/ipfs/" + k)
+
+	ctx := context.Background()
+	for _, test := range []struct {
+		cfg   config.ACME
+		host  string
+		allow bool
+	}{
+		{config.ACME{Domains: []string{"Gateway.Example.com."}}, "gateway.example.com", true},
+		{config.ACME{Domains: []string{"gateway.example.com"}}, "site.example.com", false},
+		{config.ACME{DNSLinkDomains: []string{"example.com"}}, "site.example.com", true},
+		{config.ACME{DNSLinkDomains: []string{"Site.Example.com."}}, "www.site.example.com", true},
+		{config.ACME{DNSLinkDomains: []string{"example.com"}}, "other.example.com", false},
+		{config.ACME{DNSLinkDomains: []string{"example.com"}}, "elsewhere.example.com", false},
+		{config.ACME{DNSLinkDomains: []string{"example.com"}}, "site.example.org", false},
+		{config.ACME{DNSLinkDomains: []string{"ample.com"}}, "site.example.com", false},
+		{config.ACME{}, "site.example.com", false},
+	} {
+		err := acmeHostPolicy(n, test.cfg)(ctx, test.host)
+		if (err == nil) != test.allow {
+			t.Errorf("%+v: %s allowed is %v, expected %v", test.cfg, test.host, err == nil, test.allow)
+		}
+	}
+}
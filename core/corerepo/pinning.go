@@ -14,77 +14,29 @@ objects.
 package corerepo
 
 import (
-	"fmt"
-
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	"github.com/ipfs/go-ipfs/core"
-	"github.com/ipfs/go-ipfs/merkledag"
+	"github.com/ipfs/go-ipfs/core/coreapi"
 	path "github.com/ipfs/go-ipfs/path"
 )
 
+// Pin pins the objects at paths. It is coreapi's Pin().Add.
 func Pin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool) ([]key.Key, error) {
-	dagnodes := make([]*merkledag.Node, 0)
-	for _, fpath := range paths {
-		dagnode, err := core.Resolve(ctx, n, path.Path(fpath))
-		if err != nil {
-			return nil, fmt.Errorf("pin: %s", err)
-		}
-		dagnodes = append(dagnodes, dagnode)
-	}
-
-	var out []key.Key
-	for _, dagnode := range dagnodes {
-		k, err := dagnode.Key()
-		if err != nil {
-			return nil, err
-		}
-
-		ctx, cancel := context.WithCancel(ctx)
-		defer cancel()
-		err = n.Pinning.Pin(ctx, dagnode, recursive)
-		if err != nil {
-			return nil, fmt.Errorf("pin: %s", err)
-		}
-		out = append(out, k)
-	}
-
-	err := n.Pinning.Flush()
-	if err != nil {
-		return nil, err
-	}
-
-	return out, nil
+	return coreapi.NewCoreAPI(n).Pin().Add(ctx, recursive, toPaths(paths)...)
 }
 
+// Unpin removes the pins of the objects at paths. It is coreapi's
+// Pin().Rm.
 func Unpin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool) ([]key.Key, error) {
+	return coreapi.NewCoreAPI(n).Pin().Rm(ctx, recursive, toPaths(paths)...)
+}
 
-	dagnodes := make([]*merkledag.Node, 0)
-	for _, fpath := range paths {
-		dagnode, err := core.Resolve(ctx, n, path.Path(fpath))
-		if err != nil {
-			return nil, err
-		}
-		dagnodes = append(dagnodes, dagnode)
-	}
-
-	var unpinned []key.Key
-	for _, dagnode := range dagnodes {
-		k, _ := dagnode.Key()
-
-		ctx, cancel := context.WithCancel(ctx)
-		defer cancel()
-		err := n.Pinning.Unpin(ctx, k, recursive)
-		if err != nil {
-			return nil, err
-		}
-		unpinned = append(unpinned, k)
-	}
-
-	err := n.Pinning.Flush()
-	if err != nil {
-		return nil, err
+func toPaths(strs []string) []path.Path {
+	paths := make([]path.Path, len(strs))
+	for i, s := range strs {
+		paths[i] = path.Path(s)
 	}
-	return unpinned, nil
+	return paths
 }
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+
+	denylist "github.com/ipfs/go-ipfs/denylist"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// ErrNoDenylist is returned when the config names no denylist file.
+var ErrNoDenylist = errors.New("no denylist configured, set Gateway.DenylistFile")
+
+// Denylist returns the list of content the gateway refuses to serve. It is
+// loaded once, so changes made through it apply to the running node.
+func (n *IpfsNode) Denylist() (*denylist.Denylist, error) {
+	n.denylistLk.Lock()
+	defer n.denylistLk.Unlock()
+
+	if n.denylist != nil {
+		return n.denylist, nil
+	}
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	file := cfg.Gateway.DenylistFile
+	if file == "" {
+		return nil, ErrNoDenylist
+	}
+	if !filepath.IsAbs(file) {
+		file, err = config.Path("", file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d, err := denylist.Load(file)
+	if err != nil {
+		return nil, err
+	}
+	n.denylist = d
+	return d, nil
+}
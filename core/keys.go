@@ -0,0 +1,131 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	ic "github.com/ipfs/go-ipfs/p2p/crypto"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+)
+
+// SelfKeyName names the node's own identity key, which is kept in the config
+// rather than in the keystore.
+const SelfKeyName = "self"
+
+// ErrNoKeystore is returned when the node's repo cannot store named keys.
+var ErrNoKeystore = errors.New("node has no keystore")
+
+// NamedKey is a private key along with the name it is known by locally.
+type NamedKey struct {
+	Name string
+	Key  ic.PrivKey
+}
+
+// Keystore returns the keystore of the node's repo.
+func (n *IpfsNode) Keystore() (keystore.Keystore, error) {
+	if n.Repo == nil {
+		return nil, ErrNoKeystore
+	}
+	ks := n.Repo.Keystore()
+	if ks == nil {
+		return nil, ErrNoKeystore
+	}
+	return ks, nil
+}
+
+// GetKey returns the private key stored under name. SelfKeyName refers to
+// the node's identity key.
+func (n *IpfsNode) GetKey(name string) (ic.PrivKey, error) {
+	if name == SelfKeyName {
+		if n.PrivateKey == nil {
+			return nil, errors.New("private key not loaded")
+		}
+		return n.PrivateKey, nil
+	}
+
+	ks, err := n.Keystore()
+	if err != nil {
+		return nil, err
+	}
+	return ks.Get(name)
+}
+
+// WriteIdentityKey stores sk in the config as the identity key the node
+// starts with next time. If the current key is encrypted, sk is encrypted
+// with the same passphrase.
+func (n *IpfsNode) WriteIdentityKey(sk ic.PrivKey) error {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return err
+	}
+
+	newcfg := *cfg
+	var passphrase string
+	if cfg.Identity.Encrypted() {
+		passphrase = n.passphrase
+	}
+	if err := newcfg.Identity.SetPrivateKey(sk, passphrase); err != nil {
+		return err
+	}
+	newcfg.Identity.PeerID = id.Pretty()
+	return n.Repo.SetConfig(&newcfg)
+}
+
+// IpnsKeys returns every key this node can publish ipns records with,
+// starting with its identity key.
+func (n *IpfsNode) IpnsKeys() ([]NamedKey, error) {
+	var out []NamedKey
+	if n.PrivateKey != nil {
+		out = append(out, NamedKey{Name: SelfKeyName, Key: n.PrivateKey})
+	}
+
+	ks, err := n.Keystore()
+	if err == ErrNoKeystore {
+		return out, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := ks.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		k, err := ks.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, NamedKey{Name: name, Key: k})
+	}
+	return out, nil
+}
+
+// ipnsKey returns the private key signing the records of an ipns name
+// published by this node.
+func (n *IpfsNode) ipnsKey(name key.Key) (ic.PrivKey, error) {
+	if name == key.Key(n.Identity) {
+		return n.PrivateKey, nil
+	}
+
+	keys, err := n.IpnsKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, nk := range keys {
+		h, err := nk.Key.GetPublic().Hash()
+		if err != nil {
+			return nil, err
+		}
+		if key.Key(h) == name {
+			return nk.Key, nil
+		}
+	}
+	return nil, fmt.Errorf("no private key for ipns name %s", name.B58String())
+}
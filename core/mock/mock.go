@@ -9,6 +9,7 @@ import (
 
 	commands "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	metrics "github.com/ipfs/go-ipfs/metrics"
 	host "github.com/ipfs/go-ipfs/p2p/host"
 	mocknet "github.com/ipfs/go-ipfs/p2p/net/mock"
@@ -53,6 +54,7 @@ func MockCmdsCtx() (commands.Context, error) {
 	r := &repo.Mock{
 		D: ds2.CloserWrap(syncds.MutexWrap(datastore.NewMapDatastore())),
 		C: conf,
+		K: keystore.NewMemKeystore(),
 	}
 
 	node, err := core.NewNode(context.Background(), &core.BuildCfg{
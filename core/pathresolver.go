@@ -20,38 +20,58 @@ var ErrNoNamesys = errors.New(
 // entries and returning the final merkledage node.  Effectively
 // enables /ipns/, /dns/, etc. in commands.
 func Resolve(ctx context.Context, n *IpfsNode, p path.Path) (*merkledag.Node, error) {
-	if strings.HasPrefix(p.String(), "/ipns/") {
-		// resolve ipns paths
+	p, err := resolveIpns(ctx, n, p)
+	if err != nil {
+		return nil, err
+	}
+
+	// ok, we have an ipfs path now (or what we'll treat as one)
+	return n.Resolver.ResolvePath(ctx, p)
+}
+
+// ResolveComponents resolves the given path like Resolve, but returns every
+// node along it, from the root the path starts at to the final node.
+func ResolveComponents(ctx context.Context, n *IpfsNode, p path.Path) ([]*merkledag.Node, error) {
+	p, err := resolveIpns(ctx, n, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.IsValid(); err != nil {
+		return nil, err
+	}
+	return n.Resolver.ResolvePathComponents(ctx, p)
+}
 
-		// TODO(cryptix): we sould be able to query the local cache for the path
-		if n.Namesys == nil {
-			return nil, ErrNoNamesys
-		}
+// resolveIpns replaces the /ipns/ name p starts with, if any, with the path
+// it resolves to.
+func resolveIpns(ctx context.Context, n *IpfsNode, p path.Path) (path.Path, error) {
+	if !strings.HasPrefix(p.String(), "/ipns/") {
+		return p, nil
+	}
 
-		seg := p.Segments()
+	// TODO(cryptix): we sould be able to query the local cache for the path
+	if n.Namesys == nil {
+		return "", ErrNoNamesys
+	}
 
-		if len(seg) < 2 || seg[1] == "" { // just "/<protocol/>" without further segments
-			return nil, path.ErrNoComponents
-		}
+	seg := p.Segments()
 
-		extensions := seg[2:]
-		resolvable, err := path.FromSegments("/", seg[0], seg[1])
-		if err != nil {
-			return nil, err
-		}
+	if len(seg) < 2 || seg[1] == "" { // just "/<protocol/>" without further segments
+		return "", path.ErrNoComponents
+	}
 
-		respath, err := n.Namesys.Resolve(ctx, resolvable.String())
-		if err != nil {
-			return nil, err
-		}
+	extensions := seg[2:]
+	resolvable, err := path.FromSegments("/", seg[0], seg[1])
+	if err != nil {
+		return "", err
+	}
 
-		segments := append(respath.Segments(), extensions...)
-		p, err = path.FromSegments("/", segments...)
-		if err != nil {
-			return nil, err
-		}
+	respath, err := n.Namesys.Resolve(ctx, resolvable.String())
+	if err != nil {
+		return "", err
 	}
 
-	// ok, we have an ipfs path now (or what we'll treat as one)
-	return n.Resolver.ResolvePath(ctx, p)
+	segments := append(respath.Segments(), extensions...)
+	return path.FromSegments("/", segments...)
 }
@@ -0,0 +1,231 @@
+// Package denylist keeps the list of content a gateway refuses to serve, in
+// a file of hashes and path prefixes.
+package denylist
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	gopath "path"
+	"sort"
+	"strings"
+	"sync"
+
+	atomicfile "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/facebookgo/atomicfile"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+// ErrNotListed is returned when removing an entry that is not on the list.
+var ErrNotListed = errors.New("entry is not on the denylist")
+
+// Denylist is a set of hashes and path prefixes, kept in a file with one
+// entry per line. A hash entry, like "Qm..." or "/ipfs/Qm...", denies the
+// object wherever it is reached. A path entry, like "/ipfs/Qm.../a" or
+// "/ipns/example.com/b", denies paths under it. Blank lines and lines
+// starting with '#' are ignored.
+type Denylist struct {
+	lk   sync.RWMutex
+	file string
+
+	entries  []string // as written in the file, to save them back
+	keys     map[key.Key]struct{}
+	prefixes []string
+}
+
+// Load reads the denylist in file. A missing file is an empty list, which is
+// created on the first Add.
+func Load(file string) (*Denylist, error) {
+	d := &Denylist{file: file}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload reads the file again, replacing the entries in memory.
+func (d *Denylist) Reload() error {
+	data, err := ioutil.ReadFile(d.file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var entries []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := ParseEntry(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", d.file, n, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	d.set(entries)
+	return nil
+}
+
+// ParseEntry validates a denylist entry and returns it in its canonical
+// form: a bare hash, or a clean path.
+func ParseEntry(s string) (string, error) {
+	if k, err := path.ParseKeyToPath(s); err == nil {
+		return strings.TrimPrefix(k.String(), "/ipfs/"), nil
+	}
+
+	p, err := path.ParsePath(s)
+	if err != nil || !strings.HasPrefix(s, "/") {
+		return "", fmt.Errorf("invalid denylist entry %q, expected a hash or an /ipfs/ or /ipns/ path", s)
+	}
+
+	segs := p.Segments()
+	if len(segs) < 2 || segs[1] == "" {
+		return "", fmt.Errorf("invalid denylist entry %q, expected a hash or an /ipfs/ or /ipns/ path", s)
+	}
+	if segs[0] == "ipfs" && len(segs) == 2 {
+		return segs[1], nil
+	}
+	return "/" + strings.Join(segs, "/"), nil
+}
+
+// set replaces the entries. It is called with lk held.
+func (d *Denylist) set(entries []string) {
+	d.entries = entries
+	d.keys = make(map[key.Key]struct{})
+	d.prefixes = nil
+	for _, e := range entries {
+		if strings.HasPrefix(e, "/") {
+			d.prefixes = append(d.prefixes, e)
+		} else {
+			d.keys[key.B58KeyDecode(e)] = struct{}{}
+		}
+	}
+}
+
+// Add adds entries to the list and saves it. Entries already on it are
+// skipped.
+func (d *Denylist) Add(entries ...string) error {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	next := append([]string(nil), d.entries...)
+	for _, s := range entries {
+		e, err := ParseEntry(s)
+		if err != nil {
+			return err
+		}
+		if !contains(next, e) {
+			next = append(next, e)
+		}
+	}
+	return d.save(next)
+}
+
+// Remove removes entries from the list and saves it.
+func (d *Denylist) Remove(entries ...string) error {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	next := append([]string(nil), d.entries...)
+	for _, s := range entries {
+		e, err := ParseEntry(s)
+		if err != nil {
+			return err
+		}
+		found := false
+		for i, x := range next {
+			if x == e {
+				next = append(next[:i], next[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %s", s, ErrNotListed)
+		}
+	}
+	return d.save(next)
+}
+
+// List returns the entries, sorted.
+func (d *Denylist) List() []string {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+
+	out := append([]string(nil), d.entries...)
+	sort.Strings(out)
+	return out
+}
+
+// save writes entries to the file and sets them. It is called with lk held.
+func (d *Denylist) save(entries []string) error {
+	buf := new(bytes.Buffer)
+	for _, e := range entries {
+		fmt.Fprintln(buf, e)
+	}
+	f, err := atomicfile.New(d.file, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	d.set(entries)
+	return nil
+}
+
+// Blocks returns whether the request path p is denied, by a path prefix or
+// the hash it starts from.
+func (d *Denylist) Blocks(p string) bool {
+	p = gopath.Clean("/" + p)
+
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+
+	for _, prefix := range d.prefixes {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+
+	segs := strings.SplitN(p, "/", 4)
+	if len(segs) >= 3 && segs[1] == "ipfs" {
+		if _, ok := d.keys[key.B58KeyDecode(segs[2])]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// BlocksKey returns whether the object k is denied.
+func (d *Denylist) BlocksKey(k key.Key) bool {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+
+	_, ok := d.keys[k]
+	return ok
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
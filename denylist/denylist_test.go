@@ -0,0 +1,107 @@
+package denylist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+const (
+	hashA = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+	hashB = "QmVpmzuWNapGd2k36uA1AtkD3DiJUMVeV16Rerh6cAmVKP"
+)
+
+func TestDenylist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "denylist")
+
+	d, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Blocks("/ipfs/" + hashA) {
+		t.Fatal("empty list blocks")
+	}
+
+	if err := d.Add("/ipfs/"+hashA, "/ipfs/"+hashB+"/secret", "/ipns/example.com/private/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Add("not a hash"); err == nil {
+		t.Fatal("expected an error adding an invalid entry")
+	}
+
+	for _, c := range []struct {
+		path    string
+		blocked bool
+	}{
+		{"/ipfs/" + hashA, true},
+		{"/ipfs/" + hashA + "/a/b", true},
+		{"/ipfs/" + hashB, false},
+		{"/ipfs/" + hashB + "/secret", true},
+		{"/ipfs/" + hashB + "/secret/", true},
+		{"/ipfs/" + hashB + "/secret/c", true},
+		{"/ipfs/" + hashB + "/secrets", false},
+		{"/ipfs/" + hashB + "/public/../secret", true},
+		{"/ipns/example.com/private", true},
+		{"/ipns/example.com/", false},
+	} {
+		if d.Blocks(c.path) != c.blocked {
+			t.Errorf("Blocks(%s) should be %t", c.path, c.blocked)
+		}
+	}
+	if !d.BlocksKey(key.B58KeyDecode(hashA)) || d.BlocksKey(key.B58KeyDecode(hashB)) {
+		t.Error("BlocksKey should only block hash entries")
+	}
+
+	// survives a reload from the file
+	d, err = Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.List()) != 3 {
+		t.Fatalf("reloaded %d entries, expected 3", len(d.List()))
+	}
+
+	if err := d.Remove(hashA); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Remove(hashA); err == nil {
+		t.Fatal("expected an error removing an entry not on the list")
+	}
+	if d.Blocks("/ipfs/" + hashA) {
+		t.Fatal("removed entry still blocks")
+	}
+}
+
+func TestReloadComments(t *testing.T) {
+	f, err := ioutil.TempFile("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# takedown 2015-10-01\n\n" + hashA + "\n")
+	f.Close()
+
+	d, err := Load(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Blocks("/ipfs/" + hashA) {
+		t.Fatal("entry in file does not block")
+	}
+
+	ioutil.WriteFile(f.Name(), []byte("/ipfs/bad\n"), 0644)
+	if err := d.Reload(); err == nil {
+		t.Fatal("expected an error reloading an invalid file")
+	}
+	if !d.Blocks("/ipfs/" + hashA) {
+		t.Fatal("failed reload dropped the entries")
+	}
+}
@@ -64,6 +64,7 @@ func New(parent context.Context, p peer.ID, network bsnet.BitSwapNetwork,
 	ctx, cancelFunc := context.WithCancel(parent)
 
 	notif := notifications.New()
+	tracker := newFetchTracker()
 	px := process.WithTeardown(func() error {
 		notif.Shutdown()
 		return nil
@@ -80,7 +81,9 @@ func New(parent context.Context, p peer.ID, network bsnet.BitSwapNetwork,
 		newBlocks:     make(chan *blocks.Block, HasBlockBufferSize),
 		provideKeys:   make(chan key.Key, provideKeysBufferSize),
 		wm:            NewWantManager(ctx, network),
+		tracker:       tracker,
 	}
+	bs.wm.tracker = tracker
 	go bs.wm.Run()
 	network.SetDelegate(bs)
 
@@ -128,6 +131,9 @@ type Bitswap struct {
 
 	provideKeys chan key.Key
 
+	// tracker records the progress of outstanding block requests
+	tracker *fetchTracker
+
 	counterLk      sync.Mutex
 	blocksRecvd    int
 	dupBlocksRecvd int
@@ -207,6 +213,7 @@ func (bs *Bitswap) GetBlocks(ctx context.Context, keys []key.Key) (<-chan *block
 		log.Event(ctx, "Bitswap.GetBlockRequest.Start", &k)
 	}
 
+	bs.tracker.Wanted(ctx, keys)
 	bs.wm.WantBlocks(keys)
 
 	req := &blockRequest{
@@ -223,6 +230,7 @@ func (bs *Bitswap) GetBlocks(ctx context.Context, keys []key.Key) (<-chan *block
 
 // CancelWant removes a given key from the wantlist
 func (bs *Bitswap) CancelWants(ks []key.Key) {
+	bs.tracker.Cancel(ks)
 	bs.wm.CancelWants(ks)
 }
 
@@ -278,8 +286,10 @@ func (bs *Bitswap) connectToProviders(ctx context.Context, entries []wantlist.En
 
 			child, cancel := context.WithTimeout(ctx, providerRequestTimeout)
 			defer cancel()
+			bs.tracker.FindingProviders(k)
 			providers := bs.network.FindProvidersAsync(child, k, maxProvidersPerRequest)
 			for prov := range providers {
+				bs.tracker.FoundProvider(k, prov)
 				go func(p peer.ID) {
 					bs.network.ConnectTo(ctx, p)
 				}(prov)
@@ -326,6 +336,7 @@ func (bs *Bitswap) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg
 
 			k := b.Key()
 			log.Event(ctx, "Bitswap.GetBlockRequest.End", &k)
+			bs.tracker.Received(k, p)
 
 			log.Debugf("got block %s from %s", b, p)
 			if err := bs.HasBlock(b); err != nil {
@@ -14,6 +14,7 @@ import (
 	blocksutil "github.com/ipfs/go-ipfs/blocks/blocksutil"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	tn "github.com/ipfs/go-ipfs/exchange/bitswap/testnet"
+	notif "github.com/ipfs/go-ipfs/notifications"
 	p2ptestutil "github.com/ipfs/go-ipfs/p2p/test/util"
 	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
 	delay "github.com/ipfs/go-ipfs/thirdparty/delay"
@@ -283,3 +284,163 @@ func TestBasicBitswap(t *testing.T) {
 		}
 	}
 }
+
+func TestFetchProgressEvents(t *testing.T) {
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	block := blocks.NewBlock([]byte("block"))
+	g := NewTestSessionGenerator(net)
+	defer g.Close()
+
+	peers := g.Instances(2)
+	hasBlock := peers[0]
+	defer hasBlock.Exchange.Close()
+
+	if err := hasBlock.Exchange.HasBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	wantsBlock := peers[1]
+	defer wantsBlock.Exchange.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	events := make(chan *notif.FetchEvent, 16)
+	ctx = notif.RegisterForFetchEvents(ctx, events)
+
+	if _, err := wantsBlock.Exchange.GetBlock(ctx, block.Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	var wanted, received bool
+	for !received {
+		select {
+		case ev := <-events:
+			if ev.Key != block.Key() {
+				t.Fatalf("event for unexpected key %s", ev.Key)
+			}
+			switch ev.Type {
+			case notif.WantedBlock:
+				wanted = true
+			case notif.ReceivedBlock:
+				if ev.Peer != hasBlock.Peer {
+					t.Fatalf("block received from %s, expected %s", ev.Peer, hasBlock.Peer)
+				}
+				received = true
+			}
+		case <-ctx.Done():
+			t.Fatal("did not receive ReceivedBlock event")
+		}
+	}
+	if !wanted {
+		t.Fatal("did not receive WantedBlock event")
+	}
+
+	if _, ok := wantsBlock.Exchange.Inspect(block.Key()); ok {
+		t.Fatal("received block should no longer be tracked")
+	}
+}
+
+func TestInspectWantedBlock(t *testing.T) {
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	g := NewTestSessionGenerator(net)
+	defer g.Close()
+
+	peers := g.Instances(2)
+	for _, p := range peers {
+		defer p.Exchange.Close()
+	}
+	self, other := peers[0], peers[1]
+
+	k := blocks.NewBlock([]byte("nobody has this")).Key()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := self.Exchange.GetBlocks(ctx, []key.Key{k}); err != nil {
+		t.Fatal(err)
+	}
+
+	var st *KeyStatus
+	for i := 0; i < 100; i++ {
+		var ok bool
+		st, ok = self.Exchange.Inspect(k)
+		if !ok {
+			t.Fatal("wanted key is not tracked")
+		}
+		if len(st.PeersContacted) > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if st.Requesters != 1 {
+		t.Fatalf("expected 1 requester, got %d", st.Requesters)
+	}
+	if len(st.PeersContacted) != 1 || st.PeersContacted[0] != other.Peer.Pretty() {
+		t.Fatalf("expected want to be sent to %s, got %v", other.Peer.Pretty(), st.PeersContacted)
+	}
+
+	self.Exchange.CancelWants([]key.Key{k})
+	if _, ok := self.Exchange.Inspect(k); ok {
+		t.Fatal("cancelled key should no longer be tracked")
+	}
+}
+
+func TestFetchTrackerReleasesCancelledRequests(t *testing.T) {
+	ft := newFetchTracker()
+	k := blocks.NewBlock([]byte("abandoned")).Key()
+
+	// nobody reads the events, which must not block the tracker
+	events := make(chan *notif.FetchEvent)
+	ctx, cancel := context.WithCancel(context.Background())
+	ft.Wanted(notif.RegisterForFetchEvents(ctx, events), []key.Key{k})
+	ft.FindingProviders(k)
+
+	if _, ok := ft.Status(k); !ok {
+		t.Fatal("wanted key should be tracked")
+	}
+
+	cancel()
+	for i := 0; ; i++ {
+		if _, ok := ft.Status(k); !ok {
+			break
+		}
+		if i == 100 {
+			t.Fatal("key of a cancelled request is still tracked")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestFetchTrackerEndsFinishedRequests(t *testing.T) {
+	ft := newFetchTracker()
+	k1 := blocks.NewBlock([]byte("first")).Key()
+	k2 := blocks.NewBlock([]byte("second")).Key()
+
+	events := make(chan *notif.FetchEvent, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = notif.RegisterForFetchEvents(ctx, events)
+	ft.Wanted(ctx, []key.Key{k1, k2})
+	req := ft.keys[k1].reqs[0]
+
+	if sts := ft.Requested(ctx); len(sts) != 2 {
+		t.Fatalf("expected 2 keys requested, got %d", len(sts))
+	}
+
+	ft.Received(k1, "")
+	select {
+	case <-req.done:
+		t.Fatal("request ended with a key outstanding")
+	default:
+	}
+	if sts := ft.Requested(ctx); len(sts) != 1 || sts[0].Key != k2 {
+		t.Fatalf("expected only %s requested, got %v", k2, sts)
+	}
+
+	ft.Cancel([]key.Key{k2})
+	select {
+	case <-req.done:
+	case <-time.After(time.Second):
+		t.Fatal("request did not end once all of its keys were done")
+	}
+}
@@ -0,0 +1,264 @@
+package bitswap
+
+import (
+	"sync"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	notif "github.com/ipfs/go-ipfs/notifications"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+)
+
+// KeyStatus describes what bitswap has done so far to retrieve a key that is
+// still on the wantlist.
+type KeyStatus struct {
+	Key              key.Key
+	WantedSince      time.Time
+	ProviderSearches int
+	Providers        []string
+	PeersContacted   []string
+	Requesters       int
+}
+
+type trackedKey struct {
+	wantedSince time.Time
+	searches    int
+	providers   []peer.ID
+	contacted   []peer.ID
+	reqs        []*fetchRequest
+}
+
+// fetchRequest is a call to GetBlocks whose keys are tracked. done is closed
+// once none of its keys are tracked anymore.
+type fetchRequest struct {
+	ctx       context.Context
+	remaining int
+	done      chan struct{}
+}
+
+type fetchEvent struct {
+	ctx context.Context
+	ev  *notif.FetchEvent
+}
+
+// fetchTracker records the progress of outstanding block requests so that
+// stalled fetches can be inspected, and forwards progress events to the
+// requests that registered for them with notif.RegisterForFetchEvents.
+type fetchTracker struct {
+	lk   sync.Mutex
+	keys map[key.Key]*trackedKey
+}
+
+func newFetchTracker() *fetchTracker {
+	return &fetchTracker{keys: make(map[key.Key]*trackedKey)}
+}
+
+// Wanted starts tracking the given keys on behalf of the request bound to ctx.
+// The request stops receiving events once ctx is done, or once all of its
+// keys were received or cancelled.
+func (ft *fetchTracker) Wanted(ctx context.Context, ks []key.Key) {
+	if len(ks) == 0 {
+		return
+	}
+
+	req := &fetchRequest{ctx: ctx, done: make(chan struct{})}
+	var evs []fetchEvent
+	ft.lk.Lock()
+	for _, k := range ks {
+		tk, ok := ft.keys[k]
+		if !ok {
+			tk = &trackedKey{wantedSince: time.Now()}
+			ft.keys[k] = tk
+		}
+		tk.reqs = append(tk.reqs, req)
+		req.remaining++
+		evs = append(evs, fetchEvent{ctx, &notif.FetchEvent{Type: notif.WantedBlock, Key: k}})
+	}
+	ft.lk.Unlock()
+	publishFetchEvents(evs)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			ft.release(req, ks)
+		case <-req.done:
+		}
+	}()
+}
+
+// release removes req from the given keys, and stops tracking the keys
+// nobody requests anymore.
+func (ft *fetchTracker) release(req *fetchRequest, ks []key.Key) {
+	ft.lk.Lock()
+	defer ft.lk.Unlock()
+	for _, k := range ks {
+		tk, ok := ft.keys[k]
+		if !ok {
+			continue
+		}
+		for i, r := range tk.reqs {
+			if r == req {
+				tk.reqs = append(tk.reqs[:i], tk.reqs[i+1:]...)
+				break
+			}
+		}
+		if len(tk.reqs) == 0 {
+			delete(ft.keys, k)
+		}
+	}
+}
+
+// remove stops tracking k, and ends the requests it was the last key of.
+// ft.lk must be held.
+func (ft *fetchTracker) remove(k key.Key) {
+	tk, ok := ft.keys[k]
+	if !ok {
+		return
+	}
+	delete(ft.keys, k)
+	for _, req := range tk.reqs {
+		req.remaining--
+		if req.remaining == 0 {
+			close(req.done)
+		}
+	}
+}
+
+// FindingProviders records that a provider lookup was started for k.
+func (ft *fetchTracker) FindingProviders(k key.Key) {
+	publishFetchEvents(ft.update(k, notif.FindingProviders, "", func(tk *trackedKey) {
+		tk.searches++
+	}))
+}
+
+// FoundProvider records that p was returned as a provider of k.
+func (ft *fetchTracker) FoundProvider(k key.Key, p peer.ID) {
+	publishFetchEvents(ft.update(k, notif.FoundProvider, p, func(tk *trackedKey) {
+		tk.providers = appendPeer(tk.providers, p)
+	}))
+}
+
+// SentWantlist records that the given keys were sent to p in a wantlist.
+func (ft *fetchTracker) SentWantlist(p peer.ID, ks []key.Key) {
+	var evs []fetchEvent
+	for _, k := range ks {
+		evs = append(evs, ft.update(k, notif.SentWantlist, p, func(tk *trackedKey) {
+			tk.contacted = appendPeer(tk.contacted, p)
+		})...)
+	}
+	publishFetchEvents(evs)
+}
+
+// Received records that k was received from p and stops tracking it.
+func (ft *fetchTracker) Received(k key.Key, p peer.ID) {
+	evs := ft.update(k, notif.ReceivedBlock, p, nil)
+	ft.Cancel([]key.Key{k})
+	publishFetchEvents(evs)
+}
+
+// Cancel stops tracking the given keys.
+func (ft *fetchTracker) Cancel(ks []key.Key) {
+	ft.lk.Lock()
+	defer ft.lk.Unlock()
+	for _, k := range ks {
+		ft.remove(k)
+	}
+}
+
+// Status returns the current status of k, if it is being tracked.
+func (ft *fetchTracker) Status(k key.Key) (*KeyStatus, bool) {
+	ft.lk.Lock()
+	defer ft.lk.Unlock()
+	tk, ok := ft.keys[k]
+	if !ok {
+		return nil, false
+	}
+	return tk.status(k), true
+}
+
+// Requested returns the status of the keys still wanted by the requests
+// that registered for fetch events with the same channel as ctx.
+func (ft *fetchTracker) Requested(ctx context.Context) []*KeyStatus {
+	ch := ctx.Value(notif.FetchProgressKey)
+	if ch == nil {
+		return nil
+	}
+
+	ft.lk.Lock()
+	defer ft.lk.Unlock()
+	var sts []*KeyStatus
+	for k, tk := range ft.keys {
+		for _, req := range tk.reqs {
+			if req.ctx.Value(notif.FetchProgressKey) == ch {
+				sts = append(sts, tk.status(k))
+				break
+			}
+		}
+	}
+	return sts
+}
+
+func (tk *trackedKey) status(k key.Key) *KeyStatus {
+	st := &KeyStatus{
+		Key:              k,
+		WantedSince:      tk.wantedSince,
+		ProviderSearches: tk.searches,
+		Requesters:       len(tk.reqs),
+	}
+	for _, p := range tk.providers {
+		st.Providers = append(st.Providers, p.Pretty())
+	}
+	for _, p := range tk.contacted {
+		st.PeersContacted = append(st.PeersContacted, p.Pretty())
+	}
+	return st
+}
+
+// update applies fn to the record of k and returns the events to send to the
+// requesters of k. Events must be published without holding ft.lk.
+func (ft *fetchTracker) update(k key.Key, t notif.FetchEventType, p peer.ID, fn func(*trackedKey)) []fetchEvent {
+	ft.lk.Lock()
+	defer ft.lk.Unlock()
+	tk, ok := ft.keys[k]
+	if !ok {
+		return nil
+	}
+	if fn != nil {
+		fn(tk)
+	}
+
+	var evs []fetchEvent
+	for _, req := range tk.reqs {
+		evs = append(evs, fetchEvent{req.ctx, &notif.FetchEvent{Type: t, Key: k, Peer: p}})
+	}
+	return evs
+}
+
+func publishFetchEvents(evs []fetchEvent) {
+	for _, e := range evs {
+		notif.PublishFetchEvent(e.ctx, e.ev)
+	}
+}
+
+func appendPeer(ps []peer.ID, p peer.ID) []peer.ID {
+	for _, o := range ps {
+		if o == p {
+			return ps
+		}
+	}
+	return append(ps, p)
+}
+
+// Inspect returns what bitswap has done so far to retrieve k. It returns
+// false if k is not currently wanted.
+func (bs *Bitswap) Inspect(k key.Key) (*KeyStatus, bool) {
+	return bs.tracker.Status(k)
+}
+
+// InspectFetch returns the status of the keys still wanted by the requests
+// made with the fetch event channel registered on ctx, see
+// notif.RegisterForFetchEvents.
+func (bs *Bitswap) InspectFetch(ctx context.Context) []*KeyStatus {
+	return bs.tracker.Requested(ctx)
+}
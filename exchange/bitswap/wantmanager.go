@@ -25,6 +25,9 @@ type WantManager struct {
 
 	network bsnet.BitSwapNetwork
 	ctx     context.Context
+
+	// tracker, if set, is told which keys were sent to which peers
+	tracker *fetchTracker
 }
 
 func NewWantManager(ctx context.Context, network bsnet.BitSwapNetwork) *WantManager {
@@ -55,6 +58,7 @@ type msgQueue struct {
 	outlk   sync.Mutex
 	out     bsmsg.BitSwapMessage
 	network bsnet.BitSwapNetwork
+	tracker *fetchTracker
 
 	work chan struct{}
 	done chan struct{}
@@ -180,6 +184,16 @@ func (mq *msgQueue) doWork(ctx context.Context) {
 		// TODO: what do we do if this fails?
 		return
 	}
+
+	if mq.tracker != nil {
+		var sent []key.Key
+		for _, e := range wlm.Wantlist() {
+			if !e.Cancel {
+				sent = append(sent, e.Key)
+			}
+		}
+		mq.tracker.SentWantlist(mq.p, sent)
+	}
 }
 
 func (pm *WantManager) Connected(p peer.ID) {
@@ -246,6 +260,7 @@ func (wm *WantManager) newMsgQueue(p peer.ID) *msgQueue {
 	mq.done = make(chan struct{})
 	mq.work = make(chan struct{}, 1)
 	mq.network = wm.network
+	mq.tracker = wm.tracker
 	mq.p = p
 
 	return mq
@@ -164,8 +164,10 @@ func (bs *Bitswap) providerConnector(parent context.Context) {
 			// be able to provide for all keys. This currently holds true in most
 			// every situation. Later, this assumption may not hold as true.
 			child, cancel := context.WithTimeout(req.ctx, providerRequestTimeout)
+			bs.tracker.FindingProviders(keys[0])
 			providers := bs.network.FindProvidersAsync(child, keys[0], maxProvidersPerRequest)
 			for p := range providers {
+				bs.tracker.FoundProvider(keys[0], p)
 				go bs.network.ConnectTo(req.ctx, p)
 			}
 			cancel()
@@ -0,0 +1,92 @@
+package reprovide
+
+import (
+	"fmt"
+	"sort"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	pin "github.com/ipfs/go-ipfs/pin"
+)
+
+// KeyChanFunc returns the keys a reprovide run should announce.
+type KeyChanFunc func(context.Context) (<-chan key.Key, error)
+
+// Names of the strategies accepted by NewStrategy.
+const (
+	StrategyAll    = "all"
+	StrategyPinned = "pinned"
+	StrategyRoots  = "roots"
+)
+
+// NewBlockstoreProvider returns a KeyChanFunc that announces every block in
+// the blockstore.
+func NewBlockstoreProvider(bstore blocks.Blockstore) KeyChanFunc {
+	return func(ctx context.Context) (<-chan key.Key, error) {
+		return bstore.AllKeysChan(ctx)
+	}
+}
+
+// NewPinnedProvider returns a KeyChanFunc that announces every pinned block,
+// including blocks pinned indirectly by a recursive pin.
+func NewPinnedProvider(pinner pin.Pinner) KeyChanFunc {
+	return func(ctx context.Context) (<-chan key.Key, error) {
+		keys := pinner.DirectKeys()
+		keys = append(keys, pinner.RecursiveKeys()...)
+		for k := range pinner.IndirectKeys() {
+			keys = append(keys, k)
+		}
+		return sortedKeyChan(ctx, keys), nil
+	}
+}
+
+// NewPinnedRootsProvider returns a KeyChanFunc that announces only the roots
+// of recursive pins.
+func NewPinnedRootsProvider(pinner pin.Pinner) KeyChanFunc {
+	return func(ctx context.Context) (<-chan key.Key, error) {
+		return sortedKeyChan(ctx, pinner.RecursiveKeys()), nil
+	}
+}
+
+// NewStrategy returns the KeyChanFunc for the named strategy.
+func NewStrategy(name string, bstore blocks.Blockstore, pinner pin.Pinner) (KeyChanFunc, error) {
+	switch name {
+	case StrategyAll, "":
+		return NewBlockstoreProvider(bstore), nil
+	case StrategyPinned:
+		return NewPinnedProvider(pinner), nil
+	case StrategyRoots:
+		return NewPinnedRootsProvider(pinner), nil
+	default:
+		return nil, fmt.Errorf("unknown reprovider strategy %q", name)
+	}
+}
+
+// sortedKeyChan sends the deduplicated keys out in a stable order, so that an
+// interrupted run can be resumed from its cursor.
+func sortedKeyChan(ctx context.Context, keys []key.Key) <-chan key.Key {
+	seen := make(map[key.Key]struct{})
+	var uniq []string
+	for _, k := range keys {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		uniq = append(uniq, string(k))
+	}
+	sort.Strings(uniq)
+
+	out := make(chan key.Key)
+	go func() {
+		defer close(out)
+		for _, k := range uniq {
+			select {
+			case out <- key.Key(k):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -1,73 +1,356 @@
 package reprovide
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	backoff "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/cenkalti/backoff"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
-	blocks "github.com/ipfs/go-ipfs/blocks/blockstore"
+	bloom "github.com/ipfs/go-ipfs/blocks/bloom"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	routing "github.com/ipfs/go-ipfs/routing"
 	logging "github.com/ipfs/go-ipfs/vendor/go-log-v1.0.0"
 )
 
 var log = logging.Logger("reprovider")
 
+var ErrAlreadyRunning = errors.New("reprovider is already running")
+
+// cursorKey is where the progress of the current run is kept, so that a run
+// interrupted by a restart resumes where it stopped.
+var cursorKey = ds.NewKey("/local/reprovider/cursor")
+
+// providedKey is where a bloom filter of the keys provided by the current
+// run is kept. Key providers do not list keys in a stable order, so a
+// resumed run skips the keys found in the filter rather than the keys before
+// a position.
+var providedKey = ds.NewKey("/local/reprovider/provided")
+
+// providedFilterSize is the size in bytes of the filter of provided keys.
+// With five million keys about one in twenty is a false positive, which a
+// resumed run skips; the next run provides it again.
+var providedFilterSize = 4 << 20
+
+// cursorSaveInterval is how often the cursor and the filter of provided keys
+// are written during a run.
+var cursorSaveInterval = time.Minute
+
+// ProvideRetryTime is how long providing a key is retried before the run
+// skips it.
+var ProvideRetryTime = backoff.DefaultMaxElapsedTime
+
 type Reprovider struct {
 	// The routing system to provide values through
 	rsys routing.IpfsRouting
 
-	// The backing store for blocks to be provided
-	bstore blocks.Blockstore
+	// The keys to be provided in each run
+	keyProvider KeyChanFunc
+
+	// Where the progress cursor is stored, may be nil
+	dstore ds.Datastore
+
+	// Maximum number of provides per second, zero means unlimited
+	rateLimit int
+
+	// trigger receives a channel that is closed once the triggered run
+	// has started
+	trigger chan chan struct{}
+
+	lk     sync.Mutex
+	status Status
+}
+
+// Status describes the current or last reprovide run.
+type Status struct {
+	Running   bool
+	LastStart time.Time
+	LastEnd   time.Time
+	Provided  int
+	Failed    int
+	Resumed   bool
+	LastError string
 }
 
-func NewReprovider(rsys routing.IpfsRouting, bstore blocks.Blockstore) *Reprovider {
+type cursor struct {
+	Provided int
+	Finished bool
+}
+
+// NewReprovider creates a reprovider announcing the keys returned by
+// keyProvider through rsys. If dstore is not nil, the progress of each run is
+// recorded there.
+func NewReprovider(rsys routing.IpfsRouting, keyProvider KeyChanFunc, dstore ds.Datastore) *Reprovider {
 	return &Reprovider{
-		rsys:   rsys,
-		bstore: bstore,
+		rsys:        rsys,
+		keyProvider: keyProvider,
+		dstore:      dstore,
+		trigger:     make(chan chan struct{}),
 	}
 }
 
+// SetRateLimit limits the number of provides per second. Zero disables the
+// limit.
+func (rp *Reprovider) SetRateLimit(perSecond int) {
+	rp.lk.Lock()
+	defer rp.lk.Unlock()
+	rp.rateLimit = perSecond
+}
+
 func (rp *Reprovider) ProvideEvery(ctx context.Context, tick time.Duration) {
 	// dont reprovide immediately.
 	// may have just started the daemon and shutting it down immediately.
 	// probability( up another minute | uptime ) increases with uptime.
 	after := time.After(time.Minute)
 	for {
+		var started chan struct{}
 		select {
 		case <-ctx.Done():
 			return
+		case started = <-rp.trigger:
 		case <-after:
-			err := rp.Reprovide(ctx)
-			if err != nil {
-				log.Debug(err)
-			}
-			after = time.After(tick)
 		}
+
+		err := rp.run(ctx, started)
+		if err != nil {
+			log.Debug(err)
+		}
+		after = time.After(tick)
+	}
+}
+
+// Trigger starts a reprovide run in the ProvideEvery loop without waiting for
+// it to complete. Once it returns, Status describes the triggered run.
+func (rp *Reprovider) Trigger(ctx context.Context) error {
+	if rp.Status().Running {
+		return ErrAlreadyRunning
 	}
+
+	started := make(chan struct{})
+	select {
+	case rp.trigger <- started:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-started:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the status of the current or last run.
+func (rp *Reprovider) Status() Status {
+	rp.lk.Lock()
+	defer rp.lk.Unlock()
+	return rp.status
 }
 
+// Reprovide announces every key returned by the key provider. If the previous
+// run was interrupted, the keys it provided are skipped.
 func (rp *Reprovider) Reprovide(ctx context.Context) error {
-	keychan, err := rp.bstore.AllKeysChan(ctx)
+	return rp.run(ctx, nil)
+}
+
+// run is Reprovide, closing started, if not nil, once the run has started
+// or was refused.
+func (rp *Reprovider) run(ctx context.Context, started chan struct{}) error {
+	rp.lk.Lock()
+	if rp.status.Running {
+		rp.lk.Unlock()
+		if started != nil {
+			close(started)
+		}
+		return ErrAlreadyRunning
+	}
+	rp.status = Status{Running: true, LastStart: time.Now()}
+	rp.lk.Unlock()
+	if started != nil {
+		close(started)
+	}
+
+	err := rp.reprovide(ctx)
+
+	rp.lk.Lock()
+	rp.status.Running = false
+	rp.status.LastEnd = time.Now()
 	if err != nil {
-		return fmt.Errorf("Failed to get key chan from blockstore: %s", err)
+		rp.status.LastError = err.Error()
+	}
+	rp.lk.Unlock()
+	return err
+}
+
+func (rp *Reprovider) reprovide(ctx context.Context) error {
+	// stop the key provider however the run ends
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var provided bloom.Filter
+	count := 0
+	if cur := rp.loadCursor(); cur != nil && !cur.Finished {
+		provided = rp.loadProvided()
+		count = cur.Provided
+	}
+	resumed := provided != nil
+	if !resumed {
+		provided = bloom.NewFilter(providedFilterSize)
+		rp.saveCursor(&cursor{}, nil)
 	}
+
+	rp.lk.Lock()
+	rp.status.Resumed = resumed
+	limit := rp.rateLimit
+	rp.lk.Unlock()
+
+	var limiter <-chan time.Time
+	if limit > 0 {
+		t := time.NewTicker(time.Second / time.Duration(limit))
+		defer t.Stop()
+		limiter = t.C
+	}
+
+	keychan, err := rp.keyProvider(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to get key chan from key provider: %s", err)
+	}
+
+	lastSave := time.Now()
 	for k := range keychan {
-		op := func() error {
-			err := rp.rsys.Provide(ctx, k)
-			if err != nil {
-				log.Debugf("Failed to provide key: %s", err)
+		if resumed && provided.Find([]byte(k)) {
+			continue
+		}
+
+		if limiter != nil {
+			select {
+			case <-limiter:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := rp.provide(ctx, k); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
-			return err
+			log.Warningf("failed to provide %s, skipping it: %s", k.B58String(), err)
+			rp.lk.Lock()
+			rp.status.Failed++
+			rp.lk.Unlock()
+			continue
+		}
+
+		provided.Add([]byte(k))
+		count++
+		rp.lk.Lock()
+		rp.status.Provided++
+		rp.lk.Unlock()
+		if time.Since(lastSave) >= cursorSaveInterval {
+			rp.saveCursor(&cursor{Provided: count}, provided)
+			lastSave = time.Now()
 		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 
-		// TODO: this backoff library does not respect our context, we should
-		// eventually work contexts into it. low priority.
-		err := backoff.Retry(op, backoff.NewExponentialBackOff())
+	rp.saveCursor(&cursor{Finished: true, Provided: count}, nil)
+	return nil
+}
+
+func (rp *Reprovider) provide(ctx context.Context, k key.Key) error {
+	op := func() error {
+		err := rp.rsys.Provide(ctx, k)
 		if err != nil {
-			log.Debugf("Providing failed after number of retries: %s", err)
-			return err
+			log.Debugf("Failed to provide key: %s", err)
 		}
+		return err
+	}
+
+	// TODO: this backoff library does not respect our context, we should
+	// eventually work contexts into it. low priority.
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = ProvideRetryTime
+	err := backoff.Retry(op, b)
+	if err != nil {
+		log.Debugf("Providing failed after number of retries: %s", err)
+		return err
 	}
 	return nil
 }
+
+func (rp *Reprovider) loadCursor() *cursor {
+	if rp.dstore == nil {
+		return nil
+	}
+	val, err := rp.dstore.Get(cursorKey)
+	if err != nil {
+		if err != ds.ErrNotFound {
+			log.Debugf("reading reprovider cursor: %s", err)
+		}
+		return nil
+	}
+	b, ok := val.([]byte)
+	if !ok {
+		return nil
+	}
+
+	cur := new(cursor)
+	if err := json.Unmarshal(b, cur); err != nil {
+		log.Debugf("decoding reprovider cursor: %s", err)
+		return nil
+	}
+	return cur
+}
+
+// saveCursor records the progress of the current run, along with the
+// filter of the keys it provided. A nil filter forgets the stored one.
+func (rp *Reprovider) saveCursor(cur *cursor, provided bloom.Filter) {
+	if rp.dstore == nil {
+		return
+	}
+
+	if provided != nil {
+		if err := rp.dstore.Put(providedKey, provided.Bytes()); err != nil {
+			log.Debugf("writing provided keys: %s", err)
+			return
+		}
+	} else if err := rp.dstore.Delete(providedKey); err != nil && err != ds.ErrNotFound {
+		log.Debugf("deleting provided keys: %s", err)
+	}
+
+	b, err := json.Marshal(cur)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if err := rp.dstore.Put(cursorKey, b); err != nil {
+		log.Debugf("writing reprovider cursor: %s", err)
+	}
+}
+
+// loadProvided returns the filter of the keys the interrupted run provided,
+// or nil if there is none.
+func (rp *Reprovider) loadProvided() bloom.Filter {
+	if rp.dstore == nil {
+		return nil
+	}
+	val, err := rp.dstore.Get(providedKey)
+	if err != nil {
+		if err != ds.ErrNotFound {
+			log.Debugf("reading provided keys: %s", err)
+		}
+		return nil
+	}
+	b, ok := val.([]byte)
+	if !ok || len(b) == 0 {
+		return nil
+	}
+	return bloom.FromBytes(b)
+}
@@ -1,13 +1,19 @@
 package reprovide_test
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
 	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	blocks "github.com/ipfs/go-ipfs/blocks"
 	blockstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	bloom "github.com/ipfs/go-ipfs/blocks/bloom"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	routing "github.com/ipfs/go-ipfs/routing"
 	mock "github.com/ipfs/go-ipfs/routing/mock"
 	testutil "github.com/ipfs/go-ipfs/util/testutil"
 
@@ -31,7 +37,7 @@ func TestReprovide(t *testing.T) {
 	blk := blocks.NewBlock([]byte("this is a test"))
 	bstore.Put(blk)
 
-	reprov := NewReprovider(clA, bstore)
+	reprov := NewReprovider(clA, NewBlockstoreProvider(bstore), nil)
 	err := reprov.Reprovide(ctx)
 	if err != nil {
 		t.Fatal(err)
@@ -50,3 +56,213 @@ func TestReprovide(t *testing.T) {
 		t.Fatal("Somehow got the wrong peer back as a provider.")
 	}
 }
+
+func TestReprovideResumesFromCursor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mrserv := mock.NewServer()
+
+	idA := testutil.RandIdentityOrFatal(t)
+	idB := testutil.RandIdentityOrFatal(t)
+
+	clA := mrserv.Client(idA)
+	clB := mrserv.Client(idB)
+
+	var keys []key.Key
+	for _, s := range []string{"a", "b", "c"} {
+		keys = append(keys, blocks.NewBlock([]byte(s)).Key())
+	}
+	keyProvider := func(ctx context.Context) (<-chan key.Key, error) {
+		out := make(chan key.Key, len(keys))
+		for _, k := range keys {
+			out <- k
+		}
+		close(out)
+		return out, nil
+	}
+
+	// pretend a previous run was interrupted after providing the second
+	// key. keys are not listed in a stable order, the run skips that key
+	// wherever it comes.
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	cur, err := json.Marshal(map[string]interface{}{
+		"Provided": 1,
+		"Finished": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dstore.Put(ds.NewKey("/local/reprovider/cursor"), cur); err != nil {
+		t.Fatal(err)
+	}
+	provided := bloom.NewFilter(1024)
+	provided.Add([]byte(keys[1]))
+	if err := dstore.Put(ds.NewKey("/local/reprovider/provided"), provided.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	reprov := NewReprovider(clA, keyProvider, dstore)
+	if err := reprov.Reprovide(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	st := reprov.Status()
+	if !st.Resumed || st.Provided != 2 {
+		t.Fatalf("expected a resumed run providing 2 keys, got %#v", st)
+	}
+
+	for i, k := range keys {
+		provs, err := clB.FindProviders(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 && len(provs) != 0 {
+			t.Fatal("key provided by the interrupted run should not have been provided again")
+		}
+		if i != 1 && len(provs) == 0 {
+			t.Fatalf("key %d should have been provided", i)
+		}
+	}
+
+	// the next run starts from the beginning
+	if err := reprov.Reprovide(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := reprov.Status(); st.Resumed || st.Provided != 3 {
+		t.Fatalf("expected a full run providing 3 keys, got %#v", st)
+	}
+}
+
+func TestReprovideStrategies(t *testing.T) {
+	if _, err := NewStrategy("bogus", nil, nil); err == nil {
+		t.Fatal("expected an error for an unknown strategy")
+	}
+	for _, name := range []string{StrategyAll, StrategyPinned, StrategyRoots} {
+		if _, err := NewStrategy(name, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTriggerStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cl := mock.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	release := make(chan struct{})
+	defer close(release)
+	keyProvider := func(ctx context.Context) (<-chan key.Key, error) {
+		out := make(chan key.Key)
+		go func() {
+			defer close(out)
+			<-release
+		}()
+		return out, nil
+	}
+
+	reprov := NewReprovider(cl, keyProvider, nil)
+	go reprov.ProvideEvery(ctx, time.Hour)
+
+	if err := reprov.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the status is the triggered run's, not the previous one's
+	if st := reprov.Status(); !st.Running || st.LastStart.IsZero() {
+		t.Fatalf("expected the triggered run to be running, got %#v", st)
+	}
+	if err := reprov.Trigger(ctx); err != ErrAlreadyRunning {
+		t.Fatalf("expected ErrAlreadyRunning, got %v", err)
+	}
+}
+
+// failingRouting fails to provide one key.
+type failingRouting struct {
+	routing.IpfsRouting
+	bad key.Key
+}
+
+func (r *failingRouting) Provide(ctx context.Context, k key.Key) error {
+	if k == r.bad {
+		return errors.New("provide failed")
+	}
+	return r.IpfsRouting.Provide(ctx, k)
+}
+
+func TestReprovideSkipsFailedKeys(t *testing.T) {
+	defer func(d time.Duration) { ProvideRetryTime = d }(ProvideRetryTime)
+	ProvideRetryTime = time.Millisecond * 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mrserv := mock.NewServer()
+	clA := mrserv.Client(testutil.RandIdentityOrFatal(t))
+	clB := mrserv.Client(testutil.RandIdentityOrFatal(t))
+
+	var keys []key.Key
+	for _, s := range []string{"a", "b", "c"} {
+		keys = append(keys, blocks.NewBlock([]byte(s)).Key())
+	}
+	keyProvider := func(ctx context.Context) (<-chan key.Key, error) {
+		out := make(chan key.Key, len(keys))
+		for _, k := range keys {
+			out <- k
+		}
+		close(out)
+		return out, nil
+	}
+
+	reprov := NewReprovider(&failingRouting{IpfsRouting: clA, bad: keys[0]}, keyProvider, nil)
+	if err := reprov.Reprovide(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := reprov.Status(); st.Provided != 2 || st.Failed != 1 {
+		t.Fatalf("expected 2 keys provided and 1 failed, got %#v", st)
+	}
+	provs, err := clB.FindProviders(ctx, keys[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provs) == 0 {
+		t.Fatal("keys after the failed one should have been provided")
+	}
+}
+
+func TestReprovideStopsKeyProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cl := mock.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	stopped := make(chan struct{})
+	keyProvider := func(kctx context.Context) (<-chan key.Key, error) {
+		out := make(chan key.Key)
+		go func() {
+			defer close(stopped)
+			defer close(out)
+			for {
+				select {
+				case out <- blocks.NewBlock([]byte("a")).Key():
+				case <-kctx.Done():
+					return
+				}
+			}
+		}()
+		return out, nil
+	}
+
+	// the rate limit makes the run wait on ctx between keys
+	reprov := NewReprovider(cl, keyProvider, nil)
+	reprov.SetRateLimit(1)
+	runCtx, runCancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer runCancel()
+	if err := reprov.Reprovide(runCtx); err == nil {
+		t.Fatal("expected the run to be interrupted")
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 5):
+		t.Fatal("the key provider was not stopped")
+	}
+}
@@ -18,6 +18,7 @@ import (
 	core "github.com/ipfs/go-ipfs/core"
 	nsfs "github.com/ipfs/go-ipfs/ipnsfs"
 	namesys "github.com/ipfs/go-ipfs/namesys"
+	ic "github.com/ipfs/go-ipfs/p2p/crypto"
 	offroute "github.com/ipfs/go-ipfs/routing/offline"
 	u "github.com/ipfs/go-ipfs/util"
 	ci "github.com/ipfs/go-ipfs/util/testutil/ci"
@@ -113,7 +114,7 @@ func setupIpnsTest(t *testing.T, node *core.IpfsNode) (*core.IpfsNode, *fstest.M
 		}
 
 		node.Routing = offroute.NewOfflineRouter(node.Repo.Datastore(), node.PrivateKey)
-		node.Namesys = namesys.NewNameSystem(node.Routing)
+		node.Namesys = namesys.NewNameSystem(node.Routing, node.Repo.Datastore(), nil, 0)
 
 		ipnsfs, err := nsfs.NewFilesystem(context.Background(), node.DAG, node.Namesys, node.Pinning, node.PrivateKey)
 		if err != nil {
@@ -123,7 +124,7 @@ func setupIpnsTest(t *testing.T, node *core.IpfsNode) (*core.IpfsNode, *fstest.M
 		node.IpnsFs = ipnsfs
 	}
 
-	fs, err := NewFileSystem(node, node.PrivateKey, "", "")
+	fs, err := NewFileSystem(node, []ic.PrivKey{node.PrivateKey}, "", "")
 	if err != nil {
 		t.Fatal(err)
 	}
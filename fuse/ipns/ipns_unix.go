@@ -32,8 +32,8 @@ type FileSystem struct {
 }
 
 // NewFileSystem constructs new fs using given core.IpfsNode instance.
-func NewFileSystem(ipfs *core.IpfsNode, sk ci.PrivKey, ipfspath, ipnspath string) (*FileSystem, error) {
-	root, err := CreateRoot(ipfs, []ci.PrivKey{sk}, ipfspath, ipnspath)
+func NewFileSystem(ipfs *core.IpfsNode, keys []ci.PrivKey, ipfspath, ipnspath string) (*FileSystem, error) {
+	root, err := CreateRoot(ipfs, keys, ipfspath, ipnspath)
 	if err != nil {
 		return nil, err
 	}
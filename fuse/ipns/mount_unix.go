@@ -7,6 +7,7 @@ import (
 	core "github.com/ipfs/go-ipfs/core"
 	mount "github.com/ipfs/go-ipfs/fuse/mount"
 	ipnsfs "github.com/ipfs/go-ipfs/ipnsfs"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
 )
 
 // Mount mounts ipns at a given location, and returns a mount.Mount instance.
@@ -18,15 +19,25 @@ func Mount(ipfs *core.IpfsNode, ipnsmp, ipfsmp string) (mount.Mount, error) {
 
 	allow_other := cfg.Mounts.FuseAllowOther
 
+	// mount one root per key we can publish with
+	named, err := ipfs.IpnsKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]ci.PrivKey, len(named))
+	for i, nk := range named {
+		keys[i] = nk.Key
+	}
+
 	if ipfs.IpnsFs == nil {
-		fs, err := ipnsfs.NewFilesystem(ipfs.Context(), ipfs.DAG, ipfs.Namesys, ipfs.Pinning, ipfs.PrivateKey)
+		fs, err := ipnsfs.NewFilesystem(ipfs.Context(), ipfs.DAG, ipfs.Namesys, ipfs.Pinning, keys...)
 		if err != nil {
 			return nil, err
 		}
 		ipfs.IpnsFs = fs
 	}
 
-	fsys, err := NewFileSystem(ipfs, ipfs.PrivateKey, ipfsmp, ipnsmp)
+	fsys, err := NewFileSystem(ipfs, keys, ipfsmp, ipnsmp)
 	if err != nil {
 		return nil, err
 	}
@@ -290,6 +290,41 @@ func TestSeekEndSingleBlockFile(t *testing.T) {
 	}
 }
 
+func TestSeekPastEnd(t *testing.T) {
+	nbytes := int64(50 * 1024)
+	ds := mdtest.Mock()
+	nd, should := getTestDag(t, ds, nbytes, 500)
+
+	rs, err := uio.NewDagReader(context.Background(), nd, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, offset := range []int64{nbytes, nbytes + 10} {
+		if _, err := rs.Seek(offset, os.SEEK_SET); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := rs.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+			t.Fatalf("read %d bytes past the end, err %v", n, err)
+		}
+	}
+
+	seeked, err := rs.Seek(-100, os.SEEK_END)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seeked != nbytes-100 {
+		t.Fatalf("seeked to %d, expected %d", seeked, nbytes-100)
+	}
+	out, err := ioutil.ReadAll(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := arrComp(out, should[nbytes-100:]); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestSeekingStress(t *testing.T) {
 	nbytes := int64(1024 * 1024)
 	ds := mdtest.Mock()
@@ -0,0 +1,233 @@
+// Package keystore stores the named private keys a node can publish IPNS
+// records with.
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+)
+
+// Keystore provides a key management interface.
+type Keystore interface {
+	// Has returns whether or not a key exists in the Keystore
+	Has(name string) (bool, error)
+	// Put stores a key in the Keystore, if a key with the same name already
+	// exists, returns ErrKeyExists
+	Put(name string, k ci.PrivKey) error
+	// Get retrieves a key from the Keystore if it exists, and returns
+	// ErrNoSuchKey otherwise.
+	Get(name string) (ci.PrivKey, error)
+	// Delete removes a key from the Keystore
+	Delete(name string) error
+	// List returns the names of all the keys in the Keystore
+	List() ([]string, error)
+}
+
+// ErrNoSuchKey is returned when a key of the given name is not stored.
+var ErrNoSuchKey = errors.New("no key by the given name was found")
+
+// ErrKeyExists is returned by Put when a key of the given name is already
+// stored.
+var ErrKeyExists = errors.New("key by that name already exists, refusing to overwrite")
+
+// FSKeystore stores each key in its own file, named after the key.
+type FSKeystore struct {
+	dir string
+}
+
+// NewFSKeystore returns a keystore kept in dir, creating dir if needed.
+func NewFSKeystore(dir string) (*FSKeystore, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return nil, err
+		}
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	return &FSKeystore{dir}, nil
+}
+
+// validateName checks that name can be used as a file name in the keystore.
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("key names must be at least one character")
+	}
+
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("key names may not contain slashes")
+	}
+
+	if strings.HasPrefix(name, ".") {
+		return fmt.Errorf("key names may not begin with a period")
+	}
+
+	return nil
+}
+
+func (ks *FSKeystore) Has(name string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+
+	_, err := os.Stat(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (ks *FSKeystore) Put(name string, k ci.PrivKey) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	b, err := ci.MarshalPrivateKey(k)
+	if err != nil {
+		return err
+	}
+
+	kp := filepath.Join(ks.dir, name)
+	fi, err := os.OpenFile(kp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		if os.IsExist(err) {
+			return ErrKeyExists
+		}
+		return err
+	}
+	defer fi.Close()
+
+	_, err = fi.Write(b)
+	return err
+}
+
+func (ks *FSKeystore) Get(name string) (ci.PrivKey, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(ks.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoSuchKey
+		}
+		return nil, err
+	}
+
+	return ci.UnmarshalPrivateKey(data)
+}
+
+func (ks *FSKeystore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return ErrNoSuchKey
+	}
+	return err
+}
+
+func (ks *FSKeystore) List() ([]string, error) {
+	dir, err := os.Open(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, n := range names {
+		if validateName(n) == nil {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// MemKeystore is a keystore kept in memory, for nodes without a repo on
+// disk and for tests.
+type MemKeystore struct {
+	lk   sync.Mutex
+	keys map[string]ci.PrivKey
+}
+
+func NewMemKeystore() *MemKeystore {
+	return &MemKeystore{keys: make(map[string]ci.PrivKey)}
+}
+
+func (mk *MemKeystore) Has(name string) (bool, error) {
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+
+	_, ok := mk.keys[name]
+	return ok, nil
+}
+
+func (mk *MemKeystore) Put(name string, k ci.PrivKey) error {
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	if _, ok := mk.keys[name]; ok {
+		return ErrKeyExists
+	}
+
+	mk.keys[name] = k
+	return nil
+}
+
+func (mk *MemKeystore) Get(name string) (ci.PrivKey, error) {
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+
+	k, ok := mk.keys[name]
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+	return k, nil
+}
+
+func (mk *MemKeystore) Delete(name string) error {
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+
+	if _, ok := mk.keys[name]; !ok {
+		return ErrNoSuchKey
+	}
+	delete(mk.keys, name)
+	return nil
+}
+
+func (mk *MemKeystore) List() ([]string, error) {
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+
+	out := make([]string, 0, len(mk.keys))
+	for k := range mk.keys {
+		out = append(out, k)
+	}
+	return out, nil
+}
@@ -0,0 +1,102 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+)
+
+func privKeyOrFatal(t *testing.T) ci.PrivKey {
+	sk, _, err := ci.GenerateKeyPairWithReader(ci.RSA, 512, rand.New(rand.NewSource(rand.Int63())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk
+}
+
+func testKeystore(t *testing.T, ks Keystore) {
+	k1 := privKeyOrFatal(t)
+	k2 := privKeyOrFatal(t)
+
+	if err := ks.Put("foo", k1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("bar", k2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("foo", k2); err != ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+
+	for _, bad := range []string{"", ".hidden", "a/b"} {
+		if err := ks.Put(bad, k1); err == nil {
+			t.Fatalf("expected error storing key named %q", bad)
+		}
+	}
+
+	has, err := ks.Has("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("should have key foo")
+	}
+
+	out, err := ks.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Equals(k1) {
+		t.Fatal("got back different key than stored")
+	}
+
+	names, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "bar" || names[1] != "foo" {
+		t.Fatalf("unexpected key list: %v", names)
+	}
+
+	if err := ks.Delete("bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Delete("bar"); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+	if _, err := ks.Get("bar"); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+}
+
+func TestFSKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks, err := NewFSKeystore(dir + "/keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKeystore(t, ks)
+
+	// reopening sees the same keys
+	ks, err = NewFSKeystore(dir + "/keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := ks.Has("foo"); !has {
+		t.Fatal("key lost after reopening the keystore")
+	}
+}
+
+func TestMemKeystore(t *testing.T) {
+	testKeystore(t, NewMemKeystore())
+}
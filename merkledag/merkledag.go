@@ -9,6 +9,7 @@ import (
 	blocks "github.com/ipfs/go-ipfs/blocks"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	bserv "github.com/ipfs/go-ipfs/blockservice"
+	notif "github.com/ipfs/go-ipfs/notifications"
 	logging "github.com/ipfs/go-ipfs/vendor/go-log-v1.0.0"
 )
 
@@ -122,9 +123,10 @@ func (n *dagService) Remove(nd *Node) error {
 }
 
 // FetchGraph asynchronously fetches all nodes that are children of the given
-// node, and returns a channel that may be waited upon for the fetch to complete
+// node, and returns a channel that is closed once the fetch is complete.
+// Every node retrieved is reported to listeners registered on ctx with
+// notifications.RegisterForFetchEvents.
 func FetchGraph(ctx context.Context, root *Node, serv DAGService) chan struct{} {
-	log.Warning("Untested.")
 	var wg sync.WaitGroup
 	done := make(chan struct{})
 
@@ -137,6 +139,7 @@ func FetchGraph(ctx context.Context, root *Node, serv DAGService) chan struct{}
 			select {
 			case <-ctx.Done():
 				return
+			default:
 			}
 
 			nd, err := lnk.GetNode(ctx, serv)
@@ -144,6 +147,10 @@ func FetchGraph(ctx context.Context, root *Node, serv DAGService) chan struct{}
 				log.Debug(err)
 				return
 			}
+			notif.PublishFetchEvent(ctx, &notif.FetchEvent{
+				Type: notif.FetchedNode,
+				Key:  key.Key(lnk.Hash),
+			})
 
 			// Wait for children to finish
 			<-FetchGraph(ctx, nd, serv)
@@ -152,7 +159,7 @@ func FetchGraph(ctx context.Context, root *Node, serv DAGService) chan struct{}
 
 	go func() {
 		wg.Wait()
-		done <- struct{}{}
+		close(done)
 	}()
 
 	return done
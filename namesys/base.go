@@ -2,6 +2,7 @@ package namesys
 
 import (
 	"strings"
+	"time"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
@@ -9,27 +10,41 @@ import (
 )
 
 type resolver interface {
-	// resolveOnce looks up a name once (without recursion).
-	resolveOnce(ctx context.Context, name string) (value path.Path, err error)
+	// resolveOnce looks up a name once (without recursion), returning
+	// how long the value may be cached for.
+	resolveOnce(ctx context.Context, name string) (value path.Path, ttl time.Duration, err error)
 }
 
 // resolve is a helper for implementing Resolver.ResolveN using resolveOnce.
 func resolve(ctx context.Context, r resolver, name string, depth int, prefixes ...string) (path.Path, error) {
+	chain, err := resolveChain(ctx, r, name, depth, prefixes...)
+	if len(chain) == 0 || (err != nil && err != ErrResolveRecursion) {
+		return "", err
+	}
+	return chain[len(chain)-1], err
+}
+
+// resolveChain is like resolve, but returns every value the name resolved
+// through, ending with the one resolve returns. If resolution fails midway,
+// the values resolved so far are returned along with the error.
+func resolveChain(ctx context.Context, r resolver, name string, depth int, prefixes ...string) ([]path.Path, error) {
+	var chain []path.Path
 	for {
-		p, err := r.resolveOnce(ctx, name)
+		p, _, err := r.resolveOnce(ctx, name)
 		if err != nil {
 			log.Warningf("Could not resolve %s", name)
-			return "", err
+			return chain, err
 		}
 		log.Debugf("Resolved %s to %s", name, p.String())
+		chain = append(chain, p)
 
 		if strings.HasPrefix(p.String(), "/ipfs/") {
 			// we've bottomed out with an IPFS path
-			return p, nil
+			return chain, nil
 		}
 
 		if depth == 1 {
-			return p, ErrResolveRecursion
+			return chain, ErrResolveRecursion
 		}
 
 		matched := false
@@ -44,7 +59,7 @@ func resolve(ctx context.Context, r resolver, name string, depth int, prefixes .
 		}
 
 		if !matched {
-			return p, nil
+			return chain, nil
 		}
 
 		if depth > 1 {
@@ -0,0 +1,115 @@
+package namesys
+
+import (
+	"sync/atomic"
+	"time"
+
+	lru "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/hashicorp/golang-lru"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+// DefaultResolverCacheSize is the number of names a NameSystem keeps the
+// resolved values of.
+const DefaultResolverCacheSize = 128
+
+// DefaultResolverCacheTTL is how long resolved values are cached when their
+// source gives no ttl of its own.
+const DefaultResolverCacheTTL = time.Minute
+
+// CacheStats describes the use of a name cache.
+type CacheStats struct {
+	Size   int    // names currently cached
+	Hits   uint64 // resolutions answered from the cache
+	Misses uint64 // resolutions that went to a resolver
+}
+
+// CacheReporter is implemented by name systems that cache resolved names.
+type CacheReporter interface {
+	CacheStats() CacheStats
+}
+
+type noCacheKey struct{}
+
+// ContextWithNoCache returns a context under which names are resolved from
+// their source instead of the cache. Fresh values still update the cache.
+func ContextWithNoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func noCache(ctx context.Context) bool {
+	v, _ := ctx.Value(noCacheKey{}).(bool)
+	return v
+}
+
+type cacheEntry struct {
+	val path.Path
+	eol time.Time
+}
+
+// nameCache is an lru cache of resolved names, each valid for its own ttl.
+type nameCache struct {
+	lru    *lru.Cache
+	hits   uint64
+	misses uint64
+}
+
+// newNameCache returns a cache of up to size names, or nil if size is not
+// positive.
+func newNameCache(size int) *nameCache {
+	if size <= 0 {
+		return nil
+	}
+
+	c, err := lru.New(size)
+	if err != nil {
+		// only fails on a non-positive size
+		panic(err)
+	}
+	return &nameCache{lru: c}
+}
+
+// get returns the cached value of name, and how much longer it is valid.
+func (c *nameCache) get(name string) (path.Path, time.Duration, bool) {
+	if c == nil {
+		return "", 0, false
+	}
+
+	v, ok := c.lru.Get(name)
+	if ok {
+		e := v.(cacheEntry)
+		if left := e.eol.Sub(time.Now()); left > 0 {
+			atomic.AddUint64(&c.hits, 1)
+			return e.val, left, true
+		}
+		c.lru.Remove(name)
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	return "", 0, false
+}
+
+func (c *nameCache) set(name string, val path.Path, ttl time.Duration) {
+	if c == nil {
+		return
+	}
+
+	if ttl <= 0 {
+		c.lru.Remove(name)
+		return
+	}
+	c.lru.Add(name, cacheEntry{val: val, eol: time.Now().Add(ttl)})
+}
+
+func (c *nameCache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	return CacheStats{
+		Size:   c.lru.Len(),
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+}
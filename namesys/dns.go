@@ -2,8 +2,8 @@ package namesys
 
 import (
 	"errors"
-	"net"
 	"strings"
+	"time"
 
 	isd "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-is-domain"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
@@ -11,24 +11,21 @@ import (
 	path "github.com/ipfs/go-ipfs/path"
 )
 
-type LookupTXTFunc func(name string) (txt []string, err error)
+// dnslinkPrefix is the subdomain holding the dnslink records of a domain.
+const dnslinkPrefix = "_dnslink."
 
 // DNSResolver implements a Resolver on DNS domains
 type DNSResolver struct {
 	lookupTXT LookupTXTFunc
-	// TODO: maybe some sort of caching?
-	// cache would need a timeout
 }
 
-// NewDNSResolver constructs a name resolver using DNS TXT records.
-func NewDNSResolver() Resolver {
-	return &DNSResolver{lookupTXT: net.LookupTXT}
-}
-
-// newDNSResolver constructs a name resolver using DNS TXT records,
-// returning a resolver instead of NewDNSResolver's Resolver.
-func newDNSResolver() resolver {
-	return &DNSResolver{lookupTXT: net.LookupTXT}
+// NewDNSResolver constructs a name resolver using DNS TXT records, looked
+// up with lookup. A nil lookup uses the system resolver.
+func NewDNSResolver(lookup LookupTXTFunc) *DNSResolver {
+	if lookup == nil {
+		lookup = systemLookupTXT
+	}
+	return &DNSResolver{lookupTXT: lookup}
 }
 
 // Resolve implements Resolver.
@@ -41,28 +38,46 @@ func (r *DNSResolver) ResolveN(ctx context.Context, name string, depth int) (pat
 	return resolve(ctx, r, name, depth, "/ipns/")
 }
 
+// ResolveChain resolves name like ResolveN, returning every intermediate
+// value along with the final one.
+func (r *DNSResolver) ResolveChain(ctx context.Context, name string, depth int) ([]path.Path, error) {
+	return resolveChain(ctx, r, name, depth, "/ipns/")
+}
+
 // resolveOnce implements resolver.
 // TXT records for a given domain name should contain a b58
-// encoded multihash.
-func (r *DNSResolver) resolveOnce(ctx context.Context, name string) (path.Path, error) {
+// encoded multihash. Records of _dnslink.<domain> are preferred over those
+// of the domain itself.
+func (r *DNSResolver) resolveOnce(ctx context.Context, name string) (path.Path, time.Duration, error) {
 	if !isd.IsDomain(name) {
-		return "", errors.New("not a valid domain name")
+		return "", 0, errors.New("not a valid domain name")
 	}
 
 	log.Infof("DNSResolver resolving %s", name)
-	txt, err := r.lookupTXT(name)
+	p, ttl, err := r.lookupLink(dnslinkPrefix + name)
+	if err == nil {
+		return p, ttl, nil
+	}
+	log.Debugf("no dnslink at %s%s, trying %s: %s", dnslinkPrefix, name, name, err)
+
+	return r.lookupLink(name)
+}
+
+// lookupLink returns the first valid entry among the TXT records of name.
+func (r *DNSResolver) lookupLink(name string) (path.Path, time.Duration, error) {
+	txt, ttl, err := r.lookupTXT(name)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	for _, t := range txt {
 		p, err := parseEntry(t)
 		if err == nil {
-			return p, nil
+			return p, ttl, nil
 		}
 	}
 
-	return "", ErrResolveFailed
+	return "", 0, ErrResolveFailed
 }
 
 func parseEntry(txt string) (path.Path, error) {
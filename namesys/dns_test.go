@@ -1,20 +1,28 @@
 package namesys
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	dns "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/miekg/dns"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
 type mockDNS struct {
 	entries map[string][]string
 }
 
-func (m *mockDNS) lookupTXT(name string) (txt []string, err error) {
+func (m *mockDNS) lookupTXT(name string) (txt []string, ttl time.Duration, err error) {
 	txt, ok := m.entries[name]
 	if !ok {
-		return nil, fmt.Errorf("No TXT entry for %s", name)
+		return nil, 0, fmt.Errorf("No TXT entry for %s", name)
 	}
-	return txt, nil
+	return txt, time.Minute, nil
 }
 
 func TestDnsEntryParsing(t *testing.T) {
@@ -86,6 +94,18 @@ func newMockDNS() *mockDNS {
 			"bad.example.com": []string{
 				"dnslink=",
 			},
+			"_dnslink.sub.example.com": []string{
+				"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD/sub",
+			},
+			"sub.example.com": []string{
+				"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD/bare",
+			},
+			"_dnslink.junk.example.com": []string{
+				"not a dnslink",
+			},
+			"junk.example.com": []string{
+				"dnslink=/ipns/sub.example.com",
+			},
 		},
 	}
 }
@@ -109,4 +129,179 @@ func TestDNSResolution(t *testing.T) {
 	testResolution(t, r, "loop1.example.com", 3, "/ipns/loop2.example.com", ErrResolveRecursion)
 	testResolution(t, r, "loop1.example.com", DefaultDepthLimit, "/ipns/loop1.example.com", ErrResolveRecursion)
 	testResolution(t, r, "bad.example.com", DefaultDepthLimit, "", ErrResolveFailed)
+	testResolution(t, r, "sub.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD/sub", nil)
+	testResolution(t, r, "junk.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD/sub", nil)
+}
+
+func TestDNSResolveChain(t *testing.T) {
+	r := NewDNSResolver(newMockDNS().lookupTXT)
+
+	chain, err := r.ResolveChain(context.Background(), "dns2.example.com", DefaultDepthLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"/ipns/dns1.example.com",
+		"/ipns/ipfs.example.com",
+		"/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD",
+	}
+	if len(chain) != len(expected) {
+		t.Fatalf("expected chain %v, got %v", expected, chain)
+	}
+	for i, p := range chain {
+		if p.String() != expected[i] {
+			t.Fatalf("expected chain %v, got %v", expected, chain)
+		}
+	}
+
+	chain, err = r.ResolveChain(context.Background(), "dns2.example.com", 1)
+	if err != ErrResolveRecursion {
+		t.Fatalf("expected ErrResolveRecursion, got %v", err)
+	}
+	if len(chain) != 1 || chain[0].String() != expected[0] {
+		t.Fatalf("unexpected chain %v", chain)
+	}
+}
+
+func TestDelegatingLookup(t *testing.T) {
+	named := func(n string) LookupTXTFunc {
+		return func(name string) ([]string, time.Duration, error) {
+			return []string{n}, time.Minute, nil
+		}
+	}
+
+	lookup, err := NewLookupTXT(map[string]string{"eth.": "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookup == nil {
+		t.Fatal("expected a lookup function")
+	}
+	if _, err := NewLookupTXT(map[string]string{"eth": ""}); err == nil {
+		t.Fatal("expected error for a missing resolver")
+	}
+
+	lookup = NewDelegatingLookupTXT(map[string]LookupTXTFunc{
+		normalizeSuffix("eth"):          named("eth"),
+		normalizeSuffix("foo.eth"):      named("foo.eth"),
+		normalizeSuffix(".example.com"): named("example.com"),
+	}, named("fallback"))
+
+	cases := map[string]string{
+		"vitalik.eth":     "eth",
+		"bar.foo.eth":     "foo.eth",
+		"foo.eth.":        "foo.eth",
+		"BAR.Example.COM": "example.com",
+		"notexample.com":  "fallback",
+		"ipfs.io":         "fallback",
+		"_dnslink.a.eth":  "eth",
+	}
+	for name, exp := range cases {
+		txt, _, err := lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txt[0] != exp {
+			t.Fatalf("%s: expected the %s resolver, got %s", name, exp, txt[0])
+		}
+	}
+}
+
+func TestDoHLookup(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q := new(dns.Msg)
+		if err := q.Unpack(buf); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := new(dns.Msg)
+		resp.SetReply(q)
+		if q.Question[0].Name == "_dnslink.example.com." {
+			rr, err := dns.NewRR(`_dnslink.example.com. 300 IN TXT "dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"`)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			resp.Answer = append(resp.Answer, rr)
+		} else {
+			resp.Rcode = dns.RcodeNameError
+		}
+
+		out, err := resp.Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(out)
+	}))
+	defer s.Close()
+
+	r := NewDNSResolver(NewDoHLookupTXT(s.URL))
+	p, ttl, err := r.resolveOnce(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD" {
+		t.Fatalf("unexpected value %s", p)
+	}
+	if ttl != 300*time.Second {
+		t.Fatalf("expected the ttl of the record, got %s", ttl)
+	}
+
+	if _, _, err := r.resolveOnce(context.Background(), "missing.example.com"); err == nil {
+		t.Fatal("expected lookup of missing name to fail")
+	}
+}
+
+func TestNameserverLookupTCPFallback(t *testing.T) {
+	// the same handler answers over udp and tcp, but udp answers are
+	// truncated
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, q *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(q)
+		if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+			resp.Truncated = true
+		} else {
+			rr, err := dns.NewRR(`_dnslink.example.com. 300 IN TXT "dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"`)
+			if err != nil {
+				t.Error(err)
+			}
+			resp.Answer = append(resp.Answer, rr)
+		}
+		w.WriteMsg(resp)
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		l.Close()
+		t.Skip("no udp port matching the tcp one: ", err)
+	}
+	tcpSrv := &dns.Server{Listener: l, Handler: handler}
+	udpSrv := &dns.Server{PacketConn: pc, Handler: handler}
+	go tcpSrv.ActivateAndServe()
+	go udpSrv.ActivateAndServe()
+	defer tcpSrv.Shutdown()
+	defer udpSrv.Shutdown()
+
+	txt, ttl, err := NewNameserverLookupTXT(l.Addr().String())("_dnslink.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txt) != 1 || txt[0] != "dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD" {
+		t.Fatalf("unexpected records %v", txt)
+	}
+	if ttl != 300*time.Second {
+		t.Fatalf("expected the ttl of the record, got %s", ttl)
+	}
 }
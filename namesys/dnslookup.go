@@ -0,0 +1,195 @@
+package namesys
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	dns "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+// LookupTXTFunc returns the TXT records of a domain, and how long they may
+// be cached for.
+type LookupTXTFunc func(name string) (txt []string, ttl time.Duration, err error)
+
+const resolvConf = "/etc/resolv.conf"
+
+// dohTimeout bounds DNS-over-HTTPS requests.
+const dohTimeout = time.Second * 10
+
+// NewLookupTXT returns a lookup function using the given resolvers, keyed by
+// the domain suffix (such as "eth" or "example.com") they answer for. The
+// resolver of the longest matching suffix is used, and the key "." matches
+// every domain. A resolver is either an https:// DNS-over-HTTPS endpoint or
+// a nameserver address. Domains no resolver matches are looked up with the
+// system resolver.
+func NewLookupTXT(resolvers map[string]string) (LookupTXTFunc, error) {
+	rules := make(map[string]LookupTXTFunc)
+	for suffix, addr := range resolvers {
+		var lookup LookupTXTFunc
+		switch {
+		case strings.HasPrefix(addr, "https://"):
+			lookup = NewDoHLookupTXT(addr)
+		case addr != "":
+			lookup = NewNameserverLookupTXT(addr)
+		default:
+			return nil, fmt.Errorf("no resolver given for %q", suffix)
+		}
+		rules[normalizeSuffix(suffix)] = lookup
+	}
+
+	return NewDelegatingLookupTXT(rules, systemLookupTXT), nil
+}
+
+// NewDelegatingLookupTXT returns a lookup function using the rule of the
+// longest domain suffix matching each name, or fallback where none does.
+func NewDelegatingLookupTXT(rules map[string]LookupTXTFunc, fallback LookupTXTFunc) LookupTXTFunc {
+	return func(name string) ([]string, time.Duration, error) {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+		best := -1
+		lookup := fallback
+		for suffix, l := range rules {
+			match := suffix == "" || name == suffix || strings.HasSuffix(name, "."+suffix)
+			if match && len(suffix) > best {
+				best = len(suffix)
+				lookup = l
+			}
+		}
+		return lookup(name)
+	}
+}
+
+func normalizeSuffix(s string) string {
+	return strings.Trim(strings.ToLower(s), ".")
+}
+
+// NewNameserverLookupTXT returns a lookup function querying the nameserver
+// at addr, which defaults to port 53.
+func NewNameserverLookupTXT(addr string) LookupTXTFunc {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+
+	return func(name string) ([]string, time.Duration, error) {
+		resp, err := exchangeTXT(name, addr)
+		if err != nil {
+			return nil, 0, err
+		}
+		return txtAnswers(name, resp)
+	}
+}
+
+// NewDoHLookupTXT returns a lookup function sending wire format queries to
+// the DNS-over-HTTPS endpoint at url, as described in RFC 8484.
+func NewDoHLookupTXT(url string) LookupTXTFunc {
+	client := &http.Client{Timeout: dohTimeout}
+
+	return func(name string) ([]string, time.Duration, error) {
+		q := txtQuery(name)
+		// a zero id makes responses cacheable by http caches
+		q.Id = 0
+		buf, err := q.Pack()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		vals := req.URL.Query()
+		vals.Set("dns", base64.RawURLEncoding.EncodeToString(buf))
+		req.URL.RawQuery = vals.Encode()
+		req.Header.Set("Accept", "application/dns-message")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, 0, fmt.Errorf("lookup %s: %s returned %s", name, url, resp.Status)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(body); err != nil {
+			return nil, 0, err
+		}
+		return txtAnswers(name, msg)
+	}
+}
+
+// systemLookupTXT queries the nameservers of resolv.conf, to learn the ttl
+// of the records. Where there is no resolv.conf, it falls back to the net
+// package, assuming DefaultResolverCacheTTL.
+func systemLookupTXT(name string) ([]string, time.Duration, error) {
+	conf, err := dns.ClientConfigFromFile(resolvConf)
+	if err != nil || len(conf.Servers) == 0 {
+		txt, err := net.LookupTXT(name)
+		return txt, DefaultResolverCacheTTL, err
+	}
+
+	for _, srv := range conf.Servers {
+		var resp *dns.Msg
+		resp, err = exchangeTXT(name, net.JoinHostPort(srv, conf.Port))
+		if err != nil {
+			continue
+		}
+		return txtAnswers(name, resp)
+	}
+	return nil, 0, err
+}
+
+// exchangeTXT asks the nameserver at addr for the TXT records of name over
+// udp, asking again over tcp if the answer did not fit a datagram.
+func exchangeTXT(name, addr string) (*dns.Msg, error) {
+	resp, _, err := new(dns.Client).Exchange(txtQuery(name), addr)
+	if err != nil || !resp.Truncated {
+		return resp, err
+	}
+	resp, _, err = (&dns.Client{Net: "tcp"}).Exchange(txtQuery(name), addr)
+	return resp, err
+}
+
+func txtQuery(name string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeTXT)
+	m.RecursionDesired = true
+	return m
+}
+
+// txtAnswers collects the TXT records of a dns response, and the lowest ttl
+// among them.
+func txtAnswers(name string, resp *dns.Msg) ([]string, time.Duration, error) {
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, 0, fmt.Errorf("lookup %s: %s", name, dns.RcodeToString[resp.Rcode])
+	}
+
+	var txt []string
+	var ttl uint32
+	for _, rr := range resp.Answer {
+		t, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		txt = append(txt, strings.Join(t.Txt, ""))
+		if len(txt) == 1 || t.Hdr.Ttl < ttl {
+			ttl = t.Hdr.Ttl
+		}
+	}
+	if len(txt) == 0 {
+		return nil, 0, fmt.Errorf("lookup %s: no TXT records", name)
+	}
+	return txt, time.Duration(ttl) * time.Second, nil
+}
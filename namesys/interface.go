@@ -31,6 +31,7 @@ package namesys
 
 import (
 	"errors"
+	"time"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	ci "github.com/ipfs/go-ipfs/p2p/crypto"
@@ -55,6 +56,9 @@ var ErrResolveFailed = errors.New("could not resolve name.")
 var ErrResolveRecursion = errors.New(
 	"could not resolve name (recursion limit exceeded).")
 
+// DefaultRecordLifetime is how long records made by Publish are valid.
+const DefaultRecordLifetime = time.Hour * 24
+
 // ErrPublishFailed signals an error when attempting to publish.
 var ErrPublishFailed = errors.New("could not publish name.")
 
@@ -105,4 +109,8 @@ type Publisher interface {
 	// Publish establishes a name-value mapping.
 	// TODO make this not PrivKey specific.
 	Publish(ctx context.Context, name ci.PrivKey, value path.Path) error
+
+	// PublishWithEOL is like Publish, but the record is valid until eol,
+	// and resolvers may cache it for ttl. A zero ttl leaves it unset.
+	PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.Path, eol time.Time, ttl time.Duration) error
 }
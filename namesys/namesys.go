@@ -2,8 +2,11 @@ package namesys
 
 import (
 	"strings"
+	"time"
 
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	ci "github.com/ipfs/go-ipfs/p2p/crypto"
 	path "github.com/ipfs/go-ipfs/path"
 	routing "github.com/ipfs/go-ipfs/routing"
@@ -18,21 +21,27 @@ import (
 //
 // It can only publish to: (a) ipfs routing naming.
 //
+// Resolved names are kept in an lru cache for as long as their source allows.
 type mpns struct {
 	resolvers  map[string]resolver
 	publishers map[string]Publisher
+	cache      *nameCache
 }
 
-// NewNameSystem will construct the IPFS naming system based on Routing
-func NewNameSystem(r routing.IpfsRouting) NameSystem {
+// NewNameSystem will construct the IPFS naming system based on Routing,
+// looking up dns links with lookup and caching up to cachesize resolved
+// names. A nil lookup uses the system resolver, and a cachesize of zero
+// disables the cache. Published records are remembered in dstore.
+func NewNameSystem(r routing.IpfsRouting, dstore ds.Datastore, lookup LookupTXTFunc, cachesize int) NameSystem {
 	return &mpns{
+		cache: newNameCache(cachesize),
 		resolvers: map[string]resolver{
-			"dns":      newDNSResolver(),
+			"dns":      NewDNSResolver(lookup),
 			"proquint": new(ProquintResolver),
 			"dht":      newRoutingResolver(r),
 		},
 		publishers: map[string]Publisher{
-			"/ipns/": NewRoutingPublisher(r),
+			"/ipns/": NewRoutingPublisher(r, dstore),
 		},
 	}
 }
@@ -56,28 +65,63 @@ func (ns *mpns) ResolveN(ctx context.Context, name string, depth int) (path.Path
 }
 
 // resolveOnce implements resolver.
-func (ns *mpns) resolveOnce(ctx context.Context, name string) (path.Path, error) {
+func (ns *mpns) resolveOnce(ctx context.Context, name string) (path.Path, time.Duration, error) {
 	if !strings.HasPrefix(name, "/ipns/") {
 		name = "/ipns/" + name
 	}
 	segments := strings.SplitN(name, "/", 3)
 	if len(segments) < 3 || segments[0] != "" {
 		log.Warningf("Invalid name syntax for %s", name)
-		return "", ErrResolveFailed
+		return "", 0, ErrResolveFailed
+	}
+
+	if !noCache(ctx) {
+		if p, ttl, ok := ns.cache.get(segments[2]); ok {
+			log.Debugf("Resolved %s from cache", name)
+			return p, ttl, nil
+		}
 	}
 
 	for protocol, resolver := range ns.resolvers {
 		log.Debugf("Attempting to resolve %s with %s", name, protocol)
-		p, err := resolver.resolveOnce(ctx, segments[2])
+		p, ttl, err := resolver.resolveOnce(ctx, segments[2])
 		if err == nil {
-			return p, err
+			ns.cache.set(segments[2], p, ttl)
+			return p, ttl, nil
 		}
 	}
 	log.Warningf("No resolver found for %s", name)
-	return "", ErrResolveFailed
+	return "", 0, ErrResolveFailed
+}
+
+// CacheStats implements CacheReporter.
+func (ns *mpns) CacheStats() CacheStats {
+	return ns.cache.stats()
 }
 
 // Publish implements Publisher
 func (ns *mpns) Publish(ctx context.Context, name ci.PrivKey, value path.Path) error {
-	return ns.publishers["/ipns/"].Publish(ctx, name, value)
+	return ns.PublishWithEOL(ctx, name, value, time.Now().Add(DefaultRecordLifetime), 0)
+}
+
+// PublishWithEOL implements Publisher
+func (ns *mpns) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.Path, eol time.Time, ttl time.Duration) error {
+	err := ns.publishers["/ipns/"].PublishWithEOL(ctx, name, value, eol, ttl)
+	if err != nil {
+		return err
+	}
+
+	// we know the new value better than any cached one
+	hash, err := name.GetPublic().Hash()
+	if err != nil {
+		return err
+	}
+	if ttl == 0 {
+		ttl = DefaultResolverCacheTTL
+	}
+	if left := eol.Sub(time.Now()); left < ttl {
+		ttl = left
+	}
+	ns.cache.set(key.Key(hash).B58String(), value, ttl)
+	return nil
 }
@@ -3,6 +3,7 @@ package namesys
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
@@ -27,8 +28,9 @@ func testResolution(t *testing.T, resolver Resolver, name string, depth int, exp
 	}
 }
 
-func (r *mockResolver) resolveOnce(ctx context.Context, name string) (path.Path, error) {
-	return path.ParsePath(r.entries[name])
+func (r *mockResolver) resolveOnce(ctx context.Context, name string) (path.Path, time.Duration, error) {
+	p, err := path.ParsePath(r.entries[name])
+	return p, time.Minute, err
 }
 
 func mockResolverOne() *mockResolver {
@@ -69,3 +71,88 @@ func TestNamesysResolution(t *testing.T) {
 	testResolution(t, r, "/ipns/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", 2, "/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n", ErrResolveRecursion)
 	testResolution(t, r, "/ipns/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", 3, "/ipns/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy", ErrResolveRecursion)
 }
+
+type countingResolver struct {
+	entries map[string]string
+	ttl     time.Duration
+	calls   int
+}
+
+func (r *countingResolver) resolveOnce(ctx context.Context, name string) (path.Path, time.Duration, error) {
+	r.calls++
+	p, err := path.ParsePath(r.entries[name])
+	return p, r.ttl, err
+}
+
+func TestNamesysCache(t *testing.T) {
+	cr := &countingResolver{
+		entries: map[string]string{
+			"ipfs.io": "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj",
+		},
+		ttl: time.Minute,
+	}
+	r := &mpns{
+		resolvers: map[string]resolver{"count": cr},
+		cache:     newNameCache(10),
+	}
+	ctx := context.Background()
+	expected := "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj"
+
+	for i := 0; i < 3; i++ {
+		testResolution(t, r, "/ipns/ipfs.io", DefaultDepthLimit, expected, nil)
+	}
+	if cr.calls != 1 {
+		t.Fatalf("expected a single lookup, got %d", cr.calls)
+	}
+
+	// bypassing the cache looks the name up again
+	p, err := r.ResolveN(ContextWithNoCache(ctx), "/ipns/ipfs.io", DefaultDepthLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != expected {
+		t.Fatalf("%s != %s", p, expected)
+	}
+	if cr.calls != 2 {
+		t.Fatalf("expected --nocache to look the name up, got %d lookups", cr.calls)
+	}
+
+	stats := r.CacheStats()
+	if stats.Size != 1 || stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("unexpected cache stats: %+v", stats)
+	}
+
+	// values without a ttl are not cached
+	cr.ttl = 0
+	r.cache = newNameCache(10)
+	testResolution(t, r, "/ipns/ipfs.io", DefaultDepthLimit, expected, nil)
+	testResolution(t, r, "/ipns/ipfs.io", DefaultDepthLimit, expected, nil)
+	if cr.calls != 4 {
+		t.Fatalf("expected uncacheable values to be looked up, got %d lookups", cr.calls)
+	}
+}
+
+func TestNameCacheExpiry(t *testing.T) {
+	c := newNameCache(10)
+	c.set("a", path.Path("/ipfs/a"), time.Millisecond)
+	c.set("b", path.Path("/ipfs/b"), time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, _, ok := c.get("a"); ok {
+		t.Fatal("expired entry should not be returned")
+	}
+	p, ttl, ok := c.get("b")
+	if !ok || p != "/ipfs/b" {
+		t.Fatal("expected cached entry for b")
+	}
+	if ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("unexpected remaining ttl %s", ttl)
+	}
+
+	// a disabled cache never hits
+	var nc *nameCache
+	nc.set("a", path.Path("/ipfs/a"), time.Hour)
+	if _, _, ok := nc.get("a"); ok {
+		t.Fatal("disabled cache should not hit")
+	}
+}
@@ -10,6 +10,8 @@ It is generated from these files:
 
 It has these top-level messages:
 	IpnsEntry
+	IpnsPush
+	SuccessionRecord
 */
 package namesys_pb
 
@@ -56,6 +58,8 @@ type IpnsEntry struct {
 	Signature        []byte                  `protobuf:"bytes,2,req,name=signature" json:"signature,omitempty"`
 	ValidityType     *IpnsEntry_ValidityType `protobuf:"varint,3,opt,name=validityType,enum=namesys.pb.IpnsEntry_ValidityType" json:"validityType,omitempty"`
 	Validity         []byte                  `protobuf:"bytes,4,opt,name=validity" json:"validity,omitempty"`
+	Sequence         *uint64                 `protobuf:"varint,5,opt,name=sequence" json:"sequence,omitempty"`
+	Ttl              *uint64                 `protobuf:"varint,6,opt,name=ttl" json:"ttl,omitempty"`
 	XXX_unrecognized []byte                  `json:"-"`
 }
 
@@ -91,6 +95,149 @@ func (m *IpnsEntry) GetValidity() []byte {
 	return nil
 }
 
+func (m *IpnsEntry) GetSequence() uint64 {
+	if m != nil && m.Sequence != nil {
+		return *m.Sequence
+	}
+	return 0
+}
+
+func (m *IpnsEntry) GetTtl() uint64 {
+	if m != nil && m.Ttl != nil {
+		return *m.Ttl
+	}
+	return 0
+}
+
+type IpnsPush_MessageType int32
+
+const (
+	IpnsPush_SUBSCRIBE   IpnsPush_MessageType = 0
+	IpnsPush_UNSUBSCRIBE IpnsPush_MessageType = 1
+	IpnsPush_UPDATE      IpnsPush_MessageType = 2
+)
+
+var IpnsPush_MessageType_name = map[int32]string{
+	0: "SUBSCRIBE",
+	1: "UNSUBSCRIBE",
+	2: "UPDATE",
+}
+var IpnsPush_MessageType_value = map[string]int32{
+	"SUBSCRIBE":   0,
+	"UNSUBSCRIBE": 1,
+	"UPDATE":      2,
+}
+
+func (x IpnsPush_MessageType) Enum() *IpnsPush_MessageType {
+	p := new(IpnsPush_MessageType)
+	*p = x
+	return p
+}
+func (x IpnsPush_MessageType) String() string {
+	return proto.EnumName(IpnsPush_MessageType_name, int32(x))
+}
+func (x *IpnsPush_MessageType) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(IpnsPush_MessageType_value, data, "IpnsPush_MessageType")
+	if err != nil {
+		return err
+	}
+	*x = IpnsPush_MessageType(value)
+	return nil
+}
+
+// IpnsPush is exchanged by the ipns push protocol, to subscribe to the
+// updates of a name and to push them to subscribers.
+type IpnsPush struct {
+	Type *IpnsPush_MessageType `protobuf:"varint,1,req,name=type,enum=namesys.pb.IpnsPush_MessageType" json:"type,omitempty"`
+	// name is the multihash of the public key the name belongs to
+	Name []byte `protobuf:"bytes,2,req,name=name" json:"name,omitempty"`
+	// pubKey and entry make up an UPDATE: the marshalled public key of
+	// the name, and the marshalled IpnsEntry it signed
+	PubKey           []byte `protobuf:"bytes,3,opt,name=pubKey" json:"pubKey,omitempty"`
+	Entry            []byte `protobuf:"bytes,4,opt,name=entry" json:"entry,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *IpnsPush) Reset()         { *m = IpnsPush{} }
+func (m *IpnsPush) String() string { return proto.CompactTextString(m) }
+func (*IpnsPush) ProtoMessage()    {}
+
+func (m *IpnsPush) GetType() IpnsPush_MessageType {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return IpnsPush_SUBSCRIBE
+}
+
+func (m *IpnsPush) GetName() []byte {
+	if m != nil {
+		return m.Name
+	}
+	return nil
+}
+
+func (m *IpnsPush) GetPubKey() []byte {
+	if m != nil {
+		return m.PubKey
+	}
+	return nil
+}
+
+func (m *IpnsPush) GetEntry() []byte {
+	if m != nil {
+		return m.Entry
+	}
+	return nil
+}
+
+// SuccessionRecord commits a key to the key that will replace it, and once
+// the key is retired, reveals that successor. It is stored in the routing
+// system at /succession/<multihash of oldKey>.
+type SuccessionRecord struct {
+	// the marshalled public key of the retired key
+	OldKey []byte `protobuf:"bytes,1,req,name=oldKey" json:"oldKey,omitempty"`
+	// the multihash of the marshalled public key of the successor
+	NextKeyHash []byte `protobuf:"bytes,4,req,name=nextKeyHash" json:"nextKeyHash,omitempty"`
+	// the marshalled public key of the successor, once it is revealed
+	NewKey []byte `protobuf:"bytes,2,opt,name=newKey" json:"newKey,omitempty"`
+	// signature of the retired key over nextKeyHash
+	Signature        []byte `protobuf:"bytes,3,req,name=signature" json:"signature,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *SuccessionRecord) Reset()         { *m = SuccessionRecord{} }
+func (m *SuccessionRecord) String() string { return proto.CompactTextString(m) }
+func (*SuccessionRecord) ProtoMessage()    {}
+
+func (m *SuccessionRecord) GetOldKey() []byte {
+	if m != nil {
+		return m.OldKey
+	}
+	return nil
+}
+
+func (m *SuccessionRecord) GetNextKeyHash() []byte {
+	if m != nil {
+		return m.NextKeyHash
+	}
+	return nil
+}
+
+func (m *SuccessionRecord) GetNewKey() []byte {
+	if m != nil {
+		return m.NewKey
+	}
+	return nil
+}
+
+func (m *SuccessionRecord) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("namesys.pb.IpnsEntry_ValidityType", IpnsEntry_ValidityType_name, IpnsEntry_ValidityType_value)
+	proto.RegisterEnum("namesys.pb.IpnsPush_MessageType", IpnsPush_MessageType_name, IpnsPush_MessageType_value)
 }
@@ -2,12 +2,15 @@ package namesys
 
 import (
 	"errors"
+	"time"
 
 	proquint "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/bren2010/proquint"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	path "github.com/ipfs/go-ipfs/path"
 )
 
+const proquintCacheTTL = time.Hour
+
 type ProquintResolver struct{}
 
 // Resolve implements Resolver.
@@ -21,10 +24,11 @@ func (r *ProquintResolver) ResolveN(ctx context.Context, name string, depth int)
 }
 
 // resolveOnce implements resolver. Decodes the proquint string.
-func (r *ProquintResolver) resolveOnce(ctx context.Context, name string) (path.Path, error) {
+func (r *ProquintResolver) resolveOnce(ctx context.Context, name string) (path.Path, time.Duration, error) {
 	ok, err := proquint.IsProquint(name)
 	if err != nil || !ok {
-		return "", errors.New("not a valid proquint string")
+		return "", 0, errors.New("not a valid proquint string")
 	}
-	return path.FromString(string(proquint.Decode(name))), nil
+	// decoding never gives a different answer, cache it for long
+	return path.FromString(string(proquint.Decode(name))), proquintCacheTTL, nil
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
@@ -29,26 +30,37 @@ var ErrExpiredRecord = errors.New("expired record")
 // unknown validity type.
 var ErrUnrecognizedValidity = errors.New("unrecognized validity type")
 
+// publishedRecordPrefix is where the last record published for each name
+// is kept, so its sequence number never goes backwards.
+var publishedRecordPrefix = ds.NewKey("/local/ipns/record")
+
 // ipnsPublisher is capable of publishing and resolving names to the IPFS
 // routing system.
 type ipnsPublisher struct {
 	routing routing.IpfsRouting
+	dstore  ds.Datastore
+
+	// push, if set, sends published records to subscribers
+	push *PushService
 }
 
 // NewRoutingPublisher constructs a publisher for the IPFS Routing name system.
-func NewRoutingPublisher(route routing.IpfsRouting) Publisher {
-	return &ipnsPublisher{routing: route}
+// The last record published for each name is kept in dstore.
+func NewRoutingPublisher(route routing.IpfsRouting, dstore ds.Datastore) Publisher {
+	return &ipnsPublisher{routing: route, dstore: dstore}
 }
 
 // Publish implements Publisher. Accepts a keypair and a value,
 // and publishes it out to the routing system
 func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value path.Path) error {
+	return p.PublishWithEOL(ctx, k, value, time.Now().Add(DefaultRecordLifetime), 0)
+}
+
+// PublishWithEOL implements Publisher. The published record is valid until
+// eol and carries ttl as a caching hint, if ttl is not zero.
+func (p *ipnsPublisher) PublishWithEOL(ctx context.Context, k ci.PrivKey, value path.Path, eol time.Time, ttl time.Duration) error {
 	log.Debugf("Publish %s", value)
 
-	data, err := createRoutingEntryData(k, value)
-	if err != nil {
-		return err
-	}
 	pubkey := k.GetPublic()
 	pkbytes, err := pubkey.Bytes()
 	if err != nil {
@@ -57,6 +69,22 @@ func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value path.Pa
 
 	nameb := u.Hash(pkbytes)
 	namekey := key.Key("/pk/" + string(nameb))
+	ipnskey := key.Key("/ipns/" + string(nameb))
+
+	seq, err := p.nextSequence(ctx, nameb, ipnskey)
+	if err != nil {
+		return err
+	}
+	data, err := createRoutingEntryData(k, value, seq, eol, ttl)
+	if err != nil {
+		return err
+	}
+
+	// remember the record before putting it, so a failed put can only
+	// skip a sequence number, never reuse one
+	if err := p.dstore.Put(publishedRecordKey(key.Key(nameb)), data); err != nil {
+		return err
+	}
 
 	log.Debugf("Storing pubkey at: %s", namekey)
 	// Store associated public key
@@ -67,8 +95,6 @@ func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value path.Pa
 		return err
 	}
 
-	ipnskey := key.Key("/ipns/" + string(nameb))
-
 	log.Debugf("Storing ipns entry at: %s", ipnskey)
 	// Store ipns entry at "/ipns/"+b58(h(pubkey))
 	timectx, cancel = context.WithDeadline(ctx, time.Now().Add(time.Second*10))
@@ -77,16 +103,87 @@ func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value path.Pa
 		return err
 	}
 
+	if p.push != nil {
+		if err := p.push.Push(pubkey, data); err != nil {
+			log.Warningf("failed to push ipns entry of %s: %s", key.Key(nameb).B58String(), err)
+		}
+	}
+
 	return nil
 }
 
-func createRoutingEntryData(pk ci.PrivKey, val path.Path) ([]byte, error) {
+// nextSequence returns the sequence number for the next record published
+// for name, one more than the sequence of the latest record we published or
+// found in the routing system at ipnskey.
+func (p *ipnsPublisher) nextSequence(ctx context.Context, name []byte, ipnskey key.Key) (uint64, error) {
+	var seq uint64
+	if last, err := GetPublishedEntry(p.dstore, key.Key(name)); err == nil {
+		seq = last.GetSequence() + 1
+	} else if err != ds.ErrNotFound {
+		return 0, err
+	}
+
+	timectx, cancel := context.WithDeadline(ctx, time.Now().Add(time.Second*10))
+	defer cancel()
+
+	val, err := p.routing.GetValue(timectx, ipnskey)
+	switch err {
+	case nil:
+	case routing.ErrNotFound, ds.ErrNotFound:
+		log.Debugf("no previous ipns entry at %s", ipnskey)
+		return seq, nil
+	default:
+		// publishing a sequence lower than the one out there would be
+		// silently ignored
+		return 0, fmt.Errorf("cannot find the current ipns entry: %s", err)
+	}
+
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(val, entry); err != nil {
+		log.Debugf("failed to decode previous ipns entry at %s: %s", ipnskey, err)
+		return seq, nil
+	}
+	if entry.GetSequence() >= seq {
+		seq = entry.GetSequence() + 1
+	}
+	return seq, nil
+}
+
+// GetPublishedEntry returns the last record this node published for name,
+// as kept in dstore by the routing publisher.
+func GetPublishedEntry(dstore ds.Datastore, name key.Key) (*pb.IpnsEntry, error) {
+	val, err := dstore.Get(publishedRecordKey(name))
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := val.([]byte)
+	if !ok {
+		return nil, errors.New("value stored in datastore not []byte")
+	}
+
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(b, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func publishedRecordKey(name key.Key) ds.Key {
+	return publishedRecordPrefix.ChildString(name.B58String())
+}
+
+func createRoutingEntryData(pk ci.PrivKey, val path.Path, seq uint64, eol time.Time, ttl time.Duration) ([]byte, error) {
 	entry := new(pb.IpnsEntry)
 
 	entry.Value = []byte(val)
 	typ := pb.IpnsEntry_EOL
 	entry.ValidityType = &typ
-	entry.Validity = []byte(u.FormatRFC3339(time.Now().Add(time.Hour * 24)))
+	entry.Validity = []byte(u.FormatRFC3339(eol))
+	entry.Sequence = proto.Uint64(seq)
+	if ttl > 0 {
+		entry.Ttl = proto.Uint64(uint64(ttl.Nanoseconds()))
+	}
 
 	sig, err := pk.Sign(ipnsEntryDataForSig(entry))
 	if err != nil {
@@ -97,12 +194,22 @@ func createRoutingEntryData(pk ci.PrivKey, val path.Path) ([]byte, error) {
 }
 
 func ipnsEntryDataForSig(e *pb.IpnsEntry) []byte {
-	return bytes.Join([][]byte{
+	parts := [][]byte{
 		e.Value,
 		e.Validity,
 		[]byte(fmt.Sprint(e.GetValidityType())),
-	},
-		[]byte{})
+	}
+
+	// the sequence is signed so it cannot be raised to make an old record
+	// win. entries from before sequences existed are signed without it,
+	// and entries without a ttl leave it out.
+	if e.Sequence != nil {
+		parts = append(parts, []byte(fmt.Sprint(e.GetSequence())))
+	}
+	if e.Ttl != nil {
+		parts = append(parts, []byte(fmt.Sprint(e.GetTtl())))
+	}
+	return bytes.Join(parts, []byte{})
 }
 
 var IpnsRecordValidator = &record.ValidChecker{
@@ -110,6 +217,56 @@ var IpnsRecordValidator = &record.ValidChecker{
 	Sign: true,
 }
 
+// IpnsSelectorFunc implements record.SelectorFunc. It picks the entry with
+// the highest sequence number, breaking ties with the latest EOL.
+func IpnsSelectorFunc(k key.Key, vals [][]byte) (int, error) {
+	var recs []*pb.IpnsEntry
+	for _, v := range vals {
+		e := new(pb.IpnsEntry)
+		if err := proto.Unmarshal(v, e); err != nil {
+			recs = append(recs, nil)
+			continue
+		}
+		recs = append(recs, e)
+	}
+
+	return selectRecord(recs, vals)
+}
+
+func selectRecord(recs []*pb.IpnsEntry, vals [][]byte) (int, error) {
+	var best *pb.IpnsEntry
+	besti := -1
+
+	for i, r := range recs {
+		if r == nil || r.GetSequence() < best.GetSequence() {
+			continue
+		}
+
+		if besti == -1 || r.GetSequence() > best.GetSequence() {
+			best, besti = r, i
+			continue
+		}
+
+		// equal sequence, prefer the entry that lives longer
+		rt, err := u.ParseRFC3339(string(r.GetValidity()))
+		if err != nil {
+			continue
+		}
+		bestt, err := u.ParseRFC3339(string(best.GetValidity()))
+		if err != nil || rt.After(bestt) {
+			best, besti = r, i
+		} else if rt.Equal(bestt) && bytes.Compare(vals[i], vals[besti]) > 0 {
+			// make the choice deterministic
+			best, besti = r, i
+		}
+	}
+
+	if besti == -1 {
+		return 0, errors.New("no usable records in given set")
+	}
+	return besti, nil
+}
+
 // ValidateIpnsRecord implements ValidatorFunc and verifies that the
 // given 'val' is an IpnsEntry and that that entry is valid.
 func ValidateIpnsRecord(k key.Key, val []byte) error {
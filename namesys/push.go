@@ -0,0 +1,468 @@
+package namesys
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	ggio "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/io"
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	pb "github.com/ipfs/go-ipfs/namesys/pb"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	host "github.com/ipfs/go-ipfs/p2p/host"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	routing "github.com/ipfs/go-ipfs/routing"
+)
+
+// PushProtocol is the protocol ipns records are pushed to subscribers with.
+const PushProtocol protocol.ID = "/ipfs/ipns/push"
+
+// SubscriptionTTL is how long a peer stays subscribed to a name without
+// subscribing again. Our own subscriptions are renewed every half of it.
+var SubscriptionTTL = time.Hour
+
+// MaxSubscriptionsPerPeer bounds the names a single peer can subscribe to
+// here.
+var MaxSubscriptionsPerPeer = 64
+
+// MaxSubscribers bounds the subscriptions of all peers together.
+var MaxSubscribers = 4096
+
+// ErrNotSubscribed is returned for updates of names nobody asked for.
+var ErrNotSubscribed = errors.New("not subscribed to name")
+
+// ErrStaleUpdate is returned for updates no newer than the known record.
+var ErrStaleUpdate = errors.New("update is not newer than the known record")
+
+// knownEntryTimeout bounds looking up the record of a name in the routing
+// system, which the first record pushed for it must be newer than.
+var knownEntryTimeout = time.Second * 10
+
+// pushedEntry is the latest record known for a name.
+type pushedEntry struct {
+	pubkey []byte
+	entry  []byte
+	seq    uint64
+}
+
+// PushService pushes the records this node publishes to the peers that
+// subscribed to their names, and takes in the records pushed for the names
+// it subscribed to. Records it takes in update the name cache right away,
+// and are passed on to its own subscribers.
+type PushService struct {
+	ctx     context.Context
+	host    host.Host
+	cache   *nameCache
+	routing routing.IpfsRouting
+
+	lk sync.Mutex
+	// subscribers are the peers we push the records of a name to, and
+	// when their subscriptions expire
+	subscribers map[key.Key]map[peer.ID]time.Time
+	// perPeer counts the names each subscriber subscribed to, and total
+	// all of their subscriptions
+	perPeer map[peer.ID]int
+	total   int
+	// subscriptions are the peers we asked for the records of a name
+	subscriptions map[key.Key]map[peer.ID]struct{}
+	latest        map[key.Key]*pushedEntry
+}
+
+// NewPushService starts serving the ipns push protocol on h. Names ns
+// publishes are pushed to subscribers, and pushed records update its cache.
+// Expired subscribers are dropped, and our subscriptions renewed, until ctx
+// is done.
+func NewPushService(ctx context.Context, h host.Host, ns NameSystem) *PushService {
+	ps := &PushService{
+		ctx:           ctx,
+		host:          h,
+		subscribers:   make(map[key.Key]map[peer.ID]time.Time),
+		perPeer:       make(map[peer.ID]int),
+		subscriptions: make(map[key.Key]map[peer.ID]struct{}),
+		latest:        make(map[key.Key]*pushedEntry),
+	}
+
+	if m, ok := ns.(*mpns); ok {
+		ps.cache = m.cache
+		if p, ok := m.publishers["/ipns/"].(*ipnsPublisher); ok {
+			p.push = ps
+		}
+		if r, ok := m.resolvers["dht"].(*routingResolver); ok {
+			ps.routing = r.routing
+		}
+	}
+
+	h.SetStreamHandler(PushProtocol, ps.handleNewStream)
+	go ps.maintain(ctx)
+	return ps
+}
+
+// maintain drops expired subscribers and renews our subscriptions until ctx
+// is done.
+func (ps *PushService) maintain(ctx context.Context) {
+	tick := time.NewTicker(SubscriptionTTL / 2)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			ps.expireSubscribers(time.Now())
+			ps.renewSubscriptions()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// renewSubscriptions subscribes again at every peer we subscribed at, so
+// our subscriptions do not expire there.
+func (ps *PushService) renewSubscriptions() {
+	ps.lk.Lock()
+	subs := make(map[key.Key][]peer.ID, len(ps.subscriptions))
+	for name, peers := range ps.subscriptions {
+		for p := range peers {
+			subs[name] = append(subs[name], p)
+		}
+	}
+	ps.lk.Unlock()
+
+	for name, peers := range subs {
+		for _, p := range peers {
+			err := ps.send(p, &pb.IpnsPush{
+				Type: pb.IpnsPush_SUBSCRIBE.Enum(),
+				Name: []byte(name),
+			})
+			if err != nil {
+				log.Debugf("failed to renew the subscription to %s at %s: %s", name.B58String(), p, err)
+			}
+		}
+	}
+}
+
+// Subscribe asks each of peers to push the records of name to us.
+func (ps *PushService) Subscribe(name key.Key, peers ...peer.ID) error {
+	var firstErr error
+	for _, p := range peers {
+		err := ps.send(p, &pb.IpnsPush{
+			Type: pb.IpnsPush_SUBSCRIBE.Enum(),
+			Name: []byte(name),
+		})
+		if err != nil {
+			log.Debugf("failed to subscribe to %s at %s: %s", name.B58String(), p, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		ps.lk.Lock()
+		addPeer(ps.subscriptions, name, p)
+		ps.lk.Unlock()
+	}
+	return firstErr
+}
+
+// Unsubscribe tells every peer we subscribed at to stop pushing the records
+// of name.
+func (ps *PushService) Unsubscribe(name key.Key) {
+	ps.lk.Lock()
+	peers := ps.subscriptions[name]
+	delete(ps.subscriptions, name)
+	ps.lk.Unlock()
+
+	for p := range peers {
+		err := ps.send(p, &pb.IpnsPush{
+			Type: pb.IpnsPush_UNSUBSCRIBE.Enum(),
+			Name: []byte(name),
+		})
+		if err != nil {
+			log.Debugf("failed to unsubscribe from %s at %s: %s", name.B58String(), p, err)
+		}
+	}
+}
+
+// Subscriptions returns the names we subscribed to.
+func (ps *PushService) Subscriptions() []key.Key {
+	ps.lk.Lock()
+	defer ps.lk.Unlock()
+
+	out := make([]key.Key, 0, len(ps.subscriptions))
+	for k := range ps.subscriptions {
+		out = append(out, k)
+	}
+	return out
+}
+
+// Push sends the record entry, signed by pk, to the subscribers of its
+// name.
+func (ps *PushService) Push(pk ci.PubKey, entry []byte) error {
+	pkb, err := pk.Bytes()
+	if err != nil {
+		return err
+	}
+	h, err := pk.Hash()
+	if err != nil {
+		return err
+	}
+
+	e := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(entry, e); err != nil {
+		return err
+	}
+
+	name := key.Key(h)
+	pe := &pushedEntry{pubkey: pkb, entry: entry, seq: e.GetSequence()}
+
+	ps.lk.Lock()
+	ps.latest[name] = pe
+	ps.lk.Unlock()
+
+	ps.forward(name, pe, "")
+	return nil
+}
+
+func (ps *PushService) handleNewStream(s inet.Stream) {
+	defer s.Close()
+
+	from := s.Conn().RemotePeer()
+	r := ggio.NewDelimitedReader(s, inet.MessageSizeMax)
+	msg := new(pb.IpnsPush)
+	if err := r.ReadMsg(msg); err != nil {
+		log.Debugf("failed to read ipns push message from %s: %s", from, err)
+		return
+	}
+
+	name := key.Key(msg.GetName())
+	switch msg.GetType() {
+	case pb.IpnsPush_SUBSCRIBE:
+		ps.lk.Lock()
+		ok := ps.addSubscriber(name, from, time.Now())
+		pe := ps.latest[name]
+		ps.lk.Unlock()
+		if !ok {
+			log.Debugf("refused the subscription of %s to %s: too many subscriptions", from, name.B58String())
+			return
+		}
+
+		// bring the new subscriber up to date
+		if pe != nil {
+			go ps.sendEntry(from, name, pe)
+		}
+
+	case pb.IpnsPush_UNSUBSCRIBE:
+		ps.lk.Lock()
+		ps.removeSubscriber(name, from)
+		ps.lk.Unlock()
+
+	case pb.IpnsPush_UPDATE:
+		err := ps.receive(name, msg.GetPubKey(), msg.GetEntry(), from)
+		if err != nil {
+			log.Debugf("rejected ipns push of %s from %s: %s", name.B58String(), from, err)
+		}
+	}
+}
+
+// receive checks a record pushed by a peer we subscribed at, and if it is
+// the newest known for name, caches its value and passes it on to our
+// subscribers.
+func (ps *PushService) receive(name key.Key, pkb, data []byte, from peer.ID) error {
+	ps.lk.Lock()
+	_, subscribed := ps.subscriptions[name][from]
+	known := ps.latest[name] != nil
+	ps.lk.Unlock()
+	if !subscribed {
+		return ErrNotSubscribed
+	}
+
+	entry, err := verifyPushedEntry(name, pkb, data)
+	if err != nil {
+		return err
+	}
+
+	// until a record was pushed, the one in the routing system is the
+	// newest known, so older ones cannot be replayed
+	var routed *pushedEntry
+	if !known {
+		routed = ps.routedEntry(name)
+	}
+
+	pe := &pushedEntry{pubkey: pkb, entry: data, seq: entry.GetSequence()}
+	ps.lk.Lock()
+	old := ps.latest[name]
+	if old == nil {
+		old = routed
+	}
+	if old != nil && old.seq >= pe.seq {
+		ps.lk.Unlock()
+		return ErrStaleUpdate
+	}
+	ps.latest[name] = pe
+	ps.lk.Unlock()
+
+	p, err := entryValue(entry)
+	if err != nil {
+		return err
+	}
+	ps.cache.set(name.B58String(), p, recordTTL(entry))
+
+	ps.forward(name, pe, from)
+	return nil
+}
+
+// routedEntry returns the record of name found in the routing system, or
+// nil if there is none.
+func (ps *PushService) routedEntry(name key.Key) *pushedEntry {
+	if ps.routing == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ps.ctx, knownEntryTimeout)
+	defer cancel()
+
+	data, err := ps.routing.GetValue(ctx, key.Key("/ipns/"+string(name)))
+	if err != nil {
+		log.Debugf("no record of %s to check pushes against: %s", name.B58String(), err)
+		return nil
+	}
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(data, entry); err != nil {
+		return nil
+	}
+	return &pushedEntry{entry: data, seq: entry.GetSequence()}
+}
+
+// verifyPushedEntry checks that data is a current record of name, signed
+// by the key in pkb.
+func verifyPushedEntry(name key.Key, pkb, data []byte) (*pb.IpnsEntry, error) {
+	pk, err := ci.UnmarshalPublicKey(pkb)
+	if err != nil {
+		return nil, err
+	}
+	h, err := pk.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if key.Key(h) != name {
+		return nil, fmt.Errorf("public key does not match name %s", name.B58String())
+	}
+
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	if ok, err := pk.Verify(ipnsEntryDataForSig(entry), entry.GetSignature()); err != nil || !ok {
+		return nil, fmt.Errorf("invalid signature on record of %s", name.B58String())
+	}
+
+	if err := ValidateIpnsRecord(name, data); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// forward sends pe to the subscribers of name, except the peer it came
+// from and those whose subscriptions expired.
+func (ps *PushService) forward(name key.Key, pe *pushedEntry, from peer.ID) {
+	now := time.Now()
+	ps.lk.Lock()
+	var peers []peer.ID
+	for p, expires := range ps.subscribers[name] {
+		if p != from && now.Before(expires) {
+			peers = append(peers, p)
+		}
+	}
+	ps.lk.Unlock()
+
+	for _, p := range peers {
+		go ps.sendEntry(p, name, pe)
+	}
+}
+
+// sendEntry pushes pe to p, dropping p from the subscribers of name if it
+// cannot be reached.
+func (ps *PushService) sendEntry(p peer.ID, name key.Key, pe *pushedEntry) {
+	err := ps.send(p, &pb.IpnsPush{
+		Type:   pb.IpnsPush_UPDATE.Enum(),
+		Name:   []byte(name),
+		PubKey: pe.pubkey,
+		Entry:  pe.entry,
+	})
+	if err != nil {
+		log.Debugf("failed to push %s to %s, dropping subscriber: %s", name.B58String(), p, err)
+		ps.lk.Lock()
+		ps.removeSubscriber(name, p)
+		ps.lk.Unlock()
+	}
+}
+
+// addSubscriber subscribes p to name until SubscriptionTTL after now, or
+// renews its subscription. It returns false if p or all peers together
+// hold too many subscriptions. ps.lk must be held.
+func (ps *PushService) addSubscriber(name key.Key, p peer.ID, now time.Time) bool {
+	peers, ok := ps.subscribers[name]
+	if _, renew := peers[p]; !renew {
+		if ps.perPeer[p] >= MaxSubscriptionsPerPeer || ps.total >= MaxSubscribers {
+			return false
+		}
+		ps.perPeer[p]++
+		ps.total++
+	}
+	if !ok {
+		peers = make(map[peer.ID]time.Time)
+		ps.subscribers[name] = peers
+	}
+	peers[p] = now.Add(SubscriptionTTL)
+	return true
+}
+
+// removeSubscriber drops the subscription of p to name. ps.lk must be held.
+func (ps *PushService) removeSubscriber(name key.Key, p peer.ID) {
+	peers := ps.subscribers[name]
+	if _, ok := peers[p]; !ok {
+		return
+	}
+	delete(peers, p)
+	if len(peers) == 0 {
+		delete(ps.subscribers, name)
+	}
+	ps.total--
+	if ps.perPeer[p]--; ps.perPeer[p] == 0 {
+		delete(ps.perPeer, p)
+	}
+}
+
+// expireSubscribers drops the subscriptions that expired by now.
+func (ps *PushService) expireSubscribers(now time.Time) {
+	ps.lk.Lock()
+	defer ps.lk.Unlock()
+	for name, peers := range ps.subscribers {
+		for p, expires := range peers {
+			if !now.Before(expires) {
+				ps.removeSubscriber(name, p)
+			}
+		}
+	}
+}
+
+func (ps *PushService) send(p peer.ID, msg *pb.IpnsPush) error {
+	s, err := ps.host.NewStream(PushProtocol, p)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return ggio.NewDelimitedWriter(s).WriteMsg(msg)
+}
+
+func addPeer(m map[key.Key]map[peer.ID]struct{}, name key.Key, p peer.ID) {
+	peers, ok := m[name]
+	if !ok {
+		peers = make(map[peer.ID]struct{})
+		m[name] = peers
+	}
+	peers[p] = struct{}{}
+}
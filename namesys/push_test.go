@@ -0,0 +1,246 @@
+package namesys
+
+import (
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	mocknet "github.com/ipfs/go-ipfs/p2p/net/mock"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	path "github.com/ipfs/go-ipfs/path"
+	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
+	testutil "github.com/ipfs/go-ipfs/util/testutil"
+)
+
+// waitCached waits for ns to have val cached for name.
+func waitCached(t *testing.T, ns NameSystem, name key.Key, val path.Path) {
+	cache := ns.(*mpns).cache
+	timeout := time.After(time.Second * 5)
+	for {
+		if p, _, ok := cache.get(name.B58String()); ok && p == val {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("%s was never pushed %s", name.B58String(), val)
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func TestPushUpdates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	// every node sees a different routing system, so only pushes can
+	// carry records between them
+	var nss []NameSystem
+	var pss []*PushService
+	for _, h := range hosts {
+		r := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+		ns := NewNameSystem(r, ds.NewMapDatastore(), nil, 10)
+		nss = append(nss, ns)
+		pss = append(pss, NewPushService(ctx, h, ns))
+	}
+
+	sk, pk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := pk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(h)
+
+	// node 1 subscribes at the publisher, node 2 at node 1
+	if err := pss[1].Subscribe(name, hosts[0].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := pss[2].Subscribe(name, hosts[1].ID()); err != nil {
+		t.Fatal(err)
+	}
+	// wait for the subscriptions to arrive
+	time.Sleep(time.Millisecond * 100)
+
+	for _, val := range []path.Path{
+		path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN"),
+		path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"),
+	} {
+		if err := nss[0].Publish(ctx, sk, val); err != nil {
+			t.Fatal(err)
+		}
+		waitCached(t, nss[1], name, val)
+		waitCached(t, nss[2], name, val)
+
+		// resolving needs no lookup on the subscribers
+		res, err := nss[2].Resolve(ctx, "/ipns/"+name.B58String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != val {
+			t.Fatalf("resolved %s, expected %s", res, val)
+		}
+	}
+
+	if subs := pss[2].Subscriptions(); len(subs) != 1 || subs[0] != name {
+		t.Fatalf("unexpected subscriptions %v", subs)
+	}
+}
+
+func TestPushRejectsInvalid(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	ns := NewNameSystem(r, ds.NewMapDatastore(), nil, 10)
+	ps := NewPushService(ctx, mn.Hosts()[0], ns)
+
+	sk, pk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherpk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := pk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(h)
+	pkb, err := pk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherpkb, err := otherpk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	eol := time.Now().Add(time.Hour)
+	entry, err := createRoutingEntryData(sk, val, 1, eol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ps.receive(name, pkb, entry, ""); err != ErrNotSubscribed {
+		t.Fatalf("expected ErrNotSubscribed, got %v", err)
+	}
+
+	// pretend we subscribed somewhere
+	addPeer(ps.subscriptions, name, "")
+	if err := ps.receive(name, pkb, entry, "other"); err != ErrNotSubscribed {
+		t.Fatalf("expected ErrNotSubscribed from a peer we did not subscribe at, got %v", err)
+	}
+
+	if err := ps.receive(name, otherpkb, entry, ""); err == nil {
+		t.Fatal("accepted record with the wrong public key")
+	}
+
+	// a record older than the routed one is a replay
+	routed, err := createRoutingEntryData(sk, val, 3, eol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.PutValue(ctx, key.Key("/ipns/"+string(name)), routed); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.receive(name, pkb, entry, ""); err != ErrStaleUpdate {
+		t.Fatalf("expected ErrStaleUpdate for a record older than the routed one, got %v", err)
+	}
+	newer, err := createRoutingEntryData(sk, val, 4, eol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := createRoutingEntryData(sk, val, 5, time.Now().Add(-time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.receive(name, pkb, expired, ""); err != ErrExpiredRecord {
+		t.Fatalf("expected ErrExpiredRecord, got %v", err)
+	}
+
+	if err := ps.receive(name, pkb, newer, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.receive(name, pkb, newer, ""); err != ErrStaleUpdate {
+		t.Fatalf("expected ErrStaleUpdate, got %v", err)
+	}
+
+	p, _, ok := ns.(*mpns).cache.get(name.B58String())
+	if !ok || p != val {
+		t.Fatal("accepted record was not cached")
+	}
+}
+
+func TestPushSubscriberLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	defer func(perPeer, total int) {
+		MaxSubscriptionsPerPeer, MaxSubscribers = perPeer, total
+	}(MaxSubscriptionsPerPeer, MaxSubscribers)
+	MaxSubscriptionsPerPeer, MaxSubscribers = 2, 3
+
+	mn, err := mocknet.FullMeshConnected(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := NewNameSystem(mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t)), ds.NewMapDatastore(), nil, 10)
+	ps := NewPushService(ctx, mn.Hosts()[0], ns)
+
+	now := time.Now()
+	add := func(name key.Key, p peer.ID) bool {
+		ps.lk.Lock()
+		defer ps.lk.Unlock()
+		return ps.addSubscriber(name, p, now)
+	}
+
+	if !add("a", "p1") || !add("b", "p1") {
+		t.Fatal("refused subscriptions under the limits")
+	}
+	if add("c", "p1") {
+		t.Fatal("accepted more subscriptions than a peer may hold")
+	}
+	// renewing is not a new subscription
+	if !add("a", "p1") {
+		t.Fatal("refused renewing a subscription")
+	}
+	if !add("a", "p2") {
+		t.Fatal("refused a subscription under the limits")
+	}
+	if add("b", "p3") {
+		t.Fatal("accepted more subscriptions than all peers may hold")
+	}
+
+	// unsubscribing frees a slot
+	ps.lk.Lock()
+	ps.removeSubscriber("a", "p2")
+	ps.lk.Unlock()
+	if !add("b", "p3") {
+		t.Fatal("refused a subscription after one was dropped")
+	}
+
+	ps.expireSubscribers(now.Add(SubscriptionTTL))
+	ps.lk.Lock()
+	defer ps.lk.Unlock()
+	if len(ps.subscribers) != 0 || len(ps.perPeer) != 0 || ps.total != 0 {
+		t.Fatalf("subscriptions left after they expired: %v %v %d", ps.subscribers, ps.perPeer, ps.total)
+	}
+}
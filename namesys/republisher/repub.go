@@ -0,0 +1,338 @@
+// Package republisher keeps IPNS records published by this node alive by
+// re-signing and re-putting them before they expire.
+package republisher
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	pb "github.com/ipfs/go-ipfs/namesys/pb"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	path "github.com/ipfs/go-ipfs/path"
+	routing "github.com/ipfs/go-ipfs/routing"
+	logging "github.com/ipfs/go-ipfs/vendor/go-log-v1.0.0"
+)
+
+var log = logging.Logger("ipns-repub")
+
+// DefaultRepublishPeriod is how often remembered names are republished,
+// at most. Names with short-lived records are republished more often.
+var DefaultRepublishPeriod = time.Hour * 4
+
+// initialRepublishDelay is how long Run waits before the first republish,
+// so a daemon started and stopped right away does not republish.
+var initialRepublishDelay = time.Minute
+
+// ErrUnknownName is returned when asked about a name that was never
+// published through the republisher.
+var ErrUnknownName = errors.New("name is not republished")
+
+// publishedPrefix is where the names to republish are remembered.
+var publishedPrefix = ds.NewKey("/local/ipns/published")
+
+// KeyLookupFunc returns the private key that signs the records of name.
+type KeyLookupFunc func(name key.Key) (ci.PrivKey, error)
+
+// Republisher remembers the names published through it and periodically
+// republishes the value each of them currently points to. Each name is
+// republished once per Interval, or halfway through the lifetime of its
+// record if that comes first.
+type Republisher struct {
+	pub    namesys.Publisher
+	dstore ds.Datastore
+	getKey KeyLookupFunc
+
+	// Interval is the longest time between republishes of a name.
+	Interval time.Duration
+
+	// RecordLifetime is the lifetime of republished records for names
+	// published without one.
+	RecordLifetime time.Duration
+
+	// Routing, if set, is where the succession records kept in the
+	// datastore are republished.
+	Routing routing.IpfsRouting
+
+	lk    sync.Mutex
+	names map[key.Key]struct{}
+
+	// due is when each name is next republished, names missing from it
+	// are due right away. published wakes Run when a name is added.
+	due       map[key.Key]time.Time
+	published chan struct{}
+}
+
+// entry holds what was asked for when a name was published.
+type entry struct {
+	Lifetime time.Duration
+	TTL      time.Duration
+}
+
+// NewRepublisher creates a republisher publishing through pub and
+// remembering names in dstore. getKey may be nil if Run is never called.
+func NewRepublisher(pub namesys.Publisher, dstore ds.Datastore, getKey KeyLookupFunc) *Republisher {
+	return &Republisher{
+		pub:            pub,
+		dstore:         dstore,
+		getKey:         getKey,
+		Interval:       DefaultRepublishPeriod,
+		RecordLifetime: namesys.DefaultRecordLifetime,
+		names:          make(map[key.Key]struct{}),
+		due:            make(map[key.Key]time.Time),
+		published:      make(chan struct{}, 1),
+	}
+}
+
+// AddName makes the republisher keep name alive for as long as it runs,
+// without remembering it in the datastore. It is meant for names that
+// always exist, like the node's own.
+func (rp *Republisher) AddName(name key.Key) {
+	rp.lk.Lock()
+	defer rp.lk.Unlock()
+	rp.names[name] = struct{}{}
+}
+
+// Publish publishes value under the name of k with a record valid for
+// lifetime, and remembers the name so that it is republished before the
+// record expires. A zero lifetime selects RecordLifetime.
+func (rp *Republisher) Publish(ctx context.Context, k ci.PrivKey, value path.Path, lifetime, ttl time.Duration) error {
+	if lifetime <= 0 {
+		lifetime = rp.RecordLifetime
+	}
+
+	if err := rp.pub.PublishWithEOL(ctx, k, value, time.Now().Add(lifetime), ttl); err != nil {
+		return err
+	}
+
+	h, err := k.GetPublic().Hash()
+	if err != nil {
+		return err
+	}
+	name := key.Key(h)
+	e := &entry{Lifetime: lifetime, TTL: ttl}
+	if err := rp.remember(name, e); err != nil {
+		return err
+	}
+
+	rp.lk.Lock()
+	rp.due[name] = time.Now().Add(rp.period(e))
+	rp.lk.Unlock()
+	select {
+	case rp.published <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Forget stops republishing name.
+func (rp *Republisher) Forget(name key.Key) error {
+	rp.lk.Lock()
+	delete(rp.names, name)
+	delete(rp.due, name)
+	rp.lk.Unlock()
+
+	err := rp.dstore.Delete(publishedKey(name))
+	if err == ds.ErrNotFound {
+		return ErrUnknownName
+	}
+	return err
+}
+
+// Names returns every name the republisher keeps alive.
+func (rp *Republisher) Names() ([]key.Key, error) {
+	entries, err := rp.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []key.Key
+	for name := range entries {
+		out = append(out, name)
+	}
+	return out, nil
+}
+
+// Run republishes every name whenever it is due, until ctx is done.
+// Succession records are republished once per Interval.
+func (rp *Republisher) Run(ctx context.Context) {
+	next := time.Now().Add(initialRepublishDelay)
+	var successionsDue time.Time
+	for {
+		timer := time.NewTimer(next.Sub(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-rp.published:
+			// a new name may be due before the timer fires
+			timer.Stop()
+			if due := time.Now().Add(rp.nextDue(time.Now())); due.Before(next) {
+				next = due
+			}
+			continue
+		case <-timer.C:
+		}
+
+		next = time.Now().Add(rp.republishDue(ctx))
+
+		if rp.Routing == nil {
+			continue
+		}
+		if !time.Now().Before(successionsDue) {
+			if err := namesys.RepublishSuccessions(ctx, rp.Routing, rp.dstore); err != nil {
+				log.Error("republisher failed to republish successions: ", err)
+			}
+			successionsDue = time.Now().Add(rp.Interval)
+		}
+		if successionsDue.Before(next) {
+			next = successionsDue
+		}
+	}
+}
+
+// period is how long a record published for e is republished after.
+func (rp *Republisher) period(e *entry) time.Duration {
+	lifetime := e.Lifetime
+	if lifetime <= 0 {
+		lifetime = rp.RecordLifetime
+	}
+	if p := lifetime / 2; p < rp.Interval {
+		return p
+	}
+	return rp.Interval
+}
+
+// republishDue republishes the names that are due, and returns how long
+// until the next one is.
+func (rp *Republisher) republishDue(ctx context.Context) time.Duration {
+	entries, err := rp.entries()
+	if err != nil {
+		log.Error("republisher failed to list names: ", err)
+		return rp.Interval
+	}
+
+	now := time.Now()
+	for name, e := range entries {
+		rp.lk.Lock()
+		due, ok := rp.due[name]
+		rp.lk.Unlock()
+		if ok && now.Before(due) {
+			continue
+		}
+
+		if err := rp.republish(ctx, name, e); err != nil {
+			log.Errorf("republishing %s: %s", name, err)
+		}
+		if ctx.Err() != nil {
+			return 0
+		}
+		rp.lk.Lock()
+		rp.due[name] = time.Now().Add(rp.period(e))
+		rp.lk.Unlock()
+	}
+
+	return rp.nextDue(time.Now())
+}
+
+// nextDue returns how long after now the next name is due, at most
+// Interval.
+func (rp *Republisher) nextDue(now time.Time) time.Duration {
+	rp.lk.Lock()
+	defer rp.lk.Unlock()
+
+	wait := rp.Interval
+	for _, due := range rp.due {
+		d := due.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		if d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// republish re-signs the record currently stored for name with a new EOL.
+func (rp *Republisher) republish(ctx context.Context, name key.Key, e *entry) error {
+	if rp.getKey == nil {
+		return errors.New("republisher has no key lookup")
+	}
+	priv, err := rp.getKey(name)
+	if err != nil {
+		return err
+	}
+
+	current, err := rp.currentEntry(name)
+	if err != nil {
+		return err
+	}
+
+	lifetime := e.Lifetime
+	if lifetime <= 0 {
+		lifetime = rp.RecordLifetime
+	}
+	ttl := e.TTL
+	if ttl <= 0 {
+		ttl = time.Duration(current.GetTtl())
+	}
+
+	log.Debugf("republishing %s -> %s", name, current.GetValue())
+	return rp.pub.PublishWithEOL(ctx, priv, path.Path(current.GetValue()), time.Now().Add(lifetime), ttl)
+}
+
+// currentEntry returns the last record published for name, as the
+// publisher keeps it in the datastore.
+func (rp *Republisher) currentEntry(name key.Key) (*pb.IpnsEntry, error) {
+	return namesys.GetPublishedEntry(rp.dstore, name)
+}
+
+func (rp *Republisher) entries() (map[key.Key]*entry, error) {
+	out := make(map[key.Key]*entry)
+	rp.lk.Lock()
+	for name := range rp.names {
+		out[name] = new(entry)
+	}
+	rp.lk.Unlock()
+
+	res, err := rp.dstore.Query(dsq.Query{Prefix: publishedPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+
+		b, ok := r.Value.([]byte)
+		if !ok {
+			continue
+		}
+		e := new(entry)
+		if err := json.Unmarshal(b, e); err != nil {
+			log.Warningf("bad republisher entry %s: %s", r.Key, err)
+			continue
+		}
+		out[key.B58KeyDecode(ds.NewKey(r.Key).BaseNamespace())] = e
+	}
+	return out, nil
+}
+
+func (rp *Republisher) remember(name key.Key, e *entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return rp.dstore.Put(publishedKey(name), b)
+}
+
+func publishedKey(name key.Key) ds.Key {
+	return publishedPrefix.ChildString(name.B58String())
+}
@@ -0,0 +1,109 @@
+package republisher
+
+import (
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	path "github.com/ipfs/go-ipfs/path"
+	offroute "github.com/ipfs/go-ipfs/routing/offline"
+	u "github.com/ipfs/go-ipfs/util"
+	testutil "github.com/ipfs/go-ipfs/util/testutil"
+)
+
+func setupRepublisher(t *testing.T, dstore ds.Datastore) (*Republisher, ci.PrivKey, key.Key) {
+	sk, pk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := pk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(h)
+
+	ns := namesys.NewNameSystem(offroute.NewOfflineRouter(dstore, sk), dstore, nil, 0)
+	rp := NewRepublisher(ns, dstore, func(k key.Key) (ci.PrivKey, error) {
+		if k != name {
+			t.Fatalf("asked for the key of unknown name %s", k)
+		}
+		return sk, nil
+	})
+	return rp, sk, name
+}
+
+func TestRepublish(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	rp, sk, name := setupRepublisher(t, dstore)
+
+	p := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	if err := rp.Publish(ctx, sk, p, time.Minute, time.Second*30); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := rp.currentEntry(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstEOL, err := u.ParseRFC3339(string(first.GetValidity()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.GetTtl() != uint64(time.Second*30) {
+		t.Fatalf("expected ttl of 30s, got %d", first.GetTtl())
+	}
+
+	// a minute long record is due halfway through its lifetime, and
+	// not republished before
+	if wait := rp.nextDue(time.Now()); wait > time.Second*30 || wait < time.Second*29 {
+		t.Fatalf("expected the name to be due in 30s, got %s", wait)
+	}
+	rp.republishDue(ctx)
+	if e, err := rp.currentEntry(name); err != nil || e.GetSequence() != first.GetSequence() {
+		t.Fatalf("expected the record not to be republished yet: %v", err)
+	}
+
+	// a new republisher on the same datastore knows the name
+	rp2, _, _ := setupRepublisher(t, dstore)
+	rp2.getKey = rp.getKey
+	names, err := rp2.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != name {
+		t.Fatalf("expected %s to be remembered, got %v", name, names)
+	}
+
+	rp2.republishDue(ctx)
+
+	second, err := rp.currentEntry(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondEOL, err := u.ParseRFC3339(string(second.GetValidity()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secondEOL.After(firstEOL) {
+		t.Fatalf("expected republished record to live longer: %s, %s", firstEOL, secondEOL)
+	}
+	if second.GetSequence() != first.GetSequence()+1 {
+		t.Fatalf("expected sequence %d, got %d", first.GetSequence()+1, second.GetSequence())
+	}
+	if string(second.GetValue()) != string(p) || second.GetTtl() != first.GetTtl() {
+		t.Fatal("republished record changed value or ttl")
+	}
+
+	if err := rp2.Forget(name); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := rp.Names(); len(names) != 0 {
+		t.Fatalf("expected no names after forgetting, got %v", names)
+	}
+}
@@ -1,29 +1,47 @@
 package namesys
 
 import (
+	"errors"
 	"testing"
+	"time"
 
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	key "github.com/ipfs/go-ipfs/blocks/key"
+	pb "github.com/ipfs/go-ipfs/namesys/pb"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
 	path "github.com/ipfs/go-ipfs/path"
+	routing "github.com/ipfs/go-ipfs/routing"
 	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
 	u "github.com/ipfs/go-ipfs/util"
 	testutil "github.com/ipfs/go-ipfs/util/testutil"
 )
 
 func TestRoutingResolve(t *testing.T) {
-	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
-
-	resolver := NewRoutingResolver(d)
-	publisher := NewRoutingPublisher(d)
-
 	privk, pubk, err := testutil.RandTestKeyPair(512)
 	if err != nil {
 		t.Fatal(err)
 	}
+	testRoutingResolve(t, privk, pubk)
+}
+
+func TestRoutingResolveEd25519(t *testing.T) {
+	privk, pubk, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRoutingResolve(t, privk, pubk)
+}
+
+func testRoutingResolve(t *testing.T, privk ci.PrivKey, pubk ci.PubKey) {
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+
+	resolver := NewRoutingResolver(d)
+	publisher := NewRoutingPublisher(d, ds.NewMapDatastore())
 
 	h := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
-	err = publisher.Publish(context.Background(), privk, h)
+	err := publisher.Publish(context.Background(), privk, h)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -43,3 +61,186 @@ func TestRoutingResolve(t *testing.T) {
 		t.Fatal("Got back incorrect value.")
 	}
 }
+
+func TestPublishSequence(t *testing.T) {
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+
+	resolver := NewRoutingResolver(d)
+	publisher := NewRoutingPublisher(d, ds.NewMapDatastore())
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkb, err := pubk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhash := u.Hash(pubkb)
+
+	paths := []path.Path{
+		path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN"),
+		path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"),
+	}
+	for i, h := range paths {
+		if err := publisher.Publish(context.Background(), privk, h); err != nil {
+			t.Fatal(err)
+		}
+
+		val, err := d.GetValue(context.Background(), key.Key("/ipns/"+string(pkhash)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := new(pb.IpnsEntry)
+		if err := proto.Unmarshal(val, entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.GetSequence() != uint64(i) {
+			t.Fatalf("expected sequence %d, got %d", i, entry.GetSequence())
+		}
+
+		res, err := resolver.Resolve(context.Background(), key.Key(pkhash).Pretty())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != h {
+			t.Fatalf("expected %s, got %s", h, res)
+		}
+	}
+}
+
+// failingRouting fails every lookup with err.
+type failingRouting struct {
+	routing.IpfsRouting
+	err error
+}
+
+func (r *failingRouting) GetValue(context.Context, key.Key) ([]byte, error) {
+	return nil, r.err
+}
+
+func TestPublishSequenceLookupFailure(t *testing.T) {
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	dstore := ds.NewMapDatastore()
+	h := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkb, err := pubk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(u.Hash(pubkb))
+
+	publisher := NewRoutingPublisher(d, dstore)
+	for i := 0; i < 2; i++ {
+		if err := publisher.Publish(context.Background(), privk, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a failed lookup must not restart the sequence
+	failing := NewRoutingPublisher(&failingRouting{d, errors.New("timeout")}, dstore)
+	if err := failing.Publish(context.Background(), privk, h); err == nil {
+		t.Fatal("expected publish to fail when the lookup fails")
+	}
+
+	// records that routing lost are still counted
+	lost := NewRoutingPublisher(&failingRouting{d, routing.ErrNotFound}, dstore)
+	if err := lost.Publish(context.Background(), privk, h); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := GetPublishedEntry(dstore, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.GetSequence() != 2 {
+		t.Fatalf("expected sequence 2, got %d", entry.GetSequence())
+	}
+}
+
+func TestIpnsSelector(t *testing.T) {
+	privk, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+
+	var vals [][]byte
+	for _, seq := range []uint64{1, 3, 2} {
+		data, err := createRoutingEntryData(privk, h, seq, time.Now().Add(time.Hour), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vals = append(vals, data)
+	}
+	vals = append(vals, []byte("not an entry"))
+
+	i, err := IpnsSelectorFunc(key.Key("/ipns/foo"), vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != 1 {
+		t.Fatalf("expected the highest sequence to win, got %d", i)
+	}
+
+	// with equal sequences, the later EOL wins
+	eol := func(d time.Duration) []byte {
+		typ := pb.IpnsEntry_EOL
+		data, err := proto.Marshal(&pb.IpnsEntry{
+			Value:        []byte(h),
+			Signature:    []byte("sig"),
+			ValidityType: &typ,
+			Validity:     []byte(u.FormatRFC3339(time.Now().Add(d))),
+			Sequence:     proto.Uint64(5),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	i, err = IpnsSelectorFunc(key.Key("/ipns/foo"), [][]byte{eol(time.Hour), eol(time.Hour * 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != 1 {
+		t.Fatalf("expected the later EOL to win, got %d", i)
+	}
+
+	if _, err := IpnsSelectorFunc(key.Key("/ipns/foo"), [][]byte{[]byte("junk")}); err == nil {
+		t.Fatal("expected an error with no usable records")
+	}
+}
+
+func TestRecordTTL(t *testing.T) {
+	privk, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	eol := time.Now().Add(time.Hour)
+
+	check := func(ttl time.Duration, min, max time.Duration) {
+		data, err := createRoutingEntryData(privk, val, 1, eol, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := new(pb.IpnsEntry)
+		if err := proto.Unmarshal(data, entry); err != nil {
+			t.Fatal(err)
+		}
+		got := recordTTL(entry)
+		if got < min || got > max {
+			t.Fatalf("ttl %s: got %s, expected between %s and %s", ttl, got, min, max)
+		}
+	}
+
+	// no ttl in the record
+	check(0, DefaultResolverCacheTTL, DefaultResolverCacheTTL)
+	// the record's own ttl
+	check(time.Second*30, time.Second*30, time.Second*30)
+	// never past the end of life
+	check(time.Hour*5, time.Minute*59, time.Hour)
+}
@@ -2,6 +2,7 @@ package namesys
 
 import (
 	"fmt"
+	"time"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
@@ -11,6 +12,7 @@ import (
 	pb "github.com/ipfs/go-ipfs/namesys/pb"
 	path "github.com/ipfs/go-ipfs/path"
 	routing "github.com/ipfs/go-ipfs/routing"
+	u "github.com/ipfs/go-ipfs/util"
 	logging "github.com/ipfs/go-ipfs/vendor/go-log-v1.0.0"
 )
 
@@ -19,6 +21,9 @@ var log = logging.Logger("namesys")
 // routingResolver implements NSResolver for the main IPFS SFS-like naming
 type routingResolver struct {
 	routing routing.IpfsRouting
+
+	// noSuccessor caches the names found to have no successor
+	noSuccessor *nameCache
 }
 
 // NewRoutingResolver constructs a name resolver using the IPFS Routing system
@@ -28,7 +33,7 @@ func NewRoutingResolver(route routing.IpfsRouting) Resolver {
 		panic("attempt to create resolver with nil routing system")
 	}
 
-	return &routingResolver{routing: route}
+	return &routingResolver{routing: route, noSuccessor: newNameCache(DefaultResolverCacheSize)}
 }
 
 // newRoutingResolver returns a resolver instead of a Resolver.
@@ -37,7 +42,7 @@ func newRoutingResolver(route routing.IpfsRouting) resolver {
 		panic("attempt to create resolver with nil routing system")
 	}
 
-	return &routingResolver{routing: route}
+	return &routingResolver{routing: route, noSuccessor: newNameCache(DefaultResolverCacheSize)}
 }
 
 // Resolve implements Resolver.
@@ -52,15 +57,51 @@ func (r *routingResolver) ResolveN(ctx context.Context, name string, depth int)
 
 // resolveOnce implements resolver. Uses the IPFS routing system to
 // resolve SFS-like names.
-func (r *routingResolver) resolveOnce(ctx context.Context, name string) (path.Path, error) {
+func (r *routingResolver) resolveOnce(ctx context.Context, name string) (path.Path, time.Duration, error) {
 	log.Debugf("RoutingResolve: '%s'", name)
 	hash, err := mh.FromB58String(name)
 	if err != nil {
 		log.Warning("RoutingResolve: bad input hash: [%s]\n", name)
-		return "", err
+		return "", 0, err
 	}
 	// name should be a multihash. if it isn't, error out here.
 
+	p, ttl, err := r.resolveEntry(ctx, hash)
+	if err == nil {
+		return p, ttl, nil
+	}
+
+	// a retired key resolves through its successor once its own entry has
+	// expired or is gone. most keys are never retired, so only look then.
+	if next := r.successor(ctx, name, hash); next != "" {
+		log.Debugf("RoutingResolve: %s was succeeded by %s", name, next)
+		return next, DefaultResolverCacheTTL, nil
+	}
+	return "", 0, err
+}
+
+// successor returns the revealed successor of the key with multihash hash,
+// or "" if it has none. Names without one are remembered for
+// DefaultResolverCacheTTL, as long as an entry would be cached.
+func (r *routingResolver) successor(ctx context.Context, name string, hash mh.Multihash) path.Path {
+	if _, _, ok := r.noSuccessor.get(name); ok {
+		return ""
+	}
+
+	p, err := lookupSuccessor(ctx, r.routing, hash)
+	if err != nil {
+		log.Debugf("no successor for %s: %s", name, err)
+		if ctx.Err() == nil {
+			r.noSuccessor.set(name, "", DefaultResolverCacheTTL)
+		}
+		return ""
+	}
+	return p
+}
+
+// resolveEntry fetches and checks the ipns entry of the key with multihash
+// hash, returning the path it points to.
+func (r *routingResolver) resolveEntry(ctx context.Context, hash mh.Multihash) (path.Path, time.Duration, error) {
 	// use the routing system to get the name.
 	// /ipns/<name>
 	h := []byte("/ipns/" + string(hash))
@@ -69,19 +110,22 @@ func (r *routingResolver) resolveOnce(ctx context.Context, name string) (path.Pa
 	val, err := r.routing.GetValue(ctx, ipnsKey)
 	if err != nil {
 		log.Warning("RoutingResolve get failed.")
-		return "", err
+		return "", 0, err
 	}
 
 	entry := new(pb.IpnsEntry)
 	err = proto.Unmarshal(val, entry)
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+	if err := ValidateIpnsRecord(ipnsKey, val); err != nil {
+		return "", 0, err
 	}
 
 	// name should be a public key retrievable from ipfs
 	pubkey, err := routing.GetPublicKey(r.routing, ctx, hash)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	hsh, _ := pubkey.Hash()
@@ -89,11 +133,19 @@ func (r *routingResolver) resolveOnce(ctx context.Context, name string) (path.Pa
 
 	// check sig with pk
 	if ok, err := pubkey.Verify(ipnsEntryDataForSig(entry), entry.GetSignature()); err != nil || !ok {
-		return "", fmt.Errorf("Invalid value. Not signed by PrivateKey corresponding to %v", pubkey)
+		return "", 0, fmt.Errorf("Invalid value. Not signed by PrivateKey corresponding to %v", pubkey)
 	}
 
 	// ok sig checks out. this is a valid name.
+	p, err := entryValue(entry)
+	if err != nil {
+		return "", 0, err
+	}
+	return p, recordTTL(entry), nil
+}
 
+// entryValue returns the path an ipns entry points to.
+func entryValue(entry *pb.IpnsEntry) (path.Path, error) {
 	// check for old style record:
 	valh, err := mh.Cast(entry.GetValue())
 	if err != nil {
@@ -105,3 +157,23 @@ func (r *routingResolver) resolveOnce(ctx context.Context, name string) (path.Pa
 		return path.FromKey(key.Key(valh)), nil
 	}
 }
+
+// recordTTL returns how long the value of entry may be cached: its ttl if
+// it has one, but never past its end of life.
+func recordTTL(entry *pb.IpnsEntry) time.Duration {
+	ttl := DefaultResolverCacheTTL
+	if entry.Ttl != nil {
+		ttl = time.Duration(entry.GetTtl())
+	}
+
+	if entry.GetValidityType() == pb.IpnsEntry_EOL {
+		eol, err := u.ParseRFC3339(string(entry.GetValidity()))
+		if err != nil {
+			return 0
+		}
+		if left := eol.Sub(time.Now()); left < ttl {
+			ttl = left
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,262 @@
+package namesys
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	pb "github.com/ipfs/go-ipfs/namesys/pb"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	path "github.com/ipfs/go-ipfs/path"
+	routing "github.com/ipfs/go-ipfs/routing"
+	record "github.com/ipfs/go-ipfs/routing/record"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// ErrBadSuccession is returned for succession records that are malformed,
+// stored under the wrong key or not signed by the key they retire.
+var ErrBadSuccession = errors.New("invalid succession record")
+
+// ErrNotRevealed is returned when the successor of a key is committed to,
+// but not revealed yet.
+var ErrNotRevealed = errors.New("successor not revealed")
+
+// successionRecordPrefix is where the succession records published by this
+// node are kept, so that they can be republished.
+var successionRecordPrefix = ds.NewKey("/local/ipns/succession")
+
+// successionKey is where the successor of the key with multihash h is
+// stored in the routing system.
+func successionKey(h []byte) key.Key {
+	return key.Key("/succession/" + string(h))
+}
+
+// CreateSuccessionCommitment returns a succession record, signed by old,
+// committing to next as the key that will replace it without revealing
+// next. Publishing it ahead of a rotation means whoever later steals old
+// cannot name a successor of their own: a record naming another key
+// conflicts with the commitment, and is never picked.
+func CreateSuccessionCommitment(old ci.PrivKey, next ci.PubKey) ([]byte, error) {
+	return createSuccession(old, next, false)
+}
+
+// CreateSuccessionRecord returns a succession record, signed by old,
+// naming next as the key that replaces it.
+func CreateSuccessionRecord(old ci.PrivKey, next ci.PubKey) ([]byte, error) {
+	return createSuccession(old, next, true)
+}
+
+func createSuccession(old ci.PrivKey, next ci.PubKey, reveal bool) ([]byte, error) {
+	oldb, err := old.GetPublic().Bytes()
+	if err != nil {
+		return nil, err
+	}
+	nextb, err := next.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	nexth := []byte(u.Hash(nextb))
+
+	sig, err := old.Sign(successionDataForSig(nexth))
+	if err != nil {
+		return nil, err
+	}
+	rec := &pb.SuccessionRecord{
+		OldKey:      oldb,
+		NextKeyHash: nexth,
+		Signature:   sig,
+	}
+	if reveal {
+		rec.NewKey = nextb
+	}
+	return proto.Marshal(rec)
+}
+
+func successionDataForSig(nexth []byte) []byte {
+	return bytes.Join([][]byte{[]byte("succession:"), nexth}, nil)
+}
+
+// PublishCommitment publishes a commitment of old to its successor next,
+// see CreateSuccessionCommitment. The record is kept in dstore and
+// republished by RepublishSuccessions.
+func PublishCommitment(ctx context.Context, r routing.IpfsRouting, dstore ds.Datastore, old ci.PrivKey, next ci.PubKey) error {
+	data, err := CreateSuccessionCommitment(old, next)
+	if err != nil {
+		return err
+	}
+	return putSuccession(ctx, r, dstore, old.GetPublic(), data)
+}
+
+// PublishSuccession retires old in favor of next: the names of old resolve
+// through the names of next from then on. The public key of next is
+// published along with the record, so it can be resolved right away. The
+// record is kept in dstore and republished by RepublishSuccessions.
+//
+// If old committed to a successor, next must be that successor.
+func PublishSuccession(ctx context.Context, r routing.IpfsRouting, dstore ds.Datastore, old ci.PrivKey, next ci.PubKey) error {
+	data, err := CreateSuccessionRecord(old, next)
+	if err != nil {
+		return err
+	}
+	nextb, err := next.Bytes()
+	if err != nil {
+		return err
+	}
+
+	timectx, cancel := context.WithDeadline(ctx, time.Now().Add(time.Second*10))
+	defer cancel()
+	if err := r.PutValue(timectx, key.Key("/pk/"+string(u.Hash(nextb))), nextb); err != nil {
+		return err
+	}
+	return putSuccession(ctx, r, dstore, old.GetPublic(), data)
+}
+
+// putSuccession keeps the succession record data of old in dstore, then
+// puts it in the routing system.
+func putSuccession(ctx context.Context, r routing.IpfsRouting, dstore ds.Datastore, old ci.PubKey, data []byte) error {
+	h, err := old.Hash()
+	if err != nil {
+		return err
+	}
+	if err := dstore.Put(successionRecordPrefix.ChildString(key.Key(h).B58String()), data); err != nil {
+		return err
+	}
+
+	timectx, cancel := context.WithDeadline(ctx, time.Now().Add(time.Second*10))
+	defer cancel()
+	return r.PutValue(timectx, successionKey(h), data)
+}
+
+// RepublishSuccessions puts every succession record kept in dstore in the
+// routing system again, so that they outlive the records of the routing
+// system.
+func RepublishSuccessions(ctx context.Context, r routing.IpfsRouting, dstore ds.Datastore) error {
+	res, err := dstore.Query(dsq.Query{Prefix: successionRecordPrefix.String()})
+	if err != nil {
+		return err
+	}
+	for e := range res.Next() {
+		if e.Error != nil {
+			return e.Error
+		}
+		data, ok := e.Value.([]byte)
+		if !ok {
+			continue
+		}
+		h := key.B58KeyDecode(ds.NewKey(e.Key).BaseNamespace())
+
+		timectx, cancel := context.WithDeadline(ctx, time.Now().Add(time.Second*10))
+		err := r.PutValue(timectx, successionKey([]byte(h)), data)
+		cancel()
+		if err != nil {
+			log.Errorf("republishing the succession of %s: %s", h, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// SuccessionRecordValidator checks succession records in the routing
+// system. They are self-certifying, like public key records.
+var SuccessionRecordValidator = &record.ValidChecker{
+	Func: ValidateSuccessionRecord,
+	Sign: false,
+}
+
+// ValidateSuccessionRecord implements record.ValidatorFunc. It checks that
+// val is stored under the hash of the key it retires, signed by it, and
+// that the successor it reveals, if any, is the one it commits to.
+func ValidateSuccessionRecord(k key.Key, val []byte) error {
+	_, err := verifySuccession(k, val)
+	return err
+}
+
+// SuccessionSelectorFunc implements record.SelectorFunc. A key commits to
+// a single successor: valid records committing to different successors
+// are conflicting, and none of them is picked. Of the records agreeing on
+// the successor, one revealing it is preferred.
+func SuccessionSelectorFunc(k key.Key, vals [][]byte) (int, error) {
+	best := -1
+	var bestRec *pb.SuccessionRecord
+	for i, v := range vals {
+		rec, err := verifySuccession(k, v)
+		if err != nil {
+			continue
+		}
+		if bestRec == nil {
+			best, bestRec = i, rec
+			continue
+		}
+		if !bytes.Equal(rec.GetNextKeyHash(), bestRec.GetNextKeyHash()) {
+			return 0, record.ErrConflictingRecords
+		}
+		if bestRec.NewKey == nil && rec.NewKey != nil {
+			best, bestRec = i, rec
+		}
+	}
+	if best == -1 {
+		return 0, ErrBadSuccession
+	}
+	return best, nil
+}
+
+// verifySuccession checks the succession record val stored at k.
+func verifySuccession(k key.Key, val []byte) (*pb.SuccessionRecord, error) {
+	rec := new(pb.SuccessionRecord)
+	if err := proto.Unmarshal(val, rec); err != nil {
+		return nil, err
+	}
+	if successionKey(u.Hash(rec.GetOldKey())) != k {
+		return nil, ErrBadSuccession
+	}
+	if _, err := mh.Cast(rec.GetNextKeyHash()); err != nil {
+		return nil, ErrBadSuccession
+	}
+
+	old, err := ci.UnmarshalPublicKey(rec.GetOldKey())
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := old.Verify(successionDataForSig(rec.GetNextKeyHash()), rec.GetSignature()); err != nil || !ok {
+		return nil, ErrBadSuccession
+	}
+
+	if rec.NewKey != nil {
+		if _, err := ci.UnmarshalPublicKey(rec.GetNewKey()); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(u.Hash(rec.GetNewKey()), rec.GetNextKeyHash()) {
+			return nil, ErrBadSuccession
+		}
+	}
+	return rec, nil
+}
+
+// lookupSuccessor returns the name of the key that replaced the key with
+// multihash h, if it was retired. A key that only committed to its
+// successor is not retired yet.
+func lookupSuccessor(ctx context.Context, r routing.IpfsRouting, h mh.Multihash) (path.Path, error) {
+	k := successionKey(h)
+	val, err := r.GetValue(ctx, k)
+	if err != nil {
+		return "", err
+	}
+
+	rec, err := verifySuccession(k, val)
+	if err != nil {
+		return "", err
+	}
+	if rec.NewKey == nil {
+		return "", ErrNotRevealed
+	}
+	return path.FromString("/ipns/" + key.Key(rec.GetNextKeyHash()).B58String()), nil
+}
@@ -0,0 +1,301 @@
+package namesys
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	pb "github.com/ipfs/go-ipfs/namesys/pb"
+	path "github.com/ipfs/go-ipfs/path"
+	routing "github.com/ipfs/go-ipfs/routing"
+	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
+	record "github.com/ipfs/go-ipfs/routing/record"
+	testutil "github.com/ipfs/go-ipfs/util/testutil"
+)
+
+func TestSuccessionResolve(t *testing.T) {
+	ctx := context.Background()
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	ns := NewNameSystem(d, ds.NewMapDatastore(), nil, 0)
+
+	oldsk, oldpk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newsk, newpk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldh, err := oldpk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldName := "/ipns/" + key.Key(oldh).B58String()
+
+	p1 := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	p2 := path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+
+	if err := ns.Publish(ctx, oldsk, p1); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ns.Resolve(ctx, oldName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != p1 {
+		t.Fatalf("resolved %s, expected %s", res, p1)
+	}
+
+	dstore := ds.NewMapDatastore()
+	if err := PublishCommitment(ctx, d, dstore, oldsk, newpk); err != nil {
+		t.Fatal(err)
+	}
+
+	// a commitment alone does not retire the key
+	res, err = ns.Resolve(ctx, oldName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != p1 {
+		t.Fatalf("resolved %s before the successor was revealed, expected %s", res, p1)
+	}
+
+	if err := PublishSuccession(ctx, d, dstore, oldsk, newpk); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Publish(ctx, newsk, p2); err != nil {
+		t.Fatal(err)
+	}
+
+	// while the old key has a current record, it is used
+	res, err = ns.Resolve(ctx, oldName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != p1 {
+		t.Fatalf("resolved %s while the old record is current, expected %s", res, p1)
+	}
+
+	// once it expires, the successor takes over
+	if err := ns.PublishWithEOL(ctx, oldsk, p1, time.Now().Add(time.Millisecond*50), 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	res, err = ns.Resolve(ctx, oldName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != p2 {
+		t.Fatalf("resolved %s, expected the successor's %s", res, p2)
+	}
+}
+
+func TestValidateSuccessionRecord(t *testing.T) {
+	oldsk, oldpk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	othersk, otherpk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldh, err := oldpk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherh, err := otherpk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := successionKey(oldh)
+
+	data, err := CreateSuccessionRecord(oldsk, otherpk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSuccessionRecord(k, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// stored under another key
+	if err := ValidateSuccessionRecord(successionKey(otherh), data); err != ErrBadSuccession {
+		t.Fatalf("expected ErrBadSuccession, got %v", err)
+	}
+
+	// claiming to be signed by the old key, but signed by another
+	forged, err := CreateSuccessionRecord(othersk, otherpk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := new(pb.SuccessionRecord)
+	if err := proto.Unmarshal(forged, rec); err != nil {
+		t.Fatal(err)
+	}
+	rec.OldKey, err = oldpk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err = proto.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSuccessionRecord(k, forged); err != ErrBadSuccession {
+		t.Fatalf("expected ErrBadSuccession, got %v", err)
+	}
+
+	// revealing a successor other than the one committed to
+	_, thirdpk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thirdb, err := thirdpk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = new(pb.SuccessionRecord)
+	if err := proto.Unmarshal(data, rec); err != nil {
+		t.Fatal(err)
+	}
+	rec.NewKey = thirdb
+	swapped, err := proto.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSuccessionRecord(k, swapped); err != ErrBadSuccession {
+		t.Fatalf("expected ErrBadSuccession, got %v", err)
+	}
+
+	// the selector skips invalid records and prefers the revealed record
+	commit, err := CreateSuccessionCommitment(oldsk, otherpk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSuccessionRecord(k, commit); err != nil {
+		t.Fatal(err)
+	}
+	best, err := SuccessionSelectorFunc(k, [][]byte{forged, commit, data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best != 2 {
+		t.Fatalf("selected record %d, expected the revealed record", best)
+	}
+
+	// whoever holds the old key cannot pick another successor once one
+	// is committed to, whatever record they craft
+	data2, err := CreateSuccessionRecord(oldsk, thirdpk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SuccessionSelectorFunc(k, [][]byte{commit, data2}); err != record.ErrConflictingRecords {
+		t.Fatalf("expected record.ErrConflictingRecords, got %v", err)
+	}
+}
+
+// slowSuccessionRouting never finds succession records, and takes until
+// the lookup is cancelled to say so.
+type slowSuccessionRouting struct {
+	routing.IpfsRouting
+}
+
+func (r *slowSuccessionRouting) GetValue(ctx context.Context, k key.Key) ([]byte, error) {
+	if strings.HasPrefix(string(k), "/succession/") {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return r.IpfsRouting.GetValue(ctx, k)
+}
+
+func TestSuccessionLookupDoesNotDelayResolve(t *testing.T) {
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	ns := NewNameSystem(&slowSuccessionRouting{d}, ds.NewMapDatastore(), nil, 0)
+
+	sk, pk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := pk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	if err := ns.Publish(context.Background(), sk, p); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	res, err := ns.Resolve(ctx, "/ipns/"+key.Key(h).B58String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != p {
+		t.Fatalf("resolved %s, expected %s", res, p)
+	}
+}
+
+// countingRouting counts the lookups of succession records.
+type countingRouting struct {
+	routing.IpfsRouting
+	lookups int32
+}
+
+func (r *countingRouting) GetValue(ctx context.Context, k key.Key) ([]byte, error) {
+	if strings.HasPrefix(string(k), "/succession/") {
+		atomic.AddInt32(&r.lookups, 1)
+	}
+	return r.IpfsRouting.GetValue(ctx, k)
+}
+
+func TestSuccessionLookups(t *testing.T) {
+	ctx := context.Background()
+	cr := &countingRouting{IpfsRouting: mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))}
+	ns := NewNameSystem(cr, ds.NewMapDatastore(), nil, 0)
+
+	sk, pk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := pk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "/ipns/" + key.Key(h).B58String()
+
+	// a name with a current record needs no succession lookup
+	p := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	if err := ns.Publish(ctx, sk, p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ns.Resolve(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&cr.lookups); n != 0 {
+		t.Fatalf("expected no succession lookups, got %d", n)
+	}
+
+	// a missing name is looked up once, then known to have no successor
+	_, otherpk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherh, err := otherpk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := "/ipns/" + key.Key(otherh).B58String()
+	for i := 0; i < 2; i++ {
+		if _, err := ns.Resolve(ctx, missing); err == nil {
+			t.Fatal("resolved a name without records")
+		}
+	}
+	if n := atomic.LoadInt32(&cr.lookups); n != 1 {
+		t.Fatalf("expected 1 succession lookup, got %d", n)
+	}
+}
@@ -0,0 +1,129 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+)
+
+const FetchProgressKey = "FetchProgressEvent"
+
+type FetchEventType int
+
+const (
+	WantedBlock FetchEventType = iota
+	FindingProviders
+	FoundProvider
+	SentWantlist
+	ReceivedBlock
+	FetchedNode
+)
+
+var fetchEventNames = map[FetchEventType]string{
+	WantedBlock:      "wanted",
+	FindingProviders: "finding-providers",
+	FoundProvider:    "found-provider",
+	SentWantlist:     "sent-wantlist",
+	ReceivedBlock:    "received",
+	FetchedNode:      "fetched",
+}
+
+func (t FetchEventType) String() string {
+	if s, ok := fetchEventNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown(%d)", int(t))
+}
+
+// FetchEvent describes a single step in retrieving a block from the
+// network. Peer is only set for events that involve a remote peer.
+type FetchEvent struct {
+	Type FetchEventType
+	Key  key.Key
+	Peer peer.ID
+	Time time.Time
+}
+
+func (fe *FetchEvent) String() string {
+	s := fmt.Sprintf("%s %-17s %s", fe.Time.Format("15:04:05.000"), fe.Type, fe.Key.B58String())
+	if fe.Peer != "" {
+		s += " " + fe.Peer.Pretty()
+	}
+	return s
+}
+
+func RegisterForFetchEvents(ctx context.Context, ch chan<- *FetchEvent) context.Context {
+	return context.WithValue(ctx, FetchProgressKey, ch)
+}
+
+// WantsFetchEvents returns whether anyone registered for fetch events on the
+// given context.
+func WantsFetchEvents(ctx context.Context) bool {
+	_, ok := ctx.Value(FetchProgressKey).(chan<- *FetchEvent)
+	return ok
+}
+
+// PublishFetchEvent sends ev to the channel registered on ctx. It is called
+// from the exchange's message handling, so it never blocks: the event is
+// dropped if the subscriber's buffer is full. Subscribers should not keep
+// state derived from the events alone; the exchange can tell what is still
+// outstanding, see bitswap.InspectFetch.
+func PublishFetchEvent(ctx context.Context, ev *FetchEvent) {
+	ich := ctx.Value(FetchProgressKey)
+	if ich == nil {
+		return
+	}
+
+	ch, ok := ich.(chan<- *FetchEvent)
+	if !ok {
+		return
+	}
+
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	select {
+	case ch <- ev:
+	default:
+	}
+}
+
+func (fe *FetchEvent) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{})
+	out["Type"] = int(fe.Type)
+	out["Key"] = fe.Key.B58String()
+	if fe.Peer != "" {
+		out["Peer"] = peer.IDB58Encode(fe.Peer)
+	}
+	out["Time"] = fe.Time
+	return json.Marshal(out)
+}
+
+func (fe *FetchEvent) UnmarshalJSON(b []byte) error {
+	temp := struct {
+		Type int
+		Key  string
+		Peer string
+		Time time.Time
+	}{}
+	err := json.Unmarshal(b, &temp)
+	if err != nil {
+		return err
+	}
+	if len(temp.Peer) > 0 {
+		pid, err := peer.IDB58Decode(temp.Peer)
+		if err != nil {
+			return err
+		}
+		fe.Peer = pid
+	}
+	fe.Type = FetchEventType(temp.Type)
+	fe.Key = key.B58KeyDecode(temp.Key)
+	fe.Time = temp.Time
+	return nil
+}
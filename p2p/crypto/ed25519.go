@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	ed25519 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/crypto/ed25519"
+
+	pb "github.com/ipfs/go-ipfs/p2p/crypto/pb"
+)
+
+// ErrEncryptionNotSupported is returned by keys that can only sign.
+var ErrEncryptionNotSupported = errors.New("key type does not support encryption")
+
+type Ed25519PrivateKey struct {
+	k ed25519.PrivateKey
+}
+
+type Ed25519PublicKey struct {
+	k ed25519.PublicKey
+}
+
+func (pk *Ed25519PublicKey) Verify(data, sig []byte) (bool, error) {
+	if !ed25519.Verify(pk.k, data, sig) {
+		return false, errors.New("invalid ed25519 signature")
+	}
+	return true, nil
+}
+
+func (pk *Ed25519PublicKey) Bytes() ([]byte, error) {
+	pbmes := new(pb.PublicKey)
+	typ := pb.KeyType_Ed25519
+	pbmes.Type = &typ
+	pbmes.Data = []byte(pk.k)
+	return proto.Marshal(pbmes)
+}
+
+// Encrypt is not supported, ed25519 keys can only sign.
+func (pk *Ed25519PublicKey) Encrypt(b []byte) ([]byte, error) {
+	return nil, ErrEncryptionNotSupported
+}
+
+// Equals checks whether this key is equal to another
+func (pk *Ed25519PublicKey) Equals(k Key) bool {
+	return KeyEqual(pk, k)
+}
+
+func (pk *Ed25519PublicKey) Hash() ([]byte, error) {
+	return KeyHash(pk)
+}
+
+func (sk *Ed25519PrivateKey) GenSecret() []byte {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return buf
+}
+
+func (sk *Ed25519PrivateKey) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(sk.k, message), nil
+}
+
+func (sk *Ed25519PrivateKey) GetPublic() PubKey {
+	return &Ed25519PublicKey{sk.k.Public().(ed25519.PublicKey)}
+}
+
+// Decrypt is not supported, ed25519 keys can only sign.
+func (sk *Ed25519PrivateKey) Decrypt(b []byte) ([]byte, error) {
+	return nil, ErrEncryptionNotSupported
+}
+
+func (sk *Ed25519PrivateKey) Bytes() ([]byte, error) {
+	pbmes := new(pb.PrivateKey)
+	typ := pb.KeyType_Ed25519
+	pbmes.Type = &typ
+	pbmes.Data = []byte(sk.k)
+	return proto.Marshal(pbmes)
+}
+
+// Equals checks whether this key is equal to another
+func (sk *Ed25519PrivateKey) Equals(k Key) bool {
+	return KeyEqual(sk, k)
+}
+
+func (sk *Ed25519PrivateKey) Hash() ([]byte, error) {
+	return KeyHash(sk)
+}
+
+// UnmarshalEd25519PrivateKey reads a private key in the 64 byte form of
+// the ed25519 package, the seed followed by the public key.
+func UnmarshalEd25519PrivateKey(b []byte) (*Ed25519PrivateKey, error) {
+	if len(b) != ed25519.PrivateKeySize {
+		return nil, errors.New("ed25519 private key has the wrong size")
+	}
+	k := ed25519.NewKeyFromSeed(b[:ed25519.SeedSize])
+	if !bytes.Equal(k, b) {
+		return nil, errors.New("ed25519 private key does not match its public key")
+	}
+	return &Ed25519PrivateKey{k}, nil
+}
+
+func UnmarshalEd25519PublicKey(b []byte) (*Ed25519PublicKey, error) {
+	if len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("ed25519 public key has the wrong size")
+	}
+	return &Ed25519PublicKey{ed25519.PublicKey(append([]byte(nil), b...))}, nil
+}
@@ -1,6 +1,6 @@
 // package crypto implements various cryptographic utilities used by ipfs.
-// This includes a Public and Private key interface and an RSA key implementation
-// that satisfies it.
+// This includes a Public and Private key interface and RSA and Ed25519 key
+// implementations that satisfy it.
 package crypto
 
 import (
@@ -20,6 +20,7 @@ import (
 	"hash"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	ed25519 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/crypto/ed25519"
 
 	pb "github.com/ipfs/go-ipfs/p2p/crypto/pb"
 	u "github.com/ipfs/go-ipfs/util"
@@ -32,8 +33,15 @@ var ErrBadKeyType = errors.New("invalid or unsupported key type")
 
 const (
 	RSA = iota
+	Ed25519
 )
 
+// KeyTypes maps the names of the supported key types to their values.
+var KeyTypes = map[string]int{
+	"rsa":     RSA,
+	"ed25519": Ed25519,
+}
+
 // Key represents a crypto key that can be compared to another key
 type Key interface {
 	// Bytes returns a serialized, storeable representation of this key
@@ -80,7 +88,8 @@ func GenerateKeyPair(typ, bits int) (PrivKey, PubKey, error) {
 	return GenerateKeyPairWithReader(typ, bits, rand.Reader)
 }
 
-// Generates a keypair of the given type and bitsize
+// Generates a keypair of the given type and bitsize. Ed25519 keys have a
+// fixed size, bits is ignored for them.
 func GenerateKeyPairWithReader(typ, bits int, src io.Reader) (PrivKey, PubKey, error) {
 	switch typ {
 	case RSA:
@@ -90,6 +99,12 @@ func GenerateKeyPairWithReader(typ, bits int, src io.Reader) (PrivKey, PubKey, e
 		}
 		pk := &priv.PublicKey
 		return &RsaPrivateKey{sk: priv}, &RsaPublicKey{pk}, nil
+	case Ed25519:
+		pub, priv, err := ed25519.GenerateKey(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &Ed25519PrivateKey{priv}, &Ed25519PublicKey{pub}, nil
 	default:
 		return nil, nil, ErrBadKeyType
 	}
@@ -239,6 +254,8 @@ func UnmarshalPublicKey(data []byte) (PubKey, error) {
 	switch pmes.GetType() {
 	case pb.KeyType_RSA:
 		return UnmarshalRsaPublicKey(pmes.GetData())
+	case pb.KeyType_Ed25519:
+		return UnmarshalEd25519PublicKey(pmes.GetData())
 	default:
 		return nil, ErrBadKeyType
 	}
@@ -247,15 +264,7 @@ func UnmarshalPublicKey(data []byte) (PubKey, error) {
 // MarshalPublicKey converts a public key object into a protobuf serialized
 // public key
 func MarshalPublicKey(k PubKey) ([]byte, error) {
-	b, err := MarshalRsaPublicKey(k.(*RsaPublicKey))
-	if err != nil {
-		return nil, err
-	}
-	pmes := new(pb.PublicKey)
-	typ := pb.KeyType_RSA // for now only type.
-	pmes.Type = &typ
-	pmes.Data = b
-	return proto.Marshal(pmes)
+	return k.Bytes()
 }
 
 // UnmarshalPrivateKey converts a protobuf serialized private key into its
@@ -270,6 +279,8 @@ func UnmarshalPrivateKey(data []byte) (PrivKey, error) {
 	switch pmes.GetType() {
 	case pb.KeyType_RSA:
 		return UnmarshalRsaPrivateKey(pmes.GetData())
+	case pb.KeyType_Ed25519:
+		return UnmarshalEd25519PrivateKey(pmes.GetData())
 	default:
 		return nil, ErrBadKeyType
 	}
@@ -277,12 +288,7 @@ func UnmarshalPrivateKey(data []byte) (PrivKey, error) {
 
 // MarshalPrivateKey converts a key object into its protobuf serialized form.
 func MarshalPrivateKey(k PrivKey) ([]byte, error) {
-	b := MarshalRsaPrivateKey(k.(*RsaPrivateKey))
-	pmes := new(pb.PrivateKey)
-	typ := pb.KeyType_RSA // for now only type.
-	pmes.Type = &typ
-	pmes.Data = b
-	return proto.Marshal(pmes)
+	return k.Bytes()
 }
 
 // ConfigDecodeKey decodes from b64 (for config file), and unmarshals.
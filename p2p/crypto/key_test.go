@@ -19,6 +19,28 @@ func TestRsaKeys(t *testing.T) {
 	testKeyEquals(t, pk)
 }
 
+func TestEd25519Keys(t *testing.T) {
+	sk, pk, err := GenerateKeyPair(Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKeySignature(t, sk)
+	testKeyEncoding(t, sk)
+	testKeyEquals(t, sk)
+	testKeyEquals(t, pk)
+
+	sig, err := sk.Sign([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := pk.Verify([]byte("hellp"), sig); ok {
+		t.Fatal("signature verified for different data")
+	}
+	if _, err := pk.Encrypt([]byte("hello")); err != ErrEncryptionNotSupported {
+		t.Fatalf("expected ErrEncryptionNotSupported, got %v", err)
+	}
+}
+
 func testKeySignature(t *testing.T, sk PrivKey) {
 	pk := sk.GetPublic()
 
@@ -0,0 +1,93 @@
+package secio
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+)
+
+func newGenerator(t *testing.T, typ, bits int) *SessionGenerator {
+	sk, _, err := ci.GenerateKeyPair(typ, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SessionGenerator{LocalID: id, PrivateKey: sk}
+}
+
+// connPair returns both ends of a loopback tcp connection.
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- c
+	}()
+	a, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, <-accepted
+}
+
+func testHandshake(t *testing.T, ga, gb *SessionGenerator) {
+	ctx := context.Background()
+	ca, cb := connPair(t)
+	defer ca.Close()
+	defer cb.Close()
+
+	sa, err := ga.NewSession(ctx, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, err := gb.NewSession(ctx, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("hello over secio")
+	errs := make(chan error, 1)
+	go func() {
+		errs <- sa.ReadWriter().WriteMsg(msg)
+	}()
+	got, err := sb.ReadWriter().ReadMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("read %q, expected %q", got, msg)
+	}
+
+	if sa.RemotePeer() != gb.LocalID || sb.RemotePeer() != ga.LocalID {
+		t.Fatal("the sessions do not know the remote peers")
+	}
+	if !sb.RemotePublicKey().Equals(ga.PrivateKey.GetPublic()) {
+		t.Fatal("the remote public key is not the peer's")
+	}
+}
+
+func TestHandshakeEd25519(t *testing.T) {
+	testHandshake(t, newGenerator(t, ci.Ed25519, 0), newGenerator(t, ci.Ed25519, 0))
+}
+
+func TestHandshakeMixedKeys(t *testing.T) {
+	testHandshake(t, newGenerator(t, ci.Ed25519, 0), newGenerator(t, ci.RSA, 1024))
+}
@@ -2,4 +2,11 @@ package config
 
 type API struct {
 	HTTPHeaders map[string][]string // HTTP headers to return with the API.
+
+	// RequireToken makes the API refuse requests without a valid token, see
+	// 'ipfs api token'.
+	RequireToken bool
+
+	// TLS serves the API over HTTPS.
+	TLS TLS
 }
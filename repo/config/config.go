@@ -30,6 +30,10 @@ type Config struct {
 	API              API                   // local node's API settings
 	Swarm            SwarmConfig
 	Log              Log
+	Reprovider       Reprovider // local node's reprovider settings
+	Routing          Routing    // local node's routing settings
+	Ipns             Ipns       // local node's ipns settings
+	DNS              DNS        // local node's dns link resolution settings
 }
 
 const (
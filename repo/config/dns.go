@@ -0,0 +1,8 @@
+package config
+
+type DNS struct {
+	// Resolvers maps domain suffixes, such as "eth" or "." for all domains,
+	// to the resolver used for them: a DNS-over-HTTPS url starting with
+	// https:// or a nameserver address. Other domains use the system resolver.
+	Resolvers map[string]string
+}
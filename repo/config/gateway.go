@@ -5,4 +5,35 @@ type Gateway struct {
 	HTTPHeaders  map[string][]string // HTTP headers to return with the gateway
 	RootRedirect string
 	Writable     bool
+
+	// SubdomainHost, if set, is the domain the gateway serves content from
+	// in subdomain mode, as <hash>.ipfs.<SubdomainHost> and
+	// <name>.ipns.<SubdomainHost>. Each gets its own browser origin.
+	SubdomainHost string
+
+	// DenylistFile names a file of hashes and paths the gateway refuses to
+	// serve. Relative paths are relative to the repo. See
+	// 'ipfs gateway denylist'.
+	DenylistFile string
+
+	// CacheSize bounds, in bytes, the decoded nodes the gateway keeps
+	// between requests. Zero uses a default, a negative size disables the
+	// cache.
+	CacheSize int
+
+	// MimeTypes maps file extensions, like ".md", to the content type the
+	// gateway serves them as. It overrides the system's types, but not the
+	// type in a file's unixfs metadata.
+	MimeTypes map[string]string
+
+	// AccessLog names a file the gateway appends a line to for each request.
+	// Relative paths are relative to the repo. Empty disables the log.
+	AccessLog string
+
+	// AccessLogFormat is "common", the Common Log Format, or "json".
+	AccessLogFormat string
+
+	// TLS serves the gateway over HTTPS. With ACME.DNSLinkDomains, it gets
+	// certificates for the websites it serves by their DNSLink.
+	TLS TLS
 }
@@ -1,24 +1,143 @@
 package config
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"errors"
+	"fmt"
+
+	pbkdf2 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/crypto/pbkdf2"
 	ic "github.com/ipfs/go-ipfs/p2p/crypto"
 )
 
+// ErrPassphraseRequired is returned when decoding an encrypted private key
+// without a passphrase.
+var ErrPassphraseRequired = errors.New("private key is encrypted, a passphrase is required")
+
+// ErrBadPassphrase is returned when an encrypted private key does not
+// decrypt with the passphrase given.
+var ErrBadPassphrase = errors.New("wrong passphrase for private key")
+
 // Identity tracks the configuration of the local node's identity.
 type Identity struct {
 	PeerID  string
-	PrivKey string
+	PrivKey string `json:",omitempty"`
+
+	// EncryptedPrivKey holds the private key instead of PrivKey when it is
+	// encrypted with a passphrase.
+	EncryptedPrivKey *EncryptedKey `json:",omitempty"`
+}
+
+// EncryptedKey is a private key encrypted with AES-256-GCM, under a key
+// derived from a passphrase with PBKDF2-SHA256.
+type EncryptedKey struct {
+	Iterations int
+	Salt       []byte
+	Nonce      []byte
+	Data       []byte
 }
 
-// DecodePrivateKey is a helper to decode the users PrivateKey
+// kdfIterations is the number of PBKDF2 iterations newly encrypted keys
+// use. Each key records its own, so it can be raised later.
+const kdfIterations = 600000
+
+// Encrypted reports whether the private key is encrypted.
+func (i *Identity) Encrypted() bool {
+	return i.EncryptedPrivKey != nil
+}
+
+// DecodePrivateKey is a helper to decode the users PrivateKey. The
+// passphrase is only used if the key is encrypted.
 func (i *Identity) DecodePrivateKey(passphrase string) (ic.PrivKey, error) {
+	if i.Encrypted() {
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		pkb, err := i.EncryptedPrivKey.decrypt(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return ic.UnmarshalPrivateKey(pkb)
+	}
+
 	pkb, err := base64.StdEncoding.DecodeString(i.PrivKey)
 	if err != nil {
 		return nil, err
 	}
-
-	// currently storing key unencrypted. in the future we need to encrypt it.
-	// TODO(security)
 	return ic.UnmarshalPrivateKey(pkb)
 }
+
+// SetPrivateKey stores sk as the identity key, encrypted with passphrase
+// unless it is empty. It does not change the PeerID.
+func (i *Identity) SetPrivateKey(sk ic.PrivKey, passphrase string) error {
+	skb, err := sk.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if passphrase == "" {
+		i.PrivKey = base64.StdEncoding.EncodeToString(skb)
+		i.EncryptedPrivKey = nil
+		return nil
+	}
+
+	ek, err := encryptKey(skb, passphrase)
+	if err != nil {
+		return err
+	}
+	i.PrivKey = ""
+	i.EncryptedPrivKey = ek
+	return nil
+}
+
+func encryptKey(data []byte, passphrase string) (*EncryptedKey, error) {
+	ek := &EncryptedKey{
+		Iterations: kdfIterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(ek.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := ek.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	ek.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(ek.Nonce); err != nil {
+		return nil, err
+	}
+	ek.Data = aead.Seal(nil, ek.Nonce, data, nil)
+	return ek, nil
+}
+
+func (ek *EncryptedKey) decrypt(passphrase string) ([]byte, error) {
+	aead, err := ek.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(ek.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted key has a bad nonce size %d", len(ek.Nonce))
+	}
+
+	data, err := aead.Open(nil, ek.Nonce, ek.Data, nil)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return data, nil
+}
+
+func (ek *EncryptedKey) aead(passphrase string) (cipher.AEAD, error) {
+	if ek.Iterations <= 0 {
+		return nil, errors.New("encrypted key has no kdf iterations")
+	}
+	k := pbkdf2.Key([]byte(passphrase), ek.Salt, ek.Iterations, 32, sha256.New)
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
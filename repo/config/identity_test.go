@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+)
+
+func TestEncryptedPrivKey(t *testing.T) {
+	sk, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ident Identity
+	if err := ident.SetPrivateKey(sk, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if !ident.Encrypted() || ident.PrivKey != "" {
+		t.Fatal("key was not encrypted")
+	}
+
+	// survives a trip through the config file
+	data, err := json.Marshal(&ident)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"PrivKey"`) {
+		t.Fatalf("encrypted identity has a plain key: %s", data)
+	}
+	var loaded Identity
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loaded.DecodePrivateKey(""); err != ErrPassphraseRequired {
+		t.Fatalf("expected ErrPassphraseRequired, got %v", err)
+	}
+	if _, err := loaded.DecodePrivateKey("hunter3"); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+	out, err := loaded.DecodePrivateKey("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Equals(sk) {
+		t.Fatal("decrypted a different key")
+	}
+
+	// and can be stored unencrypted again
+	if err := loaded.SetPrivateKey(out, ""); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Encrypted() {
+		t.Fatal("key is still encrypted")
+	}
+	out, err = loaded.DecodePrivateKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Equals(sk) {
+		t.Fatal("decoded a different key")
+	}
+}
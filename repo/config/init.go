@@ -1,7 +1,6 @@
 package config
 
 import (
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -11,12 +10,18 @@ import (
 )
 
 func Init(out io.Writer, nBitsForKeypair int) (*Config, error) {
+	return InitWithKeyType(out, ci.RSA, nBitsForKeypair)
+}
+
+// InitWithKeyType is like Init, but generates an identity key of the given
+// type. The size in bits only applies to RSA keys.
+func InitWithKeyType(out io.Writer, keyType int, nBitsForKeypair int) (*Config, error) {
 	ds, err := datastoreConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	identity, err := identityConfig(out, nBitsForKeypair)
+	identity, err := identityConfig(out, keyType, nBitsForKeypair)
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +77,26 @@ func Init(out io.Writer, nBitsForKeypair int) (*Config, error) {
 			RootRedirect: "",
 			Writable:     false,
 		},
+
+		Reprovider: Reprovider{
+			Interval: "12h",
+			Strategy: "all",
+		},
+
+		Routing: Routing{
+			Type: "dht",
+		},
+
+		Ipns: Ipns{
+			RepublishPeriod: "4h",
+			RecordLifetime:  "24h",
+
+			ResolveCacheSize: 128,
+		},
+
+		DNS: DNS{
+			Resolvers: map[string]string{},
+		},
 	}
 
 	return conf, nil
@@ -89,27 +114,31 @@ func datastoreConfig() (*Datastore, error) {
 }
 
 // identityConfig initializes a new identity.
-func identityConfig(out io.Writer, nbits int) (Identity, error) {
+func identityConfig(out io.Writer, keyType int, nbits int) (Identity, error) {
 	// TODO guard higher up
 	ident := Identity{}
-	if nbits < 1024 {
-		return ident, errors.New("Bitsize less than 1024 is considered unsafe.")
+	switch keyType {
+	case ci.RSA:
+		if nbits < 1024 {
+			return ident, errors.New("Bitsize less than 1024 is considered unsafe.")
+		}
+		fmt.Fprintf(out, "generating %v-bit RSA keypair...", nbits)
+	case ci.Ed25519:
+		fmt.Fprintf(out, "generating ed25519 keypair...")
+	default:
+		return ident, ci.ErrBadKeyType
 	}
 
-	fmt.Fprintf(out, "generating %v-bit RSA keypair...", nbits)
-	sk, pk, err := ci.GenerateKeyPair(ci.RSA, nbits)
+	sk, pk, err := ci.GenerateKeyPair(keyType, nbits)
 	if err != nil {
 		return ident, err
 	}
 	fmt.Fprintf(out, "done\n")
 
-	// currently storing key unencrypted. in the future we need to encrypt it.
-	// TODO(security)
-	skbytes, err := sk.Bytes()
-	if err != nil {
+	// stored unencrypted, see Identity.SetPrivateKey to encrypt it
+	if err := ident.SetPrivateKey(sk, ""); err != nil {
 		return ident, err
 	}
-	ident.PrivKey = base64.StdEncoding.EncodeToString(skbytes)
 
 	id, err := peer.IDFromPublicKey(pk)
 	if err != nil {
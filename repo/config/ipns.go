@@ -0,0 +1,10 @@
+package config
+
+type Ipns struct {
+	RepublishPeriod string // Longest time between republishes of the names published by this node
+	RecordLifetime  string // Lifetime of republished records, for names published without one
+
+	ResolveCacheSize int // Number of resolved names to cache, negative to disable the cache
+
+	Push bool // Push published records to subscribed peers, and take in the records of subscribed names
+}
@@ -0,0 +1,7 @@
+package config
+
+type Reprovider struct {
+	Interval  string // Time period to reprovide locally stored objects to the network
+	Strategy  string // Which keys to announce: "all", "pinned" or "roots"
+	RateLimit int    // Maximum number of provides per second, 0 for no limit
+}
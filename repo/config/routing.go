@@ -0,0 +1,17 @@
+package config
+
+// Routing defines configuration options for libp2p routing
+type Routing struct {
+	// Type sets default daemon routing mode: "dht", "dhtclient" or
+	// "supernode".
+	Type string
+
+	// Alpha is the number of concurrent requests per DHT lookup path.
+	// Zero uses the DHT default.
+	Alpha int
+
+	// DisjointPaths is the number of disjoint paths each DHT lookup is
+	// split into. Results found on different paths are cross-checked.
+	// Zero uses the DHT default.
+	DisjointPaths int
+}
@@ -0,0 +1,46 @@
+package config
+
+// TLS configures serving HTTP over TLS. It is on if CertFile or
+// ACME.DirectoryURL is set.
+type TLS struct {
+	// CertFile and KeyFile name PEM files with a certificate chain and its
+	// key. Relative paths are relative to the repo.
+	CertFile string
+	KeyFile  string
+
+	// ACME gets certificates from an ACME server, for names clients ask for
+	// with SNI.
+	ACME ACME
+}
+
+// ACME configures getting certificates from an ACME server, like Let's
+// Encrypt. The server must reach the listener on the port it validates
+// tls-alpn-01 challenges on, 443 by default.
+type ACME struct {
+	// DirectoryURL is the URL of the server's directory.
+	DirectoryURL string
+
+	// Email is the contact for the account.
+	Email string
+
+	// Domains lists the names to get certificates for.
+	Domains []string
+
+	// DNSLinkDomains also gets certificates for these domains and their
+	// subdomains, when they have a DNSLink record to content this node has,
+	// which the gateway serves as websites.
+	DNSLinkDomains []string
+
+	// CACertFile names a PEM file of the CAs to trust for the ACME server
+	// itself, for servers like pebble with their own CA.
+	CACertFile string
+
+	// CacheDir keeps the account key and certificates. Relative paths are
+	// relative to the repo. The default is "acme".
+	CacheDir string
+}
+
+// Enabled returns whether t turns TLS on.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.ACME.DirectoryURL != ""
+}
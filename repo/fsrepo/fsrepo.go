@@ -16,6 +16,7 @@ import (
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/measure"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/mount"
 	ldbopts "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb/opt"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	repo "github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/common"
 	config "github.com/ipfs/go-ipfs/repo/config"
@@ -56,9 +57,10 @@ func (err NoRepoError) Error() string {
 }
 
 const (
-	leveldbDirectory = "datastore"
-	flatfsDirectory  = "blocks"
-	apiFile          = "api"
+	leveldbDirectory  = "datastore"
+	flatfsDirectory   = "blocks"
+	keystoreDirectory = "keystore"
+	apiFile           = "api"
 )
 
 var (
@@ -94,6 +96,7 @@ type FSRepo struct {
 	lockfile io.Closer
 	config   *config.Config
 	ds       ds.ThreadSafeDatastore
+	keys     keystore.Keystore
 }
 
 var _ repo.Repo = (*FSRepo)(nil)
@@ -159,6 +162,10 @@ func open(repoPath string) (repo.Repo, error) {
 		return nil, err
 	}
 
+	if err := r.openKeystore(); err != nil {
+		return nil, err
+	}
+
 	// setup eventlogger
 	configureEventLoggerAtRepoPath(r.config, r.path)
 
@@ -261,6 +268,10 @@ func Init(repoPath string, conf *config.Config) error {
 		return fmt.Errorf("datastore: %s", err)
 	}
 
+	if err := dir.Writable(path.Join(repoPath, keystoreDirectory)); err != nil {
+		return err
+	}
+
 	if err := dir.Writable(path.Join(repoPath, "logs")); err != nil {
 		return err
 	}
@@ -343,6 +354,17 @@ func (r *FSRepo) openConfig() error {
 	return nil
 }
 
+// openKeystore opens the keystore directory of the repo, creating it if
+// it does not exist.
+func (r *FSRepo) openKeystore() error {
+	ks, err := keystore.NewFSKeystore(path.Join(r.path, keystoreDirectory))
+	if err != nil {
+		return err
+	}
+	r.keys = ks
+	return nil
+}
+
 // openDatastore returns an error if the config file is not present.
 func (r *FSRepo) openDatastore() error {
 	leveldbPath := path.Join(r.path, leveldbDirectory)
@@ -589,6 +611,15 @@ func (r *FSRepo) Datastore() ds.ThreadSafeDatastore {
 	return d
 }
 
+// Keystore returns the repo's keystore. If FSRepo is Closed, return value
+// is undefined.
+func (r *FSRepo) Keystore() keystore.Keystore {
+	packageLock.Lock()
+	k := r.keys
+	packageLock.Unlock()
+	return k
+}
+
 var _ io.Closer = &FSRepo{}
 var _ repo.Repo = &FSRepo{}
 
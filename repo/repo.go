@@ -6,6 +6,7 @@ import (
 
 	datastore "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	config "github.com/ipfs/go-ipfs/repo/config"
 )
 
@@ -22,6 +23,9 @@ type Repo interface {
 
 	Datastore() datastore.ThreadSafeDatastore
 
+	// Keystore returns the named private keys kept in the repo.
+	Keystore() keystore.Keystore
+
 	// SetAPIAddr sets the API address in the repo.
 	SetAPIAddr(addr string) error
 
@@ -54,6 +54,15 @@ type IpfsDHT struct {
 	diaglock sync.Mutex // lock to make diagnostics work better
 
 	Validator record.Validator // record validator funcs
+	Selector  record.Selector  // record selection funcs
+
+	// clientOnly is set when this dht issues queries but does not serve
+	// ProtocolDHT to other peers
+	clientOnly bool
+
+	// query parameters, zero selects AlphaValue and DisjointPaths
+	alpha int
+	paths int
 
 	ctx  context.Context
 	proc goprocess.Process
@@ -61,6 +70,21 @@ type IpfsDHT struct {
 
 // NewDHT creates a new DHT object with the given peer as the 'local' host
 func NewDHT(ctx context.Context, h host.Host, dstore ds.ThreadSafeDatastore) *IpfsDHT {
+	dht := makeDHT(ctx, h, dstore)
+	h.SetStreamHandler(ProtocolDHT, dht.handleNewStream)
+	return dht
+}
+
+// NewDHTClient creates a new DHT object with the given peer as the 'local'
+// host. The returned dht issues queries and provides values, but does not
+// serve ProtocolDHT, so other peers will not add it to their routing tables.
+func NewDHTClient(ctx context.Context, h host.Host, dstore ds.ThreadSafeDatastore) *IpfsDHT {
+	dht := makeDHT(ctx, h, dstore)
+	dht.clientOnly = true
+	return dht
+}
+
+func makeDHT(ctx context.Context, h host.Host, dstore ds.ThreadSafeDatastore) *IpfsDHT {
 	dht := new(IpfsDHT)
 	dht.datastore = dstore
 	dht.self = h.ID()
@@ -78,8 +102,7 @@ func NewDHT(ctx context.Context, h host.Host, dstore ds.ThreadSafeDatastore) *Ip
 
 	dht.ctx = ctx
 
-	h.SetStreamHandler(ProtocolDHT, dht.handleNewStream)
-	dht.providers = NewProviderManager(dht.ctx, dht.self)
+	dht.providers = NewProviderManager(dht.ctx, dht.self, dstore)
 	dht.proc.AddChild(dht.providers.proc)
 	goprocessctx.CloseAfterContext(dht.proc, ctx)
 
@@ -89,9 +112,46 @@ func NewDHT(ctx context.Context, h host.Host, dstore ds.ThreadSafeDatastore) *Ip
 	dht.Validator = make(record.Validator)
 	dht.Validator["pk"] = record.PublicKeyValidator
 
+	dht.Selector = make(record.Selector)
+	dht.Selector["pk"] = record.PublicKeySelector
+
 	return dht
 }
 
+// ClientOnly returns whether this dht only issues queries, without serving
+// ProtocolDHT.
+func (dht *IpfsDHT) ClientOnly() bool {
+	return dht.clientOnly
+}
+
+// SetQueryParams sets the number of concurrent requests per lookup path and
+// the number of disjoint paths each query is split into. Zero values select
+// AlphaValue and DisjointPaths. It must be called before the dht is used.
+func (dht *IpfsDHT) SetQueryParams(alpha, paths int) {
+	dht.alpha = alpha
+	dht.paths = paths
+}
+
+func (dht *IpfsDHT) queryAlpha() int {
+	if dht.alpha > 0 {
+		return dht.alpha
+	}
+	return AlphaValue
+}
+
+func (dht *IpfsDHT) queryPaths() int {
+	if dht.paths > 0 {
+		return dht.paths
+	}
+	return DisjointPaths
+}
+
+// querySeeds is the number of peers from the routing table a query starts
+// with, enough to give every path alpha peers.
+func (dht *IpfsDHT) querySeeds() int {
+	return dht.queryAlpha() * dht.queryPaths()
+}
+
 // LocalPeer returns the peer.Peer of the dht.
 func (dht *IpfsDHT) LocalPeer() peer.ID {
 	return dht.self
@@ -147,18 +207,20 @@ func (dht *IpfsDHT) putProvider(ctx context.Context, p peer.ID, skey string) err
 	return nil
 }
 
-// getValueOrPeers queries a particular peer p for the value for
-// key. It returns either the value or a list of closer peers.
-// NOTE: it will update the dht's peerstore with any new addresses
-// it finds for the given peer.
+// getValueOrPeers queries a particular peer p for the record for
+// key. It returns the record, if the peer has one, and the closer peers it
+// sent back.
 func (dht *IpfsDHT) getValueOrPeers(ctx context.Context, p peer.ID,
-	key key.Key) ([]byte, []peer.PeerInfo, error) {
+	key key.Key) (*pb.Record, []peer.PeerInfo, error) {
 
 	pmes, err := dht.getValueSingle(ctx, p, key)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// Perhaps we were given closer peers
+	peers := pb.PBPeersToPeerInfos(pmes.GetCloserPeers())
+
 	if record := pmes.GetRecord(); record != nil {
 		// Success! We were given the value
 		log.Debug("getValueOrPeers: got value")
@@ -169,11 +231,9 @@ func (dht *IpfsDHT) getValueOrPeers(ctx context.Context, p peer.ID,
 			log.Info("Received invalid record! (discarded)")
 			return nil, nil, err
 		}
-		return record.GetValue(), nil, nil
+		return record, peers, nil
 	}
 
-	// Perhaps we were given closer peers
-	peers := pb.PBPeersToPeerInfos(pmes.GetCloserPeers())
 	if len(peers) > 0 {
 		log.Debug("getValueOrPeers: peers")
 		return nil, peers, nil
@@ -194,8 +254,17 @@ func (dht *IpfsDHT) getValueSingle(ctx context.Context, p peer.ID,
 
 // getLocal attempts to retrieve the value from the datastore
 func (dht *IpfsDHT) getLocal(key key.Key) ([]byte, error) {
+	rec, err := dht.getLocalRecord(key)
+	if err != nil {
+		return nil, err
+	}
+	return rec.GetValue(), nil
+}
 
-	log.Debug("getLocal %s", key)
+// getLocalRecord attempts to retrieve the record from the datastore
+func (dht *IpfsDHT) getLocalRecord(key key.Key) (*pb.Record, error) {
+
+	log.Debugf("getLocal %s", key)
 	v, err := dht.datastore.Get(key.DsKey())
 	if err != nil {
 		return nil, err
@@ -221,7 +290,7 @@ func (dht *IpfsDHT) getLocal(key key.Key) ([]byte, error) {
 		}
 	}
 
-	return rec.GetValue(), nil
+	return rec, nil
 }
 
 // getOwnPrivateKey attempts to load the local peers private
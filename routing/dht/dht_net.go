@@ -34,8 +34,9 @@ func (dht *IpfsDHT) handleNewMessage(s inet.Stream) {
 		return
 	}
 
-	// update the peer (on valid msgs only)
-	dht.updateFromMessage(ctx, mPeer, pmes)
+	// update the peer (on valid msgs only). clients querying us do not
+	// belong in the routing table.
+	dht.updateIfServesDHT(ctx, s.Conn())
 
 	// get handler for this msg type.
 	handler := dht.handlerForMsgType(pmes.GetType())
@@ -806,3 +806,44 @@ func TestConnectCollision(t *testing.T) {
 		dhtB.host.Close()
 	}
 }
+
+func TestClientModeConnect(t *testing.T) {
+	ctx := context.Background()
+
+	server := setupDHT(ctx, t)
+	client := NewDHTClient(ctx, netutil.GenHostSwarm(t, ctx), dssync.MutexWrap(ds.NewMapDatastore()))
+	defer func() {
+		for _, d := range []*IpfsDHT{server, client} {
+			d.Close()
+			defer d.host.Close()
+		}
+	}()
+
+	addrs := server.peerstore.Addrs(server.self)
+	client.peerstore.AddAddrs(server.self, addrs, peer.TempAddrTTL)
+	if err := client.host.Connect(ctx, peer.PeerInfo{ID: server.self}); err != nil {
+		t.Fatal(err)
+	}
+
+	for client.routingTable.Find(server.self) == "" {
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	k := key.Key("TestClientModeConnect")
+	server.providers.AddProvider(ctx, k, server.self)
+
+	ctxT, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	provs, err := client.FindProviders(ctxT, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provs) != 1 || provs[0].ID != server.self {
+		t.Fatalf("expected %s as the only provider, got %v", server.self, provs)
+	}
+
+	// the client queried the server, but must not be in its routing table
+	if server.routingTable.Find(client.self) != "" {
+		t.Fatal("client-only dht was added to the server's routing table")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
@@ -290,3 +291,312 @@ func TestLessThanKResponses(t *testing.T) {
 	}
 	t.Fatal("Expected to recieve an error.")
 }
+
+func TestDisjointPathsCrossCheck(t *testing.T) {
+	ctx := context.Background()
+	mn, err := mocknet.FullMeshConnected(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	tsds := dssync.MutexWrap(ds.NewMapDatastore())
+	d := NewDHT(ctx, hosts[0], tsds)
+	d.SetQueryParams(1, 3)
+	d.Validator["v"] = &record.ValidChecker{
+		Func: func(key.Key, []byte) error {
+			return nil
+		},
+		Sign: false,
+	}
+	// the liar's value would win if it were not cross-checked
+	d.Selector["v"] = func(_ key.Key, vals [][]byte) (int, error) {
+		for i, v := range vals {
+			if string(v) == "bad" {
+				return i, nil
+			}
+		}
+		return 0, nil
+	}
+
+	for i := 1; i < 4; i++ {
+		d.Update(ctx, hosts[i].ID())
+	}
+
+	k := key.Key("/v/hello")
+	sk, err := d.getOwnPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	makeRec := func(val string) *pb.Record {
+		rec, err := record.MakePutRecord(sk, k, []byte(val), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+	bad, good := makeRec("bad"), makeRec("good")
+
+	// hosts[1] lies on its path, hosts[2] and hosts[3] lead to the honest
+	// hosts[4:]. hosts[5] is reachable from both but must only be queried
+	// by one path.
+	var lk sync.Mutex
+	queried := make(map[peer.ID]int)
+	for i, host := range hosts[1:] {
+		i, host := i+1, host // shadow loop vars
+		host.SetStreamHandler(ProtocolDHT, func(s inet.Stream) {
+			defer s.Close()
+
+			pbr := ggio.NewDelimitedReader(s, inet.MessageSizeMax)
+			pbw := ggio.NewDelimitedWriter(s)
+
+			// paths still running once the others agree are cancelled,
+			// closing their streams early.
+			pmes := new(pb.Message)
+			if err := pbr.ReadMsg(pmes); err != nil {
+				return
+			}
+
+			// outdated records are corrected with a PUT_VALUE
+			if pmes.GetType() != pb.Message_GET_VALUE {
+				pbw.WriteMsg(pmes)
+				return
+			}
+
+			lk.Lock()
+			queried[host.ID()]++
+			lk.Unlock()
+
+			resp := &pb.Message{Type: pmes.Type}
+			switch i {
+			case 1:
+				resp.Record = bad
+			case 2, 3:
+				var ps []peer.PeerInfo
+				for _, h := range hosts[i+2 : i+4] {
+					ps = append(ps, host.Peerstore().PeerInfo(h.ID()))
+				}
+				resp.CloserPeers = pb.PeerInfosToPBPeers(d.host.Network(), ps)
+			default:
+				resp.Record = good
+			}
+			pbw.WriteMsg(resp)
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	val, err := d.GetValue(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "good" {
+		t.Fatalf("expected the value agreed on by most paths, got %q", val)
+	}
+
+	lk.Lock()
+	defer lk.Unlock()
+	for p, n := range queried {
+		if n > 1 {
+			t.Fatalf("peer %s was queried by %d paths", p, n)
+		}
+	}
+}
+
+func TestCrossCheck(t *testing.T) {
+	a := &dhtQueryResult{value: []byte("a"), success: true}
+	b := &dhtQueryResult{value: []byte("b"), success: true}
+	b2 := &dhtQueryResult{value: []byte("b"), success: true}
+
+	best, agree, distinct := crossCheck([]*dhtQueryResult{a, b, b2})
+	if string(best.value) != "b" || agree != 2 || distinct != 2 {
+		t.Fatalf("got %v %d %d", best, agree, distinct)
+	}
+
+	if best, _, _ := crossCheck(nil); best != nil {
+		t.Fatal("expected no result from no paths")
+	}
+}
+
+func TestGetValueSelectsBest(t *testing.T) {
+	ctx := context.Background()
+	mn, err := mocknet.FullMeshConnected(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	tsds := dssync.MutexWrap(ds.NewMapDatastore())
+	d := NewDHT(ctx, hosts[0], tsds)
+	d.Validator["v"] = &record.ValidChecker{
+		Func: func(key.Key, []byte) error {
+			return nil
+		},
+		Sign: false,
+	}
+	// the highest value is the newest
+	d.Selector["v"] = func(_ key.Key, vals [][]byte) (int, error) {
+		best := 0
+		for i, v := range vals {
+			if string(v) > string(vals[best]) {
+				best = i
+			}
+		}
+		return best, nil
+	}
+
+	for i := 1; i < 4; i++ {
+		d.Update(ctx, hosts[i].ID())
+	}
+
+	k := key.Key("/v/hello")
+	sk, err := d.getOwnPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := record.MakePutRecord(sk, k, []byte("1"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := record.MakePutRecord(sk, k, []byte("2"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// our own copy is stale as well
+	if err := d.putLocal(k, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	corrected := make(chan peer.ID, 3)
+	for i, host := range hosts[1:] {
+		i, host := i+1, host // shadow loop vars
+		host.SetStreamHandler(ProtocolDHT, func(s inet.Stream) {
+			defer s.Close()
+
+			pbr := ggio.NewDelimitedReader(s, inet.MessageSizeMax)
+			pbw := ggio.NewDelimitedWriter(s)
+
+			pmes := new(pb.Message)
+			if err := pbr.ReadMsg(pmes); err != nil {
+				return
+			}
+
+			switch pmes.GetType() {
+			case pb.Message_GET_VALUE:
+				resp := &pb.Message{Type: pmes.Type, Record: stale}
+				if i == 3 {
+					resp.Record = fresh
+				}
+				pbw.WriteMsg(resp)
+			case pb.Message_PUT_VALUE:
+				if string(pmes.GetRecord().GetValue()) == "2" {
+					corrected <- host.ID()
+				}
+				pbw.WriteMsg(pmes)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	val, err := d.GetValue(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "2" {
+		t.Fatalf("expected the newest value, got %q", val)
+	}
+
+	// the peers holding the stale record are sent the fresh one
+	seen := make(map[peer.ID]bool)
+	for len(seen) < 2 {
+		select {
+		case p := <-corrected:
+			if p == hosts[3].ID() {
+				t.Fatal("peer with the fresh record should not be corrected")
+			}
+			seen[p] = true
+		case <-ctx.Done():
+			t.Fatalf("only %d of 2 outdated peers corrected", len(seen))
+		}
+	}
+
+	local, err := d.getLocal(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(local) != "2" {
+		t.Fatalf("expected local record to be replaced, got %q", local)
+	}
+}
+
+func TestGetValueCollectTimeout(t *testing.T) {
+	defer func(d time.Duration) { valueCollectTimeout = d }(valueCollectTimeout)
+	valueCollectTimeout = time.Millisecond * 100
+
+	ctx := context.Background()
+	mn, err := mocknet.FullMeshConnected(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	tsds := dssync.MutexWrap(ds.NewMapDatastore())
+	d := NewDHT(ctx, hosts[0], tsds)
+	d.Validator["v"] = &record.ValidChecker{
+		Func: func(key.Key, []byte) error {
+			return nil
+		},
+		Sign: false,
+	}
+	for i := 1; i < 4; i++ {
+		d.Update(ctx, hosts[i].ID())
+	}
+
+	k := key.Key("/v/hello")
+	sk, err := d.getOwnPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := record.MakePutRecord(sk, k, []byte("world"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one peer answers right away, the others take far longer
+	release := make(chan struct{})
+	defer close(release)
+	for i, host := range hosts[1:] {
+		i := i + 1 // shadow loop var
+		host.SetStreamHandler(ProtocolDHT, func(s inet.Stream) {
+			defer s.Close()
+
+			pbr := ggio.NewDelimitedReader(s, inet.MessageSizeMax)
+			pbw := ggio.NewDelimitedWriter(s)
+
+			pmes := new(pb.Message)
+			if err := pbr.ReadMsg(pmes); err != nil {
+				return
+			}
+			if i != 1 {
+				<-release
+			}
+			pbw.WriteMsg(&pb.Message{Type: pmes.Type, Record: rec})
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	start := time.Now()
+	val, err := d.GetValue(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "world" {
+		t.Fatalf("got %q", val)
+	}
+	if took := time.Since(start); took > time.Second*2 {
+		t.Fatalf("lookup took %s after the first value was found", took)
+	}
+}
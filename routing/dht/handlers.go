@@ -1,6 +1,7 @@
 package dht
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 
@@ -10,6 +11,7 @@ import (
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	pb "github.com/ipfs/go-ipfs/routing/dht/pb"
+	record "github.com/ipfs/go-ipfs/routing/record"
 	lgbl "github.com/ipfs/go-ipfs/util/eventlog/loggables"
 )
 
@@ -112,6 +114,19 @@ func (dht *IpfsDHT) handlePutValue(ctx context.Context, p peer.ID, pmes *pb.Mess
 		return nil, err
 	}
 
+	// don't let an outdated record replace a better one we already have
+	k := key.Key(pmes.GetKey())
+	if old, err := dht.getLocalRecord(k); err == nil {
+		vals := [][]byte{pmes.GetRecord().GetValue(), old.GetValue()}
+		i, err := dht.Selector.BestRecord(k, vals)
+		if err == record.ErrConflictingRecords || (err == nil && i == 1 && !bytes.Equal(vals[0], vals[1])) {
+			log.Debugf("%s handlePutValue keeping better record for %s", dht.self, k)
+			resp := pb.NewMessage(pmes.GetType(), pmes.GetKey(), pmes.GetClusterLevel())
+			resp.Record = old
+			return resp, nil
+		}
+	}
+
 	data, err := proto.Marshal(pmes.GetRecord())
 	if err != nil {
 		return nil, err
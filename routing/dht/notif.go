@@ -2,8 +2,11 @@ package dht
 
 import (
 	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	identify "github.com/ipfs/go-ipfs/p2p/protocol/identify"
 )
 
 // netNotifiee defines methods to be used with the IpfsDHT
@@ -20,7 +23,8 @@ func (nn *netNotifiee) Connected(n inet.Network, v inet.Conn) {
 		return
 	default:
 	}
-	dht.Update(dht.Context(), v.RemotePeer())
+
+	dht.updateIfServesDHT(dht.Context(), v)
 }
 
 func (nn *netNotifiee) Disconnected(n inet.Network, v inet.Conn) {
@@ -37,3 +41,69 @@ func (nn *netNotifiee) OpenedStream(n inet.Network, v inet.Stream) {}
 func (nn *netNotifiee) ClosedStream(n inet.Network, v inet.Stream) {}
 func (nn *netNotifiee) Listen(n inet.Network, a ma.Multiaddr)      {}
 func (nn *netNotifiee) ListenClose(n inet.Network, a ma.Multiaddr) {}
+
+type idServiceHost interface {
+	IDService() *identify.IDService
+}
+
+// updateIfServesDHT adds the remote peer of c to the routing table if it
+// serves the dht. Unless its protocols are known already, that waits for
+// identify, so it is checked in the background.
+func (dht *IpfsDHT) updateIfServesDHT(ctx context.Context, c inet.Conn) {
+	p := c.RemotePeer()
+	if protos, found := peerProtocols(dht, p); found {
+		if servesDHT(p, protos) {
+			dht.Update(ctx, p)
+		}
+		return
+	}
+
+	go func() {
+		if dht.peerServesDHT(c) {
+			dht.Update(dht.Context(), p)
+		}
+	}()
+}
+
+// peerServesDHT returns whether the remote peer of c announced ProtocolDHT
+// during identify, waiting for it if needed. Peers whose protocols are
+// unknown are assumed to serve it.
+func (dht *IpfsDHT) peerServesDHT(c inet.Conn) bool {
+	p := c.RemotePeer()
+	protos, found := peerProtocols(dht, p)
+	if !found {
+		if h, ok := dht.host.(idServiceHost); ok {
+			ids := h.IDService()
+			<-ids.IdentifyWait(c)
+			protos, found = peerProtocols(dht, p)
+			if !found {
+				// identify had not started on this conn yet
+				ids.IdentifyConn(c)
+				protos, found = peerProtocols(dht, p)
+			}
+		}
+	}
+	if !found {
+		return true
+	}
+	return servesDHT(p, protos)
+}
+
+func servesDHT(p peer.ID, protos []string) bool {
+	for _, proto := range protos {
+		if proto == string(ProtocolDHT) {
+			return true
+		}
+	}
+	log.Debugf("%s does not serve %s, not adding it to the routing table", p, ProtocolDHT)
+	return false
+}
+
+func peerProtocols(dht *IpfsDHT, p peer.ID) ([]string, bool) {
+	v, err := dht.peerstore.Get(p, "Protocols")
+	if err != nil {
+		return nil, false
+	}
+	protos, ok := v.([]string)
+	return protos, ok
+}
@@ -1,8 +1,15 @@
 package dht
 
 import (
+	"encoding/binary"
+	"fmt"
+	"strings"
 	"time"
 
+	lru "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/hashicorp/golang-lru"
+	base58 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-base58"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess"
 	goprocessctx "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess/context"
 	key "github.com/ipfs/go-ipfs/blocks/key"
@@ -11,18 +18,36 @@ import (
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
+// ProvideValidity is how long a provider record is kept after it was last
+// announced.
+var ProvideValidity = time.Hour * 24
+
+var defaultCleanupInterval = time.Hour
+
+// gcBatchSize bounds the number of expired provider records collected before
+// they are deleted.
+var gcBatchSize = 256
+
+// lruCacheSize is the number of keys whose provider sets are kept in memory.
+var lruCacheSize = 256
+
+var providersKeyPrefix = "/providers"
+
 type ProviderManager struct {
 	// all non channel fields are meant to be accessed only within
 	// the run method
-	providers map[key.Key]*providerSet
+	providers *lru.Cache
 	local     map[key.Key]struct{}
 	lpeer     peer.ID
+	dstore    ds.Datastore
 
 	getlocal chan chan []key.Key
 	newprovs chan *addProv
 	getprovs chan *getProv
 	period   time.Duration
 	proc     goprocess.Process
+
+	cleanupInterval time.Duration
 }
 
 type providerSet struct {
@@ -40,42 +65,216 @@ type getProv struct {
 	resp chan []peer.ID
 }
 
-func NewProviderManager(ctx context.Context, local peer.ID) *ProviderManager {
+// NewProviderManager returns a ProviderManager that persists provider records
+// in dstore, keeping the most recently used ones cached in memory.
+func NewProviderManager(ctx context.Context, local peer.ID, dstore ds.Datastore) *ProviderManager {
 	pm := new(ProviderManager)
 	pm.getprovs = make(chan *getProv)
 	pm.newprovs = make(chan *addProv)
-	pm.providers = make(map[key.Key]*providerSet)
+	pm.dstore = dstore
+	cache, err := lru.New(lruCacheSize)
+	if err != nil {
+		panic(err) //only happens if negative value is passed to lru constructor
+	}
+	pm.providers = cache
+	pm.lpeer = local
 	pm.getlocal = make(chan chan []key.Key)
 	pm.local = make(map[key.Key]struct{})
+	pm.cleanupInterval = defaultCleanupInterval
 	pm.proc = goprocessctx.WithContext(ctx)
 	pm.proc.Go(func(p goprocess.Process) { pm.run() })
 
 	return pm
 }
 
+func providerKeyPrefix(k key.Key) string {
+	return providersKeyPrefix + "/" + k.B58String()
+}
+
+func mkProvKey(k key.Key, p peer.ID) ds.Key {
+	return ds.NewKey(providerKeyPrefix(k) + "/" + base58.Encode([]byte(p)))
+}
+
+// queryPrefix queries dstore for the keys below prefix. A trailing slash on
+// prefix is dropped, as the mount datastore cleans query prefixes into keys
+// while leveldb matches them byte for byte, and keys that only start with
+// the same characters are filtered out.
+func queryPrefix(dstore ds.Datastore, prefix string) (dsq.Results, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	res, err := dstore.Query(dsq.Query{Prefix: prefix})
+	if err != nil {
+		return nil, err
+	}
+	return dsq.NaiveFilter(res, dsq.FilterKeyPrefix{Prefix: prefix + "/"}), nil
+}
+
+func (pm *ProviderManager) providersForKey(k key.Key) ([]peer.ID, error) {
+	pset, err := pm.getProvSet(k)
+	if err != nil {
+		return nil, err
+	}
+	// the set stays cached and changes, so callers get a copy
+	return append([]peer.ID(nil), pset.providers...), nil
+}
+
+func (pm *ProviderManager) getProvSet(k key.Key) (*providerSet, error) {
+	cached, ok := pm.providers.Get(k)
+	if ok {
+		return cached.(*providerSet), nil
+	}
+
+	pset, err := loadProvSet(pm.dstore, k)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pset.providers) > 0 {
+		pm.providers.Add(k, pset)
+	}
+
+	return pset, nil
+}
+
+func loadProvSet(dstore ds.Datastore, k key.Key) (*providerSet, error) {
+	res, err := queryPrefix(dstore, providerKeyPrefix(k))
+	if err != nil {
+		return nil, err
+	}
+
+	out := newProviderSet()
+	for e := range res.Next() {
+		if e.Error != nil {
+			log.Error("got an error: ", e.Error)
+			continue
+		}
+
+		parts := strings.Split(e.Key, "/")
+		if len(parts) != 4 {
+			log.Warningf("incorrectly formatted provider entry in datastore: %s", e.Key)
+			continue
+		}
+
+		t, err := readTimeValue(e.Value)
+		if err != nil {
+			log.Warning("parsing providers record from disk: ", err)
+			continue
+		}
+		if time.Now().Sub(t) > ProvideValidity {
+			continue
+		}
+
+		pid := base58.Decode(parts[3])
+		if len(pid) == 0 {
+			log.Warningf("decoding peer id from provider record: %s", e.Key)
+			continue
+		}
+
+		out.setVal(peer.ID(pid), t)
+	}
+
+	return out, nil
+}
+
+func readTimeValue(i interface{}) (time.Time, error) {
+	data, ok := i.([]byte)
+	if !ok {
+		return time.Time{}, fmt.Errorf("data was not a []byte")
+	}
+
+	nsec, n := binary.Varint(data)
+	if n <= 0 {
+		return time.Time{}, fmt.Errorf("failed to parse time")
+	}
+
+	return time.Unix(0, nsec), nil
+}
+
+func (pm *ProviderManager) addProv(k key.Key, p peer.ID) error {
+	provs, err := pm.getProvSet(k)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	provs.setVal(p, now)
+	pm.providers.Add(k, provs)
+
+	return writeProviderEntry(pm.dstore, k, p, now)
+}
+
+func writeProviderEntry(dstore ds.Datastore, k key.Key, p peer.ID, t time.Time) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(buf, t.UnixNano())
+	return dstore.Put(mkProvKey(k, p), buf[:n])
+}
+
+// deleteExpired removes every provider record older than ProvideValidity
+// from the datastore, gcBatchSize records at a time. It stops early when
+// closing is closed.
+func (pm *ProviderManager) deleteExpired(closing <-chan struct{}) error {
+	res, err := queryPrefix(pm.dstore, providersKeyPrefix)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	var expired []ds.Key
+	deleteBatch := func() error {
+		for _, k := range expired {
+			if err := pm.dstore.Delete(k); err != nil && err != ds.ErrNotFound {
+				return err
+			}
+		}
+		expired = expired[:0]
+		return nil
+	}
+
+	for e := range res.Next() {
+		if e.Error != nil {
+			return e.Error
+		}
+		t, err := readTimeValue(e.Value)
+		if err != nil || time.Now().Sub(t) > ProvideValidity {
+			expired = append(expired, ds.NewKey(e.Key))
+		}
+		if len(expired) < gcBatchSize {
+			continue
+		}
+		if err := deleteBatch(); err != nil {
+			return err
+		}
+		select {
+		case <-closing:
+			return nil
+		default:
+		}
+	}
+	return deleteBatch()
+}
+
 func (pm *ProviderManager) run() {
-	tick := time.NewTicker(time.Hour)
+	tick := time.NewTicker(pm.cleanupInterval)
+	defer tick.Stop()
+
+	// the datastore is cleaned up apart from the loop, one run at a time
+	var gcDone chan struct{}
 	for {
 		select {
 		case np := <-pm.newprovs:
 			if np.val == pm.lpeer {
 				pm.local[np.k] = struct{}{}
 			}
-			provs, ok := pm.providers[np.k]
-			if !ok {
-				provs = newProviderSet()
-				pm.providers[np.k] = provs
+			err := pm.addProv(np.k, np.val)
+			if err != nil {
+				log.Error("error adding new providers: ", err)
 			}
-			provs.Add(np.val)
 
 		case gp := <-pm.getprovs:
-			var parr []peer.ID
-			provs, ok := pm.providers[gp.k]
-			if ok {
-				parr = provs.providers
+			provs, err := pm.providersForKey(gp.k)
+			if err != nil && err != ds.ErrNotFound {
+				log.Error("error reading providers: ", err)
 			}
 
-			gp.resp <- parr
+			gp.resp <- provs
 
 		case lc := <-pm.getlocal:
 			var keys []key.Key
@@ -84,17 +283,32 @@ func (pm *ProviderManager) run() {
 			}
 			lc <- keys
 
+		case <-gcDone:
+			gcDone = nil
+
 		case <-tick.C:
-			for _, provs := range pm.providers {
-				var filtered []peer.ID
-				for p, t := range provs.set {
-					if time.Now().Sub(t) > time.Hour*24 {
-						delete(provs.set, p)
-					} else {
-						filtered = append(filtered, p)
+			if gcDone == nil {
+				done := make(chan struct{})
+				gcDone = done
+				pm.proc.Go(func(p goprocess.Process) {
+					defer close(done)
+					if err := pm.deleteExpired(p.Closing()); err != nil {
+						log.Error("error garbage collecting provider records: ", err)
 					}
+				})
+			}
+
+			// expired records may still be cached
+			for _, k := range pm.providers.Keys() {
+				iprovs, ok := pm.providers.Get(k)
+				if !ok {
+					continue
+				}
+				provs := iprovs.(*providerSet)
+				provs.expire()
+				if len(provs.providers) == 0 {
+					pm.providers.Remove(k)
 				}
-				provs.providers = filtered
 			}
 
 		case <-pm.proc.Closing():
@@ -145,10 +359,27 @@ func newProviderSet() *providerSet {
 }
 
 func (ps *providerSet) Add(p peer.ID) {
+	ps.setVal(p, time.Now())
+}
+
+func (ps *providerSet) setVal(p peer.ID, t time.Time) {
 	_, found := ps.set[p]
 	if !found {
 		ps.providers = append(ps.providers, p)
 	}
 
-	ps.set[p] = time.Now()
+	ps.set[p] = t
+}
+
+// expire drops every provider last seen more than ProvideValidity ago.
+func (ps *providerSet) expire() {
+	var filtered []peer.ID
+	for _, p := range ps.providers {
+		if time.Now().Sub(ps.set[p]) > ProvideValidity {
+			delete(ps.set, p)
+		} else {
+			filtered = append(filtered, p)
+		}
+	}
+	ps.providers = filtered
 }
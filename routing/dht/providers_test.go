@@ -2,17 +2,22 @@ package dht
 
 import (
 	"testing"
+	"time"
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	syncmount "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/syncmount"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
 func TestProviderManager(t *testing.T) {
 	ctx := context.Background()
 	mid := peer.ID("testing")
-	p := NewProviderManager(ctx, mid)
+	p := NewProviderManager(ctx, mid, ds.NewMapDatastore())
 	a := key.Key("test")
 	p.AddProvider(ctx, a, peer.ID("testingprovider"))
 	resp := p.GetProviders(ctx, a)
@@ -21,3 +26,139 @@ func TestProviderManager(t *testing.T) {
 	}
 	p.proc.Close()
 }
+
+func TestGetProvidersReturnsCopy(t *testing.T) {
+	ctx := context.Background()
+	p := NewProviderManager(ctx, peer.ID("testing"), ds.NewMapDatastore())
+	defer p.proc.Close()
+
+	a := key.Key("test")
+	p.AddProvider(ctx, a, peer.ID("first"))
+	resp := p.GetProviders(ctx, a)
+	resp[0] = peer.ID("changed")
+	p.AddProvider(ctx, a, peer.ID("second"))
+
+	resp = p.GetProviders(ctx, a)
+	if len(resp) != 2 || resp[0] != peer.ID("first") {
+		t.Fatalf("cached providers were changed through a returned slice: %v", resp)
+	}
+}
+
+func TestProvidersDatastore(t *testing.T) {
+	old := lruCacheSize
+	lruCacheSize = 10
+	defer func() { lruCacheSize = old }()
+
+	ctx := context.Background()
+	mid := peer.ID("testing")
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	p := NewProviderManager(ctx, mid, dstore)
+	defer p.proc.Close()
+
+	friend := peer.ID("friend")
+	var keys []key.Key
+	for i := 0; i < 100; i++ {
+		k := key.Key(string(rune(i)) + "key")
+		keys = append(keys, k)
+		p.AddProvider(ctx, k, friend)
+	}
+
+	// most of these have been evicted from the cache by now
+	for _, k := range keys {
+		resp := p.GetProviders(ctx, k)
+		if len(resp) != 1 || resp[0] != friend {
+			t.Fatalf("expected %s as the provider of %s, got %v", friend, k, resp)
+		}
+	}
+
+	// a fresh manager on the same datastore still knows the providers
+	p2 := NewProviderManager(ctx, mid, dstore)
+	defer p2.proc.Close()
+	for _, k := range keys {
+		if resp := p2.GetProviders(ctx, k); len(resp) != 1 {
+			t.Fatalf("provider of %s was not persisted", k)
+		}
+	}
+}
+
+func TestProvidesExpire(t *testing.T) {
+	oldValidity := ProvideValidity
+	oldInterval := defaultCleanupInterval
+	oldBatch := gcBatchSize
+	ProvideValidity = time.Millisecond * 100
+	defaultCleanupInterval = time.Millisecond * 50
+	gcBatchSize = 3
+	defer func() {
+		ProvideValidity = oldValidity
+		defaultCleanupInterval = oldInterval
+		gcBatchSize = oldBatch
+	}()
+
+	ctx := context.Background()
+	mid := peer.ID("testing")
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	p := NewProviderManager(ctx, mid, dstore)
+	defer p.proc.Close()
+
+	peers := []peer.ID{"a", "b"}
+	var keys []key.Key
+	for i := 0; i < 10; i++ {
+		k := key.Key(string(rune(i)))
+		keys = append(keys, k)
+		p.AddProvider(ctx, k, peers[0])
+		p.AddProvider(ctx, k, peers[1])
+	}
+
+	for _, k := range keys {
+		if out := p.GetProviders(ctx, k); len(out) != 2 {
+			t.Fatal("expected providers to still be there")
+		}
+	}
+
+	time.Sleep(time.Millisecond * 300)
+
+	for _, k := range keys {
+		if out := p.GetProviders(ctx, k); len(out) > 0 {
+			t.Fatal("expected providers to be cleaned up, got: ", out)
+		}
+	}
+
+	res, err := dstore.Query(dsq.Query{Prefix: providersKeyPrefix, KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) > 0 {
+		t.Fatalf("expected expired records to be removed from the datastore, %d remain", len(entries))
+	}
+}
+
+func TestQueryPrefix(t *testing.T) {
+	mapds := ds.NewMapDatastore()
+	mounted := syncmount.New([]syncmount.Mount{{Prefix: ds.NewKey("/"), Datastore: ds.NewMapDatastore()}})
+
+	for _, dstore := range []ds.Datastore{mapds, mounted} {
+		for _, k := range []string{"/providers/a/x", "/providers/ab/y", "/other"} {
+			if err := dstore.Put(ds.NewKey(k), []byte{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, prefix := range []string{"/providers/a", "/providers/a/"} {
+			res, err := queryPrefix(dstore, prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, err := res.Rest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Key != "/providers/a/x" {
+				t.Fatalf("%T: expected only /providers/a/x below %s, got %v", dstore, prefix, entries)
+			}
+		}
+	}
+}
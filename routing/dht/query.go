@@ -18,13 +18,12 @@ import (
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
-var maxQueryConcurrency = AlphaValue
-
 type dhtQuery struct {
 	dht         *IpfsDHT
 	key         key.Key   // the key we're querying for
 	qfunc       queryFunc // the function to execute per peer
 	concurrency int       // the concurrency parameter
+	paths       int       // the number of disjoint paths to run
 }
 
 type dhtQueryResult struct {
@@ -41,7 +40,8 @@ func (dht *IpfsDHT) newQuery(k key.Key, f queryFunc) *dhtQuery {
 		key:         k,
 		dht:         dht,
 		qfunc:       f,
-		concurrency: maxQueryConcurrency,
+		concurrency: dht.queryAlpha(),
+		paths:       dht.queryPaths(),
 	}
 }
 
@@ -53,6 +53,8 @@ func (dht *IpfsDHT) newQuery(k key.Key, f queryFunc) *dhtQuery {
 type queryFunc func(context.Context, peer.ID) (*dhtQueryResult, error)
 
 // Run runs the query at hand. pass in a list of peers to use first.
+// If the query has more than one path, the peers are split between
+// disjoint lookups (as in S/Kademlia) whose results are cross-checked.
 func (q *dhtQuery) Run(ctx context.Context, peers []peer.ID) (*dhtQueryResult, error) {
 	select {
 	case <-ctx.Done():
@@ -63,15 +65,102 @@ func (q *dhtQuery) Run(ctx context.Context, peers []peer.ID) (*dhtQueryResult, e
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	runner := newQueryRunner(q)
+	if q.paths > 1 && len(peers) > 1 {
+		return q.runDisjoint(ctx, peers)
+	}
+
+	runner := newQueryRunner(q, pset.New())
 	return runner.Run(ctx, peers)
 }
 
+// runDisjoint runs one lookup per path. The paths share the set of peers
+// seen, so that no peer is queried by more than one path, and a malicious
+// peer can only affect the path that reached it. Once a majority of the
+// paths agree on a result it is returned; otherwise the result found by
+// the most paths wins.
+func (q *dhtQuery) runDisjoint(ctx context.Context, peers []peer.ID) (*dhtQueryResult, error) {
+	npaths := q.paths
+	if len(peers) < npaths {
+		npaths = len(peers)
+	}
+
+	// peers are sorted by distance, so deal them out to keep the paths
+	// equally close to the key.
+	seen := pset.New()
+	seeds := make([][]peer.ID, npaths)
+	for i, p := range peers {
+		seen.Add(p)
+		seeds[i%npaths] = append(seeds[i%npaths], p)
+	}
+
+	type pathResult struct {
+		res *dhtQueryResult
+		err error
+	}
+	results := make(chan pathResult, npaths)
+	for _, s := range seeds {
+		go func(s []peer.ID) {
+			res, err := newQueryRunner(q, seen).Run(ctx, s)
+			results <- pathResult{res, err}
+		}(s)
+	}
+
+	var found []*dhtQueryResult
+	var errs []error
+	for i := 0; i < npaths; i++ {
+		var pr pathResult
+		select {
+		case pr = <-results:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if pr.err != nil {
+			errs = append(errs, pr.err)
+		} else if pr.res != nil {
+			found = append(found, pr.res)
+		}
+
+		if best, agree, _ := crossCheck(found); agree > npaths/2 {
+			return best, nil
+		}
+	}
+
+	best, agree, distinct := crossCheck(found)
+	if best == nil {
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		return nil, routing.ErrNotFound
+	}
+	if distinct > 1 {
+		log.Warningf("disjoint paths for %s disagree: %d distinct results, using the one found by %d of %d paths",
+			q.key, distinct, agree, npaths)
+	}
+	return best, nil
+}
+
+// crossCheck groups the results of disjoint paths by what they found. It
+// returns a result of the largest group, the size of that group and the
+// number of groups. Ties go to the result that arrived first.
+func crossCheck(results []*dhtQueryResult) (best *dhtQueryResult, agree int, distinct int) {
+	counts := make(map[string]int)
+	for _, res := range results {
+		id := string(res.value) + "/" + string(res.peer.ID)
+		counts[id]++
+		if counts[id] > agree {
+			best, agree = res, counts[id]
+		}
+	}
+	return best, agree, len(counts)
+}
+
 type dhtQueryRunner struct {
 	query          *dhtQuery        // query to run
 	peersSeen      *pset.PeerSet    // all peers queried. prevent querying same peer 2x
 	peersToQuery   *queue.ChanQueue // peers remaining to be queried
 	peersRemaining todoctr.Counter  // peersToQuery + currently processing
+	peersQueued    int              // peers added to this runner
 
 	result *dhtQueryResult // query result
 	errs   u.MultiErr      // result errors. maybe should be a map[peer.ID]error
@@ -83,14 +172,16 @@ type dhtQueryRunner struct {
 	sync.RWMutex
 }
 
-func newQueryRunner(q *dhtQuery) *dhtQueryRunner {
+// newQueryRunner creates a runner for a single lookup path. seen may be
+// shared with the runners of other paths to keep them disjoint.
+func newQueryRunner(q *dhtQuery, seen *pset.PeerSet) *dhtQueryRunner {
 	proc := process.WithParent(process.Background())
 	ctx := ctxproc.OnClosingContext(proc)
 	return &dhtQueryRunner{
 		query:          q,
 		peersToQuery:   queue.NewChanQueue(ctx, queue.NewXORDistancePQ(q.key)),
 		peersRemaining: todoctr.NewSyncCounter(),
-		peersSeen:      pset.New(),
+		peersSeen:      seen,
 		rateLimit:      make(chan struct{}, q.concurrency),
 		proc:           proc,
 	}
@@ -109,9 +200,14 @@ func (r *dhtQueryRunner) Run(ctx context.Context, peers []peer.ID) (*dhtQueryRes
 		r.rateLimit <- struct{}{}
 	}
 
-	// add all the peers we got first.
+	// add all the peers we got first. they may already have been marked
+	// as seen when the query was split into disjoint paths.
 	for _, p := range peers {
-		r.addPeerToQuery(p)
+		if p == r.query.dht.self {
+			continue
+		}
+		r.peersSeen.Add(p)
+		r.queuePeer(p)
 	}
 
 	// go do this thing.
@@ -138,7 +234,7 @@ func (r *dhtQueryRunner) Run(ctx context.Context, peers []peer.ID) (*dhtQueryRes
 		err = routing.ErrNotFound
 
 		// if every query to every peer failed, something must be very wrong.
-		if len(r.errs) > 0 && len(r.errs) == r.peersSeen.Size() {
+		if len(r.errs) > 0 && len(r.errs) == r.peersQueued {
 			log.Debugf("query errs: %s", r.errs)
 			err = r.errs[0]
 		}
@@ -167,6 +263,14 @@ func (r *dhtQueryRunner) addPeerToQuery(next peer.ID) {
 		return
 	}
 
+	r.queuePeer(next)
+}
+
+func (r *dhtQueryRunner) queuePeer(next peer.ID) {
+	r.Lock()
+	r.peersQueued++
+	r.Unlock()
+
 	r.peersRemaining.Increment(1)
 	select {
 	case r.peersToQuery.EnqChan <- next:
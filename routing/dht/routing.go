@@ -1,7 +1,9 @@
 package dht
 
 import (
+	"bytes"
 	"sync"
+	"time"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	key "github.com/ipfs/go-ipfs/blocks/key"
@@ -21,6 +23,25 @@ import (
 // results will wait for the channel to drain.
 var asyncQueryBuffer = 10
 
+// valuesToCollect is the number of records from other peers GetValue
+// gathers before picking the best of them, our own included.
+var valuesToCollect = 3
+
+// valueCollectTimeout bounds how long GetValue keeps collecting records once
+// the first one was found.
+var valueCollectTimeout = time.Second * 2
+
+// fixOutdatedTimeout bounds sending the best record to a peer that returned
+// an outdated one.
+var fixOutdatedTimeout = time.Second * 30
+
+// receivedRecord is a record found during a value lookup, along with the
+// peer that returned it.
+type receivedRecord struct {
+	rec  *pb.Record
+	from peer.ID
+}
+
 // This file implements the Routing interface for the IpfsDHT struct.
 
 // Basic Put/Get
@@ -55,6 +76,10 @@ func (dht *IpfsDHT) PutValue(ctx context.Context, key key.Key, value []byte) err
 		return err
 	}
 
+	var lk sync.Mutex
+	var tried, stored int
+	var lastErr error
+
 	wg := sync.WaitGroup{}
 	for p := range pchan {
 		wg.Add(1)
@@ -66,52 +91,111 @@ func (dht *IpfsDHT) PutValue(ctx context.Context, key key.Key, value []byte) err
 			})
 
 			err := dht.putValueToPeer(ctx, p, key, rec)
+			lk.Lock()
+			defer lk.Unlock()
+			tried++
 			if err != nil {
 				log.Debugf("failed putting value to peer: %s", err)
+				lastErr = err
+				return
 			}
+			stored++
 		}(p)
 	}
 	wg.Wait()
+
+	if tried > 0 && stored == 0 {
+		log.Warningf("PutValue %s: failed to put value to any of %d peers: %s", key, tried, lastErr)
+	}
 	return nil
 }
 
 // GetValue searches for the value corresponding to given Key.
-// If the search does not succeed, a multiaddr string of a closer peer is
-// returned along with util.ErrSearchIncomplete
+// Several records are collected, including our own, and the best one is
+// chosen with the Selector. Peers found holding an outdated record are sent
+// the best one.
 func (dht *IpfsDHT) GetValue(ctx context.Context, key key.Key) ([]byte, error) {
-	// If we have it local, dont bother doing an RPC!
-	val, err := dht.getLocal(key)
+	recs, err := dht.getValues(ctx, key, valuesToCollect)
+	if err != nil {
+		return nil, err
+	}
+
+	best, err := dht.selectRecord(key, recs)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("GetValue %v %v", key, best.rec.GetValue())
+
+	dht.fixOutdated(key, best, recs)
+	return best.rec.GetValue(), nil
+}
+
+// getValues collects the local record for key, and up to nvals records from
+// the network. Once the first valid record is found, the lookup ends within
+// valueCollectTimeout.
+func (dht *IpfsDHT) getValues(ctx context.Context, key key.Key, nvals int) ([]receivedRecord, error) {
+	var recs []receivedRecord
+	var found int
+	var lk sync.Mutex
+
+	rec, err := dht.getLocalRecord(key)
 	if err == nil {
 		log.Debug("have it locally")
-		return val, nil
+		recs = append(recs, receivedRecord{rec: rec, from: dht.self})
 	} else {
-		log.Debug("failed to get value locally: %s", err)
+		log.Debugf("failed to get value locally: %s", err)
 	}
 
 	// get closest peers in the routing table
-	rtp := dht.routingTable.NearestPeers(kb.ConvertKey(key), AlphaValue)
-	log.Debugf("peers in rt: %s", len(rtp), rtp)
+	rtp := dht.routingTable.NearestPeers(kb.ConvertKey(key), dht.querySeeds())
+	log.Debugf("peers in rt: %d %s", len(rtp), rtp)
 	if len(rtp) == 0 {
+		if len(recs) > 0 {
+			return recs, nil
+		}
 		log.Warning("No peers from routing table!")
 		return nil, kb.ErrLookupFailure
 	}
 
-	// setup the Query
+	// disjoint paths each end at the first value they find, and the values
+	// are cross-checked.
+	disjoint := dht.queryPaths() > 1 && len(rtp) > 1
+
 	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var timer *time.Timer
+	defer func() {
+		lk.Lock()
+		defer lk.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	// setup the Query
 	query := dht.newQuery(key, func(ctx context.Context, p peer.ID) (*dhtQueryResult, error) {
 		notif.PublishQueryEvent(parent, &notif.QueryEvent{
 			Type: notif.SendingQuery,
 			ID:   p,
 		})
 
-		val, peers, err := dht.getValueOrPeers(ctx, p, key)
+		rec, peers, err := dht.getValueOrPeers(ctx, p, key)
 		if err != nil {
 			return nil, err
 		}
 
-		res := &dhtQueryResult{value: val, closerPeers: peers}
-		if val != nil {
-			res.success = true
+		res := &dhtQueryResult{closerPeers: peers}
+		if rec != nil {
+			res.value = rec.GetValue()
+			lk.Lock()
+			recs = append(recs, receivedRecord{rec: rec, from: p})
+			found++
+			res.success = disjoint || found >= nvals
+			if timer == nil {
+				timer = time.AfterFunc(valueCollectTimeout, cancel)
+			}
+			lk.Unlock()
 		}
 
 		notif.PublishQueryEvent(parent, &notif.QueryEvent{
@@ -124,17 +208,76 @@ func (dht *IpfsDHT) GetValue(ctx context.Context, key key.Key) ([]byte, error) {
 	})
 
 	// run it!
-	result, err := query.Run(ctx, rtp)
-	if err != nil {
+	best, err := query.Run(ctx, rtp)
+
+	lk.Lock()
+	defer lk.Unlock()
+	if len(recs) == 0 {
+		if err == nil {
+			err = routing.ErrNotFound
+		}
 		return nil, err
 	}
 
-	log.Debugf("GetValue %v %v", key, result.value)
-	if result.value == nil {
-		return nil, routing.ErrNotFound
+	// only trust the records of the value most paths agree on, besides our
+	// own
+	if disjoint && best != nil && best.value != nil {
+		var agreed []receivedRecord
+		for _, r := range recs {
+			if r.from == dht.self || bytes.Equal(r.rec.GetValue(), best.value) {
+				agreed = append(agreed, r)
+			}
+		}
+		return agreed, nil
+	}
+
+	// workers of a cancelled query may still be appending
+	return append([]receivedRecord(nil), recs...), nil
+}
+
+// selectRecord picks the best of the records found for key. Keys without a
+// selector fall back to the value returned by the most peers. Records the
+// selector finds conflicting are not resolved.
+func (dht *IpfsDHT) selectRecord(key key.Key, recs []receivedRecord) (receivedRecord, error) {
+	vals := make([][]byte, len(recs))
+	for i, r := range recs {
+		vals[i] = r.rec.GetValue()
+	}
+
+	i, err := dht.Selector.BestRecord(key, vals)
+	if err == record.ErrConflictingRecords {
+		return receivedRecord{}, err
 	}
+	if err != nil || i < 0 || i >= len(vals) {
+		log.Debugf("cannot select record for %s (%v), using the most common value", key, err)
+		i = mostCommonValue(vals)
+	}
+	return recs[i], nil
+}
+
+// fixOutdated sends best to the peers that returned a different value, and
+// replaces our own copy if it is outdated.
+func (dht *IpfsDHT) fixOutdated(key key.Key, best receivedRecord, recs []receivedRecord) {
+	for _, r := range recs {
+		if bytes.Equal(r.rec.GetValue(), best.rec.GetValue()) {
+			continue
+		}
+
+		if r.from == dht.self {
+			if err := dht.putLocal(key, best.rec); err != nil {
+				log.Debugf("failed replacing outdated local record: %s", err)
+			}
+			continue
+		}
 
-	return result.value, nil
+		go func(p peer.ID) {
+			ctx, cancel := context.WithTimeout(dht.ctx, fixOutdatedTimeout)
+			defer cancel()
+			if err := dht.putValueToPeer(ctx, p, key, best.rec); err != nil {
+				log.Debugf("failed correcting outdated record at %s: %s", p, err)
+			}
+		}(r.from)
+	}
 }
 
 // Value provider layer of indirection.
@@ -212,6 +355,11 @@ func (dht *IpfsDHT) findProvidersAsyncRoutine(ctx context.Context, key key.Key,
 	// setup the Query
 	parent := ctx
 	query := dht.newQuery(key, func(ctx context.Context, p peer.ID) (*dhtQueryResult, error) {
+		// another path may already have found enough providers
+		if ps.Size() >= count {
+			return &dhtQueryResult{success: true}, nil
+		}
+
 		notif.PublishQueryEvent(parent, &notif.QueryEvent{
 			Type: notif.SendingQuery,
 			ID:   p,
@@ -256,7 +404,7 @@ func (dht *IpfsDHT) findProvidersAsyncRoutine(ctx context.Context, key key.Key,
 		return &dhtQueryResult{closerPeers: clpeers}, nil
 	})
 
-	peers := dht.routingTable.NearestPeers(kb.ConvertKey(key), AlphaValue)
+	peers := dht.routingTable.NearestPeers(kb.ConvertKey(key), dht.querySeeds())
 	_, err := query.Run(ctx, peers)
 	if err != nil {
 		log.Debugf("Query error: %s", err)
@@ -276,7 +424,7 @@ func (dht *IpfsDHT) FindPeer(ctx context.Context, id peer.ID) (peer.PeerInfo, er
 		return pi, nil
 	}
 
-	peers := dht.routingTable.NearestPeers(kb.ConvertPeerID(id), AlphaValue)
+	peers := dht.routingTable.NearestPeers(kb.ConvertPeerID(id), dht.querySeeds())
 	if len(peers) == 0 {
 		return peer.PeerInfo{}, kb.ErrLookupFailure
 	}
@@ -343,7 +491,7 @@ func (dht *IpfsDHT) FindPeersConnectedToPeer(ctx context.Context, id peer.ID) (<
 	peerchan := make(chan peer.PeerInfo, asyncQueryBuffer)
 	peersSeen := peer.Set{}
 
-	peers := dht.routingTable.NearestPeers(kb.ConvertPeerID(id), AlphaValue)
+	peers := dht.routingTable.NearestPeers(kb.ConvertPeerID(id), dht.querySeeds())
 	if len(peers) == 0 {
 		return nil, kb.ErrLookupFailure
 	}
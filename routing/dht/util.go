@@ -13,6 +13,23 @@ var KValue = 10
 // Alpha is the concurrency factor for asynchronous requests.
 var AlphaValue = 3
 
+// DisjointPaths is the number of disjoint paths a query is split into.
+var DisjointPaths = 1
+
+// mostCommonValue returns the index of the first of the values that occur
+// most often in vals.
+func mostCommonValue(vals [][]byte) int {
+	counts := make(map[string]int)
+	best := 0
+	for i, v := range vals {
+		counts[string(v)]++
+		if counts[string(v)] > counts[string(vals[best])] {
+			best = i
+		}
+	}
+	return best
+}
+
 // A counter for incrementing a variable across multiple threads
 type counter struct {
 	n   int
@@ -0,0 +1,54 @@
+package record
+
+import (
+	"errors"
+	"strings"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+// SelectorFunc is a function that is called to pick the best of several
+// valid values found for the same key. It returns the index of that value.
+type SelectorFunc func(key.Key, [][]byte) (int, error)
+
+// ErrNoRecords is returned when a selector is asked to choose among no
+// values.
+var ErrNoRecords = errors.New("no records given")
+
+// ErrConflictingRecords is returned by selectors for valid records that
+// contradict each other, so that none of them can be picked. A node keeps
+// the record it stored first rather than replacing it with a conflicting
+// one.
+var ErrConflictingRecords = errors.New("conflicting records")
+
+// Selector picks the best value when a lookup finds several records for
+// the same key. Like Validator, it is keyed by the key prefix.
+type Selector map[string]SelectorFunc
+
+// BestRecord returns the index of the best value in vals using the
+// selector function registered for the prefix of k.
+func (s Selector) BestRecord(k key.Key, vals [][]byte) (int, error) {
+	if len(vals) == 0 {
+		return 0, ErrNoRecords
+	}
+
+	parts := strings.Split(string(k), "/")
+	if len(parts) < 3 {
+		log.Infof("Record key does not have selector: %s", k)
+		return 0, ErrInvalidRecordType
+	}
+
+	sel, ok := s[parts[1]]
+	if !ok {
+		log.Infof("Unrecognized key prefix: %s", parts[1])
+		return 0, ErrInvalidRecordType
+	}
+
+	return sel(k, vals)
+}
+
+// PublicKeySelector implements SelectorFunc. Valid public key records for a
+// key are all identical, so it picks the first one.
+func PublicKeySelector(k key.Key, vals [][]byte) (int, error) {
+	return 0, nil
+}
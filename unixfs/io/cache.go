@@ -0,0 +1,316 @@
+package io
+
+import (
+	"container/list"
+	"sync"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	ftpb "github.com/ipfs/go-ipfs/unixfs/pb"
+)
+
+// readAhead is the number of child nodes a NodeCache fetches at once, ahead
+// of the one asked for.
+const readAhead = 8
+
+// linkSize estimates the memory a link takes in a decoded node.
+const linkSize = 64
+
+// fileLayout is the decoded unixfs data of a file node, with the offset each
+// of its children starts at, counted from the end of the node's own data.
+type fileLayout struct {
+	pb      *ftpb.Data
+	offsets []int64
+}
+
+func newFileLayout(pb *ftpb.Data) *fileLayout {
+	offsets := make([]int64, len(pb.Blocksizes))
+	var off int64
+	for i, s := range pb.Blocksizes {
+		offsets[i] = off
+		off += int64(s)
+	}
+	return &fileLayout{pb: pb, offsets: offsets}
+}
+
+// child returns the index of the child the file offset off, counted from the
+// end of the node's own data, falls in. It returns the number of children
+// if off is at or past the end.
+func (l *fileLayout) child(off int64) int {
+	lo, hi := 0, len(l.offsets)
+	for lo < hi {
+		m := (lo + hi) / 2
+		if l.offsets[m]+int64(l.pb.Blocksizes[m]) > off {
+			hi = m
+		} else {
+			lo = m + 1
+		}
+	}
+	return lo
+}
+
+func (l *fileLayout) size() int {
+	return len(l.pb.Data) + len(l.offsets)*16
+}
+
+// decodeLayout returns the layout of the file node n, from the cache if
+// serv is a NodeCache.
+func decodeLayout(n *mdag.Node, serv mdag.DAGService) (*fileLayout, error) {
+	if c, ok := serv.(*NodeCache); ok {
+		return c.layout(n)
+	}
+
+	pb := new(ftpb.Data)
+	if err := proto.Unmarshal(n.Data, pb); err != nil {
+		return nil, err
+	}
+	return newFileLayout(pb), nil
+}
+
+// NodeCache is a DAGService that keeps recently read nodes decoded in memory,
+// along with the layout of file nodes, up to a total size. DagReaders
+// sharing one seek without fetching and decoding the same nodes again, and
+// fetch children only a few at a time, ahead of where they read.
+//
+// The nodes it returns are shared, and must not be modified.
+type NodeCache struct {
+	mdag.DAGService
+
+	lk      sync.Mutex
+	maxSize int
+	size    int
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[key.Key]*list.Element
+}
+
+type cacheEntry struct {
+	key    key.Key
+	node   *mdag.Node
+	layout *fileLayout
+	size   int
+}
+
+// NewNodeCache returns a cache of the nodes in ds, taking up to about
+// maxSize bytes.
+func NewNodeCache(ds mdag.DAGService, maxSize int) *NodeCache {
+	return &NodeCache{
+		DAGService: ds,
+		maxSize:    maxSize,
+		lru:        list.New(),
+		entries:    make(map[key.Key]*list.Element),
+	}
+}
+
+// Size returns the approximate number of bytes the cached nodes take.
+func (c *NodeCache) Size() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.size
+}
+
+func (c *NodeCache) Get(ctx context.Context, k key.Key) (*mdag.Node, error) {
+	if nd, ok := c.cached(k); ok {
+		return nd, nil
+	}
+
+	nd, err := c.DAGService.Get(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	c.add(k, nd)
+	return nd, nil
+}
+
+func (c *NodeCache) Remove(nd *mdag.Node) error {
+	k, err := nd.Key()
+	if err != nil {
+		return err
+	}
+
+	c.lk.Lock()
+	if e, ok := c.entries[k]; ok {
+		c.evict(e)
+	}
+	c.lk.Unlock()
+
+	return c.DAGService.Remove(nd)
+}
+
+func (c *NodeCache) GetDAG(ctx context.Context, root *mdag.Node) []mdag.NodeGetter {
+	keys := make([]key.Key, len(root.Links))
+	for i, lnk := range root.Links {
+		keys[i] = key.Key(lnk.Hash)
+	}
+	return c.GetNodes(ctx, keys)
+}
+
+// GetNodes returns promises for the nodes of keys. Nodes not in the cache
+// are fetched when one is first asked for, along with a few after it.
+func (c *NodeCache) GetNodes(ctx context.Context, keys []key.Key) []mdag.NodeGetter {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ln := &lazyNodes{
+		ctx:      ctx,
+		cache:    c,
+		keys:     keys,
+		promises: make([]mdag.NodeGetter, len(keys)),
+	}
+	getters := make([]mdag.NodeGetter, len(keys))
+	for i := range keys {
+		getters[i] = &lazyNode{ln, i}
+	}
+	return getters
+}
+
+// layout returns the layout of the file node n, decoding it only if it is
+// not cached.
+func (c *NodeCache) layout(n *mdag.Node) (*fileLayout, error) {
+	k, err := n.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lk.Lock()
+	e, ok := c.entries[k]
+	if ok && e.Value.(*cacheEntry).layout != nil {
+		c.lru.MoveToFront(e)
+		l := e.Value.(*cacheEntry).layout
+		c.lk.Unlock()
+		return l, nil
+	}
+	c.lk.Unlock()
+
+	pb := new(ftpb.Data)
+	if err := proto.Unmarshal(n.Data, pb); err != nil {
+		return nil, err
+	}
+	l := newFileLayout(pb)
+
+	// leaves are read once per seek, their data is only kept in the node
+	if len(n.Links) > 0 {
+		c.lk.Lock()
+		if e, ok := c.entries[k]; ok {
+			ce := e.Value.(*cacheEntry)
+			if ce.layout == nil {
+				ce.layout = l
+				ce.size += l.size()
+				c.size += l.size()
+				c.shrink()
+			}
+		}
+		c.lk.Unlock()
+	}
+	return l, nil
+}
+
+func (c *NodeCache) cached(k key.Key) (*mdag.Node, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).node, true
+}
+
+func (c *NodeCache) add(k key.Key, nd *mdag.Node) {
+	size := len(nd.Data) + len(nd.Links)*linkSize
+	if size > c.maxSize {
+		return
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if e, ok := c.entries[k]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[k] = c.lru.PushFront(&cacheEntry{key: k, node: nd, size: size})
+	c.size += size
+	c.shrink()
+}
+
+// shrink evicts the least recently used nodes until the cache fits. It is
+// called with lk held.
+func (c *NodeCache) shrink() {
+	for c.size > c.maxSize {
+		c.evict(c.lru.Back())
+	}
+}
+
+func (c *NodeCache) evict(e *list.Element) {
+	ce := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, ce.key)
+	c.size -= ce.size
+}
+
+// lazyNodes fetches the nodes of keys through the cache as they are asked
+// for.
+type lazyNodes struct {
+	ctx   context.Context
+	cache *NodeCache
+	keys  []key.Key
+
+	lk       sync.Mutex
+	promises []mdag.NodeGetter // fetches in flight, by index in keys
+}
+
+type lazyNode struct {
+	nodes *lazyNodes
+	i     int
+}
+
+func (n *lazyNode) Get(ctx context.Context) (*mdag.Node, error) {
+	ln := n.nodes
+	k := ln.keys[n.i]
+	if nd, ok := ln.cache.cached(k); ok {
+		return nd, nil
+	}
+
+	ln.lk.Lock()
+	if ln.promises[n.i] == nil {
+		ln.fetch(n.i)
+	}
+	p := ln.promises[n.i]
+	ln.lk.Unlock()
+
+	nd, err := p.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ln.cache.add(k, nd)
+	return nd, nil
+}
+
+// fetch starts fetching the nodes from index i on that are neither cached
+// nor already being fetched, up to readAhead of them. It is called with lk
+// held.
+func (ln *lazyNodes) fetch(i int) {
+	var idx []int
+	var keys []key.Key
+	for j := i; j < len(ln.keys) && len(idx) < readAhead; j++ {
+		if ln.promises[j] != nil {
+			continue
+		}
+		if j > i {
+			if _, ok := ln.cache.cached(ln.keys[j]); ok {
+				continue
+			}
+		}
+		idx = append(idx, j)
+		keys = append(keys, ln.keys[j])
+	}
+
+	promises := ln.cache.DAGService.GetNodes(ln.ctx, keys)
+	for j, p := range promises {
+		ln.promises[idx[j]] = p
+	}
+}
@@ -0,0 +1,105 @@
+package io
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	importer "github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+)
+
+func TestNodeCacheReads(t *testing.T) {
+	data := make([]byte, 512*1024)
+	rand.Read(data)
+
+	ds := mdtest.Mock()
+	nd, err := importer.BuildDagFromReader(ds, chunk.NewSizeSplitter(bytes.NewReader(data), 512), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nd.Links) == 0 {
+		t.Fatal("expected a file of several blocks")
+	}
+
+	// smaller than the file, so seeking evicts
+	cache := NewNodeCache(ds, 64*1024)
+
+	buf := make([]byte, 4096)
+	for i := 0; i < 100; i++ {
+		// every reader shares the cache
+		dr, err := NewDagReader(context.Background(), nd, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		off := rand.Intn(len(data))
+		if _, err := dr.Seek(int64(off), os.SEEK_SET); err != nil {
+			t.Fatal(err)
+		}
+		n, err := dr.Read(buf)
+		if err != nil && off+len(buf) <= len(data) {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], data[off:off+n]) {
+			t.Fatalf("read wrong data at offset %d", off)
+		}
+		dr.Close()
+
+		if cache.Size() > 64*1024 {
+			t.Fatalf("cache grew to %d bytes", cache.Size())
+		}
+	}
+
+	dr, err := NewDagReader(context.Background(), nd, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("read the whole file wrong through the cache")
+	}
+}
+
+func TestNodeCacheGet(t *testing.T) {
+	ds := mdtest.Mock()
+	nd, err := importer.BuildDagFromReader(ds, chunk.NewSizeSplitter(bytes.NewReader([]byte("fnord")), 512), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := nd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewNodeCache(ds, 1024)
+	a, err := cache.Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cache.Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatal("second get was not served from the cache")
+	}
+
+	if err := cache.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Size() != 0 {
+		t.Fatal("removed node is still cached")
+	}
+	if _, err := cache.Get(context.Background(), k); err == nil {
+		t.Fatal("removed node is still in the dag")
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"os"
 
-	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	mdag "github.com/ipfs/go-ipfs/merkledag"
@@ -26,8 +25,10 @@ type DagReader struct {
 	// the node being read
 	node *mdag.Node
 
-	// cached protobuf structure from node.Data
+	// cached protobuf structure from node.Data, and the offsets of its
+	// children
 	pbdata *ftpb.Data
+	layout *fileLayout
 
 	// the current data buffer to be read from
 	// will either be a bytes.Reader or a child DagReader
@@ -59,19 +60,19 @@ type ReadSeekCloser interface {
 // NewDagReader creates a new reader object that reads the data represented by the given
 // node, using the passed in DAGService for data retreival
 func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*DagReader, error) {
-	pb := new(ftpb.Data)
-	if err := proto.Unmarshal(n.Data, pb); err != nil {
+	l, err := decodeLayout(n, serv)
+	if err != nil {
 		return nil, err
 	}
 
-	switch pb.GetType() {
+	switch pb := l.pb; pb.GetType() {
 	case ftpb.Data_Directory:
 		// Dont allow reading directories
 		return nil, ErrIsDir
 	case ftpb.Data_Raw:
 		fallthrough
 	case ftpb.Data_File:
-		return NewDataFileReader(ctx, n, pb, serv), nil
+		return newDataFileReader(ctx, n, l, serv), nil
 	case ftpb.Data_Metadata:
 		if len(n.Links) == 0 {
 			return nil, errors.New("incorrectly formatted metadata object")
@@ -89,16 +90,21 @@ func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*Dag
 }
 
 func NewDataFileReader(ctx context.Context, n *mdag.Node, pb *ftpb.Data, serv mdag.DAGService) *DagReader {
+	return newDataFileReader(ctx, n, newFileLayout(pb), serv)
+}
+
+func newDataFileReader(ctx context.Context, n *mdag.Node, l *fileLayout, serv mdag.DAGService) *DagReader {
 	fctx, cancel := context.WithCancel(ctx)
 	promises := serv.GetDAG(fctx, n)
 	return &DagReader{
 		node:     n,
 		serv:     serv,
-		buf:      NewRSNCFromBytes(pb.GetData()),
+		buf:      NewRSNCFromBytes(l.pb.GetData()),
 		promises: promises,
 		ctx:      fctx,
 		cancel:   cancel,
-		pbdata:   pb,
+		pbdata:   l.pb,
+		layout:   l,
 	}
 }
 
@@ -116,18 +122,17 @@ func (dr *DagReader) precalcNextBuf(ctx context.Context) error {
 	}
 	dr.linkPosition++
 
-	pb := new(ftpb.Data)
-	err = proto.Unmarshal(nxt.Data, pb)
+	l, err := decodeLayout(nxt, dr.serv)
 	if err != nil {
 		return fmt.Errorf("incorrectly formatted protobuf: %s", err)
 	}
 
-	switch pb.GetType() {
+	switch pb := l.pb; pb.GetType() {
 	case ftpb.Data_Directory:
 		// A directory should not exist within a file
 		return ft.ErrInvalidDirLocation
 	case ftpb.Data_File:
-		dr.buf = NewDataFileReader(dr.ctx, nxt, pb, dr.serv)
+		dr.buf = newDataFileReader(dr.ctx, nxt, l, dr.serv)
 		return nil
 	case ftpb.Data_Raw:
 		dr.buf = NewRSNCFromBytes(pb.GetData())
@@ -240,15 +245,16 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 			left -= int64(len(pb.Data))
 		}
 
-		// iterate through links and find where we need to be
-		for i := 0; i < len(pb.Blocksizes); i++ {
-			if pb.Blocksizes[i] > uint64(left) {
-				dr.linkPosition = i
-				break
-			} else {
-				left -= int64(pb.Blocksizes[i])
-			}
+		// find the link we need to be in
+		dr.linkPosition = dr.layout.child(left)
+		if dr.linkPosition == len(pb.Blocksizes) {
+			// at or past the end, reads return EOF
+			dr.buf.Close()
+			dr.buf = NewRSNCFromBytes(nil)
+			dr.offset = offset
+			return offset, nil
 		}
+		left -= dr.layout.offsets[dr.linkPosition]
 
 		// start sub-block request
 		err := dr.precalcNextBuf(dr.ctx)
@@ -274,7 +280,7 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 		noffset := dr.offset + offset
 		return dr.Seek(noffset, os.SEEK_SET)
 	case os.SEEK_END:
-		noffset := int64(dr.pbdata.GetFilesize()) - offset
+		noffset := int64(dr.pbdata.GetFilesize()) + offset
 		return dr.Seek(noffset, os.SEEK_SET)
 	default:
 		return 0, errors.New("invalid whence")
@@ -389,6 +389,11 @@ func TestLargeWriteChunks(t *testing.T) {
 		}
 	}
 
+	_, err = dagmod.Seek(0, os.SEEK_SET)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	out, err := ioutil.ReadAll(dagmod)
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// PassphraseEnv is the environment variable passphrases are read from
+// before prompting for them.
+const PassphraseEnv = "IPFS_PASSPHRASE"
+
+// IsTerminal returns whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ReadPassphrase prints prompt to stderr and reads a line from stdin. Where
+// stty is available, the input is not echoed.
+func ReadPassphrase(prompt string) (string, error) {
+	if !IsTerminal(os.Stdin) {
+		return "", fmt.Errorf("cannot prompt for a passphrase, stdin is not a terminal (set %s)", PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	if err := stty("-echo"); err == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ReadNewPassphrase prompts for a new passphrase twice, and returns it if
+// both entries match.
+func ReadNewPassphrase(prompt string) (string, error) {
+	p, err := ReadPassphrase(prompt)
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", errors.New("passphrase must not be empty")
+	}
+	again, err := ReadPassphrase("Enter the same passphrase again: ")
+	if err != nil {
+		return "", err
+	}
+	if p != again {
+		return "", errors.New("passphrases do not match")
+	}
+	return p, nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}